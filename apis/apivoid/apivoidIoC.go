@@ -9,17 +9,18 @@ import (
 	"io"
 	"net/http"
 	"regexp"
+	"sort"
 	"strings"
-	"sync"
-	"time"
 
 	// "github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
 )
 
 const (
-	APIvoidEndpoint     = "https://endpoint.apivoid.com/%s/v1/pay-as-you-go/?%s=%s&key=%s"
-	limiterMilliseconds = 333
+	APIvoidEndpoint   = "https://endpoint.apivoid.com/%s/v1/pay-as-you-go/?%s=%s&key=%s"
+	requestsPerSecond = 3
+	maxThreadCount    = 3
 )
 
 // GetAPIVoidData queries APIVoid's IP Reputation data and returns enriched results
@@ -27,37 +28,29 @@ func (m *TriageModule) GetAPIVoidData(ctx context.Context, triageRequest *triage
 
 	apivoidResults := make(map[string]*APIvoidReport)
 
-	apivoidLock := sync.Mutex{}
-
-	// insert all iocs into a channel for rate limiting
-	iocs := make(chan string, len(triageRequest.IOCs))
-	for _, ioc := range triageRequest.IOCs {
-		iocs <- ioc
-	}
-	close(iocs)
-
 	// APIVoid developer docs suggest sending not more than 2-3 requests/second
-	// implementing a limiter to send a request to APIVoid every 333ms which is ~3 req/sec
-	limiter := time.Tick(limiterMilliseconds * time.Millisecond)
-	for ioc := range iocs {
-		<-limiter
+	// the limiter is shared by every lookup of this lambda, so concurrent triages stay within it
+	options := toolbox.FanOutOptions{
+		MaxConcurrency: maxThreadCount,
+		RateLimiter:    toolbox.VendorRateLimiter(triageModuleName, requestsPerSecond, 1),
+	}
+	results := toolbox.FanOut(ctx, triageRequest.IOCs, options, func(ctx context.Context, ioc string) (interface{}, error) {
 		span, spanCtx := tb.TracerLogger.StartSpan(ctx, "APIVoidLookup", "apivoid", "", "apivoidIoCLookup")
+		defer span.End(spanCtx)
+
 		apivoidResult, err := GetAPIVoidReport(ctx, ioc, m.APIVoidClient, triageRequest.IOCsType, m.APIVoidKey)
 		if err != nil {
 			span.AddError(err)
-			apivoidLock.Lock()
-			apivoidResults[ioc] = nil
-			apivoidLock.Unlock()
-			span.End(spanCtx)
+			return nil, err
+		}
+		return apivoidResult, nil
+	})
+	for _, result := range results {
+		// Out of time, return what we have so far
+		if result.Skipped {
 			continue
 		}
-
-		apivoidLock.Lock()
-		apivoidResults[ioc] = apivoidResult
-		apivoidLock.Unlock()
-
-		span.End(spanCtx)
-
+		apivoidResults[result.IOC], _ = result.Value.(*APIvoidReport)
 	}
 	return apivoidResults, nil
 }
@@ -204,6 +197,9 @@ func apiVoidMetaDataExtract(apivoidResults map[string]*APIvoidReport, iocType tr
 	var triageMetaData []string
 
 	for ioc, data := range apivoidResults {
+		if data == nil {
+			continue
+		}
 		triageMetaData = append(triageMetaData, fmt.Sprintf("IOC: %s, RiskScore:%v\n",
 			ioc, data.Data.Report.RiskScore))
 		triageMetaData = append(triageMetaData, fmt.Sprintf("IOC: %s, FullReportS3URL:%v\n",
@@ -256,3 +252,23 @@ func apiVoidMetaDataExtract(apivoidResults map[string]*APIvoidReport, iocType tr
 	}
 	return triageMetaData
 }
+
+//apiVoidScores normalizes the risk scores (0-100) of the IOCs APIVoid reported on
+func apiVoidScores(apivoidResults map[string]*APIvoidReport) []triage.Score {
+	iocs := make([]string, 0, len(apivoidResults))
+	for ioc, data := range apivoidResults {
+		if data != nil {
+			iocs = append(iocs, ioc)
+		}
+	}
+	sort.Strings(iocs)
+
+	var scores []triage.Score
+	for _, ioc := range iocs {
+		score, ok := triage.NewScore(ioc, float64(apivoidResults[ioc].Data.Report.RiskScore.Result), 100, "RiskScore", 1)
+		if ok {
+			scores = append(scores, score)
+		}
+	}
+	return scores
+}
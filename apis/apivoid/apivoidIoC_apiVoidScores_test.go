@@ -0,0 +1,32 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestApiVoidScores(t *testing.T) {
+
+	Convey("apiVoidScores", t, func() {
+
+		Convey("should normalize the risk scores of the IOCs", func() {
+			risky, safe := &APIvoidReport{}, &APIvoidReport{}
+			So(json.Unmarshal([]byte(`{"data":{"report":{"risk_score":{"result":100}}}}`), risky), ShouldBeNil)
+			So(json.Unmarshal([]byte(`{"data":{"report":{"risk_score":{"result":0}}}}`), safe), ShouldBeNil)
+			reports := map[string]*APIvoidReport{
+				"gumblar.cn": risky,
+				"amazon.com": safe,
+				"missing.cn": nil,
+			}
+
+			So(apiVoidScores(reports), ShouldResemble, []triage.Score{
+				{IOC: "amazon.com", Score: 0, Source: "RiskScore", Confidence: 1},
+				{IOC: "gumblar.cn", Score: 100, Source: "RiskScore", Confidence: 1},
+			})
+		})
+	})
+}
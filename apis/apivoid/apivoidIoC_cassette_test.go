@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/cassette"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGetAPIVoidDataCassette(t *testing.T) {
+
+	Convey("GetAPIVoidData with recorded APIVoid responses", t, func() {
+		tb = toolbox.GetToolbox()
+		module := &TriageModule{APIVoidKey: "test-key", APIVoidClient: cassette.Wrap(t, "getAPIVoidData", nil)}
+
+		apivoidResults, err := module.GetAPIVoidData(context.Background(), &triage.Request{
+			IOCs:     []string{"123.45.67.1", "10.0.0.1"},
+			IOCsType: triage.IPType,
+		})
+		So(err, ShouldBeNil)
+
+		Convey("should return the reports of the IPs found, with their engines as a list", func() {
+			So(apivoidResults["123.45.67.1"], ShouldNotBeNil)
+			report := apivoidResults["123.45.67.1"].Data.Report
+			So(report.Blacklist.Engines, ShouldHaveLength, 2)
+			So(report.Blacklist.Engines[1].Detected, ShouldBeTrue)
+			So(report.RiskScore.Result, ShouldEqual, 50)
+			So(apivoidResults, ShouldContainKey, "10.0.0.1")
+			So(apivoidResults["10.0.0.1"], ShouldBeNil)
+		})
+
+		Convey("should score and summarize the IPs found", func() {
+			scores := apiVoidScores(apivoidResults)
+			So(scores, ShouldHaveLength, 1)
+			So(scores[0].IOC, ShouldEqual, "123.45.67.1")
+			So(apiVoidMetaDataExtract(apivoidResults, triage.IPType), ShouldContain, "IOC: 123.45.67.1,Detections:1, Engines Count: 2, Detection Rate: 50%\n")
+		})
+	})
+}
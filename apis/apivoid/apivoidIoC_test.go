@@ -4,6 +4,7 @@ import (
 	"context"
 	"testing"
 
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/cassette"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
 )
@@ -13,6 +14,7 @@ func TestGetAPIVoidData(t *testing.T) {
 	ctx := context.Background()
 	tb = toolbox.GetToolbox()
 	defer tb.Close(ctx)
+	client := cassette.Wrap(t, "triage", nil)
 
 	var triageRequests []*triage.Request
 	triageRequests = append(triageRequests, &triage.Request{
@@ -29,7 +31,7 @@ func TestGetAPIVoidData(t *testing.T) {
 	})
 
 	for _, triageRequest := range triageRequests {
-		triageModule := TriageModule{}
+		triageModule := TriageModule{APIVoidKey: "test-key", APIVoidClient: client}
 		triageResult, err := triageModule.Triage(ctx, triageRequest)
 		if err != nil {
 			t.Fatal(err)
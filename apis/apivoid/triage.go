@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox/appsectracing"
@@ -16,6 +17,13 @@ const (
 	triageModuleName = "apivoid"
 )
 
+// vendorClientOptions of APIVoid, URL reputations scan the site as they are looked up
+// and APIVoid asks for no more than 2-3 requests a second, so rate limited lookups back off for a second
+var vendorClientOptions = toolbox.VendorClientOptions{
+	Timeout: time.Minute,
+	Backoff: time.Second,
+}
+
 // TriageModule triage module TODO: Change struct based on needs from secrets
 type TriageModule struct {
 	APIVoidKey    string
@@ -42,18 +50,18 @@ func (m *TriageModule) Triage(ctx context.Context, triageRequest *triage.Request
 	tb = toolbox.GetToolbox()
 	defer tb.Close(ctx)
 
-	secret, err := tb.GetFromCredentialsStore(ctx, secretID, nil)
-	if err != nil {
-		triageAPIVoidData.Data = fmt.Sprintf("error in retrieving secrets: %s", err)
-		return []*triage.Data{triageAPIVoidData}, err
+	if m.APIVoidKey == "" {
+		secret, err := tb.GetFromCredentialsStore(ctx, secretID, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error in retrieving secrets: %w", err)
+		}
+		m.APIVoidKey = *secret.SecretString
 	}
 
 	if m.APIVoidClient == nil {
-		m.APIVoidClient = http.DefaultClient
+		m.APIVoidClient = tb.GetVendorHTTPClient(triageModuleName, vendorClientOptions)
 	}
 
-	m.APIVoidKey = *secret.SecretString
-
 	var span *appsectracing.Span
 	span, ctx = tb.TracerLogger.StartSpan(ctx, "APIVoid", "APIVoid", "services", "get")
 	defer span.End(ctx)
@@ -61,16 +69,15 @@ func (m *TriageModule) Triage(ctx context.Context, triageRequest *triage.Request
 	//get the APIVoid data that service offers
 	apivoidDataResults, err := m.GetAPIVoidData(ctx, triageRequest)
 	if err != nil {
-		triageAPIVoidData.Data = fmt.Sprintf("error from apivoid: %s", err)
-	} else {
-		//Dump data as csv
-		triageAPIVoidData.DataType = triage.CSVType
-		triageAPIVoidData.Data = dumpCSV(apivoidDataResults, triageRequest.IOCsType)
-		//calculate and add the metadata
-		triageAPIVoidData.Metadata = apiVoidMetaDataExtract(apivoidDataResults, triageRequest.IOCsType)
-
-
+		return nil, fmt.Errorf("error from apivoid: %w", err)
 	}
 
+	//Dump data as csv
+	triageAPIVoidData.DataType = triage.CSVType
+	triageAPIVoidData.Data = dumpCSV(apivoidDataResults, triageRequest.IOCsType)
+	//calculate and add the metadata
+	triageAPIVoidData.Metadata = apiVoidMetaDataExtract(apivoidDataResults, triageRequest.IOCsType)
+	triageAPIVoidData.Scores = apiVoidScores(apivoidDataResults)
+
 	return []*triage.Data{triageAPIVoidData}, nil
 }
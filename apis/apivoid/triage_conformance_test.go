@@ -0,0 +1,20 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/cassette"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage/triagetest"
+)
+
+func TestConformance(t *testing.T) {
+	module := &TriageModule{APIVoidKey: "test-key", APIVoidClient: cassette.Wrap(t, "conformance", nil)}
+	triagetest.RunConformance(t, module, triagetest.Options{
+		IOCs: map[triage.IOCType][]string{
+			triage.DomainType: {"godaddy.com"},
+			triage.IPType:     {"8.8.8.8"},
+			triage.URLType:    {"https://www.godaddy.com/"},
+		},
+	})
+}
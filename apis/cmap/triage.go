@@ -52,10 +52,9 @@ func (m *TriageModule) Triage(ctx context.Context, triageRequest *triage.Request
 	// Check to make sure we have permission to do a cmap lookup
 	span, _ = tb.TracerLogger.StartSpan(ctx, "CMAPAuth", "cmap", "auth", "authorize")
 	if auth, err := tb.Authorize(ctx, triageRequest.JWT, "Run", triageModuleName); !auth {
-		triageData.Data = "Permission denied.  You cannot run this module."
 		span.LogKV("failedAuthReason", err)
 		span.End(ctx)
-		return []*triage.Data{triageData}, nil
+		return nil, triage.ErrUnauthorized
 	}
 	span.End(ctx)
 
@@ -70,6 +69,7 @@ func (m *TriageModule) Triage(ctx context.Context, triageRequest *triage.Request
 		span.AddError(err)
 		return nil, err
 	}
+	// cmap-go builds its own client for the certificate, so CMAP isn't called with GetVendorHTTPClient
 	c, err := cmap.New(ctx, cmap.ProdBaseURL, cert, sso.Production)
 	if err != nil {
 		err = fmt.Errorf("error creating cmap client: %s", err)
@@ -84,11 +84,9 @@ func (m *TriageModule) Triage(ctx context.Context, triageRequest *triage.Request
 	customerCounts := map[string]int{}
 	totalGoDaddyDomains := 0
 	for _, domain := range triageRequest.IOCs {
-		// Check context
-		select {
-		case <-ctx.Done():
+		// Out of time, build the results of the domains processed so far
+		if ctx.Err() != nil {
 			break
-		default:
 		}
 
 		// Process this domain
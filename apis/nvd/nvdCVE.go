@@ -5,9 +5,9 @@ import (
 	"context"
 	"encoding/csv"
 	"fmt"
-	"sync"
 
 	nvd "github.com/gdcorp-infosec/threat-api/apis/nvd/nvdLibrary"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
 )
 
@@ -20,44 +20,24 @@ func (m *TriageModule) GetNVDData(ctx context.Context, triageRequest *triage.Req
 
 	nvdResults := make(map[string]*nvd.NVDReport)
 
-	wg := sync.WaitGroup{}
-	nvdLock := sync.Mutex{}
-	threadLimit := make(chan int, maxThreadCount)
-
-	for _, cve := range triageRequest.IOCs {
-		// Check context
-		select {
-		case <-ctx.Done():
-			break
-		case threadLimit <- 1:
-			wg.Add(1)
-		default:
-		}
-
+	results := toolbox.FanOut(ctx, triageRequest.IOCs, toolbox.FanOutOptions{MaxConcurrency: maxThreadCount}, func(ctx context.Context, cve string) (interface{}, error) {
 		span, spanCtx := tb.TracerLogger.StartSpan(ctx, "NVDLookup", "nvd", "", "nvdCVELookup")
+		defer span.End(spanCtx)
 
-		go func(cve string) {
-			defer func() {
-				<-threadLimit
-				wg.Done()
-			}()
-			nvdResult, err := nvd.GetNVD(ctx, cve, m.NVDClient)
-			if err != nil {
-				span.AddError(err)
-				nvdLock.Lock()
-				nvdResults[cve] = nil
-				nvdLock.Unlock()
-				return
-			}
-
-			nvdLock.Lock()
-			nvdResults[cve] = nvdResult
-			nvdLock.Unlock()
-		}(cve)
-		span.End(spanCtx)
+		nvdResult, err := nvd.GetNVD(ctx, cve, m.NVDClient)
+		if err != nil {
+			span.AddError(err)
+			return nil, err
+		}
+		return nvdResult, nil
+	})
+	for _, result := range results {
+		// Out of time, return what we have so far
+		if result.Skipped {
+			continue
+		}
+		nvdResults[result.IOC], _ = result.Value.(*nvd.NVDReport)
 	}
-
-	wg.Wait()
 	return nvdResults, nil
 }
 
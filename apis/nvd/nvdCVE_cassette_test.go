@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/cassette"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTriageCassette(t *testing.T) {
+
+	Convey("Triage with recorded NVD responses", t, func() {
+		module := &TriageModule{NVDClient: cassette.Wrap(t, "triage", nil)}
+
+		triageDatas, err := module.Triage(context.Background(), &triage.Request{
+			IOCs:     []string{"CVE-2020-29292", "CVE-1999-0000"},
+			IOCsType: triage.CVEType,
+		})
+		So(err, ShouldBeNil)
+		So(triageDatas, ShouldHaveLength, 1)
+
+		Convey("should dump the CVEs found", func() {
+			So(triageDatas[0].DataType, ShouldEqual, triage.CSVType)
+			So(strings.Count(triageDatas[0].Data, "\n"), ShouldEqual, 2)
+			So(triageDatas[0].Data, ShouldContainSubstring, "CVE-2020-29292,2021-12-30T17:15Z,CWE-352")
+		})
+
+		Convey("should report the CVEs not found and the ones with a high score", func() {
+			So(triageDatas[0].Metadata, ShouldContain, "data doesnt't exist for this cve CVE-1999-0000")
+			So(triageDatas[0].Metadata, ShouldContain, "1 CVE's have a base score > 7.0, implying high or critical severity")
+		})
+	})
+}
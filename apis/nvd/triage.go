@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox/appsectracing"
@@ -19,6 +20,13 @@ const (
 	triageModuleName = "nvd"
 )
 
+// vendorClientOptions of NVD, which is slow to answer and only allows 5 requests in 30 seconds without an API key
+var vendorClientOptions = toolbox.VendorClientOptions{
+	Timeout:    time.Minute,
+	Backoff:    time.Second * 6,
+	MaxBackoff: time.Second * 30,
+}
+
 // GetDocs of this module
 func (m *TriageModule) GetDocs() *triage.Doc {
 	return &triage.Doc{Name: triageModuleName, Description: "CVE data from NVD"}
@@ -40,7 +48,7 @@ func (m *TriageModule) Triage(ctx context.Context, triageRequest *triage.Request
 	defer tb.Close(ctx)
 
 	if m.NVDClient == nil {
-		m.NVDClient = http.DefaultClient
+		m.NVDClient = tb.GetVendorHTTPClient(triageModuleName, vendorClientOptions)
 	}
 
 	var span *appsectracing.Span
@@ -50,14 +58,14 @@ func (m *TriageModule) Triage(ctx context.Context, triageRequest *triage.Request
 	//retrieve NVD results
 	NVDResults, err := m.GetNVDData(ctx, triageRequest)
 	if err != nil {
-		triageNVDData.Data = fmt.Sprintf("error from NVD: %s", err)
-	} else {
-		//Dump data as csv
-		triageNVDData.DataType = triage.CSVType
-		//calculate and add the metadata
-		triageNVDData.Metadata = cveMetaDataExtract(NVDResults)
-		triageNVDData.Data = dumpCSV(NVDResults)
+		return nil, fmt.Errorf("error from NVD: %w", err)
 	}
 
+	//Dump data as csv
+	triageNVDData.DataType = triage.CSVType
+	//calculate and add the metadata
+	triageNVDData.Metadata = cveMetaDataExtract(NVDResults)
+	triageNVDData.Data = dumpCSV(NVDResults)
+
 	return []*triage.Data{triageNVDData}, nil
 }
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/cassette"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage/triagetest"
+)
+
+func TestConformance(t *testing.T) {
+	module := &TriageModule{NVDClient: cassette.Wrap(t, "triage", nil)}
+	triagetest.RunConformance(t, module, triagetest.Options{
+		IOCs: map[triage.IOCType][]string{triage.CVEType: {"CVE-2020-29292"}},
+	})
+}
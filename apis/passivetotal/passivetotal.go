@@ -2,9 +2,9 @@ package main
 
 import (
 	"context"
-	"sync"
 
 	pt "github.com/gdcorp-infosec/threat-api/apis/passivetotal/passivetotalLibrary"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
 )
 
@@ -16,44 +16,23 @@ func (m *TriageModule) GetPassiveDNS(ctx context.Context, triageRequest *triage.
 
 	ptDNSResults := make(map[string]*pt.PDNSReport)
 
-	wg := sync.WaitGroup{}
-	pdnsLock := sync.Mutex{}
-	threadLimit := make(chan int, maxThreadCount)
-
-	for _, ioc := range triageRequest.IOCs {
-		// Check context
-		select {
-		case <-ctx.Done():
-			break
-		case threadLimit <- 1:
-			wg.Add(1)
-		default:
-		}
-
+	results := toolbox.FanOut(ctx, triageRequest.IOCs, toolbox.FanOutOptions{MaxConcurrency: maxThreadCount}, func(ctx context.Context, ioc string) (interface{}, error) {
 		span, spanCtx := tb.TracerLogger.StartSpan(ctx, "PassiveDNSLookup", "passivetotal", "", "passiveDNSLookup")
+		defer span.End(spanCtx)
 
-		go func(ioc string) {
-			defer func() {
-				<-threadLimit
-				wg.Done()
-			}()
-
-			pdnsResult, err := pt.GetPassiveDNS(ctx, passiveDNSURL, ioc, m.PTUser, m.PTKey, m.PTClient)
-			if err != nil {
-				span.AddError(err)
-				pdnsLock.Lock()
-				ptDNSResults[ioc] = nil
-				pdnsLock.Unlock()
-				return
-			}
-
-			pdnsLock.Lock()
-			ptDNSResults[ioc] = pdnsResult
-			pdnsLock.Unlock()
-		}(ioc)
-		span.End(spanCtx)
+		pdnsResult, err := pt.GetPassiveDNS(ctx, passiveDNSURL, ioc, m.PTUser, m.PTKey, m.PTClient)
+		if err != nil {
+			span.AddError(err)
+			return nil, err
+		}
+		return pdnsResult, nil
+	})
+	for _, result := range results {
+		// Out of time, return what we have so far
+		if result.Skipped {
+			continue
+		}
+		ptDNSResults[result.IOC], _ = result.Value.(*pt.PDNSReport)
 	}
-
-	wg.Wait()
 	return ptDNSResults, nil
 }
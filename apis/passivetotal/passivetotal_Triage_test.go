@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	ptl "github.com/gdcorp-infosec/threat-api/apis/passivetotal/passivetotalLibrary"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/cassette"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTriage(t *testing.T) {
+
+	Convey("Triage with recorded PassiveTotal responses", t, func() {
+		module := &TriageModule{PTUser: "test-user", PTKey: "test-key", PTClient: cassette.Wrap(t, "triage", nil, cassette.WithSecrets("test-user"))}
+
+		triageDatas, err := module.Triage(context.Background(), &triage.Request{
+			IOCs:     []string{"godaddy.com"},
+			IOCsType: triage.DomainType,
+		})
+		So(err, ShouldBeNil)
+		So(triageDatas, ShouldHaveLength, 1)
+		So(triageDatas[0].DataType, ShouldEqual, triage.JSONType)
+
+		Convey("should group the resolutions of the domain by record type", func() {
+			responses := []ptl.PassiveTotalResponse{}
+			So(json.Unmarshal([]byte(triageDatas[0].Data), &responses), ShouldBeNil)
+			So(responses, ShouldHaveLength, 1)
+			So(responses[0].Value, ShouldEqual, "godaddy.com")
+			So(responses[0].FirstSeen, ShouldEqual, "2010-06-23 20:14:31")
+			So(responses[0].Resolutions["A"]["godaddy.com"], ShouldHaveLength, 2)
+			So(responses[0].Resolutions["A"]["godaddy.com"][0].Value, ShouldEqual, "76.223.105.230")
+			So(responses[0].Resolutions["TXT (SPF1)"]["godaddy.com"][0].Sources, ShouldResemble, []string{"pingly"})
+		})
+	})
+}
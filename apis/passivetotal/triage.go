@@ -18,6 +18,11 @@ const (
 	passiveDNSURL    = "https://api.passivetotal.org"
 )
 
+// vendorClientOptions of PassiveTotal, the passive DNS of popular domains has many records
+var vendorClientOptions = toolbox.VendorClientOptions{
+	MaxResponseBytes: 50 << 20,
+}
+
 // TriageModule triage module
 type TriageModule struct {
 	PTKey    string
@@ -46,23 +51,25 @@ func (m *TriageModule) Triage(ctx context.Context, triageRequest *triage.Request
 	tb = toolbox.GetToolbox()
 	defer tb.Close(ctx)
 
-	secret, err := tb.GetFromCredentialsStore(ctx, secretID, nil)
-	if err != nil {
-		triageDataPTData.Data = fmt.Sprintf("error in retrieving secrets: %s", err)
-		return []*triage.Data{triageDataPTData}, err
-	}
+	if m.PTKey == "" {
+		secret, err := tb.GetFromCredentialsStore(ctx, secretID, nil)
+		if err != nil {
+			triageDataPTData.Data = fmt.Sprintf("error in retrieving secrets: %s", err)
+			return []*triage.Data{triageDataPTData}, err
+		}
 
-	secretMap := map[string]string{}
-	if err := json.Unmarshal([]byte(*secret.SecretString), &secretMap); err != nil {
-		triageDataPTData.Data = fmt.Sprintf("error in unmarshaling secrets: %s", err)
-		return []*triage.Data{triageDataPTData}, err
+		secretMap := map[string]string{}
+		if err := json.Unmarshal([]byte(*secret.SecretString), &secretMap); err != nil {
+			triageDataPTData.Data = fmt.Sprintf("error in unmarshaling secrets: %s", err)
+			return []*triage.Data{triageDataPTData}, err
+		}
+		m.PTKey = secretMap["key"]
+		m.PTUser = secretMap["user"]
 	}
 
 	if m.PTClient == nil {
-		m.PTClient = http.DefaultClient
+		m.PTClient = tb.GetVendorHTTPClient(triageModuleName, vendorClientOptions)
 	}
-	m.PTKey = secretMap["key"]
-	m.PTUser = secretMap["user"]
 	m.PTURL = passiveDNSURL
 
 	var span *appsectracing.Span
@@ -6,9 +6,9 @@ import (
 	"encoding/csv"
 	"fmt"
 	"strings"
-	"sync"
 
 	rf "github.com/gdcorp-infosec/threat-api/apis/recordedfuture/recordedfutureLibrary"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
 )
 
@@ -20,44 +20,25 @@ const (
 func (m *TriageModule) cveReportCreate(ctx context.Context, triageRequest *triage.Request) (map[string]*rf.CVEReport, error) {
 	rfCVEResults := make(map[string]*rf.CVEReport)
 
-	wg := sync.WaitGroup{}
-	rfCVEResultsLock := sync.Mutex{}
-	threadLimit := make(chan int, maxThreadCount)
-
-	for _, cve := range triageRequest.IOCs {
-		select {
-		case <-ctx.Done():
-			break
-		case threadLimit <- 1:
-			wg.Add(1)
-		default:
-		}
-
-		go func(cve string) {
-			span, spanCtx := tb.TracerLogger.StartSpan(ctx, "RecordedFutureCVELookup", "recordedfuture", "", "cveEnrich")
-			span.End(spanCtx)
-
-			defer func() {
-				<-threadLimit
-				wg.Done()
-			}()
-			// Calling RF API with metadata switched off
-			rfCVEResult, err := rf.EnrichCVE(ctx, m.RFKey, m.RFClient, cve, rf.CVEReportFields, false)
-			if err != nil {
-				span.AddError(err)
-				rfCVEResultsLock.Lock()
-				rfCVEResults[cve] = nil
-				rfCVEResultsLock.Unlock()
-				return
-			}
+	results := toolbox.FanOut(ctx, triageRequest.IOCs, toolbox.FanOutOptions{MaxConcurrency: maxThreadCount}, func(ctx context.Context, cve string) (interface{}, error) {
+		span, spanCtx := tb.TracerLogger.StartSpan(ctx, "RecordedFutureCVELookup", "recordedfuture", "", "cveEnrich")
+		defer span.End(spanCtx)
 
-			rfCVEResultsLock.Lock()
-			rfCVEResults[cve] = rfCVEResult
-			rfCVEResultsLock.Unlock()
-		}(cve)
+		// Calling RF API with metadata switched off
+		rfCVEResult, err := rf.EnrichCVE(ctx, m.RFKey, m.RFClient, cve, rf.CVEReportFields, false)
+		if err != nil {
+			span.AddError(err)
+			return nil, err
+		}
+		return rfCVEResult, nil
+	})
+	for _, result := range results {
+		// Out of time, return what we have so far
+		if result.Skipped {
+			continue
+		}
+		rfCVEResults[result.IOC], _ = result.Value.(*rf.CVEReport)
 	}
-
-	wg.Wait()
 	return rfCVEResults, nil
 }
 
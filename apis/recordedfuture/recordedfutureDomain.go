@@ -6,9 +6,9 @@ import (
 	"encoding/csv"
 	"fmt"
 	"strings"
-	"sync"
 
 	rf "github.com/gdcorp-infosec/threat-api/apis/recordedfuture/recordedfutureLibrary"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
 )
 
@@ -20,43 +20,25 @@ const (
 func (m *TriageModule) domainReportCreate(ctx context.Context, triageRequest *triage.Request) (map[string]*rf.DomainReport, error) {
 	rfDomainResults := make(map[string]*rf.DomainReport)
 
-	wg := sync.WaitGroup{}
-	rfDomainResultsLock := sync.Mutex{}
-	threadLimit := make(chan int, maxThreadCount)
+	results := toolbox.FanOut(ctx, triageRequest.IOCs, toolbox.FanOutOptions{MaxConcurrency: maxThreadCount}, func(ctx context.Context, domain string) (interface{}, error) {
+		span, spanCtx := tb.TracerLogger.StartSpan(ctx, "RecordedFutureDomainLookup", "recordedfuture", "", "domainEnrich")
+		defer span.End(spanCtx)
 
-	for _, domain := range triageRequest.IOCs {
-		select {
-		case <-ctx.Done():
-			break
-		case threadLimit <- 1:
-			wg.Add(1)
+		// Calling RF API with metadata switched off
+		rfDomainResult, err := rf.EnrichDomain(ctx, m.RFKey, m.RFClient, domain, rf.DomainReportFields, false)
+		if err != nil {
+			span.AddError(err)
+			return nil, err
 		}
-
-		go func(domain string) {
-			span, spanCtx := tb.TracerLogger.StartSpan(ctx, "RecordedFutureDomainLookup", "recordedfuture", "", "domainEnrich")
-			defer span.End(spanCtx)
-
-			defer func() {
-				<-threadLimit
-				wg.Done()
-			}()
-			// Calling RF API with metadata switched off
-			rfDomainResult, err := rf.EnrichDomain(ctx, m.RFKey, m.RFClient, domain, rf.DomainReportFields, false)
-			if err != nil {
-				span.AddError(err)
-				rfDomainResultsLock.Lock()
-				rfDomainResults[domain] = nil
-				rfDomainResultsLock.Unlock()
-				return
-			}
-
-			rfDomainResultsLock.Lock()
-			rfDomainResults[domain] = rfDomainResult
-			rfDomainResultsLock.Unlock()
-		}(domain)
+		return rfDomainResult, nil
+	})
+	for _, result := range results {
+		// Out of time, return what we have so far
+		if result.Skipped {
+			continue
+		}
+		rfDomainResults[result.IOC], _ = result.Value.(*rf.DomainReport)
 	}
-
-	wg.Wait()
 	return rfDomainResults, nil
 }
 
@@ -6,9 +6,9 @@ import (
 	"encoding/csv"
 	"fmt"
 	"strings"
-	"sync"
 
 	rf "github.com/gdcorp-infosec/threat-api/apis/recordedfuture/recordedfutureLibrary"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
 )
 
@@ -22,44 +22,25 @@ const (
 func (m *TriageModule) hashReportCreate(ctx context.Context, triageRequest *triage.Request) (map[string]*rf.HashReport, error) {
 	rfHASHResults := make(map[string]*rf.HashReport)
 
-	wg := sync.WaitGroup{}
-	rfHASHResultsLock := sync.Mutex{}
-	threadLimit := make(chan int, maxThreadCount)
-
-	for _, hash := range triageRequest.IOCs {
-		select {
-		case <-ctx.Done():
-			break
-		case threadLimit <- 1:
-			wg.Add(1)
-		default:
-		}
-
-		go func(hash string) {
-			span, spanCtx := tb.TracerLogger.StartSpan(ctx, "RecordedFutureHASHLookup", "recordedfuture", "", "hashEnrich")
-			defer span.End(spanCtx)
-
-			defer func() {
-				<-threadLimit
-				wg.Done()
-			}()
-			// Calling RF API with metadata switched off
-			rfHASHResult, err := rf.EnrichHASH(ctx, m.RFKey, m.RFClient, hash, rf.HASHReportFields, false)
-			if err != nil {
-				span.AddError(err)
-				rfHASHResultsLock.Lock()
-				rfHASHResults[hash] = nil
-				rfHASHResultsLock.Unlock()
-				return
-			}
+	results := toolbox.FanOut(ctx, triageRequest.IOCs, toolbox.FanOutOptions{MaxConcurrency: maxThreadCount}, func(ctx context.Context, hash string) (interface{}, error) {
+		span, spanCtx := tb.TracerLogger.StartSpan(ctx, "RecordedFutureHASHLookup", "recordedfuture", "", "hashEnrich")
+		defer span.End(spanCtx)
 
-			rfHASHResultsLock.Lock()
-			rfHASHResults[hash] = rfHASHResult
-			rfHASHResultsLock.Unlock()
-		}(hash)
+		// Calling RF API with metadata switched off
+		rfHASHResult, err := rf.EnrichHASH(ctx, m.RFKey, m.RFClient, hash, rf.HASHReportFields, false)
+		if err != nil {
+			span.AddError(err)
+			return nil, err
+		}
+		return rfHASHResult, nil
+	})
+	for _, result := range results {
+		// Out of time, return what we have so far
+		if result.Skipped {
+			continue
+		}
+		rfHASHResults[result.IOC], _ = result.Value.(*rf.HashReport)
 	}
-
-	wg.Wait()
 	return rfHASHResults, nil
 }
 
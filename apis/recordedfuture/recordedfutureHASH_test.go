@@ -4,6 +4,7 @@ import (
 	"context"
 	"testing"
 
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/cassette"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
 )
@@ -13,6 +14,7 @@ func TestEnrichHASH(t *testing.T) {
 	ctx := context.Background()
 	tb = toolbox.GetToolbox()
 	defer tb.Close(ctx)
+	client := cassette.Wrap(t, "enrichHASH", nil)
 
 	var triageRequests []*triage.Request
 	triageRequests = append(triageRequests, &triage.Request{
@@ -25,7 +27,7 @@ func TestEnrichHASH(t *testing.T) {
 	})
 
 	for _, triageRequest := range triageRequests {
-		triageModule := TriageModule{}
+		triageModule := TriageModule{RFKey: "test-key", RFClient: client}
 		triageResult, err := triageModule.Triage(ctx, triageRequest)
 		if err != nil {
 			t.Fatal(err)
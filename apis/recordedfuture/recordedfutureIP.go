@@ -6,9 +6,9 @@ import (
 	"encoding/csv"
 	"fmt"
 	"strings"
-	"sync"
 
 	rf "github.com/gdcorp-infosec/threat-api/apis/recordedfuture/recordedfutureLibrary"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
 )
 
@@ -16,43 +16,25 @@ import (
 func (m *TriageModule) ipReportCreate(ctx context.Context, triageRequest *triage.Request) (map[string]*rf.IPReport, error) {
 	rfIPResults := make(map[string]*rf.IPReport)
 
-	wg := sync.WaitGroup{}
-	rfIPResultsLock := sync.Mutex{}
-	threadLimit := make(chan int, maxThreadCount)
+	results := toolbox.FanOut(ctx, triageRequest.IOCs, toolbox.FanOutOptions{MaxConcurrency: maxThreadCount}, func(ctx context.Context, ip string) (interface{}, error) {
+		span, spanCtx := tb.TracerLogger.StartSpan(ctx, "RecordedFutureIPLookup", "recordedfuture", "", "ipEnrich")
+		defer span.End(spanCtx)
 
-	for _, ip := range triageRequest.IOCs {
-		select {
-		case <-ctx.Done():
-			break
-		case threadLimit <- 1:
-			wg.Add(1)
+		// Calling RF API with metadata switched off
+		rfIPResult, err := rf.EnrichIP(ctx, m.RFKey, m.RFClient, ip, rf.IPReportFields, false)
+		if err != nil {
+			span.AddError(err)
+			return nil, err
 		}
-
-		go func(ip string) {
-			span, spanCtx := tb.TracerLogger.StartSpan(ctx, "RecordedFutureIPLookup", "recordedfuture", "", "ipEnrich")
-			defer span.End(spanCtx)
-
-			defer func() {
-				<-threadLimit
-				wg.Done()
-			}()
-			// Calling RF API with metadata switched off
-			rfIPResult, err := rf.EnrichIP(ctx, m.RFKey, m.RFClient, ip, rf.IPReportFields, false)
-			if err != nil {
-				span.AddError(err)
-				rfIPResultsLock.Lock()
-				rfIPResults[ip] = nil
-				rfIPResultsLock.Unlock()
-				return
-			}
-
-			rfIPResultsLock.Lock()
-			rfIPResults[ip] = rfIPResult
-			rfIPResultsLock.Unlock()
-		}(ip)
+		return rfIPResult, nil
+	})
+	for _, result := range results {
+		// Out of time, return what we have so far
+		if result.Skipped {
+			continue
+		}
+		rfIPResults[result.IOC], _ = result.Value.(*rf.IPReport)
 	}
-
-	wg.Wait()
 	return rfIPResults, nil
 }
 
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/cassette"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestIPReportCreateCassette(t *testing.T) {
+
+	Convey("ipReportCreate with recorded Recorded Future responses", t, func() {
+		tb = toolbox.GetToolbox()
+		module := &TriageModule{RFKey: "test-key", RFClient: cassette.Wrap(t, "ipReportCreate", nil)}
+
+		rfIPResults, err := module.ipReportCreate(context.Background(), &triage.Request{
+			IOCs:     []string{"123.45.67.1", "10.0.0.1"},
+			IOCsType: triage.IPType,
+		})
+		So(err, ShouldBeNil)
+
+		Convey("should return the reports of the IPs found", func() {
+			So(rfIPResults["123.45.67.1"], ShouldNotBeNil)
+			So(rfIPResults["123.45.67.1"].Data.Risk.Score, ShouldEqual, 15)
+			So(rfIPResults, ShouldContainKey, "10.0.0.1")
+			So(rfIPResults["10.0.0.1"], ShouldBeNil)
+		})
+
+		Convey("should report the risky IPs in the same CIDR block and the IPs not found", func() {
+			metadata := ipMetaDataExtract(rfIPResults)
+			So(metadata, ShouldContain, "2 risky IP addresses in same CIDR block as 123.45.67.1")
+			So(metadata, ShouldContain, "data doesnt't exist for this ip 10.0.0.1")
+		})
+	})
+}
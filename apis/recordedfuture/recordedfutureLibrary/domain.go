@@ -109,6 +109,11 @@ type DomainReport struct {
 	} `json:"metadata"`
 }
 
+// RiskScore is the risk score (0-100) of the domain
+func (r *DomainReport) RiskScore() int {
+	return r.Data.Risk.Score
+}
+
 // EnrichDomain  performs a CVE search with RecordedFuture
 func EnrichDomain(ctx context.Context, RFKey string, RFClient *http.Client, ip string, fields []string, metadata bool) (*DomainReport, error) {
 	// Build URL
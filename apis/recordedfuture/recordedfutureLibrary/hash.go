@@ -151,6 +151,11 @@ type HashReport struct {
 	} `json:"metadata"`
 }
 
+// RiskScore is the risk score (0-100) of the hash
+func (r *HashReport) RiskScore() int {
+	return r.Data.Risk.Score
+}
+
 //EnrichHASH  performs a HASH search with RecordedFuture
 func EnrichHASH(ctx context.Context, RFKey string, RFClient *http.Client, hash string, fields []string, metadata bool) (*HashReport, error) {
 	// Build URL
@@ -121,6 +121,11 @@ type IPReport struct {
 	} `json:"metadata"`
 }
 
+// RiskScore is the risk score (0-100) of the IP
+func (r *IPReport) RiskScore() int {
+	return r.Data.Risk.Score
+}
+
 //EnrichIP  performs a CVE search with RecordedFuture
 func EnrichIP(ctx context.Context, RFKey string, RFClient *http.Client, ip string, fields []string, metadata bool) (*IPReport, error) {
 	// Build URL
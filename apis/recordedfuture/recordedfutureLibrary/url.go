@@ -102,6 +102,11 @@ type UrlReport struct {
 	} `json:"metadata"`
 }
 
+// RiskScore is the risk score (0-100) of the URL
+func (r *UrlReport) RiskScore() int {
+	return r.Data.Risk.Score
+}
+
 // EnrichUrl  performs a CVE search with RecordedFuture
 func EnrichUrl(ctx context.Context, RFKey string, RFClient *http.Client, ioc string, fields []string, metadata bool) (*UrlReport, error) {
 	// Build URL
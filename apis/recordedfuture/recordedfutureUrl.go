@@ -5,9 +5,9 @@ import (
 	"context"
 	"encoding/csv"
 	"fmt"
-	"sync"
 
 	rf "github.com/gdcorp-infosec/threat-api/apis/recordedfuture/recordedfutureLibrary"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
 )
 
@@ -15,43 +15,25 @@ import (
 func (m *TriageModule) urlReportCreate(ctx context.Context, triageRequest *triage.Request) (map[string]*rf.UrlReport, error) {
 	rfUrlResults := make(map[string]*rf.UrlReport)
 
-	wg := sync.WaitGroup{}
-	rfUrlResultsLock := sync.Mutex{}
-	threadLimit := make(chan int, maxThreadCount)
+	results := toolbox.FanOut(ctx, triageRequest.IOCs, toolbox.FanOutOptions{MaxConcurrency: maxThreadCount}, func(ctx context.Context, ioc string) (interface{}, error) {
+		span, spanCtx := tb.TracerLogger.StartSpan(ctx, "RecordedFutureUrlLookup", "recordedfuture", "", "urlEnrich")
+		defer span.End(spanCtx)
 
-	for _, ioc := range triageRequest.IOCs {
-		select {
-		case <-ctx.Done():
-			break
-		case threadLimit <- 1:
-			wg.Add(1)
+		// Calling RF API with metadata switched off
+		rfUrlResult, err := rf.EnrichUrl(ctx, m.RFKey, m.RFClient, ioc, rf.UrlReportFields, false)
+		if err != nil {
+			span.AddError(err)
+			return nil, err
 		}
-
-		go func(ioc string) {
-			span, spanCtx := tb.TracerLogger.StartSpan(ctx, "RecordedFutureUrlLookup", "recordedfuture", "", "urlEnrich")
-			defer span.End(spanCtx)
-
-			defer func() {
-				<-threadLimit
-				wg.Done()
-			}()
-			// Calling RF API with metadata switched off
-			rfUrlResult, err := rf.EnrichUrl(ctx, m.RFKey, m.RFClient, ioc, rf.UrlReportFields, false)
-			if err != nil {
-				span.AddError(err)
-				rfUrlResultsLock.Lock()
-				rfUrlResults[ioc] = nil
-				rfUrlResultsLock.Unlock()
-				return
-			}
-
-			rfUrlResultsLock.Lock()
-			rfUrlResults[ioc] = rfUrlResult
-			rfUrlResultsLock.Unlock()
-		}(ioc)
+		return rfUrlResult, nil
+	})
+	for _, result := range results {
+		// Out of time, return what we have so far
+		if result.Skipped {
+			continue
+		}
+		rfUrlResults[result.IOC], _ = result.Value.(*rf.UrlReport)
 	}
-
-	wg.Wait()
 	return rfUrlResults, nil
 }
 
@@ -4,7 +4,11 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"reflect"
+	"sort"
+	"time"
 
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
 )
 
@@ -13,6 +17,11 @@ const (
 	secretID         = "/ThreatTools/Integrations/recordedfuture"
 )
 
+// vendorClientOptions of Recorded Future, which answers lookups in a few seconds so a stuck lookup is retried sooner
+var vendorClientOptions = toolbox.VendorClientOptions{
+	Timeout: time.Second * 15,
+}
+
 // TriageModule triage module
 type TriageModule struct {
 	RFKey    string
@@ -44,15 +53,16 @@ func (m *TriageModule) Triage(ctx context.Context, triageRequest *triage.Request
 		Metadata: []string{},
 	}
 
-	secret, err := tb.GetFromCredentialsStore(ctx, secretID, nil)
-	if err != nil {
-		triageData.Data = fmt.Sprintf("error in retrieving secrets: %s", err)
-		return []*triage.Data{triageData}, err
+	if m.RFKey == "" {
+		secret, err := tb.GetFromCredentialsStore(ctx, secretID, nil)
+		if err != nil {
+			triageData.Data = fmt.Sprintf("error in retrieving secrets: %s", err)
+			return []*triage.Data{triageData}, err
+		}
+		m.RFKey = *secret.SecretString
 	}
-
-	m.RFKey = *secret.SecretString
 	if m.RFClient == nil {
-		m.RFClient = http.DefaultClient
+		m.RFClient = tb.GetVendorHTTPClient(triageModuleName, vendorClientOptions)
 	}
 
 	if triageRequest.IOCsType == triage.CVEType {
@@ -86,6 +96,9 @@ func (m *TriageModule) Triage(ctx context.Context, triageRequest *triage.Request
 		//dump data as csv
 		triageData.DataType = triage.CSVType
 		triageData.Data = dumpIPCSV(rfIPResults)
+
+		// normalize the risk scores
+		triageData.Scores = reportScores(rfIPResults)
 	}
 
 	if (triageRequest.IOCsType == triage.MD5Type) || (triageRequest.IOCsType == triage.SHA1Type) || (triageRequest.IOCsType == triage.SHA256Type) {
@@ -102,6 +115,9 @@ func (m *TriageModule) Triage(ctx context.Context, triageRequest *triage.Request
 		// dump data in CSV format
 		triageData.DataType = triage.CSVType
 		triageData.Data = dumpHASHCSV(rfMD5Results)
+
+		// normalize the risk scores
+		triageData.Scores = reportScores(rfMD5Results)
 	}
 
 	if triageRequest.IOCsType == triage.DomainType {
@@ -118,6 +134,9 @@ func (m *TriageModule) Triage(ctx context.Context, triageRequest *triage.Request
 		//dump data as csv
 		triageData.DataType = triage.CSVType
 		triageData.Data = dumpDomainCSV(rfDomainResults)
+
+		// normalize the risk scores
+		triageData.Scores = reportScores(rfDomainResults)
 	}
 
 	if triageRequest.IOCsType == triage.URLType {
@@ -134,7 +153,49 @@ func (m *TriageModule) Triage(ctx context.Context, triageRequest *triage.Request
 		// dump data as csv
 		triageData.DataType = triage.CSVType
 		triageData.Data = dumpUrlCSV(rfUrlResults)
+
+		// normalize the risk scores
+		triageData.Scores = reportScores(rfUrlResults)
 	}
 
 	return []*triage.Data{triageData}, nil
 }
+
+// riskScored is a Recorded Future report with a risk score
+type riskScored interface {
+	RiskScore() int
+}
+
+// reportScores normalizes the risk scores of a map of IoCs to their reports, the IoCs without reports aren't scored
+func reportScores(reports interface{}) []triage.Score {
+	riskScores := map[string]int{}
+	iter := reflect.ValueOf(reports).MapRange()
+	for iter.Next() {
+		if iter.Value().IsNil() {
+			continue
+		}
+		if report, ok := iter.Value().Interface().(riskScored); ok {
+			riskScores[iter.Key().String()] = report.RiskScore()
+		}
+	}
+	return iocScores(riskScores)
+}
+
+// iocScores normalizes the risk scores (0-100) of the IoCs.
+// CVEs aren't scored, their risk is about how exploited they are and not how malicious.
+func iocScores(riskScores map[string]int) []triage.Score {
+	iocs := make([]string, 0, len(riskScores))
+	for ioc := range riskScores {
+		iocs = append(iocs, ioc)
+	}
+	sort.Strings(iocs)
+
+	var scores []triage.Score
+	for _, ioc := range iocs {
+		score, ok := triage.NewScore(ioc, float64(riskScores[ioc]), 100, "Risk Score", 1)
+		if ok {
+			scores = append(scores, score)
+		}
+	}
+	return scores
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/cassette"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage/triagetest"
+)
+
+func TestConformance(t *testing.T) {
+	tb = toolbox.GetToolbox()
+	module := &TriageModule{RFKey: "test-key", RFClient: cassette.Wrap(t, "conformance", nil)}
+	triagetest.RunConformance(t, module, triagetest.Options{
+		IOCs: map[triage.IOCType][]string{triage.IPType: {"8.8.8.8"}, triage.DomainType: {"godaddy.com"}},
+	})
+}
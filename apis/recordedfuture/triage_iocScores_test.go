@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	rf "github.com/gdcorp-infosec/threat-api/apis/recordedfuture/recordedfutureLibrary"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestIocScores(t *testing.T) {
+
+	Convey("iocScores", t, func() {
+
+		Convey("should normalize risk scores in a stable order", func() {
+			scores := iocScores(map[string]int{"123.45.67.89": 15, "1.2.3.4": 99})
+			So(scores, ShouldResemble, []triage.Score{
+				{IOC: "1.2.3.4", Score: 99, Source: "Risk Score", Confidence: 1},
+				{IOC: "123.45.67.89", Score: 15, Source: "Risk Score", Confidence: 1},
+			})
+		})
+
+		Convey("should not score IoCs without reports", func() {
+			So(iocScores(map[string]int{}), ShouldBeNil)
+		})
+	})
+}
+
+func TestReportScores(t *testing.T) {
+
+	Convey("reportScores", t, func() {
+
+		Convey("should normalize the risk scores of the reports", func() {
+			reports := map[string]*rf.IPReport{"1.2.3.4": {}, "5.6.7.8": nil}
+			reports["1.2.3.4"].Data.Risk.Score = 65
+			So(reportScores(reports), ShouldResemble, []triage.Score{
+				{IOC: "1.2.3.4", Score: 65, Source: "Risk Score", Confidence: 1},
+			})
+		})
+	})
+}
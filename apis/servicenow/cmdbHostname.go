@@ -8,9 +8,9 @@ import (
 	"net/url"
 	"reflect"
 	"strings"
-	"sync"
 
 	servicenow "github.com/gdcorp-infosec/threat-api/apis/servicenow/servicenowLibrary"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
 )
 
 const (
@@ -32,93 +32,77 @@ func (m *TriageModule) GetCMDBData(ctx context.Context, IOCs []string) (map[stri
 		return nil, err
 	}
 
-	wg := sync.WaitGroup{}
-	cmdbLock := sync.Mutex{}
 	// Limit the number of concurrent IOCs to scan for in the table
-	threadLimit := make(chan int, maxTableThreads)
-
-	for _, ioc := range IOCs {
-		// Check if a thread is available
-		select {
-		case <-ctx.Done():
-			wg.Wait()
-			return nil, ctx.Err()
-		case threadLimit <- 1:
-			wg.Add(1)
-		default:
-		}
-
+	results := toolbox.FanOut(ctx, IOCs, toolbox.FanOutOptions{MaxConcurrency: maxTableThreads}, func(ctx context.Context, ioc string) (interface{}, error) {
 		span, spanCtx := tb.TracerLogger.StartSpan(ctx, "SNHostnameLookup", "servicenow", "cmdb", "hostnameEnrich")
+		defer span.End(spanCtx)
 
+		rows := make(chan servicenow.Row)
+		scanErr := make(chan error, 1)
+		ctxInner, cancel := context.WithCancel(ctx)
+		defer cancel()
+		// Spawn thread to scan the table
 		go func(ioc string) {
-			rows := make(chan servicenow.Row)
-			ctxInner, cancel := context.WithCancel(ctx)
-			defer func() {
-				<-threadLimit
-				wg.Done()
-				cancel()
-			}()
-			// Spawn thread to scan the table
-			go func(ioc string) {
-				// set the ioc as fully qualified domain name
-				query := fmt.Sprintf("fqdn=%s", ioc)
-
-				//set additional values - currently retrieving only assignment group and support group
-				additionalURLValues := url.Values{
-					"sysparm_fields": []string{"assignment_group,support_group"},
-				}
-				// Perform search
-				err := newClient.GetRows(ctxInner, query, additionalURLValues, rows)
-				if err != nil {
-					span.AddError(err)
-					cmdbLock.Lock()
-					cmdbResults[ioc] = nil
-					cmdbLock.Unlock()
-				}
-			}(ioc)
-
-			// For every row returned, its groups associated - either support or assignment
-			var assignmentGroups, supportGroups []string
-			for row := range rows {
-				//extract assignment group name
-				if groupData, ok := row["assignment_group"]; ok {
-					// when there is data- its a map, else its a string[assignment_group]. Checking on data availability
-					if reflect.TypeOf(groupData).Kind() == reflect.Map {
-						assignGroupName, err := m.extractGroupName(ctxInner, groupData)
-						if err != nil {
-							span.AddError(err)
-						} else {
-							assignmentGroups = append(assignmentGroups, assignGroupName)
-						}
+			// set the ioc as fully qualified domain name
+			query := fmt.Sprintf("fqdn=%s", ioc)
+
+			//set additional values - currently retrieving only assignment group and support group
+			additionalURLValues := url.Values{
+				"sysparm_fields": []string{"assignment_group,support_group"},
+			}
+			// Perform search
+			scanErr <- newClient.GetRows(ctxInner, query, additionalURLValues, rows)
+		}(ioc)
+
+		// For every row returned, its groups associated - either support or assignment
+		var assignmentGroups, supportGroups []string
+		for row := range rows {
+			//extract assignment group name
+			if groupData, ok := row["assignment_group"]; ok {
+				// when there is data- its a map, else its a string[assignment_group]. Checking on data availability
+				if reflect.TypeOf(groupData).Kind() == reflect.Map {
+					assignGroupName, err := m.extractGroupName(ctxInner, groupData)
+					if err != nil {
+						span.AddError(err)
+					} else {
+						assignmentGroups = append(assignmentGroups, assignGroupName)
 					}
 				}
+			}
 
-				//extract support group name
-				if groupData, ok := row["support_group"]; ok {
-					// when there is data its a map, else its a string[support_group]. Checking on data availability
-					if reflect.TypeOf(groupData).Kind() == reflect.Map {
-						supportGroupName, err := m.extractGroupName(ctxInner, groupData)
-						if err != nil {
-							span.AddError(err)
-						} else {
-							supportGroups = append(supportGroups, supportGroupName)
-						}
+			//extract support group name
+			if groupData, ok := row["support_group"]; ok {
+				// when there is data its a map, else its a string[support_group]. Checking on data availability
+				if reflect.TypeOf(groupData).Kind() == reflect.Map {
+					supportGroupName, err := m.extractGroupName(ctxInner, groupData)
+					if err != nil {
+						span.AddError(err)
+					} else {
+						supportGroups = append(supportGroups, supportGroupName)
 					}
 				}
 			}
+		}
 
-			// Assign the groups back to return data
-			cmdbLock.Lock()
-			cmdbResults[ioc] = &HostNameCMDBData{
-				AssignmentGroup: assignmentGroups,
-				SupportGroup:    supportGroups,
-			}
-			cmdbLock.Unlock()
+		// The rows are closed when the scan is done
+		if err := <-scanErr; err != nil {
+			span.AddError(err)
+			return nil, err
+		}
 
-		}(ioc)
-		span.End(spanCtx)
+		// Assign the groups back to return data
+		return &HostNameCMDBData{
+			AssignmentGroup: assignmentGroups,
+			SupportGroup:    supportGroups,
+		}, nil
+	})
+	for _, result := range results {
+		// Out of time, return what we have so far
+		if result.Skipped {
+			continue
+		}
+		cmdbResults[result.IOC], _ = result.Value.(*HostNameCMDBData)
 	}
-	wg.Wait()
 
 	return cmdbResults, nil
 }
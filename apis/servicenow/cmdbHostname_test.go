@@ -4,6 +4,8 @@ import (
 	"context"
 	"testing"
 
+	servicenow "github.com/gdcorp-infosec/threat-api/apis/servicenow/servicenowLibrary"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/cassette"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
 )
@@ -14,6 +16,12 @@ func TestGetCMDBData(t *testing.T) {
 	tb = toolbox.GetToolbox()
 	defer tb.Close(ctx)
 
+	client, err := servicenow.New("https://servicenow.example.com", "test-user", "test-password", "cmdb_ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.HTTPClient = cassette.Wrap(t, "cmdbData", nil)
+
 	var triageRequests []*triage.Request
 	triageRequests = append(triageRequests, &triage.Request{
 		IOCs:     []string{"github-actions.cloud.phx3.gdg"},
@@ -21,7 +29,7 @@ func TestGetCMDBData(t *testing.T) {
 	})
 
 	for _, triageRequest := range triageRequests {
-		triageModule := TriageModule{}
+		triageModule := TriageModule{SNClient: client}
 		triageResult, err := triageModule.Triage(ctx, triageRequest)
 		if err != nil {
 			t.Fatal(err)
@@ -6,13 +6,15 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
-	"sync"
+	"strconv"
+
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
 )
 
 const (
 	// Limit of results to get per snow page, default snow is 10000
 	limitPerPage = 1000
-	// Limit of concurrent threads making requests
+	// Limit of concurrent threads making requests, and of pages fetched at a time
 	maxThreads = 10
 )
 
@@ -38,109 +40,86 @@ func (c *Client) GetURLOfRow(r Row) (string, error) {
 // additionalURLValues are additional parameters to send in the GET request for each page.  See this: https://developer.servicenow.com/dev.do#!/reference/api/orlando/rest/c_TableAPI.
 // The query is an optional SNOW encoded query. To find a SNOW encoded query, right click the desired query/filter in SNOW and press "copy Query".
 func (c *Client) GetRows(ctx context.Context, query string, additionalURLValues url.Values, rows chan Row) error {
-	// This function spawns multiple threads limited by maxThreads.
-	// Each thread will fetch a SNOW page and send any results to the returned channel.
-	// Since we don't know the total number of pages, once a single thread finds gets a 404
-	// it singles to the spawner thread to stop creating threads, wait on all the others to finish, then be done.
-
-	// Setup
-	page := 0
-	// Channel to limit our thread count
-	threadLimit := make(chan int, maxThreads)
-	// Channel to mark when we don't need to keep looking at the next pages
-	noMorePages := make(chan error, 1)
-	wg := sync.WaitGroup{}
 	defer close(rows)
-	defer close(threadLimit)
-	defer close(noMorePages)
-
-	// markDone is used to tell the spawner to stop spawning threads, and if we had an error
-	markDone := func(threadErr error) {
-		select {
-		// Set the err to this thread's error
-		case noMorePages <- threadErr:
-		default:
-		}
-	}
 
-	// Keep making threads to crawl pages until we find one request that returns a non 200 code
-	for {
-		// Start new thread to make a request, and send results
-		select {
-		case threadLimit <- 1: // Wait for thread to be available
-		case err := <-noMorePages: // Check if we no longer need to spawn pages
-			// wait for current threads to finish
-			wg.Wait()
-			return err
-		case <-ctx.Done(): // Context cancelled
-			wg.Wait()
-			return ctx.Err()
+	// Since we don't know the total number of pages, they are fetched maxThreads at a time
+	// until one of them gets a 404
+	for page := 0; ; page += maxThreads {
+		pages := []string{}
+		for i := page; i < page+maxThreads; i++ {
+			pages = append(pages, strconv.Itoa(i))
 		}
+		results := toolbox.FanOut(ctx, pages, toolbox.FanOutOptions{MaxConcurrency: maxThreads}, func(ctx context.Context, page string) (interface{}, error) {
+			pageNumber, err := strconv.Atoi(page)
+			if err != nil {
+				return false, err
+			}
+			return c.getPage(ctx, pageNumber, query, additionalURLValues, rows)
+		})
 
-		// Spawn thread
-		wg.Add(1)
-		go func(page int) {
-			defer func() { <-threadLimit }() // Mark a thread available
-			defer wg.Done()
-
-			// Build URL
-			params := url.Values{}
-			params.Add("sysparm_limit", fmt.Sprintf("%d", limitPerPage))
-			params.Add("sysparm_offset", fmt.Sprintf("%d", page*limitPerPage))
-			if query != "" {
-				params.Add("sysparm_query", fmt.Sprintf("%s", query))
+		// The pages after the first missing one are missing too
+		for _, result := range results {
+			if result.Err != nil {
+				return result.Err
 			}
-			// Add additional values
-			for key, values := range additionalURLValues {
-				for _, value := range values {
-					params.Add(key, value)
-				}
+			if found, _ := result.Value.(bool); !found {
+				return nil
 			}
-			url := fmt.Sprintf("%s?%s", c.tableURL, params.Encode())
+		}
+	}
+}
 
-			// Make request
-			resp, err := c.HttpRequest(ctx, http.MethodGet, url, nil, "")
-			if err != nil {
-				markDone(err)
-				return
-			}
+// getPage gets a page of rows and sends them to the rows channel, it returns false if there is no such page
+func (c *Client) getPage(ctx context.Context, page int, query string, additionalURLValues url.Values, rows chan Row) (bool, error) {
+	// Build URL
+	params := url.Values{}
+	params.Add("sysparm_limit", fmt.Sprintf("%d", limitPerPage))
+	params.Add("sysparm_offset", fmt.Sprintf("%d", page*limitPerPage))
+	if query != "" {
+		params.Add("sysparm_query", fmt.Sprintf("%s", query))
+	}
+	// Add additional values
+	for key, values := range additionalURLValues {
+		for _, value := range values {
+			params.Add(key, value)
+		}
+	}
+	url := fmt.Sprintf("%s?%s", c.tableURL, params.Encode())
 
-			// Check if we are done
-			switch resp.StatusCode {
-			case 200:
-			case 404:
-				// Done reading pages
-				markDone(nil)
-				return
-			default:
-				// Bad status code
-				markDone(fmt.Errorf("bad status code: %d", resp.StatusCode))
-				return
-			}
+	// Make request
+	resp, err := c.HttpRequest(ctx, http.MethodGet, url, nil, "")
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
 
-			// Parse
-			results := RowsResponse{}
-			decoder := json.NewDecoder(resp.Body)
-			err = decoder.Decode(&results)
-			resp.Body.Close()
-			if err != nil {
-				markDone(err)
-				return
-			}
+	// Check if we are done
+	switch resp.StatusCode {
+	case 200:
+	case 404:
+		// Done reading pages
+		return false, nil
+	default:
+		// Bad status code
+		return false, fmt.Errorf("bad status code: %d", resp.StatusCode)
+	}
 
-			// Send results
-			for _, entry := range results.Result {
-				select {
-				case rows <- Row(entry):
-				case <-ctx.Done():
-					markDone(ctx.Err())
-					return
-				}
-			}
-		}(page)
+	// Parse
+	results := RowsResponse{}
+	err = json.NewDecoder(resp.Body).Decode(&results)
+	if err != nil {
+		return false, err
+	}
 
-		page++
+	// Send results
+	for _, entry := range results.Result {
+		select {
+		case rows <- Row(entry):
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
 	}
+	return true, nil
 }
 
 // GetUnique is a simpler version of GetRows, works on cases where a single unique row is returned for a sysID as opposed to entire table rows returned in GetRows()
@@ -24,6 +24,8 @@ type Config struct {
 	URL      string
 	Username string
 	Password string
+	// The client requests are sent with, defaults to http.DefaultClient
+	HTTPClient *http.Client
 }
 
 // Client is a service now client for a specific servicenow table
@@ -123,5 +125,9 @@ func (c *Client) HttpRequest(ctx context.Context, method, url string, body io.Re
 	}
 	req.SetBasicAuth(c.Username, c.Password)
 
-	return http.DefaultClient.Do(req)
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
 }
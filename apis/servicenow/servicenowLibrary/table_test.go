@@ -1,5 +1,3 @@
-// +build !runTests
-
 package servicenowLibrary
 
 import (
@@ -9,7 +7,7 @@ import (
 )
 
 func TestGetRows(t *testing.T) {
-	c, err := testingClient()
+	c, err := testingClient(t, "getRows")
 	if err != nil {
 		t.Error(err)
 	}
@@ -10,6 +10,7 @@ import (
 	"net/url"
 	"reflect"
 	"regexp"
+	"sync"
 	"testing"
 
 	. "github.com/agiledragon/gomonkey/v2"
@@ -44,7 +45,11 @@ func TestGetRows(t *testing.T) {
 			Body:       ServiceNowResponseBody,
 		}
 
+		// The pages are requested concurrently
+		mutex := sync.Mutex{}
 		patches = append(patches, ApplyMethod(reflect.TypeOf(SNClient), "HttpRequest", func(client *sn.Client, ctx context.Context, method, url string, body io.Reader, contentType string) (*http.Response, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
 			actualURL = url
 			requestMethod = method
 			actualContentType = contentType
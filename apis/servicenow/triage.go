@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	servicenow "github.com/gdcorp-infosec/threat-api/apis/servicenow/servicenowLibrary"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
@@ -16,6 +17,11 @@ const (
 	triageModuleName = "servicenow"
 )
 
+// vendorClientOptions of ServiceNow, attachments are uploaded in a single request
+var vendorClientOptions = toolbox.VendorClientOptions{
+	Timeout: time.Minute * 2,
+}
+
 // TriageModule triage module
 type TriageModule struct {
 	SNClient *servicenow.Client
@@ -41,25 +47,26 @@ func (m *TriageModule) Triage(ctx context.Context, triageRequest *triage.Request
 	tb = toolbox.GetToolbox()
 	defer tb.Close(ctx)
 
-	secret, err := tb.GetFromCredentialsStore(ctx, secretID, nil)
-	if err != nil {
-		triageCMDBData.Data = fmt.Sprintf("error in retrieving secrets: %s", err)
-		return []*triage.Data{triageCMDBData}, err
-	}
+	// Setting the tableName for CMDB and other credentials to the client, unless the module was given one
+	if m.SNClient == nil {
+		secret, err := tb.GetFromCredentialsStore(ctx, secretID, nil)
+		if err != nil {
+			triageCMDBData.Data = fmt.Sprintf("error in retrieving secrets: %s", err)
+			return []*triage.Data{triageCMDBData}, err
+		}
 
-	secretMap := map[string]string{}
-	if err := json.Unmarshal([]byte(*secret.SecretString), &secretMap); err != nil {
-		triageCMDBData.Data = fmt.Sprintf("error in unmarshaling secrets: %s", err)
-		return []*triage.Data{triageCMDBData}, err
-	}
+		secretMap := map[string]string{}
+		if err := json.Unmarshal([]byte(*secret.SecretString), &secretMap); err != nil {
+			triageCMDBData.Data = fmt.Sprintf("error in unmarshaling secrets: %s", err)
+			return []*triage.Data{triageCMDBData}, err
+		}
 
-	// Setting the tableName for CMDB and other credentials to the client
-	if m.SNClient == nil {
 		m.SNClient, err = servicenow.New(secretMap["url"], secretMap["username"], secretMap["password"], "cmdb_ci")
 		if err != nil {
 			triageCMDBData.Data = fmt.Sprintf("error in creating the clients: %s", err)
 			return []*triage.Data{triageCMDBData}, err
 		}
+		m.SNClient.HTTPClient = tb.GetVendorHTTPClient(triageModuleName, vendorClientOptions)
 	}
 
 	var span *appsectracing.Span
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+
+	servicenow "github.com/gdcorp-infosec/threat-api/apis/servicenow/servicenowLibrary"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/cassette"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage/triagetest"
+)
+
+// The hostname of the recorded CMDB lookup
+func TestConformance(t *testing.T) {
+	client, err := servicenow.New("https://servicenow.example.com", "test-user", "test-password", "cmdb_ci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.HTTPClient = cassette.Wrap(t, "cmdbData", nil)
+
+	module := &TriageModule{SNClient: client}
+	triagetest.RunConformance(t, module, triagetest.Options{
+		IOCs: map[triage.IOCType][]string{triage.GoDaddyHostnameType: {"github-actions.cloud.phx3.gdg"}},
+	})
+}
@@ -23,11 +23,9 @@ func (m *TriageModule) GetServicesForIPs(ctx context.Context, ips map[string]*ne
 
 	// Enrich all ips
 	for domain, ip := range ips {
-		// Check context
-		select {
-		case <-ctx.Done():
-			break
-		default:
+		// Out of time, return what we have so far
+		if ctx.Err() != nil {
+			return hosts
 		}
 
 		host, err := m.shodanClient.GetServicesForHost(ctx, ip.String(), &shodan.HostServicesOptions{})
@@ -6,12 +6,13 @@ import (
 
 	. "github.com/agiledragon/gomonkey/v2"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
-func TestDumpCSV(t *testing.T) {
+func TestHostRecords(t *testing.T) {
 
-	Convey("dumpCSV", t, func() {
+	Convey("hostRecords", t, func() {
 		tb = toolbox.GetToolbox()
 		// setup stubs\mocks
 		patches := []*Patches{}
@@ -23,7 +24,7 @@ func TestDumpCSV(t *testing.T) {
 			}
 		})
 
-		Convey("should dump proper CSV output ", func() {
+		Convey("should render the same CSV as before records", func() {
 
 			// mock host 1
 			ShodanHost1 := Host{}
@@ -68,7 +69,7 @@ func TestDumpCSV(t *testing.T) {
 
 			expectedCSV := "Domain,IP,ASN,City,Country,ISP,OS,Hostnames,Vulnerabilities,LastUpdate,Ports\ntest domain,23.129.64.142,AS396507,,,Emerald Onion,,hostname1,some vuln,2022-03-24T20:17:22.865113,80 443\ntest ip 85.108.57.156,85.108.57.156,AS901402,,,Mock ISP,,hostname1 hostname2,mock vuln1 mock vuln2,2022-03-24T20:17:22.865113,80 443 8080 6800 7000\n"
 
-			actualCSV := dumpCSV(ShodanHosts)
+			actualCSV := triage.RecordsToCSV(hostSchema, hostRecords(ShodanHosts))
 
 			So(actualCSV, ShouldResemble, expectedCSV)
 		})
@@ -1,5 +1,3 @@
-// +build !runTests
-
 package main
 
 import (
@@ -7,6 +5,7 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/cassette"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
 )
@@ -27,8 +26,10 @@ func TestGetServicesForIPs(t *testing.T) {
 		IOCsType: triage.DomainType,
 	})
 
+	// The IPs are looked up in the recorded Shodan responses
+	client := cassette.Wrap(t, "triage", nil)
 	for _, triageRequest := range triageRequests {
-		triageModule := TriageModule{}
+		triageModule := TriageModule{ShodanKey: "test-key", ShodanClient: client}
 		triageResult, err := triageModule.Triage(ctx, triageRequest)
 		if err != nil {
 			t.Fatal(err)
@@ -37,6 +38,11 @@ func TestGetServicesForIPs(t *testing.T) {
 		if len(triageResult) == 0 {
 			t.Fatal("len 0")
 		}
+		if len(triageResult[0].Records) != 2 {
+			t.Fatalf("expected 2 hosts, got %d", len(triageResult[0].Records))
+		}
+		// The connector renders the records as CSV
+		triageResult[0].RenderCSV()
 		if triageResult[0].Data == "" {
 			t.Fatal("first data element empty ")
 		}
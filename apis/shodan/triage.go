@@ -1,14 +1,14 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"net"
+	"net/http"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox/appsectracing"
@@ -20,9 +20,15 @@ const (
 	secretID = "/ThreatTools/Integrations/shodan"
 )
 
+// vendorClientOptions of Shodan, which allows 1 request a second
+var vendorClientOptions = toolbox.VendorClientOptions{
+	Backoff: time.Second,
+}
+
 // TriageModule triage module
 type TriageModule struct {
 	ShodanKey    string
+	ShodanClient *http.Client
 	shodanClient *shodan.Client
 }
 
@@ -46,14 +52,19 @@ func (m *TriageModule) Triage(ctx context.Context, triageRequest *triage.Request
 	tb = toolbox.GetToolbox()
 	defer tb.Close(ctx)
 
-	secret, err := tb.GetFromCredentialsStore(ctx, secretID, nil)
-	if err != nil {
-		triageData.Data = fmt.Sprintf("error in retrieving secrets: %s", err)
-		return []*triage.Data{triageData}, err
+	if m.ShodanKey == "" {
+		secret, err := tb.GetFromCredentialsStore(ctx, secretID, nil)
+		if err != nil {
+			triageData.Data = fmt.Sprintf("error in retrieving secrets: %s", err)
+			return []*triage.Data{triageData}, err
+		}
+		m.ShodanKey = *secret.SecretString
 	}
-	m.ShodanKey = *secret.SecretString
 	if m.shodanClient == nil {
-		m.shodanClient = shodan.NewClient(nil, m.ShodanKey)
+		if m.ShodanClient == nil {
+			m.ShodanClient = tb.GetVendorHTTPClient(triageModuleName, vendorClientOptions)
+		}
+		m.shodanClient = shodan.NewClient(m.ShodanClient, m.ShodanKey)
 	}
 
 	// Map of domain name to IP (if we are working with domains (not ips), we should track the domain name for the output)
@@ -105,6 +116,9 @@ func (m *TriageModule) Triage(ctx context.Context, triageRequest *triage.Request
 
 	triageData.Metadata = append(triageData.Metadata, fmt.Sprintf("These %ss are located in: %s", triageRequest.IOCsType, strings.Join(geolocations, ", ")))
 
+	triageData.Schema = hostSchema
+	triageData.Records = hostRecords(shodanhosts)
+
 	// Dump full data if we are doing full dump
 	if triageRequest.Verbose {
 		result, err := json.Marshal(shodanhosts)
@@ -117,47 +131,46 @@ func (m *TriageModule) Triage(ctx context.Context, triageRequest *triage.Request
 		return []*triage.Data{triageData}, nil
 	}
 
-	triageData.DataType = triage.CSVType
-	triageData.Data = dumpCSV(shodanhosts)
-
 	return []*triage.Data{triageData}, nil
 }
 
-func dumpCSV(shodanhosts []*Host) string {
-	//Dump data as csv
-	resp := bytes.Buffer{}
-	csv := csv.NewWriter(&resp)
-	// Write headers
-	csv.Write([]string{
-		"Domain",
-		"IP",
-		"ASN",
-		"City",
-		"Country",
-		"ISP",
-		"OS",
-		"Hostnames",
-		"Vulnerabilities",
-		"LastUpdate",
-		"Ports",
-	})
+// hostSchema describes the records of the hosts
+var hostSchema = &triage.Schema{
+	Name:      "shodan.host",
+	IOCColumn: "Domain",
+	Attributes: []triage.Attribute{
+		{Name: "IP", Type: triage.StringAttribute},
+		{Name: "ASN", Type: triage.StringAttribute},
+		{Name: "City", Type: triage.StringAttribute},
+		{Name: "Country", Type: triage.StringAttribute},
+		{Name: "ISP", Type: triage.StringAttribute},
+		{Name: "OS", Type: triage.StringAttribute},
+		{Name: "Hostnames", Type: triage.ListAttribute},
+		{Name: "Vulnerabilities", Type: triage.ListAttribute, Description: "CVEs the host may be vulnerable to"},
+		{Name: "LastUpdate", Type: triage.DateTimeAttribute},
+		{Name: "Ports", Type: triage.ListAttribute},
+	},
+}
+
+// hostRecords converts the hosts to records of the domain or IP they were found for
+func hostRecords(shodanhosts []*Host) []triage.Record {
+	records := []triage.Record{}
 	for _, host := range shodanhosts {
-		cols := []string{
-			host.Domain,
-			host.ShodanHost.IP.String(),
-			host.ShodanHost.ASN,
-			host.ShodanHost.City,
-			host.ShodanHost.Country,
-			host.ShodanHost.ISP,
-			host.ShodanHost.OS,
-			strings.Join(host.ShodanHost.Hostnames, " "),
-			strings.Join(host.ShodanHost.Vulnerabilities, " "),
-			host.ShodanHost.LastUpdate,
-			strings.Trim(strings.Join(strings.Split(fmt.Sprint(host.ShodanHost.Ports), " "), " "), "[]"),
-		}
-		csv.Write(cols)
+		records = append(records, triage.Record{
+			IOC: host.Domain,
+			Attributes: map[string]interface{}{
+				"IP":              host.ShodanHost.IP.String(),
+				"ASN":             host.ShodanHost.ASN,
+				"City":            host.ShodanHost.City,
+				"Country":         host.ShodanHost.Country,
+				"ISP":             host.ShodanHost.ISP,
+				"OS":              host.ShodanHost.OS,
+				"Hostnames":       host.ShodanHost.Hostnames,
+				"Vulnerabilities": host.ShodanHost.Vulnerabilities,
+				"LastUpdate":      host.ShodanHost.LastUpdate,
+				"Ports":           host.ShodanHost.Ports,
+			},
+		})
 	}
-	csv.Flush()
-
-	return resp.String()
+	return records
 }
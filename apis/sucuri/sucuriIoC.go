@@ -4,11 +4,12 @@ import (
 	"bytes"
 	"context"
 	"encoding/csv"
+	"sort"
 	"strconv"
 
-	"sync"
 
 	sucuri "github.com/gdcorp-infosec/threat-api/apis/sucuri/sucuriLibrary"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
 )
 
@@ -16,51 +17,39 @@ const (
 	maxThreadCount = 5
 )
 
+// ratingToBadness converts the single-letter ratings into a badness score
+var ratingToBadness = map[string]float64{
+	"A": 0.00,
+	"B": 0.11,
+	"C": 0.50,
+	"D": 0.89,
+	"E": 1.00,
+}
+
 // GetSucuriData returns data from Sucuri
 func (m *TriageModule) GetSucuriData(ctx context.Context, triageRequest *triage.Request) (map[string]*sucuri.SucuriReport, error) {
 
 	sucuriResults := make(map[string]*sucuri.SucuriReport)
 
-	wg := sync.WaitGroup{}
-	sucuriLock := sync.Mutex{}
-	threadLimit := make(chan int, maxThreadCount)
-
-	for _, ioc := range triageRequest.IOCs {
-		// Check context
-		select {
-		case <-ctx.Done():
-			break
-		case threadLimit <- 1:
-			wg.Add(1)
-		default:
-		}
-
+	results := toolbox.FanOut(ctx, triageRequest.IOCs, toolbox.FanOutOptions{MaxConcurrency: maxThreadCount}, func(ctx context.Context, ioc string) (interface{}, error) {
 		// Assign operationNAme, operationType, operationSubtype, operationAction properly by the naming standards of Elastic APM
 		span, spanCtx := tb.TracerLogger.StartSpan(ctx, "SucuriLookup", "sucuri", "", "sucuriIoCLookup")
+		defer span.End(spanCtx)
 
-		go func(ioc string) {
-			defer func() {
-				<-threadLimit
-				wg.Done()
-			}()
-
-			sucuriResult, err := sucuri.GetSucuri(ctx, ioc, m.SucuriClient)
-			if err != nil {
-				span.AddError(err)
-				sucuriLock.Lock()
-				sucuriResults[ioc] = nil
-				sucuriLock.Unlock()
-				return
-			}
-
-			sucuriLock.Lock()
-			sucuriResults[ioc] = sucuriResult
-			sucuriLock.Unlock()
-		}(ioc)
-		span.End(spanCtx)
+		sucuriResult, err := sucuri.GetSucuri(ctx, ioc, m.SucuriClient)
+		if err != nil {
+			span.AddError(err)
+			return nil, err
+		}
+		return sucuriResult, nil
+	})
+	for _, result := range results {
+		// Out of time, return what we have so far
+		if result.Skipped {
+			continue
+		}
+		sucuriResults[result.IOC], _ = result.Value.(*sucuri.SucuriReport)
 	}
-
-	wg.Wait()
 	return sucuriResults, nil
 }
 
@@ -91,14 +80,6 @@ func dumpCSV(sucuriResults map[string]*sucuri.SucuriReport) string {
 		"D": "High",
 		"E": "Critical",
 	}
-	ratingToBadness := map[string]float64{
-		"A": 0.00,
-		"B": 0.11,
-		"C": 0.50,
-		"D": 0.89,
-		"E": 1.00,
-	}
-
 	for ioc, data := range sucuriResults {
 		if data == nil {
 			continue
@@ -121,7 +102,7 @@ func dumpCSV(sucuriResults map[string]*sucuri.SucuriReport) string {
 		totalscore := ratingToLongForm[data.Ratings.Total.Rating]
 		secrating := ratingToLongForm[data.Ratings.Security.Rating]
 		domrating := ratingToLongForm[data.Ratings.Domain.Rating]
-		badness := (ratingToBadness[data.Ratings.Security.Rating] + ratingToBadness[data.Ratings.Domain.Rating]) / 2.0
+		badness, _ := getBadness(data)
 
 		cols := []string{
 			ioc,
@@ -143,3 +124,44 @@ func dumpCSV(sucuriResults map[string]*sucuri.SucuriReport) string {
 
 	return resp.String()
 }
+
+// getBadness returns the badness of a domain from its security and domain ratings,
+// and how many of the two ratings Sucuri gave
+func getBadness(data *sucuri.SucuriReport) (float64, int) {
+	badness := 0.0
+	ratings := 0
+	for _, rating := range []string{data.Ratings.Security.Rating, data.Ratings.Domain.Rating} {
+		if ratingBadness, ok := ratingToBadness[rating]; ok {
+			badness += ratingBadness
+			ratings++
+		}
+	}
+	return badness / 2.0, ratings
+}
+
+// getScores normalizes the badness of the domains Sucuri rated
+func getScores(sucuriResults map[string]*sucuri.SucuriReport) []triage.Score {
+	domains := make([]string, 0, len(sucuriResults))
+	for domain := range sucuriResults {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+
+	var scores []triage.Score
+	for _, domain := range domains {
+		data := sucuriResults[domain]
+		if data == nil {
+			continue
+		}
+		badness, ratings := getBadness(data)
+		if ratings == 0 {
+			continue
+		}
+		// A missing rating counts as no badness, so trust the score less
+		score, ok := triage.NewScore(domain, badness, 1, "Badness", float64(ratings)/2.0)
+		if ok {
+			scores = append(scores, score)
+		}
+	}
+	return scores
+}
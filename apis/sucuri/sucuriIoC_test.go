@@ -2,8 +2,10 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"testing"
 
+	sucuri "github.com/gdcorp-infosec/threat-api/apis/sucuri/sucuriLibrary"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
 )
@@ -36,3 +38,31 @@ func TestSucuri(t *testing.T) {
 
 	}
 }
+
+func TestGetScores(t *testing.T) {
+	rated := &sucuri.SucuriReport{}
+	if err := json.Unmarshal([]byte(`{"ratings":{"security":{"rating":"E"},"domain":{"rating":"C"}}}`), rated); err != nil {
+		t.Fatal(err)
+	}
+	halfRated := &sucuri.SucuriReport{}
+	if err := json.Unmarshal([]byte(`{"ratings":{"security":{"rating":"D"}}}`), halfRated); err != nil {
+		t.Fatal(err)
+	}
+
+	scores := getScores(map[string]*sucuri.SucuriReport{
+		"rated.com":     rated,
+		"halfrated.com": halfRated,
+		"unrated.com":   {},
+		"missing.com":   nil,
+	})
+
+	if len(scores) != 2 {
+		t.Fatalf("expected 2 scores, got %d", len(scores))
+	}
+	if scores[0].IOC != "halfrated.com" || scores[0].Score != 44.5 || scores[0].Confidence != 0.5 {
+		t.Fatalf("unexpected score %+v", scores[0])
+	}
+	if scores[1].IOC != "rated.com" || scores[1].Score != 75 || scores[1].Confidence != 1 {
+		t.Fatalf("unexpected score %+v", scores[1])
+	}
+}
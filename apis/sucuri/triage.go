@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox/appsectracing"
@@ -14,6 +15,11 @@ const (
 	triageModuleName = "sucuri"
 )
 
+// vendorClientOptions of Sucuri, site checks scan the site as they are looked up
+var vendorClientOptions = toolbox.VendorClientOptions{
+	Timeout: time.Minute,
+}
+
 // TriageModule triage module
 type TriageModule struct {
 	SucuriClient *http.Client
@@ -41,7 +47,7 @@ func (m *TriageModule) Triage(ctx context.Context, triageRequest *triage.Request
 
 
 	if m.SucuriClient == nil {
-		m.SucuriClient = http.DefaultClient
+		m.SucuriClient = tb.GetVendorHTTPClient(triageModuleName, vendorClientOptions)
 	}
 
 
@@ -52,13 +58,14 @@ func (m *TriageModule) Triage(ctx context.Context, triageRequest *triage.Request
 	//Get the example data that service offers
 	SucuriResults, err := m.GetSucuriData(ctx, triageRequest)
 	if err != nil {
-		triageSucuriData.Data = fmt.Sprintf("error from Sucuri: %s", err)
-	} else {
-		//Dump data as csv
-		triageSucuriData.DataType = triage.CSVType
-		triageSucuriData.Data = dumpCSV(SucuriResults)
+		return nil, fmt.Errorf("error from Sucuri: %w", err)
 	}
 
+	//Dump data as csv
+	triageSucuriData.DataType = triage.CSVType
+	triageSucuriData.Data = dumpCSV(SucuriResults)
+	triageSucuriData.Scores = getScores(SucuriResults)
+
 
 	return []*triage.Data{triageSucuriData}, nil
 }
@@ -0,0 +1,13 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/cassette"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage/triagetest"
+)
+
+func TestConformance(t *testing.T) {
+	module := &TriageModule{SucuriClient: cassette.Wrap(t, "conformance", nil)}
+	triagetest.RunConformance(t, module, triagetest.Options{})
+}
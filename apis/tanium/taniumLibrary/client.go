@@ -29,22 +29,24 @@ type TaniumClient struct {
 	config *Config
 }
 
+// NewTransport creates a transport for the requests to Tanium hosts, which have self-signed certificates
+func NewTransport() *http.Transport {
+	return &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+}
+
 // NewTaniumClient creates a new *TaniumClient that is authenticated to the provided Tanium host using the provided credentials.
+// The requests are sent with the provided HTTP client, which must use a transport like NewTransport, or with a client of its own if nil.
 //
 // The returned *TaniumClient should be used for interactions with the Tanium API, unless any errors have been returned
-func NewTaniumClient(ctx context.Context, host string) (*TaniumClient, error) {
-	var configCopy Config
+func NewTaniumClient(ctx context.Context, host string, httpClient *http.Client) (*TaniumClient, error) {
 	c := &TaniumClient{
-		config: &configCopy,
-	}
-
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		config: &Config{HTTPClient: httpClient},
 	}
 
 	if c.config.HTTPClient == nil {
-		client := &http.Client{Transport: tr}
-		c.config.HTTPClient = client
+		c.config.HTTPClient = &http.Client{Transport: NewTransport()}
 	}
 
 	c.config.baseURL = strings.Trim(host, "/") + fmt.Sprintf("/api/v%d", APIVersion)
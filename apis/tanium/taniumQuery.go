@@ -7,9 +7,9 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
-	"sync"
 
 	tn "github.com/gdcorp-infosec/threat-api/apis/tanium/taniumLibrary"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
 )
 
@@ -69,47 +69,24 @@ func (m *TriageModule) SubmitTaniumQuestion(ctx context.Context, triageRequest *
 	var taniumErr error
 	taniumResults := make(map[string]chan tn.Row)
 
-	wg := sync.WaitGroup{}
-	taniumLock := sync.Mutex{}
-	threadLimit := make(chan int, maxThreadCount)
-
-	for _, ioc := range triageRequest.IOCs {
-		// Check context
-		select {
-		case <-ctx.Done():
-			break
-		case threadLimit <- 1:
-			wg.Add(1)
-		default:
-		}
-
+	results := toolbox.FanOut(ctx, triageRequest.IOCs, toolbox.FanOutOptions{MaxConcurrency: maxThreadCount}, func(ctx context.Context, ioc string) (interface{}, error) {
 		span, spanCtx := tb.TracerLogger.StartSpan(ctx, "TaniumIoCLookup", "tanium", "", "taniumIoCLookup")
-
-		go func(ioc string) {
-			defer func() {
-				<-threadLimit
-				wg.Done()
-			}()
-			_, taniumResult, err := m.performTaniumSearch(ctx, ioc, triageRequest.IOCsType)
-			if err != nil {
-				taniumErr = err
-				// span.AddError(err)
-				taniumLock.Lock()
-				taniumResults[ioc] = nil
-				taniumLock.Unlock()
-				return
-			}
-
-			taniumLock.Lock()
-			taniumResults[ioc] = taniumResult
-			taniumLock.Unlock()
-			return
-		}(ioc)
-		span.End(spanCtx)
+		defer span.End(spanCtx)
+
+		_, taniumResult, err := m.performTaniumSearch(ctx, ioc, triageRequest.IOCsType)
+		return taniumResult, err
+	})
+	for _, result := range results {
+		// Out of time, return what we have so far
+		if result.Skipped {
+			continue
+		}
+		if result.Err != nil {
+			taniumErr = result.Err
+		}
+		taniumResults[result.IOC], _ = result.Value.(chan tn.Row)
 	}
 
-	wg.Wait()
-
 	triageTaniumData := postProcessing(taniumResults, triageRequest.IOCsType)
 
 	if taniumErr != nil {
@@ -139,7 +116,7 @@ func (m *TriageModule) performTaniumSearch(ctx context.Context, ioc string, iocT
 		return nil, nil, fmt.Errorf("Current IOC Type %s is not supported", iocType)
 	}
 
-	c, err := tn.NewTaniumClient(ctx, host)
+	c, err := tn.NewTaniumClient(ctx, host, m.TaniumClient)
 
 	parsable, err := c.CanParse(ctx, questionString)
 	if err != nil {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/http"
 
+	tn "github.com/gdcorp-infosec/threat-api/apis/tanium/taniumLibrary"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox/appsectracing"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
@@ -14,6 +15,11 @@ const (
 	triageModuleName = "tanium"
 )
 
+// vendorClientOptions of Tanium, whose hosts have self-signed certificates
+var vendorClientOptions = toolbox.VendorClientOptions{
+	Transport: tn.NewTransport(),
+}
+
 // TriageModule triage module
 type TriageModule struct {
 	TaniumClient *http.Client
@@ -41,7 +47,7 @@ func (m *TriageModule) Triage(ctx context.Context, triageRequest *triage.Request
 	defer span.End(ctx)
 
 	if m.TaniumClient == nil {
-		m.TaniumClient = http.DefaultClient
+		m.TaniumClient = tb.GetVendorHTTPClient(triageModuleName, vendorClientOptions)
 	}
 
 	var err error
@@ -1,10 +1,10 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/csv"
 	"fmt"
+	"math"
+	"net/http"
 
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
@@ -16,6 +16,7 @@ const (
 
 // Triage module
 type TriageModule struct {
+	UrlhausClient *http.Client
 }
 
 // GetDocs of this module
@@ -51,155 +52,193 @@ func (m *TriageModule) Triage(ctx context.Context, triageRequest *triage.Request
 	triageData := &triage.Data{
 		Title:    "URLhaus",
 		Metadata: []string{},
+		Records:  []triage.Record{},
+	}
+
+	if m.UrlhausClient == nil {
+		m.UrlhausClient = tb.GetVendorHTTPClient(triageModuleName, vendorClientOptions)
 	}
 
 	switch triageRequest.IOCsType {
 	case triage.MD5Type:
 		triageData.Title = "Malicious URLs hosting this MD5 hash (URLhaus)"
-		entries := make([]*UrlhausPayloadEntry, len(triageRequest.IOCs))
-		for i, ioc := range triageRequest.IOCs {
-			entry, err := GetMd5(ctx, ioc)
+		triageData.Schema = payloadSchema
+		for _, ioc := range triageRequest.IOCs {
+			entry, err := GetMd5(ctx, ioc, m.UrlhausClient)
 			if err != nil {
 				fmt.Println(err)
 				continue
 			}
-			entries[i] = entry
+			triageData.Records = append(triageData.Records, PayloadRecord(ioc, entry))
+			triageData.Scores = appendScore(triageData.Scores, ioc, entry)
 		}
-		triageData.Data = HashesToCsv(entries)
 	case triage.SHA256Type:
 		triageData.Title = "Malicious URLs hosting this SHA256 hash (URLhaus)"
-		entries := make([]*UrlhausPayloadEntry, len(triageRequest.IOCs))
-		for i, ioc := range triageRequest.IOCs {
-			entry, err := GetSha256(ctx, ioc)
+		triageData.Schema = payloadSchema
+		for _, ioc := range triageRequest.IOCs {
+			entry, err := GetSha256(ctx, ioc, m.UrlhausClient)
 			if err != nil {
 				fmt.Println(err)
 				continue
 			}
-			entries[i] = entry
+			triageData.Records = append(triageData.Records, PayloadRecord(ioc, entry))
+			triageData.Scores = appendScore(triageData.Scores, ioc, entry)
 		}
-		triageData.Data = HashesToCsv(entries)
 	case triage.DomainType, triage.IPType:
 		triageData.Title = "Information about this host (URLhaus)"
-		entries := make([]*UrlhausHostEntry, len(triageRequest.IOCs))
-		for i, ioc := range triageRequest.IOCs {
-			entry, err := GetDomainOrIp(ctx, ioc)
+		triageData.Schema = hostSchema
+		for _, ioc := range triageRequest.IOCs {
+			entry, err := GetDomainOrIp(ctx, ioc, m.UrlhausClient)
 			if err != nil {
 				fmt.Println(err)
 				continue
 			}
-			entries[i] = entry
+			triageData.Records = append(triageData.Records, HostRecord(ioc, entry))
+			triageData.Scores = appendScore(triageData.Scores, ioc, entry)
 		}
-		triageData.Data = HostsToCsv(entries)
 	case triage.URLType:
 		triageData.Title = "Information about this URL address (URLhaus)"
-		entries := make([]*UrlhausUrlEntry, len(triageRequest.IOCs))
-		for i, ioc := range triageRequest.IOCs {
-			entry, err := GetUrl(ctx, ioc)
+		triageData.Schema = urlSchema
+		for _, ioc := range triageRequest.IOCs {
+			entry, err := GetUrl(ctx, ioc, m.UrlhausClient)
 			if err != nil {
 				fmt.Println(err)
 				continue
 			}
-			entries[i] = entry
+			triageData.Records = append(triageData.Records, UrlRecord(ioc, entry))
+			triageData.Scores = appendScore(triageData.Scores, ioc, entry)
 		}
-		triageData.Data = UrlsToCsv(entries)
 	}
 
 	return []*triage.Data{triageData}, nil
 }
 
-func HostsToCsv(hosts []*UrlhausHostEntry) string {
-	// Dump data into CSV format
-	resp := bytes.Buffer{}
-	csv := csv.NewWriter(&resp)
-	// Headers
-	csv.Write([]string{
-		"First Seen",
-		"URL Summary",
-		"Spamhaus",
-		"SURBL",
-		"Badness",
-	})
-	// Rows
-	for _, host := range hosts {
-		if host == nil {
-			continue
-		}
-		cols := []string{
-			host.First,
-			fmt.Sprintf("Seen at %d different URLs", host.Count),
-			host.Blacklists.SpamhausStatus,
-			host.Blacklists.SurblStatus,
-			fmt.Sprintf("%0.2f", host.GetBadnessScore()),
-		}
-		csv.Write(cols)
+// badnessScorer is an URLhaus entry with a badness score
+type badnessScorer interface {
+	GetBadnessScore() float64
+}
+
+// appendScore adds the normalized badness of an IoC URLhaus knows about to the scores
+func appendScore(scores []triage.Score, ioc string, entry badnessScorer) []triage.Score {
+	score, ok := triage.NewScore(ioc, entry.GetBadnessScore(), 1, "Badness", 1)
+	if !ok {
+		return scores
+	}
+	return append(scores, score)
+}
+
+// Schemas of the records of each kind of entry.
+// The columns the CSV had before records come first in the same order, the IoC and the new columns after them.
+var (
+	badnessAttribute = triage.Attribute{Name: "Badness", Type: triage.NumberAttribute, Description: "0 (benign) to 1 (malicious)"}
+	hostSchema       = &triage.Schema{
+		Name:          "urlhaus.host",
+		IOCColumnLast: true,
+		Attributes: []triage.Attribute{
+			{Name: "First Seen", Type: triage.DateTimeAttribute},
+			{Name: "URL Summary", Type: triage.StringAttribute},
+			{Name: "Spamhaus", Type: triage.StringAttribute, Description: "Spamhaus DBL listing"},
+			{Name: "SURBL", Type: triage.StringAttribute, Description: "SURBL listing"},
+			badnessAttribute,
+			{Name: "URL Count", Type: triage.NumberAttribute, Description: "How many malware URLs were seen on this host"},
+		},
+	}
+	urlSchema = &triage.Schema{
+		Name:          "urlhaus.url",
+		IOCColumnLast: true,
+		Attributes: []triage.Attribute{
+			{Name: "Host", Type: triage.StringAttribute},
+			{Name: "Status", Type: triage.StringAttribute, Description: "online, offline or unknown"},
+			{Name: "Added", Type: triage.DateTimeAttribute},
+			{Name: "Taken Down", Type: triage.NumberAttribute, Description: "Seconds it took to take the URL down"},
+			badnessAttribute,
+			{Name: "Threat", Type: triage.StringAttribute},
+		},
+	}
+	payloadSchema = &triage.Schema{
+		Name:          "urlhaus.payload",
+		IOCColumnLast: true,
+		Attributes: []triage.Attribute{
+			{Name: "MD5", Type: triage.StringAttribute},
+			{Name: "SHA256", Type: triage.StringAttribute},
+			{Name: "File Type", Type: triage.StringAttribute},
+			{Name: "File Size", Type: triage.NumberAttribute},
+			{Name: "First Seen", Type: triage.DateTimeAttribute},
+			{Name: "URL Summary", Type: triage.StringAttribute},
+			badnessAttribute,
+			{Name: "Signature", Type: triage.StringAttribute},
+			{Name: "URL Count", Type: triage.NumberAttribute, Description: "How many malware URLs served this payload"},
+		},
 	}
-	csv.Flush()
+)
+
+// urlSummary summarizes how many URLs an entry was seen at, like the URL Summary column of the CSV
+func urlSummary(count int) string {
+	return fmt.Sprintf("Seen at %d different URLs", count)
+}
 
-	return resp.String()
+// newRecord is the record of an IoC, scored with the badness of its entry if it has one
+func newRecord(ioc string, entry badnessScorer, attributes map[string]interface{}) triage.Record {
+	record := triage.Record{IOC: ioc, Attributes: attributes}
+	badness := entry.GetBadnessScore()
+	if score, ok := triage.NewScore(ioc, badness, 1, "Badness", 1); ok {
+		record.Score = &score.Score
+		record.Attributes["Badness"] = math.Round(badness*100) / 100
+	}
+	return record
 }
 
-func UrlsToCsv(urls []*UrlhausUrlEntry) string {
-	// Dump data into CSV format
-	resp := bytes.Buffer{}
-	csv := csv.NewWriter(&resp)
-	// Headers
-	csv.Write([]string{
-		"Host",
-		"Status",
-		"Added",
-		"Taken Down",
-		"Badness",
+// HostRecord is the record of a domain or IP address
+func HostRecord(ioc string, host *UrlhausHostEntry) triage.Record {
+	record := newRecord(ioc, host, map[string]interface{}{
+		"First Seen":  host.First,
+		"URL Summary": urlSummary(host.Count),
+		"URL Count":   host.Count,
+		"Spamhaus":    host.Blacklists.SpamhausStatus,
+		"SURBL":       host.Blacklists.SurblStatus,
 	})
-	// Rows
-	for _, url := range urls {
-		if url == nil {
-			continue
-		}
-		cols := []string{
-			url.Host,
-			url.Status,
-			url.Added,
-			fmt.Sprint(url.Takedown),
-			fmt.Sprintf("%0.2f", url.GetBadnessScore()),
+	// Tag the host with what its URLs were tagged with
+	seen := map[string]bool{}
+	for _, url := range host.Urls {
+		for _, tag := range url.Tags {
+			if !seen[tag] {
+				seen[tag] = true
+				record.Tags = append(record.Tags, tag)
+			}
 		}
-		csv.Write(cols)
 	}
-	csv.Flush()
-
-	return resp.String()
+	if host.Reference != "" {
+		record.References = []string{host.Reference}
+	}
+	return record
 }
 
-func HashesToCsv(payloads []*UrlhausPayloadEntry) string {
-	// Dump data into CSV format
-	resp := bytes.Buffer{}
-	csv := csv.NewWriter(&resp)
-	// Headers
-	csv.Write([]string{
-		"MD5",
-		"SHA256",
-		"File Type",
-		"File Size",
-		"First Seen",
-		"URL Summary",
-		"Badness",
+// UrlRecord is the record of a URL
+func UrlRecord(ioc string, url *UrlhausUrlEntry) triage.Record {
+	record := newRecord(ioc, url, map[string]interface{}{
+		"Host":       url.Host,
+		"Status":     url.UrlStatus,
+		"Threat":     url.Threat,
+		"Added":      url.Added,
+		"Taken Down": url.Takedown,
 	})
-	// Rows
-	for _, payload := range payloads {
-		if payload == nil {
-			continue
-		}
-		cols := []string{
-			payload.Md5,
-			payload.Sha,
-			payload.FileType,
-			fmt.Sprint(payload.Size),
-			payload.First,
-			fmt.Sprintf("Seen at %d different URLs", payload.UrlCount),
-			fmt.Sprintf("%0.2f", payload.GetBadnessScore()),
-		}
-		csv.Write(cols)
+	record.Tags = url.Tags
+	if url.Reference != "" {
+		record.References = []string{url.Reference}
 	}
-	csv.Flush()
+	return record
+}
 
-	return resp.String()
+// PayloadRecord is the record of a MD5 or SHA256 hash
+func PayloadRecord(ioc string, payload *UrlhausPayloadEntry) triage.Record {
+	return newRecord(ioc, payload, map[string]interface{}{
+		"MD5":         payload.Md5,
+		"SHA256":      payload.Sha,
+		"File Type":   payload.FileType,
+		"File Size":   payload.Size,
+		"Signature":   payload.Signature,
+		"First Seen":  payload.First,
+		"URL Summary": urlSummary(payload.UrlCount),
+		"URL Count":   payload.UrlCount,
+	})
 }
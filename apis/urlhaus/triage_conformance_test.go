@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/cassette"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage/triagetest"
+)
+
+func TestConformance(t *testing.T) {
+	tb = toolbox.GetToolbox()
+	module := &TriageModule{UrlhausClient: cassette.Wrap(t, "conformance", nil)}
+	// URLhaus only returns data for IoCs it knows about
+	triagetest.RunConformance(t, module, triagetest.Options{
+		IOCs: map[triage.IOCType][]string{
+			triage.DomainType: {"stumbletrouser.com"},
+			triage.IPType:     {"192.3.152.166"},
+			triage.URLType:    {"http://178.175.28.140:49228/Mozi.m"},
+			triage.MD5Type:    {"f3a5fdb1e0e62eda7501823a97240e11"},
+			triage.SHA256Type: {"f9311bfd0670d076900dd05f76dd9c1221904cda0e5b2e4d38d6b8656c8b7851"},
+		},
+	})
+}
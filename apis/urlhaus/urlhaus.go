@@ -12,6 +12,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
 	"golang.org/x/net/context/ctxhttp"
 )
 
@@ -24,8 +25,15 @@ const (
 	apiUrlUrl        = "https://urlhaus-api.abuse.ch/v1/url/"
 )
 
-func FetchSingleAsn(asn string) (string, error) {
-	resp, err := http.Get(baseUrl + asn)
+// vendorClientOptions of URLhaus, the lookups of its API are POST requests and the feeds of ASNs can be large
+var vendorClientOptions = toolbox.VendorClientOptions{
+	Timeout:          time.Minute,
+	MaxResponseBytes: 50 << 20,
+	RetryPOST:        true,
+}
+
+func FetchSingleAsn(ctx context.Context, asn string) (string, error) {
+	resp, err := ctxhttp.Get(ctx, tb.GetVendorHTTPClient(triageModuleName, vendorClientOptions), baseUrl+asn)
 	if err != nil {
 		return "", err
 	}
@@ -39,9 +47,9 @@ func FetchSingleAsn(asn string) (string, error) {
 	return string(body), nil
 }
 
-func QueryApi(ctx context.Context, apiUrl string, key string, value string) ([]byte, error) {
+func QueryApi(ctx context.Context, apiUrl string, key string, value string, client *http.Client) ([]byte, error) {
 	//resp, err := http.PostForm(apiUrl, url.Values{key: {value}})
-	resp, err := ctxhttp.PostForm(ctx, http.DefaultClient, apiUrl, url.Values{key: {value}})
+	resp, err := ctxhttp.PostForm(ctx, client, apiUrl, url.Values{key: {value}})
 	if err != nil {
 		fmt.Printf("Error in POST: %s", err)
 		return nil, err
@@ -59,7 +67,7 @@ func DownloadAsns(ctx context.Context, asns []string) []*urlHausEntry {
 	entries := []*urlHausEntry{}
 
 	for _, asn := range asns {
-		data, err := FetchSingleAsn(asn)
+		data, err := FetchSingleAsn(ctx, asn)
 		if err != nil {
 			continue
 		}
@@ -91,11 +99,11 @@ func DownloadAsns(ctx context.Context, asns []string) []*urlHausEntry {
 	return entries
 }
 
-func GetMd5(ctx context.Context, md5 string) (*UrlhausPayloadEntry, error) {
+func GetMd5(ctx context.Context, md5 string, client *http.Client) (*UrlhausPayloadEntry, error) {
 	span, spanCtx := tb.TracerLogger.StartSpan(ctx, "URLHausLookup", "urlhaus", "", "md5Enrich")
 	defer span.End(spanCtx)
 
-	body, err := QueryApi(ctx, apiHashUrl, "md5_hash", md5)
+	body, err := QueryApi(ctx, apiHashUrl, "md5_hash", md5, client)
 	if err != nil {
 		span.AddError(err)
 		return nil, err
@@ -117,11 +125,11 @@ func GetMd5(ctx context.Context, md5 string) (*UrlhausPayloadEntry, error) {
 	return &entry, nil
 }
 
-func GetSha256(ctx context.Context, sha256 string) (*UrlhausPayloadEntry, error) {
+func GetSha256(ctx context.Context, sha256 string, client *http.Client) (*UrlhausPayloadEntry, error) {
 	span, spanCtx := tb.TracerLogger.StartSpan(ctx, "URLHausLookup", "urlhaus", "", "sha256Enrich")
 	defer span.End(spanCtx)
 
-	body, err := QueryApi(ctx, apiHashUrl, "sha256_hash", sha256)
+	body, err := QueryApi(ctx, apiHashUrl, "sha256_hash", sha256, client)
 	if err != nil {
 		span.AddError(err)
 		return nil, err
@@ -145,11 +153,11 @@ func GetSha256(ctx context.Context, sha256 string) (*UrlhausPayloadEntry, error)
 	return &entry, nil
 }
 
-func GetDomainOrIp(ctx context.Context, host string) (*UrlhausHostEntry, error) {
+func GetDomainOrIp(ctx context.Context, host string, client *http.Client) (*UrlhausHostEntry, error) {
 	span, spanCtx := tb.TracerLogger.StartSpan(ctx, "URLHausLookup", "urlhaus", "", "ipdomainEnrich")
 	defer span.End(spanCtx)
 
-	body, err := QueryApi(ctx, apiHostUrl, "host", host)
+	body, err := QueryApi(ctx, apiHostUrl, "host", host, client)
 	if err != nil {
 		span.AddError(err)
 		return nil, err
@@ -173,11 +181,11 @@ func GetDomainOrIp(ctx context.Context, host string) (*UrlhausHostEntry, error)
 	return &entry, nil
 }
 
-func GetUrl(ctx context.Context, _url string) (*UrlhausUrlEntry, error) {
+func GetUrl(ctx context.Context, _url string, client *http.Client) (*UrlhausUrlEntry, error) {
 	span, spanCtx := tb.TracerLogger.StartSpan(ctx, "URLHausLookup", "urlhaus", "", "urlEnrich")
 	defer span.End(spanCtx)
 
-	body, err := QueryApi(ctx, apiUrlUrl, "url", _url)
+	body, err := QueryApi(ctx, apiUrlUrl, "url", _url, client)
 	if err != nil {
 		span.AddError(err)
 		return nil, err
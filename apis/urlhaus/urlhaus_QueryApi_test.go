@@ -51,7 +51,7 @@ func TestQueryApi(t *testing.T) {
 			APIUrl := "I am API URL 5234856723df"
 			URLHausProp := "super prop2345"
 			URLHausValue := "super value gw342345"
-			actualResponse, _ := QueryApi(ctx1, APIUrl, URLHausProp, URLHausValue)
+			actualResponse, _ := QueryApi(ctx1, APIUrl, URLHausProp, URLHausValue, nil)
 			So(actualResponse, ShouldResemble, ExpectedURLHausResponseData)
 			So(actualURL, ShouldResemble, APIUrl)
 		})
@@ -61,7 +61,7 @@ func TestQueryApi(t *testing.T) {
 			PostFormStub := ApplyFunc(ctxhttp.PostForm, func(ctx context.Context, client *http.Client, url string, data url.Values) (*http.Response, error) {
 				return nil, expectedError
 			})
-			_, actualErr := QueryApi(ctx1, "bw345gbgw45h", "dfg", "bw45g5")
+			_, actualErr := QueryApi(ctx1, "bw345gbgw45h", "dfg", "bw45g5", nil)
 			So(actualErr, ShouldResemble, expectedError)
 			PostFormStub.Reset()
 		})
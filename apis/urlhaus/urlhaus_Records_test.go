@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRecords(t *testing.T) {
+
+	Convey("HostRecord", t, func() {
+		host := &UrlhausHostEntry{}
+		So(json.Unmarshal([]byte(`{
+			"query_status": "ok",
+			"urlhaus_reference": "https://urlhaus.abuse.ch/host/gumblar.cn/",
+			"first_seen": "2021-01-07 06:13:20 UTC",
+			"url_count": "2",
+			"blacklists": {"spamhaus_dbl": "abused_legit_malware", "surbl": "listed"},
+			"urls": [
+				{"url_status": "online", "tags": ["elf", "mozi"]},
+				{"url_status": "offline", "tags": ["mozi"]}
+			]
+		}`), host), ShouldBeNil)
+
+		record := HostRecord("gumblar.cn", host)
+
+		Convey("should keep the IoC with its findings", func() {
+			So(record.IOC, ShouldEqual, "gumblar.cn")
+			So(record.Attributes["URL Count"], ShouldEqual, 2)
+			So(record.Attributes["Badness"], ShouldEqual, 0.75)
+			So(*record.Score, ShouldEqual, 75)
+			So(record.Tags, ShouldResemble, []string{"elf", "mozi"})
+			So(record.References, ShouldResemble, []string{"https://urlhaus.abuse.ch/host/gumblar.cn/"})
+		})
+
+		Convey("should render as CSV with the columns it had before records first, then the IoC", func() {
+			So(triage.RecordsToCSV(hostSchema, []triage.Record{record}), ShouldEqual,
+				"First Seen,URL Summary,Spamhaus,SURBL,Badness,URL Count,IoC,Tags,References\n"+
+					"2021-01-07 06:13:20 UTC,Seen at 2 different URLs,abused_legit_malware,listed,0.75,2,gumblar.cn,elf mozi,https://urlhaus.abuse.ch/host/gumblar.cn/\n")
+		})
+	})
+
+	Convey("PayloadRecord", t, func() {
+
+		Convey("should not score payloads VirusTotal doesn't know about", func() {
+			record := PayloadRecord("md5_hashdfg3w54g", &UrlhausPayloadEntry{Md5: "md5_hashdfg3w54g", UrlCount: 3})
+			So(record.Score, ShouldBeNil)
+			So(record.Attributes["Badness"], ShouldBeNil)
+			So(record.Attributes["URL Count"], ShouldEqual, 3)
+		})
+	})
+}
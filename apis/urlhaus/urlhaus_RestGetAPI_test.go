@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"net/http"
 	"testing"
 
 	. "github.com/agiledragon/gomonkey/v2"
@@ -52,7 +53,7 @@ func TestGetMd5(t *testing.T) {
 		URLHausUrl := ""
 		URLHausKey := ""
 		URLHausValue := ""
-		patches = append(patches, ApplyFunc(QueryApi, func(ctx context.Context, apiUrl string, key string, value string) ([]byte, error) {
+		patches = append(patches, ApplyFunc(QueryApi, func(ctx context.Context, apiUrl string, key string, value string, client *http.Client) ([]byte, error) {
 			URLHausUrl = apiUrl
 			URLHausKey = key
 			URLHausValue = value
@@ -69,7 +70,7 @@ func TestGetMd5(t *testing.T) {
 		Convey("should successfully request from URLHaus API", func() {
 			ExpectedURLHausResponseData := &UrlhausPayloadEntry{}
 			json.Unmarshal(URLHausResponseBody, &ExpectedURLHausResponseData)
-			actualResponse, _ := GetMd5(ctx1, "some value")
+			actualResponse, _ := GetMd5(ctx1, "some value", nil)
 			So(actualResponse, ShouldResemble, ExpectedURLHausResponseData)
 
 		})
@@ -79,9 +80,9 @@ func TestGetMd5(t *testing.T) {
 			Url        string
 			Prop       string
 			Value      string
-			Method     func(ctx context.Context, value string) (*UrlhausPayloadEntry, error)
-			MethodHost func(ctx context.Context, value string) (*UrlhausHostEntry, error)
-			MethodUrl  func(ctx context.Context, value string) (*UrlhausUrlEntry, error)
+			Method     func(ctx context.Context, value string, client *http.Client) (*UrlhausPayloadEntry, error)
+			MethodHost func(ctx context.Context, value string, client *http.Client) (*UrlhausHostEntry, error)
+			MethodUrl  func(ctx context.Context, value string, client *http.Client) (*UrlhausUrlEntry, error)
 		}
 
 		expectedResults := []*TestAPICall{}
@@ -129,11 +130,11 @@ func TestGetMd5(t *testing.T) {
 		for _, expectedResult := range expectedResults {
 			Convey("should successfully do "+expectedResult.Name+" from URLHaus API", func() {
 				if expectedResult.Url == apiHashUrl {
-					expectedResult.Method(ctx1, expectedResult.Value)
+					expectedResult.Method(ctx1, expectedResult.Value, nil)
 				} else if expectedResult.Url == apiHostUrl {
-					expectedResult.MethodHost(ctx1, expectedResult.Value)
+					expectedResult.MethodHost(ctx1, expectedResult.Value, nil)
 				} else if expectedResult.Url == apiUrlUrl {
-					expectedResult.MethodUrl(ctx1, expectedResult.Value)
+					expectedResult.MethodUrl(ctx1, expectedResult.Value, nil)
 				}
 				So(URLHausUrl, ShouldResemble, expectedResult.Url)
 				So(URLHausKey, ShouldResemble, expectedResult.Prop)
@@ -142,16 +143,16 @@ func TestGetMd5(t *testing.T) {
 
 			Convey("should return error for "+expectedResult.Name+"if something goes wrong", func() {
 				expectedError := errors.New("query api error for " + expectedResult.Name)
-				QueryApiStub := ApplyFunc(QueryApi, func(ctx context.Context, apiUrl string, key string, value string) ([]byte, error) {
+				QueryApiStub := ApplyFunc(QueryApi, func(ctx context.Context, apiUrl string, key string, value string, client *http.Client) ([]byte, error) {
 					return nil, expectedError
 				})
 				var actualErr error
 				if expectedResult.Url == apiHashUrl {
-					_, actualErr = expectedResult.Method(ctx1, expectedResult.Value)
+					_, actualErr = expectedResult.Method(ctx1, expectedResult.Value, nil)
 				} else if expectedResult.Url == apiHostUrl {
-					_, actualErr = expectedResult.MethodHost(ctx1, expectedResult.Value)
+					_, actualErr = expectedResult.MethodHost(ctx1, expectedResult.Value, nil)
 				} else if expectedResult.Url == apiUrlUrl {
-					_, actualErr = expectedResult.MethodUrl(ctx1, expectedResult.Value)
+					_, actualErr = expectedResult.MethodUrl(ctx1, expectedResult.Value, nil)
 				}
 				So(actualErr, ShouldResemble, expectedError)
 				QueryApiStub.Reset()
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAppendScore(t *testing.T) {
+
+	Convey("appendScore", t, func() {
+
+		Convey("Should normalize the badness of hosts", func() {
+			entry := &UrlhausHostEntry{Blacklists: UrlhausHostBlacklistSubentry{SurblStatus: "listed", SpamhausStatus: phishingDomain}}
+			So(appendScore(nil, "godaddy.com", entry), ShouldResemble, []triage.Score{{IOC: "godaddy.com", Score: 100, Source: "Badness", Confidence: 1}})
+		})
+
+		Convey("Should normalize the badness of payloads", func() {
+			entry := &UrlhausPayloadEntry{VirusTotalResults: []VirusTotalSubentry{{Percent: 43}}}
+			scores := appendScore(nil, "md5_hashdfg3w54g", entry)
+			So(scores, ShouldHaveLength, 1)
+			So(scores[0].Score, ShouldAlmostEqual, 43, 0.0001)
+		})
+
+		Convey("Should skip payloads VirusTotal doesn't know about", func() {
+			So(appendScore(nil, "md5_hashdfg3w54g", &UrlhausPayloadEntry{}), ShouldBeNil)
+		})
+	})
+}
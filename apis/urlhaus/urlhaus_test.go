@@ -4,6 +4,7 @@ import (
 	"context"
 	"testing"
 
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/cassette"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
 )
@@ -36,8 +37,10 @@ func TestGetServicesForIPs(t *testing.T) {
 		IOCsType: triage.IPType,
 	})
 
+	// The IoCs are looked up in the recorded URLhaus responses
+	client := cassette.Wrap(t, "triage", nil)
 	for _, triageRequest := range triageRequests {
-		triageModule := TriageModule{}
+		triageModule := TriageModule{UrlhausClient: client}
 		triageResult, err := triageModule.Triage(ctx, triageRequest)
 		if err != nil {
 			t.Fatal(err)
@@ -46,6 +49,12 @@ func TestGetServicesForIPs(t *testing.T) {
 		if len(triageResult) == 0 {
 			t.Fatal("len 0")
 		}
+		// Each request has an IoC URLhaus knows about
+		if len(triageResult[0].Records) == 0 {
+			t.Fatalf("no records for %s", triageRequest.IOCsType)
+		}
+		// The connector renders the records as CSV
+		triageResult[0].RenderCSV()
 		if triageResult[0].Data == "" {
 			t.Fatal("first data element empty ")
 		}
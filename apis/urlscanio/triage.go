@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gdcorp-infosec/threat-api/apis/urlscanio/urlscanioLibrary"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
@@ -17,6 +18,11 @@ const (
 	triageModuleName = "urlscanio"
 )
 
+// vendorClientOptions of urlscan.io, which allows 60 submissions a minute
+var vendorClientOptions = toolbox.VendorClientOptions{
+	Backoff: time.Second,
+}
+
 type TriageModule struct {
 	urlscanKey    string
 	urlscanClient *http.Client
@@ -42,24 +48,25 @@ func (m *TriageModule) Triage(ctx context.Context, triageRequest *triage.Request
 	tb = toolbox.GetToolbox()
 	defer tb.Close(ctx)
 
-	secret, err := tb.GetFromCredentialsStore(ctx, secretID, nil)
-	if err != nil {
-		triageData.Data = fmt.Sprintf("error in retrieving secrets: %s", err)
-		return []*triage.Data{triageData}, err
-	}
+	if m.urlscanKey == "" {
+		secret, err := tb.GetFromCredentialsStore(ctx, secretID, nil)
+		if err != nil {
+			triageData.Data = fmt.Sprintf("error in retrieving secrets: %s", err)
+			return []*triage.Data{triageData}, err
+		}
 
-	secretMap := map[string]string{}
-	if err := json.Unmarshal([]byte(*secret.SecretString), &secretMap); err != nil {
-		triageData.Data = fmt.Sprintf("error in unmarshaling secrets: %s", err)
-		return []*triage.Data{triageData}, err
+		secretMap := map[string]string{}
+		if err := json.Unmarshal([]byte(*secret.SecretString), &secretMap); err != nil {
+			triageData.Data = fmt.Sprintf("error in unmarshaling secrets: %s", err)
+			return []*triage.Data{triageData}, err
+		}
+		m.urlscanKey = secretMap["key"]
 	}
 
 	if m.urlscanClient == nil {
-		m.urlscanClient = http.DefaultClient
+		m.urlscanClient = tb.GetVendorHTTPClient(triageModuleName, vendorClientOptions)
 	}
 
-	m.urlscanKey = secretMap["key"]
-
 	var span *appsectracing.Span
 	// Log spans in Elastic APM
 	span, ctx = tb.TracerLogger.StartSpan(ctx, "URLScan", "urlscan", "services", "get")
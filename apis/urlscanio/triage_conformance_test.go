@@ -0,0 +1,20 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/agiledragon/gomonkey/v2"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/cassette"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage/triagetest"
+)
+
+func TestConformance(t *testing.T) {
+	tb = toolbox.GetToolbox()
+	patch := ApplyFunc(time.Sleep, func(d time.Duration) {})
+	defer patch.Reset()
+
+	module := &TriageModule{urlscanKey: "test-key", urlscanClient: cassette.Wrap(t, "conformance", nil)}
+	triagetest.RunConformance(t, module, triagetest.Options{})
+}
@@ -6,9 +6,9 @@ import (
 	"encoding/csv"
 	"fmt"
 	"strings"
-	"sync"
 
 	us "github.com/gdcorp-infosec/threat-api/apis/urlscanio/urlscanioLibrary"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
 )
 
@@ -21,53 +21,32 @@ func (m *TriageModule) GetURLScanData(ctx context.Context, triageRequest *triage
 
 	urlscanioResults := make(map[string]*us.ResultHolder)
 
-	wg := sync.WaitGroup{}
-	urlscanioLock := sync.Mutex{}
-	threadLimit := make(chan int, maxThreadCount)
-
-	for _, ioc := range triageRequest.IOCs {
-		// Check context
-		select {
-		case <-ctx.Done():
-			break
-		case threadLimit <- 1:
-			wg.Add(1)
-		default:
-		}
-
+	results := toolbox.FanOut(ctx, triageRequest.IOCs, toolbox.FanOutOptions{MaxConcurrency: maxThreadCount}, func(ctx context.Context, ioc string) (interface{}, error) {
 		// Log spans in Elastic APM
 		span, spanCtx := tb.TracerLogger.StartSpan(ctx, "URLScan", "urlscanio", "", "urlscanIoCLookup")
+		defer span.End(spanCtx)
 
-		go func(ioc string) {
-			defer func() {
-				<-threadLimit
-				wg.Done()
-			}()
-			urlscanioResult, err := us.GetURLScanResults(ctx, ioc, m.urlscanKey, m.urlscanClient)
-			if err != nil && strings.Contains(err.Error(), "scan prevented") {
-				metaData.BlacklistedDomainsCount++
-				metaData.BlacklistedDomains += ioc + " "
-				err = nil
-			} else if err != nil && strings.Contains(err.Error(), "dns error") {
-				metaData.URLsNotFoundCount++
-				metaData.URLsNotFound += ioc + " "
-			} else if err != nil {
-				metaData.UnknownErrorCount++
-				metaData.UnknownErrorURL += ioc + " "
-				urlscanioLock.Lock()
-				urlscanioResults[ioc] = nil
-				urlscanioLock.Unlock()
-			} else {
-				urlscanioLock.Lock()
-				urlscanioResults[ioc] = urlscanioResult
-				urlscanioLock.Unlock()
-			}
-
-		}(ioc)
-		span.End(spanCtx)
+		return us.GetURLScanResults(ctx, ioc, m.urlscanKey, m.urlscanClient)
+	})
+	for _, result := range results {
+		// Out of time, return what we have so far
+		if result.Skipped {
+			continue
+		}
+		if result.Err != nil && strings.Contains(result.Err.Error(), "scan prevented") {
+			metaData.BlacklistedDomainsCount++
+			metaData.BlacklistedDomains += result.IOC + " "
+		} else if result.Err != nil && strings.Contains(result.Err.Error(), "dns error") {
+			metaData.URLsNotFoundCount++
+			metaData.URLsNotFound += result.IOC + " "
+		} else if result.Err != nil {
+			metaData.UnknownErrorCount++
+			metaData.UnknownErrorURL += result.IOC + " "
+			urlscanioResults[result.IOC] = nil
+		} else {
+			urlscanioResults[result.IOC], _ = result.Value.(*us.ResultHolder)
+		}
 	}
-
-	wg.Wait()
 	return urlscanioResults, nil
 }
 
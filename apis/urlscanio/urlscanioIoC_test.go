@@ -3,7 +3,10 @@ package main
 import (
 	"context"
 	"testing"
+	"time"
 
+	. "github.com/agiledragon/gomonkey/v2"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/cassette"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
 )
@@ -14,6 +17,11 @@ func TestGetExampleData(t *testing.T) {
 	tb = toolbox.GetToolbox()
 	defer tb.Close(ctx)
 
+	// The recorded scans are already finished, so skip the wait for results
+	patch := ApplyFunc(time.Sleep, func(d time.Duration) {})
+	defer patch.Reset()
+	client := cassette.Wrap(t, "triage", nil)
+
 	var triageRequests []*triage.Request
 
 	triageRequests = append(triageRequests, &triage.Request{
@@ -32,7 +40,7 @@ func TestGetExampleData(t *testing.T) {
 	})
 
 	for _, triageRequest := range triageRequests {
-		triageModule := TriageModule{}
+		triageModule := TriageModule{urlscanKey: "test-key", urlscanClient: client}
 		triageResult, err := triageModule.Triage(ctx, triageRequest)
 		if err != nil {
 			t.Fatal(err)
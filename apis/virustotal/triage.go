@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"context"
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"math"
+	"net/http"
 	"strconv"
 	"time"
 
@@ -22,6 +24,10 @@ const (
 	badnessScalingFactor = 1.0 / 7.0
 	reputationComponent  = 0.2
 	analysisComponent    = 0.8
+	// Engines that need to analyze an IoC before its badness is fully trusted
+	confidentAnalysesCount = 20
+	// Code of the errors of the IoCs VirusTotal doesn't know about
+	notFoundErrorCode = "NotFoundError"
 )
 
 type VirusTotalAnalysis struct {
@@ -38,6 +44,8 @@ func (m VirusTotalAnalysis) GetAnalysesCount() int64 {
 
 // Triage module
 type TriageModule struct {
+	VTKey    string
+	VTClient *http.Client
 }
 
 // Mock interface for external VirusTotal library Object (vt.Object)
@@ -70,58 +78,75 @@ func (m *TriageModule) ProcessRequest(ctx context.Context, triageRequest *triage
 		Metadata: []string{},
 	}
 	tb := toolbox.GetToolbox()
-	virusTotal := vtlib.NewVirusTotal(tb, apiKey)
+	virusTotal := vtlib.NewVirusTotal(tb, apiKey, m.VTClient)
 
 	metaDataHolder := vtlib.InitializeLastAnalysisMetaData() // Initialize empty metadata holder
 	var entries []*vt.Object                                 // Initialize slice of entries
+	var found []string                                       // IoCs of the entries
 	switch triageRequest.IOCsType {
-	case triage.MD5Type, triage.SHA256Type:
+	case triage.MD5Type, triage.SHA1Type, triage.SHA256Type:
 		for _, ioc := range triageRequest.IOCs {
 			entry, err := virusTotal.GetHash(ctx, ioc)
 			if err != nil {
-				fmt.Println(err)
-				continue
+				if isNotFound(err) {
+					continue
+				}
+				return nil, fmt.Errorf("error from virustotal: %w", err)
 			}
 			entries = append(entries, entry)
+			found = append(found, ioc)
 		}
 		entriesVTObject := covertToVTObject(entries)
 		triageData.Data = HashesToCsv(triageRequest.IOCs, entriesVTObject, metaDataHolder)
+		triageData.Scores = IoCScores(found, entriesVTObject)
 		triageData.Metadata = []string{fmt.Sprintf("Found %d matching %s hashes", len(entries), triageRequest.IOCsType)}
 	case triage.DomainType:
 		for _, ioc := range triageRequest.IOCs {
 			entry, err := virusTotal.GetDomain(ctx, ioc)
 			if err != nil {
-				fmt.Println(err)
-				continue
+				if isNotFound(err) {
+					continue
+				}
+				return nil, fmt.Errorf("error from virustotal: %w", err)
 			}
 			entries = append(entries, entry)
+			found = append(found, ioc)
 		}
 		entriesVTObject := covertToVTObject(entries)
 		triageData.Data = DomainsToCsv(triageRequest.IOCs, entriesVTObject, metaDataHolder)
+		triageData.Scores = IoCScores(found, entriesVTObject)
 		triageData.Metadata = []string{fmt.Sprintf("Found %d matching domains", len(entries))}
 	case triage.IPType:
 		for _, ioc := range triageRequest.IOCs {
 			entry, err := virusTotal.GetAddress(ctx, ioc)
 			if err != nil {
-				fmt.Println(err)
-				continue
+				if isNotFound(err) {
+					continue
+				}
+				return nil, fmt.Errorf("error from virustotal: %w", err)
 			}
 			entries = append(entries, entry)
+			found = append(found, ioc)
 		}
 		entriesVTObject := covertToVTObject(entries)
 		triageData.Data = IpsToCsv(triageRequest.IOCs, entriesVTObject, metaDataHolder)
+		triageData.Scores = IoCScores(found, entriesVTObject)
 		triageData.Metadata = []string{fmt.Sprintf("Found %d matching IP address", len(entries))}
 	case triage.URLType:
 		for _, ioc := range triageRequest.IOCs {
 			entry, err := virusTotal.GetURL(ctx, ioc)
 			if err != nil {
-				fmt.Println(err)
-				continue
+				if isNotFound(err) {
+					continue
+				}
+				return nil, fmt.Errorf("error from virustotal: %w", err)
 			}
 			entries = append(entries, entry)
+			found = append(found, ioc)
 		}
 		entriesVTObject := covertToVTObject(entries)
 		triageData.Data = UrlsToCsv(triageRequest.IOCs, entriesVTObject, metaDataHolder)
+		triageData.Scores = IoCScores(found, entriesVTObject)
 		triageData.Metadata = []string{fmt.Sprintf("Found %d matching URLs", len(entries))}
 	}
 	currentTime := time.Now()
@@ -143,21 +168,23 @@ func (m *TriageModule) Triage(ctx context.Context, triageRequest *triage.Request
 		Metadata: []string{},
 	}
 
-	// Get the API key from
-	span, _ = tb.TracerLogger.StartSpan(ctx, "GetAPIKey", "virustotal", "", "getapikey")
-	secret, err := tb.GetFromCredentialsStore(ctx, secretID, nil)
-	if err != nil {
-		span.AddError(err)
+	// Get the API key from the credentials store, unless the module was given one
+	if m.VTKey == "" {
+		span, _ = tb.TracerLogger.StartSpan(ctx, "GetAPIKey", "virustotal", "", "getapikey")
+		secret, err := tb.GetFromCredentialsStore(ctx, secretID, nil)
+		if err != nil {
+			span.AddError(err)
+			span.End(ctx)
+			triageData.Data = fmt.Sprintf("Error retrieving secret with key, %s: %s", secretID, err)
+			return []*triage.Data{triageData}, err
+		}
+		m.VTKey = *secret.SecretString
 		span.End(ctx)
-		triageData.Data = fmt.Sprintf("Error retrieving secret with key, %s: %s", secretID, err)
-		return []*triage.Data{triageData}, err
 	}
-	apiKey := *secret.SecretString
-	span.End(ctx)
 
 	// Process the request by querying each API endpoint per IoC type
 	span, _ = tb.TracerLogger.StartSpan(ctx, "ProcessRequest", "virustotal", "", "processrequest")
-	data, err := m.ProcessRequest(ctx, triageRequest, apiKey)
+	data, err := m.ProcessRequest(ctx, triageRequest, m.VTKey)
 	if err != nil {
 		span.AddError(err)
 		span.End(ctx)
@@ -179,6 +206,34 @@ func BadnessScore(reputation int64, analysis *VirusTotalAnalysis) float64 {
 	return reputation_normalized*reputationComponent + analysis_normalized*analysisComponent
 }
 
+// IoCScores normalizes the badness of the IoCs VirusTotal knows about,
+// the more engines analyzed an IoC the more its score is trusted
+func IoCScores(iocs []string, payloads []VirusTotalObject) []triage.Score {
+	var scores []triage.Score
+	for i, payload := range payloads {
+		if payload == nil || i >= len(iocs) {
+			continue
+		}
+		reputation, err := payload.GetInt64("reputation")
+		if err != nil {
+			continue
+		}
+		analysis := new(VirusTotalAnalysis)
+		if lastAnalysis, err := payload.Get("last_analysis_stats"); err == nil {
+			if lastAnalysisMap, ok := lastAnalysis.(map[string]interface{}); ok {
+				analysis = getLastAnalysisStats(lastAnalysisMap)
+			}
+		}
+		analyses := float64(analysis.GetAnalysesCount() - analysis.timeout)
+		confidence := reputationComponent + analysisComponent*math.Min(analyses/confidentAnalysesCount, 1)
+		score, ok := triage.NewScore(iocs[i], BadnessScore(reputation, analysis), 1, "Badness", confidence)
+		if ok {
+			scores = append(scores, score)
+		}
+	}
+	return scores
+}
+
 // Dump the relevant fields from the VirusTotal Object returned by
 // the files interface into CSV format.
 func HashesToCsv(iocs []string, payloads []VirusTotalObject, metaDataHolder *vtlib.MetaData) string {
@@ -245,7 +300,7 @@ func HashesToCsv(iocs []string, payloads []VirusTotalObject, metaDataHolder *vtl
 		badness := 0.0
 		analysis := new(VirusTotalAnalysis)
 		lastAnalysis, err := payload.Get("last_analysis_stats")
-		if err != nil {
+		if err == nil && lastAnalysis != nil {
 			lastAnalysisMap := lastAnalysis.(map[string]interface{})
 			analysis = getLastAnalysisStats(lastAnalysisMap)
 			badness = BadnessScore(reputation, analysis)
@@ -393,7 +448,7 @@ func IpsToCsv(iocs []string, payloads []VirusTotalObject, metaDataHolder *vtlib.
 		badness := 0.0
 		analysis := new(VirusTotalAnalysis)
 		lastAnalysis, err := payload.Get("last_analysis_stats")
-		if err != nil {
+		if err == nil && lastAnalysis != nil {
 			lastAnalysisMap := lastAnalysis.(map[string]interface{})
 			analysis = getLastAnalysisStats(lastAnalysisMap)
 			badness = BadnessScore(reputation, analysis)
@@ -466,7 +521,7 @@ func UrlsToCsv(iocs []string, payloads []VirusTotalObject, metaDataHolder *vtlib
 		badness := 0.0
 		analysis := new(VirusTotalAnalysis)
 		lastAnalysis, err := payload.Get("last_analysis_stats")
-		if err != nil {
+		if err == nil && lastAnalysis != nil {
 			lastAnalysisMap := lastAnalysis.(map[string]interface{})
 			analysis = getLastAnalysisStats(lastAnalysisMap)
 			badness = BadnessScore(reputation, analysis)
@@ -521,6 +576,12 @@ func getLastAnalysisStats(lastAnalysisMap map[string]interface{}) *VirusTotalAna
 	return analysis
 }
 
+// isNotFound returns true if the error is VirusTotal not knowing about the IoC
+func isNotFound(err error) bool {
+	var vtErr vt.Error
+	return errors.As(err, &vtErr) && vtErr.Code == notFoundErrorCode
+}
+
 // Helper method to convert a slice of entries (vt.Object type) to a slice of VirusTotalObject entries
 func covertToVTObject(entries []*vt.Object) []VirusTotalObject {
 	entriesVTObject := make([]VirusTotalObject, len(entries))
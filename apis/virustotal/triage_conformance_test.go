@@ -0,0 +1,14 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/cassette"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage/triagetest"
+)
+
+// The recorded VirusTotal responses of the EICAR test file, looked up by each of its hashes
+func TestConformance(t *testing.T) {
+	module := &TriageModule{VTKey: "test-key", VTClient: cassette.Wrap(t, "conformance", nil)}
+	triagetest.RunConformance(t, module, triagetest.Options{})
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"crypto/sha256"
 	"fmt"
+	"net/http"
+	"time"
 
 	vt "github.com/VirusTotal/vt-go"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
@@ -17,6 +19,12 @@ const (
 	ipPath           = "ip_addresses/%s"
 )
 
+// vendorClientOptions of VirusTotal, whose public API allows 4 requests a minute
+var vendorClientOptions = toolbox.VendorClientOptions{
+	Backoff:    time.Second * 15,
+	MaxBackoff: time.Minute,
+}
+
 type VirusTotal struct {
 	tb     *toolbox.Toolbox
 	apiKey string
@@ -36,11 +44,16 @@ func InitializeLastAnalysisMetaData() *MetaData {
 	return metaDataHolder
 }
 
-func NewVirusTotal(tb *toolbox.Toolbox, apiKey string) *VirusTotal {
+// NewVirusTotal creates a VirusTotal client sending its requests with httpClient,
+// or with the vendor client of VirusTotal if it is nil
+func NewVirusTotal(tb *toolbox.Toolbox, apiKey string, httpClient *http.Client) *VirusTotal {
+	if httpClient == nil {
+		httpClient = tb.GetVendorHTTPClient(triageModuleName, vendorClientOptions)
+	}
 	virusTotal := new(VirusTotal)
 	virusTotal.tb = tb
 	virusTotal.apiKey = apiKey
-	virusTotal.client = vt.NewClient(apiKey)
+	virusTotal.client = vt.NewClient(apiKey, vt.WithHTTPClient(httpClient))
 	return virusTotal
 }
 
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// analyzedObject is a mock VirusTotal Object with a reputation and engine detections
+type analyzedObject struct {
+	Object
+	reputation int64
+	stats      map[string]interface{}
+}
+
+func (obj *analyzedObject) GetInt64(attr string) (int64, error) {
+	return obj.reputation, nil
+}
+
+func (obj *analyzedObject) Get(attr string) (interface{}, error) {
+	return obj.stats, nil
+}
+
+func TestIoCScores(t *testing.T) {
+
+	Convey("IoCScores", t, func() {
+
+		Convey("Should normalize the badness of every IoC", func() {
+			payloads := []VirusTotalObject{
+				&analyzedObject{stats: map[string]interface{}{"malicious": 10.0, "harmless": 30.0, "timeout": 5.0}},
+				&analyzedObject{reputation: -100, stats: map[string]interface{}{"malicious": 10.0, "harmless": 0.0}},
+			}
+
+			scores := IoCScores([]string{"1.2.3.4", "4.3.2.1"}, payloads)
+
+			So(scores, ShouldHaveLength, 2)
+			So(scores[0].IOC, ShouldEqual, "1.2.3.4")
+			So(scores[0].Score, ShouldAlmostEqual, analysisComponent*100*10/45)
+			So(scores[0].Confidence, ShouldAlmostEqual, 1.0)
+			So(scores[0].Source, ShouldEqual, "Badness")
+			So(scores[1].IOC, ShouldEqual, "4.3.2.1")
+			So(scores[1].Score, ShouldAlmostEqual, 100.0, 0.01)
+			So(scores[1].Confidence, ShouldAlmostEqual, 0.6)
+		})
+
+		Convey("Should barely trust IoCs no engine analyzed", func() {
+			scores := IoCScores([]string{"127.0.0.1"}, []VirusTotalObject{&Object{}})
+
+			So(scores, ShouldResemble, []triage.Score{{IOC: "127.0.0.1", Score: 0, Source: "Badness", Confidence: reputationComponent}})
+		})
+
+		Convey("Should skip missing payloads", func() {
+			So(IoCScores([]string{"127.0.0.1"}, []VirusTotalObject{nil}), ShouldBeNil)
+		})
+	})
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	vtlib "github.com/gdcorp-infosec/threat-api/apis/virustotal/virustotalLibrary"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/cassette"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
 
 	. "github.com/agiledragon/gomonkey/v2"
@@ -35,7 +36,8 @@ func TestProcessRequest(t *testing.T) {
 			JWT:      "Mock JWT token",
 			Verbose:  false,
 		}
-		triageModule := &TriageModule{}
+		// The recorded VirusTotal responses, a hash it doesn't know about and the EICAR test file
+		triageModule := &TriageModule{VTClient: cassette.Wrap(t, "processRequest", nil)}
 
 		Convey("Should process triage request", func() {
 
@@ -55,12 +57,26 @@ func TestProcessRequest(t *testing.T) {
 				Data:     "IoC,Badness,MD5,SHA1,SHA256,File Size,First Seen,Reputation,Harmless,Malicious,Suspicious,Timeout,Undetected\n",
 			}
 
-			actualTriageData, _ := triageModule.ProcessRequest(ctx1, &triageRequest, "")
-
-			println(actualTriageData)
+			actualTriageData, err := triageModule.ProcessRequest(ctx1, &triageRequest, "test-key")
 
+			So(err, ShouldBeNil)
 			So(actualTriageData, ShouldResemble, expectedTriageData)
 		})
 
+		Convey("Should process SHA1 hashes like the other hashes", func() {
+			triageRequest.IOCs = []string{"3395856ce81f2b7382dee72602f798b642f14140"}
+			triageRequest.IOCsType = triage.SHA1Type
+
+			actualTriageData, err := triageModule.ProcessRequest(ctx1, &triageRequest, "test-key")
+
+			So(err, ShouldBeNil)
+			So(actualTriageData.Metadata, ShouldContain, "Found 1 matching SHA1 hashes")
+			So(actualTriageData.Data, ShouldStartWith, "IoC,Badness,MD5,SHA1,SHA256,File Size,First Seen,Reputation,Harmless,Malicious,Suspicious,Timeout,Undetected\n")
+			So(actualTriageData.Data, ShouldContainSubstring, "\n3395856ce81f2b7382dee72602f798b642f14140,0.72,44d88612fea8a8f36de82e1278abb02f,3395856ce81f2b7382dee72602f798b642f14140,275a021bbfb6489e54d471899f7db9d1663fc695ec2fe2a2c4538aabf651fd0f,68,")
+			So(actualTriageData.Data, ShouldEndWith, ",-1,0,62,0,0,10\n")
+			So(actualTriageData.Scores, ShouldHaveLength, 1)
+			So(actualTriageData.Scores[0].IOC, ShouldEqual, "3395856ce81f2b7382dee72602f798b642f14140")
+		})
+
 	})
 }
@@ -1,15 +1,13 @@
-// +build !runTests
-
 package main
 
 import (
 	"context"
 	"encoding/csv"
 	"fmt"
-	"io/ioutil"
 	"strings"
 	"testing"
 
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/cassette"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
 )
@@ -43,20 +41,14 @@ func TestWebQueriesResults(t *testing.T) {
 		IOCsType: triage.IPType,
 	})
 
-	// this test expects the API key to be the online line in a
-	// test file named "vtapi.txt" in the same directory as this
-	// code
-	data, err := ioutil.ReadFile("vtapi.txt")
-	if err != nil {
-		panic(err)
-	}
-	apiKey := string(data)
+	// The responses are replayed from testdata/cassettes/webQueriesResults.json
+	client := cassette.Wrap(t, "webQueriesResults", nil)
 
 	for i, triageRequest := range triageRequests {
 		fmt.Printf("Triage request test %d\n", i)
 
-		triageModule := TriageModule{}
-		triageResult, err := triageModule.ProcessRequest(ctx, triageRequest, apiKey)
+		triageModule := TriageModule{VTClient: client}
+		triageResult, err := triageModule.ProcessRequest(ctx, triageRequest, "test-key")
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -97,20 +89,14 @@ func TestWebQueriesNoResults(t *testing.T) {
 		IOCsType: triage.IPType,
 	})
 
-	// this test expects the API key to be the online line in a
-	// test file named "vtapi.txt" in the same directory as this
-	// code
-	data, err := ioutil.ReadFile("vtapi.txt")
-	if err != nil {
-		panic(err)
-	}
-	apiKey := string(data)
+	// The responses are replayed from testdata/cassettes/webQueriesNoResults.json
+	client := cassette.Wrap(t, "webQueriesNoResults", nil)
 
 	for i, triageRequest := range triageRequests {
 		fmt.Printf("Triage request test %d\n", i)
 
-		triageModule := TriageModule{}
-		triageResult, err := triageModule.ProcessRequest(ctx, triageRequest, apiKey)
+		triageModule := TriageModule{VTClient: client}
+		triageResult, err := triageModule.ProcessRequest(ctx, triageRequest, "test-key")
 		if err != nil {
 			t.Fatal(err)
 		}
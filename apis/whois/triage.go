@@ -1,13 +1,12 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/csv"
 	"encoding/json"
 	"fmt"
 
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
+	whoisparser "github.com/likexian/whois-parser"
 )
 
 // TriageModule triage module
@@ -47,6 +46,10 @@ func (m *TriageModule) Triage(ctx context.Context, triageRequest *triage.Request
 		triageData.Metadata = append(triageData.Metadata, fmt.Sprintf("%d/%d Domains are invalid (bad whois data)", stats.InvalidDomains, len(triageRequest.IOCs)))
 	}
 
+	// Lookup returns one result per domain, of the base domain it looked up
+	triageData.Schema = whoisSchema
+	triageData.Records = whoisRecords(triageRequest.IOCs, whoisResults)
+
 	// Dump full data if we are doing full dump
 	if triageRequest.Verbose {
 		result, err := json.Marshal(whoisResults)
@@ -59,50 +62,60 @@ func (m *TriageModule) Triage(ctx context.Context, triageRequest *triage.Request
 		return []*triage.Data{triageData}, nil
 	}
 
-	// Dump data as simplified csv instead
-	resp := bytes.Buffer{}
-	csv := csv.NewWriter(&resp)
-	// Write headers
-	csv.Write([]string{
-		"domain",
-		"createdDate",
-		"updatedDate",
-		"expirationDate",
-		"registrarName",
-		"registrarEmail",
-		"registrarPhone",
-		"registrantName",
-		"registrantEmail",
-		"registrantPhone",
-		"registrantOrganization",
-		"registrantStreet",
-		"registrantCity",
-		"registrantCountry",
-		"administrativeOrganization",
-	})
+	return []*triage.Data{triageData}, nil
+}
+
+// whoisSchema describes the records of the whois results,
+// their IOC comes last in CSV so the columns CSV clients read keep their order
+var whoisSchema = &triage.Schema{
+	Name:          "whois.domain",
+	IOCColumnLast: true,
+	Attributes: []triage.Attribute{
+		{Name: "domain", Type: triage.StringAttribute, Description: "The base domain that was looked up"},
+		{Name: "createdDate", Type: triage.DateTimeAttribute},
+		{Name: "updatedDate", Type: triage.DateTimeAttribute},
+		{Name: "expirationDate", Type: triage.DateTimeAttribute},
+		{Name: "registrarName", Type: triage.StringAttribute, Description: "Starts with ERROR: if the lookup failed"},
+		{Name: "registrarEmail", Type: triage.StringAttribute},
+		{Name: "registrarPhone", Type: triage.StringAttribute},
+		{Name: "registrantName", Type: triage.StringAttribute},
+		{Name: "registrantEmail", Type: triage.StringAttribute},
+		{Name: "registrantPhone", Type: triage.StringAttribute},
+		{Name: "registrantOrganization", Type: triage.StringAttribute},
+		{Name: "registrantStreet", Type: triage.StringAttribute},
+		{Name: "registrantCity", Type: triage.StringAttribute},
+		{Name: "registrantCountry", Type: triage.StringAttribute},
+		{Name: "administrativeOrganization", Type: triage.StringAttribute},
+	},
+}
 
-	// Write each domain whois info
-	for _, result := range whoisResults {
-		csv.Write([]string{
-			result.Domain.Domain,
-			result.Domain.CreatedDate,
-			result.Domain.UpdatedDate,
-			result.Domain.ExpirationDate,
-			result.Registrar.Name,
-			result.Registrar.Email,
-			result.Registrar.Phone,
-			result.Registrant.Name,
-			result.Registrant.Email,
-			result.Registrant.Phone,
-			result.Registrant.Organization,
-			result.Registrant.Street,
-			result.Registrant.City,
-			result.Registrant.Country,
-			result.Administrative.Organization,
+// whoisRecords converts the whois results of the domains to records
+func whoisRecords(domains []string, whoisResults []*whoisparser.WhoisInfo) []triage.Record {
+	records := []triage.Record{}
+	for i, result := range whoisResults {
+		if i >= len(domains) {
+			break
+		}
+		records = append(records, triage.Record{
+			IOC: domains[i],
+			Attributes: map[string]interface{}{
+				"domain":                     result.Domain.Domain,
+				"createdDate":                result.Domain.CreatedDate,
+				"updatedDate":                result.Domain.UpdatedDate,
+				"expirationDate":             result.Domain.ExpirationDate,
+				"registrarName":              result.Registrar.Name,
+				"registrarEmail":             result.Registrar.Email,
+				"registrarPhone":             result.Registrar.Phone,
+				"registrantName":             result.Registrant.Name,
+				"registrantEmail":            result.Registrant.Email,
+				"registrantPhone":            result.Registrant.Phone,
+				"registrantOrganization":     result.Registrant.Organization,
+				"registrantStreet":           result.Registrant.Street,
+				"registrantCity":             result.Registrant.City,
+				"registrantCountry":          result.Registrant.Country,
+				"administrativeOrganization": result.Administrative.Organization,
+			},
 		})
 	}
-	csv.Flush()
-
-	triageData.Data = resp.String()
-	return []*triage.Data{triageData}, nil
+	return records
 }
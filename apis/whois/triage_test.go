@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
+	whoisparser "github.com/likexian/whois-parser"
+)
+
+func TestWhoisRecords(t *testing.T) {
+	whoisResults := []*whoisparser.WhoisInfo{
+		{
+			Domain:         &whoisparser.Domain{Domain: "godaddy.com", CreatedDate: "1999-03-02T05:00:00Z"},
+			Registrar:      &whoisparser.Contact{Name: "GoDaddy.com, LLC"},
+			Registrant:     &whoisparser.Contact{Organization: "Go Daddy Operating Company, LLC"},
+			Administrative: &whoisparser.Contact{},
+		},
+	}
+
+	records := whoisRecords([]string{"www.godaddy.com"}, whoisResults)
+	if len(records) != 1 {
+		t.Fatalf("expected 1 record, got %d", len(records))
+	}
+	// The record is of the IOC, not of the base domain that was looked up
+	if records[0].IOC != "www.godaddy.com" || records[0].Attributes["domain"] != "godaddy.com" {
+		t.Errorf("unexpected record %+v", records[0])
+	}
+
+	// The columns of the CSV whois always returned come first
+	expected := "domain,createdDate,updatedDate,expirationDate,registrarName,registrarEmail,registrarPhone,registrantName,registrantEmail,registrantPhone,registrantOrganization,registrantStreet,registrantCity,registrantCountry,administrativeOrganization,IoC\n" +
+		"godaddy.com,1999-03-02T05:00:00Z,,,\"GoDaddy.com, LLC\",,,,,,\"Go Daddy Operating Company, LLC\",,,,,www.godaddy.com\n"
+	if actual := triage.RecordsToCSV(whoisSchema, records); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
@@ -40,11 +40,9 @@ func Lookup(ctx context.Context, domains []string) ([]*whoisparser.WhoisInfo, *W
 	// Get WhoisInfo
 	whoisResults := []*whoisparser.WhoisInfo{}
 	for _, domain := range domains {
-		// Check context
-		select {
-		case <-ctx.Done():
-			break
-		default:
+		// Out of time, return what we have so far
+		if ctx.Err() != nil {
+			return whoisResults, stats
 		}
 
 		span, spanCtx := tb.TracerLogger.StartSpan(ctx, "WhoisLookup", "whois", "", "lookup")
@@ -108,7 +106,8 @@ func Lookup(ctx context.Context, domains []string) ([]*whoisparser.WhoisInfo, *W
 		// TODO: Add token bucket for 1000 queries per day
 		select {
 		case <-ctx.Done():
-			break
+			span.End(spanCtx)
+			return whoisResults, stats
 		case <-time.After(time.Millisecond * 500):
 		}
 
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gdcorp-infosec/threat-api/apis/zerobounce/zerobounceLibrary"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
@@ -17,6 +18,13 @@ const (
 	triageModuleName = "zerobounce"
 )
 
+// vendorClientOptions of ZeroBounce, which allows 5 requests a minute that validate up to 100 emails each
+var vendorClientOptions = toolbox.VendorClientOptions{
+	Timeout:    time.Minute,
+	Backoff:    time.Second * 12,
+	MaxBackoff: time.Minute,
+}
+
 // TriageModule triage module
 type TriageModule struct {
 	ZeroBounceKey    string
@@ -43,24 +51,25 @@ func (m *TriageModule) Triage(ctx context.Context, triageRequest *triage.Request
 	tb = toolbox.GetToolbox()
 	defer tb.Close(ctx)
 
-	secret, err := tb.GetFromCredentialsStore(ctx, secretID, nil)
-	if err != nil {
-		triageData.Data = fmt.Sprintf("error in retrieving secrets: %s", err)
-		return []*triage.Data{triageData}, err
-	}
+	if m.ZeroBounceKey == "" {
+		secret, err := tb.GetFromCredentialsStore(ctx, secretID, nil)
+		if err != nil {
+			triageData.Data = fmt.Sprintf("error in retrieving secrets: %s", err)
+			return []*triage.Data{triageData}, err
+		}
 
-	secretMap := map[string]string{}
-	if err := json.Unmarshal([]byte(*secret.SecretString), &secretMap); err != nil {
-		triageData.Data = fmt.Sprintf("error in unmarshalling secrets: %s", err)
-		return []*triage.Data{triageData}, err
+		secretMap := map[string]string{}
+		if err := json.Unmarshal([]byte(*secret.SecretString), &secretMap); err != nil {
+			triageData.Data = fmt.Sprintf("error in unmarshalling secrets: %s", err)
+			return []*triage.Data{triageData}, err
+		}
+		m.ZeroBounceKey = secretMap["api_key"]
 	}
 
 	if m.ZeroBounceClient == nil {
-		m.ZeroBounceClient = http.DefaultClient
+		m.ZeroBounceClient = tb.GetVendorHTTPClient(triageModuleName, vendorClientOptions)
 	}
 
-	m.ZeroBounceKey = secretMap["api_key"]
-
 	var span *appsectracing.Span
 	span, ctx = tb.TracerLogger.StartSpan(ctx, "Zerobounce", "zerobounce", "services", "get")
 	defer span.End(ctx)
@@ -5,15 +5,18 @@ import (
 	"context"
 	"encoding/csv"
 	"fmt"
-	"sync"
-	"time"
 
 	zb "github.com/gdcorp-infosec/threat-api/apis/zerobounce/zerobounceLibrary"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
 )
 
 const (
 	maxThreadCount = 5
+
+	// Zerobounce allows 5 requests per minute
+	requestsPerSecond = 5.0 / 60
+	requestsBurst     = 5
 )
 
 // Generates a map of email validation data retrieved from zerobounce
@@ -21,49 +24,36 @@ func (m *TriageModule) GetZeroBounceData(ctx context.Context, triageRequest *tri
 
 	zerobounceResults := make(map[string]*zb.ZeroBounceReport)
 
-	wg := sync.WaitGroup{}
-	zerobounceLock := sync.Mutex{}
-	threadLimit := make(chan int, maxThreadCount)
 	ioc_list := `"email_batch":[`
-
 	for _, ioc := range triageRequest.IOCs {
 		ioc_list += fmt.Sprintf(`{"email_address": "%s"},`, ioc)
 	}
 	ioc_list += "]"
 
-	select {
-	case <-ctx.Done():
-		break
-	case threadLimit <- 1:
-		wg.Add(1)
-	default:
+	// The emails are validated in a single batch request, the limiter keeps concurrent triages
+	// within the rate limit of zerobounce
+	options := toolbox.FanOutOptions{
+		MaxConcurrency: maxThreadCount,
+		RateLimiter:    toolbox.VendorRateLimiter(triageModuleName, requestsPerSecond, requestsBurst),
 	}
+	results := toolbox.FanOut(ctx, []string{ioc_list}, options, func(ctx context.Context, ioc_list string) (interface{}, error) {
+		span, spanCtx := tb.TracerLogger.StartSpan(ctx, "EmailLookup", "zerobounce", "", "zerobounceEmailLookup")
+		defer span.End(spanCtx)
 
-	span, spanCtx := tb.TracerLogger.StartSpan(ctx, "EmailLookup", "zerobounce", "", "zerobounceEmailLookup")
-
-	go func(ioc_list string) {
-		defer func() {
-			<-threadLimit
-			wg.Done()
-		}()
 		zerobounceResult, err := zb.GetZeroBounce(ctx, ioc_list, "", m.ZeroBounceKey, m.ZeroBounceClient)
 		if err != nil {
 			span.AddError(err)
-			zerobounceLock.Lock()
-			zerobounceResults[ioc_list] = nil
-			zerobounceLock.Unlock()
-			return
+			return nil, err
 		}
-
-		zerobounceLock.Lock()
-		zerobounceResults[ioc_list] = zerobounceResult
-		zerobounceLock.Unlock()
-
-		time.Sleep(2 * time.Second)
-	}(ioc_list)
-	span.End(spanCtx)
-
-	wg.Wait()
+		return zerobounceResult, nil
+	})
+	for _, result := range results {
+		// Out of time, return what we have so far
+		if result.Skipped {
+			continue
+		}
+		zerobounceResults[result.IOC], _ = result.Value.(*zb.ZeroBounceReport)
+	}
 	return zerobounceResults, nil
 }
 
@@ -0,0 +1,56 @@
+// Command threatapi-local serves the API and runs its jobs in a single process, without AWS.
+// Jobs are stored in a local BoltDB file and run on fixture modules answering with the results in their JSON file.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+
+	"github.com/gdcorp-infosec/threat-api/lambdas/local"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8080", "address to serve the API on")
+	db := flag.String("db", "threatapi.db", "BoltDB file to store jobs in")
+	fixtures := flag.String("fixtures", "cmd/threatapi-local/fixtures", "directory of the <module name>.json files of the fixture modules")
+	devAcceptAnyJWT := flag.Bool("dev-accept-any-jwt", false, "accept any JWT without validating it with SSO, for development only")
+	flag.Parse()
+
+	modules, err := local.LoadFixtureModules(*fixtures)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	server, err := local.NewServer(*db, modules...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	server.AcceptAnyJWT = *devAcceptAnyJWT
+	if server.AcceptAnyJWT {
+		server.Logger.Warn("Accepting any JWT without validating it, anyone who can reach the API can act as anyone")
+	}
+
+	// Stop taking requests on interrupt, then wait for the modules to wrap up
+	httpServer := &http.Server{Addr: *addr, Handler: server}
+	go func() {
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		<-interrupt
+		httpServer.Shutdown(context.Background())
+	}()
+
+	fmt.Printf("Serving the API on http://%s with %d modules\n", *addr, len(modules))
+	err = httpServer.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if err := server.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -29,6 +29,8 @@ require (
 	github.com/agiledragon/gomonkey/v2 v2.7.0
 	github.com/gdcorp-infosec/go-ldap v1.1.0
 	github.com/gdcorp-infosec/go-sso-client v1.1.0
+	github.com/santhosh-tekuri/jsonschema/v5 v5.0.0
+	go.etcd.io/bbolt v1.3.6
 )
 
 require (
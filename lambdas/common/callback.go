@@ -0,0 +1,427 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
+)
+
+const (
+	// CallbackTimestampHeader is the header with the unix time the callback was signed at
+	CallbackTimestampHeader = "X-Threat-Timestamp"
+	// CallbackSignatureHeader is the header with the HMAC signature of the callback, only set if the submitter provided a secret
+	CallbackSignatureHeader = "X-Threat-Signature"
+
+	// JobCallbacksQueueParameterName is the parameter with the URL of the queue the callbacks of jobs are sent from
+	JobCallbacksQueueParameterName = "/ThreatTools/JobCallbacks"
+
+	callbackMaxAttempts = 3
+	callbackTimeout     = time.Second * 5
+	// SQS can't delay messages any longer than this
+	callbackMaxDelay = time.Minute * 15
+)
+
+// Job statuses sent in job notifications, these match the statuses the API reports for a job
+const (
+	JobNotificationCompleted  = "Completed"
+	JobNotificationIncomplete = "Incomplete"
+	JobNotificationCancelled  = "Cancelled"
+)
+
+// callbackRetryDelay is how long we wait before the first retry of a callback, it doubles on each retry
+var callbackRetryDelay = time.Second
+
+// ErrCallbackAddressNotAllowed is returned when a callback host is, or resolves to, an address we don't call back to
+var ErrCallbackAddressNotAllowed = errors.New("callback address not allowed")
+
+// blockedCallbackNetworks are networks callbacks can't reach besides the loopback, link-local and private ones
+var blockedCallbackNetworks = []*net.IPNet{
+	mustParseCIDR("0.0.0.0/8"),
+	// Shared address space of carrier-grade NATs
+	mustParseCIDR("100.64.0.0/10"),
+}
+
+// JobCallbackMessage asks the job callbacks lambda to send the callback of a job if it finished
+type JobCallbackMessage struct {
+	JobID string `json:"jobId"`
+	// Unix time the job is checked at, for checks that wait for the job to time out
+	NotBefore float64 `json:"notBefore,omitempty"`
+}
+
+// JobNotification is the body of the callback sent to the submitter when a job finishes
+type JobNotification struct {
+	JobID            string                   `json:"jobId"`
+	JobStatus        string                   `json:"jobStatus"`
+	StartTime        float64                  `json:"startTime"`
+	EndTime          float64                  `json:"endTime"`
+	RequestedModules []string                 `json:"requestedModules"`
+	Modules          map[string]*ModuleStatus `json:"modules"`
+}
+
+// CallbackDelivery is a single attempt at delivering a callback
+type CallbackDelivery struct {
+	Attempt    int     `json:"attempt" dynamodbav:"attempt"`
+	Time       float64 `json:"time" dynamodbav:"time"`
+	StatusCode int     `json:"statusCode,omitempty" dynamodbav:"statusCode,omitempty"`
+	Error      string  `json:"error,omitempty" dynamodbav:"error,omitempty"`
+}
+
+// SignCallback returns the signature of a callback body sent at this timestamp.
+// Receivers should compute this with their secret and compare it to the CallbackSignatureHeader.
+func SignCallback(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ValidateCallbackURL returns an error if the callback URL isn't an absolute https URL,
+// or if its host is or resolves to a loopback, link-local (like the instance metadata service), private or unspecified address.
+// The address is checked again when the callback is sent, the host could resolve to something else by then.
+func ValidateCallbackURL(ctx context.Context, callbackURL string) error {
+	u, err := url.Parse(callbackURL)
+	if err != nil || u.Scheme != "https" || u.Hostname() == "" {
+		return fmt.Errorf("callback URL must be an absolute https URL")
+	}
+
+	ips := []net.IP{}
+	if ip := net.ParseIP(u.Hostname()); ip != nil {
+		ips = append(ips, ip)
+	} else {
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+		if err != nil {
+			return fmt.Errorf("error resolving callback host: %w", err)
+		}
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+	}
+	for _, ip := range ips {
+		if !callbackAddressAllowed(ip) {
+			return ErrCallbackAddressNotAllowed
+		}
+	}
+	return nil
+}
+
+// callbackAddressAllowed returns false for addresses inside our network or the host, which callbacks must not reach
+func callbackAddressAllowed(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() {
+		return false
+	}
+	for _, network := range blockedCallbackNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// callbackTransport only connects to addresses callbacks are allowed to reach.
+// The address is checked once it is resolved, right before connecting, so a host can't be pointed at our network after it was validated.
+func callbackTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout: callbackTimeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !callbackAddressAllowed(ip) {
+				return ErrCallbackAddressNotAllowed
+			}
+			return nil
+		},
+	}
+	return &http.Transport{
+		// Proxies would connect for us, past the check of the address
+		Proxy:               nil,
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: callbackTimeout,
+	}
+}
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
+
+// SendJobCallback POSTs the notification to the callback URL, retrying on network errors and server errors.
+// It returns every delivery attempt, and an error if the callback could not be delivered.
+func SendJobCallback(ctx context.Context, client *http.Client, callbackURL string, secret string, notification JobNotification) ([]CallbackDelivery, error) {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling notification: %w", err)
+	}
+
+	deliveries := []CallbackDelivery{}
+	retryDelay := callbackRetryDelay
+	for attempt := 1; attempt <= callbackMaxAttempts; attempt++ {
+		delivery, retry := sendCallback(ctx, client, callbackURL, secret, body)
+		delivery.Attempt = attempt
+		deliveries = append(deliveries, delivery)
+		if delivery.Error == "" {
+			return deliveries, nil
+		}
+		if !retry || attempt == callbackMaxAttempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return deliveries, ctx.Err()
+		case <-time.After(retryDelay):
+		}
+		retryDelay *= 2
+	}
+
+	return deliveries, fmt.Errorf("error delivering callback after %d attempts: %s", len(deliveries), deliveries[len(deliveries)-1].Error)
+}
+
+// sendCallback makes a single attempt at delivering a callback, and returns whether it's worth trying again
+func sendCallback(ctx context.Context, client *http.Client, callbackURL string, secret string, body []byte) (CallbackDelivery, bool) {
+	delivery := CallbackDelivery{Time: EpochTime(time.Now())}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		delivery.Error = fmt.Sprintf("error creating request: %s", err)
+		return delivery, false
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(CallbackTimestampHeader, timestamp)
+	if secret != "" {
+		req.Header.Set(CallbackSignatureHeader, SignCallback(secret, timestamp, body))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// Don't log the error itself, it contains the callback URL
+		delivery.Error = "error sending request"
+		return delivery, true
+	}
+	resp.Body.Close()
+	delivery.StatusCode = resp.StatusCode
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return delivery, false
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		delivery.Error = fmt.Sprintf("bad status code: %d", resp.StatusCode)
+		return delivery, true
+	default:
+		// The receiver rejected the callback, sending it again won't help
+		delivery.Error = fmt.Sprintf("bad status code: %d", resp.StatusCode)
+		return delivery, false
+	}
+}
+
+// completionNotification builds the notification for this job.
+// It returns false if the job is still waiting on modules to report.
+func (j *JobDBEntry) completionNotification(now time.Time) (JobNotification, bool) {
+	notification := JobNotification{
+		JobID:            j.JobID,
+		JobStatus:        JobNotificationCompleted,
+		StartTime:        j.StartTime,
+		EndTime:          EpochTime(now),
+		RequestedModules: j.RequestedModules,
+		Modules:          map[string]*ModuleStatus{},
+	}
+
+	unfinished := []string{}
+	for _, module := range j.RequestedModules {
+		status, ok := j.ModuleStatuses[module]
+		if !ok || status == nil {
+			status = &ModuleStatus{Status: ModulePending}
+		}
+		if !status.Finished() {
+			unfinished = append(unfinished, module)
+		}
+		notification.Modules[module] = status
+	}
+
+	if len(unfinished) > 0 {
+		lastDispatch := time.Unix(int64(math.Max(j.StartTime, j.LastDispatchTime)), 0)
+		if lastDispatch.After(now.Add(-JobTimeout)) {
+			return notification, false
+		}
+		// The job timed out, the modules that never reported won't anymore
+		notification.JobStatus = JobNotificationIncomplete
+		for _, module := range unfinished {
+			timedOut := *notification.Modules[module]
+			timedOut.Status = ModuleTimedOut
+			timedOut.ErrorCode = ModuleErrorCodeTimeout
+			timedOut.Retryable = true
+			notification.Modules[module] = &timedOut
+		}
+	}
+
+	if j.Cancelled {
+		notification.JobStatus = JobNotificationCancelled
+	}
+	return notification, true
+}
+
+// JobCallbackStore is what sending the callbacks of jobs needs from the job store, see the jobstore package
+type JobCallbackStore interface {
+	// GetJob gets a job without the responses stored apart from it, it returns nil if there is no such job
+	GetJob(ctx context.Context, jobID string) (*JobDBEntry, error)
+	// ClaimCallback marks the callback of a job as sent, it returns false if it already was
+	ClaimCallback(ctx context.Context, jobID string) (bool, error)
+	// SetCallbackDeliveries stores the delivery attempts of the callback of a job
+	SetCallbackDeliveries(ctx context.Context, jobID string, deliveries []CallbackDelivery) error
+}
+
+// getCallbackJob gets the job if it has a callback that wasn't sent yet, it returns nil otherwise
+func getCallbackJob(ctx context.Context, store JobCallbackStore, jobID string) (*JobDBEntry, error) {
+	jobEntry, err := store.GetJob(ctx, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting job: %w", err)
+	}
+	if jobEntry == nil || !jobEntry.Callback || jobEntry.CallbackSent {
+		return nil, nil
+	}
+	return jobEntry, nil
+}
+
+// EnqueueJobCallback asks the job callbacks lambda to send the callback of the job once this delay is over, if the job finished by then.
+// Jobs are checked once they time out this way, so they are called back even if some of their modules never report.
+func EnqueueJobCallback(ctx context.Context, t *toolbox.Toolbox, jobID string, delay time.Duration) error {
+	span, ctx := t.TracerLogger.StartSpan(ctx, "EnqueueJobCallback", "job", "callback", "enqueue")
+	defer span.End(ctx)
+	span.LogKV("jobID", jobID)
+
+	if t.AWSSession == nil {
+		return toolbox.ErrNoAWSSession
+	}
+	queueURL, err := t.GetFromParameterStore(ctx, JobCallbacksQueueParameterName, false)
+	if err != nil || queueURL.Value == nil {
+		span.LogKV("error", err)
+		return fmt.Errorf("error getting job callbacks queue: %w", err)
+	}
+
+	message := JobCallbackMessage{JobID: jobID}
+	if delay > 0 {
+		message.NotBefore = EpochTime(time.Now().Add(delay))
+	}
+	messageMarshalled, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("error marshalling job callback message: %w", err)
+	}
+	// Longer delays are waited for by the job callbacks lambda sending the message again
+	if delay > callbackMaxDelay {
+		delay = callbackMaxDelay
+	}
+	_, err = sqs.New(t.AWSSession).SendMessageWithContext(ctx, &sqs.SendMessageInput{
+		QueueUrl:     queueURL.Value,
+		MessageBody:  aws.String(string(messageMarshalled)),
+		DelaySeconds: aws.Int64(int64(math.Ceil(delay.Seconds()))),
+	})
+	if err != nil {
+		span.LogKV("error", err)
+		return fmt.Errorf("error sending job callback message: %w", err)
+	}
+	return nil
+}
+
+// EnqueueJobCallbackIfFinished asks the job callbacks lambda to send the callback of the job if every requested module has reported.
+// The response processor calls this for every module response, so it never waits on the callback itself.
+func EnqueueJobCallbackIfFinished(ctx context.Context, t *toolbox.Toolbox, store JobCallbackStore, jobID string) error {
+	jobEntry, err := getCallbackJob(ctx, store, jobID)
+	if err != nil || jobEntry == nil {
+		return err
+	}
+	if _, finished := jobEntry.completionNotification(time.Now()); !finished {
+		return nil
+	}
+	return EnqueueJobCallback(ctx, t, jobID, 0)
+}
+
+// NotifyJobFinished sends the callback of the job if every requested module has reported or the job timed out.
+// The callback is sent at most once, and every delivery attempt is stored on the job.
+func NotifyJobFinished(ctx context.Context, t *toolbox.Toolbox, store JobCallbackStore, jobID string) error {
+	span, ctx := t.TracerLogger.StartSpan(ctx, "NotifyJobFinished", "job", "callback", "notify")
+	defer span.End(ctx)
+	span.LogKV("jobID", jobID)
+
+	jobEntry, err := getCallbackJob(ctx, store, jobID)
+	if err != nil {
+		span.LogKV("error", err)
+		return err
+	}
+	if jobEntry == nil {
+		return nil
+	}
+	notification, finished := jobEntry.completionNotification(time.Now())
+	if !finished {
+		return nil
+	}
+
+	// Claim the callback, every module response of this job could get here at the same time
+	claimed, err := store.ClaimCallback(ctx, jobID)
+	if err != nil {
+		span.LogKV("error", err)
+		return fmt.Errorf("error claiming callback: %w", err)
+	}
+	if !claimed {
+		// Someone else is sending it
+		return nil
+	}
+
+	// The callback URL and secret are only stored in the encrypted submission
+	decryptedData, err := t.Decrypt(ctx, jobID, jobEntry.Submission)
+	if err != nil {
+		span.LogKV("error", err)
+		return fmt.Errorf("error decrypting submission: %w", err)
+	}
+	submission := JobSubmission{}
+	err = json.Unmarshal(decryptedData, &submission)
+	if err != nil {
+		return fmt.Errorf("error unmarshalling submission: %w", err)
+	}
+	if submission.CallbackURL == "" {
+		return nil
+	}
+
+	// The host may resolve to somewhere else than when the job was submitted
+	var deliveries []CallbackDelivery
+	sendErr := ValidateCallbackURL(ctx, submission.CallbackURL)
+	if sendErr != nil {
+		deliveries = []CallbackDelivery{{Attempt: 1, Time: EpochTime(time.Now()), Error: sendErr.Error()}}
+	} else {
+		client := t.GetHTTPClient(&http.Client{Timeout: callbackTimeout, Transport: callbackTransport()})
+		deliveries, sendErr = SendJobCallback(ctx, client, submission.CallbackURL, submission.CallbackSecret, notification)
+	}
+	if sendErr != nil {
+		span.LogKV("error", sendErr)
+	}
+
+	// Keep a log of the delivery attempts on the job
+	err = store.SetCallbackDeliveries(ctx, jobID, deliveries)
+	if err != nil {
+		span.LogKV("error", err)
+		return fmt.Errorf("error storing callback deliveries: %w", err)
+	}
+
+	return sendErr
+}
@@ -0,0 +1,235 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSendJobCallback(t *testing.T) {
+	callbackRetryDelay = time.Millisecond
+	ctx := context.Background()
+	notification := JobNotification{
+		JobID:            "some job ID",
+		JobStatus:        JobNotificationCompleted,
+		RequestedModules: []string{"apivoid"},
+		Modules: map[string]*ModuleStatus{
+			"apivoid": {Status: ModuleSucceeded, IOCCount: 1, ResultCount: 1},
+		},
+	}
+
+	t.Run("signed", func(t *testing.T) {
+		var received JobNotification
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			if r.Header.Get(CallbackSignatureHeader) != SignCallback("secret", r.Header.Get(CallbackTimestampHeader), body) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.Unmarshal(body, &received)
+		}))
+		defer server.Close()
+
+		deliveries, err := SendJobCallback(ctx, server.Client(), server.URL, "secret", notification)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deliveries) != 1 || deliveries[0].StatusCode != http.StatusOK {
+			t.Errorf("unexpected deliveries: %+v", deliveries)
+		}
+		if received.JobID != notification.JobID || received.Modules["apivoid"].Status != ModuleSucceeded {
+			t.Errorf("unexpected notification: %+v", received)
+		}
+	})
+
+	t.Run("unsigned without secret", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get(CallbackSignatureHeader) != "" {
+				w.WriteHeader(http.StatusBadRequest)
+			}
+		}))
+		defer server.Close()
+
+		_, err := SendJobCallback(ctx, server.Client(), server.URL, "", notification)
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("retries server errors", func(t *testing.T) {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if requests < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		defer server.Close()
+
+		deliveries, err := SendJobCallback(ctx, server.Client(), server.URL, "secret", notification)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deliveries) != 3 {
+			t.Fatalf("expected 3 deliveries, got %d", len(deliveries))
+		}
+		if deliveries[0].StatusCode != http.StatusServiceUnavailable || deliveries[0].Error == "" || deliveries[2].Error != "" {
+			t.Errorf("unexpected deliveries: %+v", deliveries)
+		}
+	})
+
+	t.Run("gives up after max attempts", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer server.Close()
+
+		deliveries, err := SendJobCallback(ctx, server.Client(), server.URL, "secret", notification)
+		if err == nil {
+			t.Error("expected error")
+		}
+		if len(deliveries) != callbackMaxAttempts {
+			t.Errorf("expected %d deliveries, got %d", callbackMaxAttempts, len(deliveries))
+		}
+	})
+
+	t.Run("does not retry rejected callbacks", func(t *testing.T) {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.WriteHeader(http.StatusForbidden)
+		}))
+		defer server.Close()
+
+		deliveries, err := SendJobCallback(ctx, server.Client(), server.URL, "secret", notification)
+		if err == nil {
+			t.Error("expected error")
+		}
+		if requests != 1 || len(deliveries) != 1 {
+			t.Errorf("expected 1 request, got %d", requests)
+		}
+	})
+}
+
+func TestCompletionNotification(t *testing.T) {
+	now := time.Now()
+
+	t.Run("waits for modules", func(t *testing.T) {
+		job := JobDBEntry{
+			StartTime:        EpochTime(now.Add(-time.Minute)),
+			RequestedModules: []string{"apivoid", "urlscanio"},
+			ModuleStatuses: map[string]*ModuleStatus{
+				"apivoid":   {Status: ModuleSucceeded},
+				"urlscanio": {Status: ModuleRunning},
+			},
+		}
+		if _, finished := job.completionNotification(now); finished {
+			t.Error("job should not be finished")
+		}
+	})
+
+	t.Run("completed", func(t *testing.T) {
+		job := JobDBEntry{
+			StartTime:        EpochTime(now.Add(-time.Minute)),
+			RequestedModules: []string{"apivoid", "urlscanio"},
+			ModuleStatuses: map[string]*ModuleStatus{
+				"apivoid":   {Status: ModuleSucceeded},
+				"urlscanio": {Status: ModuleFailed, ErrorCode: ModuleErrorCodeModule},
+			},
+		}
+		notification, finished := job.completionNotification(now)
+		if !finished || notification.JobStatus != JobNotificationCompleted {
+			t.Errorf("unexpected notification: %+v", notification)
+		}
+	})
+
+	t.Run("timed out", func(t *testing.T) {
+		job := JobDBEntry{
+			StartTime:        EpochTime(now.Add(-JobTimeout * 2)),
+			RequestedModules: []string{"apivoid", "urlscanio"},
+			ModuleStatuses: map[string]*ModuleStatus{
+				"apivoid":   {Status: ModuleSucceeded},
+				"urlscanio": {Status: ModulePending},
+			},
+		}
+		notification, finished := job.completionNotification(now)
+		if !finished || notification.JobStatus != JobNotificationIncomplete {
+			t.Fatalf("unexpected notification: %+v", notification)
+		}
+		if notification.Modules["urlscanio"].Status != ModuleTimedOut {
+			t.Errorf("unexpected module status: %+v", notification.Modules["urlscanio"])
+		}
+		if job.ModuleStatuses["urlscanio"].Status != ModulePending {
+			t.Error("job module status should not be modified")
+		}
+	})
+
+	t.Run("retried modules get the full timeout", func(t *testing.T) {
+		job := JobDBEntry{
+			StartTime:        EpochTime(now.Add(-JobTimeout * 2)),
+			LastDispatchTime: EpochTime(now.Add(-time.Minute)),
+			RequestedModules: []string{"apivoid"},
+			ModuleStatuses: map[string]*ModuleStatus{
+				"apivoid": {Status: ModulePending},
+			},
+		}
+		if _, finished := job.completionNotification(now); finished {
+			t.Error("job should not be finished")
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		job := JobDBEntry{
+			StartTime:        EpochTime(now.Add(-time.Minute)),
+			RequestedModules: []string{"apivoid"},
+			Cancelled:        true,
+			ModuleStatuses: map[string]*ModuleStatus{
+				"apivoid": {Status: ModuleCancelled, ErrorCode: ModuleErrorCodeCancelled},
+			},
+		}
+		notification, finished := job.completionNotification(now)
+		if !finished || notification.JobStatus != JobNotificationCancelled {
+			t.Errorf("unexpected notification: %+v", notification)
+		}
+	})
+}
+
+func TestValidateCallbackURL(t *testing.T) {
+	ctx := context.Background()
+	for callbackURL, allowed := range map[string]bool{
+		"https://93.184.216.34/callback":               true,
+		"https://[2606:2800:220:1:248:1893:25c8:1946]": true,
+		"http://93.184.216.34/callback":                false,
+		"/callback":                                    false,
+		"https://127.0.0.1/callback":                   false,
+		"https://[::1]/callback":                       false,
+		"https://169.254.169.254/latest/meta-data":     false,
+		"https://10.0.0.1/callback":                    false,
+		"https://172.16.0.1/callback":                  false,
+		"https://192.168.1.1/callback":                 false,
+		"https://100.64.0.1/callback":                  false,
+		"https://0.0.0.0/callback":                     false,
+		"https://[fd00::1]/callback":                   false,
+	} {
+		if err := ValidateCallbackURL(ctx, callbackURL); (err == nil) != allowed {
+			t.Errorf("expected %s to be allowed: %v, got %v", callbackURL, allowed, err)
+		}
+	}
+}
+
+func TestCallbackTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// The test server listens on the loopback address, which callbacks must not reach
+	client := &http.Client{Timeout: callbackTimeout, Transport: callbackTransport()}
+	_, err := client.Get(server.URL)
+	if !errors.Is(err, ErrCallbackAddressNotAllowed) {
+		t.Errorf("expected the connection to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+// Package cassette records the requests modules make to their vendors, and replays them in tests.
+// Tests wrap the http.Client of a module with a cassette, then run offline against the recorded responses.
+// Set CASSETTE_MODE=record to record the cassettes again against the real vendors.
+// Secrets are scrubbed from the recordings, see Scrubber.
+package cassette
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"unicode/utf8"
+)
+
+// Cassette is the requests recorded in a test, and their responses
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Interaction is a recorded request and its response
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is a recorded request, scrubbed of secrets
+type Request struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body,omitempty"`
+}
+
+// Response is a recorded response, scrubbed of secrets
+type Response struct {
+	StatusCode int         `json:"statusCode"`
+	Headers    http.Header `json:"headers,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	// Set when the body is not text, and is stored base64 encoded
+	BodyBase64 bool `json:"bodyBase64,omitempty"`
+}
+
+// Load loads the cassette at this path
+func Load(path string) (*Cassette, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cassette := &Cassette{}
+	err = json.Unmarshal(data, cassette)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling cassette %s: %w", path, err)
+	}
+	return cassette, nil
+}
+
+// Save saves the cassette at this path, creating its directory if needed
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling cassette: %w", err)
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// setBody sets the body of the response, base64 encoded if it is not text
+func (r *Response) setBody(body []byte) {
+	if utf8.Valid(body) {
+		r.Body = string(body)
+		return
+	}
+	r.Body = base64.StdEncoding.EncodeToString(body)
+	r.BodyBase64 = true
+}
+
+// body gets the body of the response
+func (r *Response) body() ([]byte, error) {
+	if r.BodyBase64 {
+		return base64.StdEncoding.DecodeString(r.Body)
+	}
+	return []byte(r.Body), nil
+}
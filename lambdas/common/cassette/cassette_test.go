@@ -0,0 +1,103 @@
+package cassette
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// failingTB records the failures of a test that is expected to fail
+type failingTB struct {
+	testing.TB
+	failed bool
+}
+
+func (t *failingTB) Error(args ...interface{}) {
+	t.failed = true
+}
+
+func TestRecordReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cassette")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "vendor.json")
+
+	requests := 0
+	vendor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ioc":"` + r.URL.Query().Get("ioc") + `","session":"vendor-session"}`))
+	}))
+	defer vendor.Close()
+
+	get := func(client *http.Client, ioc string, key string) string {
+		req, _ := http.NewRequest(http.MethodGet, vendor.URL+"/lookup?ioc="+ioc+"&key="+key, nil)
+		req.Header.Set("X-RFToken", key)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	// Record against the vendor
+	t.Run("record", func(t *testing.T) {
+		client := Wrap(t, "vendor", nil, WithMode(ModeRecord), WithPath(path), WithSecrets("secret-key"))
+		if body := get(client, "example.com", "secret-key"); !strings.Contains(body, "vendor-session") {
+			t.Errorf("expected the response of the vendor, got %s", body)
+		}
+	})
+	recording, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(recording), "secret-key") || strings.Contains(string(recording), "vendor-session") {
+		t.Errorf("expected the secrets to be scrubbed, got %s", recording)
+	}
+
+	// Replay without the vendor, with any key
+	t.Run("replay", func(t *testing.T) {
+		client := Wrap(t, "vendor", nil, WithMode(ModeReplay), WithPath(path))
+		if body := get(client, "example.com", "other-key"); body != `{"ioc":"example.com","session":"REDACTED"}` {
+			t.Errorf("expected the recorded response, got %s", body)
+		}
+	})
+	if requests != 1 {
+		t.Errorf("expected only the recording to reach the vendor, got %d requests", requests)
+	}
+
+	// Requests that weren't recorded fail
+	replayTest := &failingTB{TB: t}
+	client := Wrap(replayTest, "vendor", nil, WithMode(ModeReplay), WithPath(path))
+	if _, err := client.Get(vendor.URL + "/lookup?ioc=example.org"); err == nil || !replayTest.failed {
+		t.Errorf("expected the request to fail, got %v", err)
+	}
+}
+
+func TestScrubber(t *testing.T) {
+	scrubber := DefaultScrubber()
+	scrubber.Secrets = []string{"user:pass"}
+
+	request := scrubber.scrubRequest(Request{
+		URL:     "https://endpoint.apivoid.com/iprep/v1/pay-as-you-go/?ip=1.1.1.1&key=abc",
+		Headers: http.Header{"Api-Key": {"abc"}, "Content-Type": {"application/json"}},
+		Body:    `{"api_key":"abc", "email_batch":[{"email_address":"user:pass"}]}`,
+	})
+	if request.URL != "https://endpoint.apivoid.com/iprep/v1/pay-as-you-go/?ip=1.1.1.1&key=REDACTED" {
+		t.Errorf("expected the key query parameter to be scrubbed, got %s", request.URL)
+	}
+	if request.Headers.Get("API-Key") != Redacted || request.Headers.Get("Content-Type") != "application/json" {
+		t.Errorf("expected only the key header to be scrubbed, got %v", request.Headers)
+	}
+	if request.Body != `{"api_key":"REDACTED", "email_batch":[{"email_address":"REDACTED"}]}` {
+		t.Errorf("expected the key and secret to be scrubbed from the body, got %s", request.Body)
+	}
+}
@@ -0,0 +1,243 @@
+package cassette
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// Mode is whether a recorder replays or records its cassette
+type Mode string
+
+// Modes
+const (
+	// ModeReplay replays the recorded responses, requests that weren't recorded fail
+	ModeReplay Mode = "replay"
+	// ModeRecord sends the requests to the vendors, and records them to the cassette when the test ends
+	ModeRecord Mode = "record"
+)
+
+// modeENVVar sets the mode of every recorder, replay by default
+const modeENVVar = "CASSETTE_MODE"
+
+// Recorder is a http.RoundTripper replaying or recording a cassette
+type Recorder struct {
+	Mode     Mode
+	Path     string
+	Scrubber *Scrubber
+	// Transport sends the requests to the vendors when recording
+	Transport http.RoundTripper
+
+	t        testing.TB
+	mutex    sync.Mutex
+	cassette *Cassette
+	// Interactions already replayed, so requests sent more than once get their responses in order
+	replayed map[*Interaction]bool
+}
+
+// Option configures a recorder
+type Option func(r *Recorder)
+
+// WithSecrets scrubs these secrets from the recordings, like the keys the test gives the module
+func WithSecrets(secrets ...string) Option {
+	return func(r *Recorder) {
+		r.Scrubber.Secrets = append(r.Scrubber.Secrets, secrets...)
+	}
+}
+
+// WithScrubber scrubs the recordings with this scrubber instead of the DefaultScrubber
+func WithScrubber(scrubber *Scrubber) Option {
+	return func(r *Recorder) {
+		r.Scrubber = scrubber
+	}
+}
+
+// WithPath stores the cassette at this path instead of testdata/cassettes/<name>.json
+func WithPath(path string) Option {
+	return func(r *Recorder) {
+		r.Path = path
+	}
+}
+
+// WithMode sets the mode of the recorder instead of CASSETTE_MODE
+func WithMode(mode Mode) Option {
+	return func(r *Recorder) {
+		r.Mode = mode
+	}
+}
+
+// New creates a recorder of the cassette testdata/cassettes/<name>.json of the package under test
+func New(t testing.TB, name string, options ...Option) *Recorder {
+	t.Helper()
+	r := &Recorder{
+		Mode:      ModeReplay,
+		Path:      filepath.Join("testdata", "cassettes", name+".json"),
+		Scrubber:  DefaultScrubber(),
+		Transport: http.DefaultTransport,
+		t:         t,
+		cassette:  &Cassette{},
+		replayed:  map[*Interaction]bool{},
+	}
+	if mode := os.Getenv(modeENVVar); mode != "" {
+		r.Mode = Mode(mode)
+	}
+	for _, option := range options {
+		option(r)
+	}
+
+	switch r.Mode {
+	case ModeReplay:
+		cassette, err := Load(r.Path)
+		if err != nil {
+			t.Fatalf("error loading cassette, record it with %s=%s: %s", modeENVVar, ModeRecord, err)
+		}
+		r.cassette = cassette
+	case ModeRecord:
+		t.Cleanup(func() {
+			if err := r.cassette.Save(r.Path); err != nil {
+				t.Errorf("error saving cassette: %s", err)
+			}
+		})
+	default:
+		t.Fatalf("unknown cassette mode %q", r.Mode)
+	}
+	return r
+}
+
+// Wrap returns a copy of the client sending its requests through a recorder of the cassette, see New.
+// Requests are recorded through the transport of the client.
+func Wrap(t testing.TB, name string, client *http.Client, options ...Option) *http.Client {
+	t.Helper()
+	r := New(t, name, options...)
+	wrapped := &http.Client{}
+	if client != nil {
+		*wrapped = *client
+		if client.Transport != nil {
+			r.Transport = client.Transport
+		}
+	}
+	wrapped.Transport = r
+	return wrapped
+}
+
+// RoundTrip replays or records the request
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	request, err := newRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	request = r.Scrubber.scrubRequest(request)
+
+	if r.Mode == ModeRecord {
+		return r.record(req, request)
+	}
+	// Like a real transport, requests whose context is done are never sent
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+	interaction := r.find(request)
+	if interaction == nil {
+		err = fmt.Errorf("no recorded response to %s %s in %s", request.Method, request.URL, r.Path)
+		r.t.Error(err)
+		return nil, err
+	}
+	return newResponse(req, interaction.Response)
+}
+
+// record sends the request, and records it with its response
+func (r *Recorder) record(req *http.Request, request Request) (*http.Response, error) {
+	resp, err := r.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	// Scrubbing can change the length of the body
+	response := Response{StatusCode: resp.StatusCode, Headers: resp.Header.Clone()}
+	response.Headers.Del("Content-Length")
+	response.setBody(body)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, &Interaction{
+		Request:  request,
+		Response: r.Scrubber.scrubResponse(response),
+	})
+	return resp, nil
+}
+
+// find finds the recording of the request, the first one not yet replayed if it was recorded more than once
+func (r *Recorder) find(request Request) *Interaction {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var last *Interaction
+	for _, interaction := range r.cassette.Interactions {
+		if !interaction.Request.matches(request) {
+			continue
+		}
+		if !r.replayed[interaction] {
+			r.replayed[interaction] = true
+			return interaction
+		}
+		last = interaction
+	}
+	// Requests sent more times than they were recorded get the last response
+	return last
+}
+
+// matches returns true if the scrubbed requests are the same, headers are ignored
+func (request Request) matches(other Request) bool {
+	return request.Method == other.Method && request.URL == other.URL && request.Body == other.Body
+}
+
+// newRequest records a request, without consuming its body
+func newRequest(req *http.Request) (Request, error) {
+	request := Request{
+		Method:  req.Method,
+		URL:     req.URL.String(),
+		Headers: req.Header.Clone(),
+	}
+	if req.Body == nil || req.Body == http.NoBody {
+		return request, nil
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return request, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	request.Body = string(body)
+	return request, nil
+}
+
+// newResponse replays a recorded response to the request
+func newResponse(req *http.Request, response Response) (*http.Response, error) {
+	body, err := response.body()
+	if err != nil {
+		return nil, fmt.Errorf("error decoding recorded body: %w", err)
+	}
+	header := response.Headers.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", response.StatusCode, http.StatusText(response.StatusCode)),
+		StatusCode:    response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
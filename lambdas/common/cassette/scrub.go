@@ -0,0 +1,113 @@
+package cassette
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces the secrets scrubbed from recordings
+const Redacted = "REDACTED"
+
+// Scrubber removes secrets from recorded requests and responses.
+// Requests are scrubbed the same way before they are matched to recordings, so tests can use any keys.
+type Scrubber struct {
+	// Headers with secrets, like API keys and credentials, matched case insensitively
+	Headers []string
+	// Query parameters with secrets, matched case insensitively
+	QueryParams []string
+	// JSON fields with secrets in request and response bodies
+	JSONFields []string
+	// Secrets replaced wherever they appear, like the keys of a test
+	Secrets []string
+}
+
+// DefaultScrubber scrubs the headers, query parameters and JSON fields modules send their vendors keys in
+func DefaultScrubber() *Scrubber {
+	return &Scrubber{
+		Headers:     []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "API-Key", "X-Api-Key", "X-Apikey", "X-RFToken", "Session"},
+		QueryParams: []string{"key", "apikey", "api_key", "token", "access_token", "password"},
+		JSONFields:  []string{"api_key", "apikey", "password", "session", "token"},
+	}
+}
+
+// scrubRequest returns the request scrubbed of secrets
+func (s *Scrubber) scrubRequest(request Request) Request {
+	request.URL = s.scrubURL(request.URL)
+	request.Headers = s.scrubHeaders(request.Headers)
+	request.Body = s.scrubBody(request.Body)
+	return request
+}
+
+// scrubResponse returns the response scrubbed of secrets, bodies that are not text are left as they are
+func (s *Scrubber) scrubResponse(response Response) Response {
+	response.Headers = s.scrubHeaders(response.Headers)
+	if !response.BodyBase64 {
+		response.Body = s.scrubBody(response.Body)
+	}
+	return response
+}
+
+// scrubURL replaces the values of the secret query parameters, and the secrets anywhere else in the URL
+func (s *Scrubber) scrubURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return s.scrubSecrets(rawURL)
+	}
+	query := u.Query()
+	for name := range query {
+		if containsFold(s.QueryParams, name) {
+			query.Set(name, Redacted)
+		}
+	}
+	u.RawQuery = query.Encode()
+	return s.scrubSecrets(u.String())
+}
+
+// scrubHeaders returns a copy of the headers with the values of secret headers replaced
+func (s *Scrubber) scrubHeaders(headers http.Header) http.Header {
+	if headers == nil {
+		return nil
+	}
+	scrubbed := http.Header{}
+	for name, values := range headers {
+		for _, value := range values {
+			if containsFold(s.Headers, name) {
+				value = Redacted
+			}
+			scrubbed.Add(name, s.scrubSecrets(value))
+		}
+	}
+	return scrubbed
+}
+
+// scrubBody replaces the values of the secret JSON fields, and the secrets anywhere else in the body
+func (s *Scrubber) scrubBody(body string) string {
+	for _, field := range s.JSONFields {
+		fieldRegex := regexp.MustCompile(fmt.Sprintf(`("%s"\s*:\s*)"(?:[^"\\]|\\.)*"`, regexp.QuoteMeta(field)))
+		body = fieldRegex.ReplaceAllString(body, fmt.Sprintf(`$1"%s"`, Redacted))
+	}
+	return s.scrubSecrets(body)
+}
+
+// scrubSecrets replaces the secrets in a string
+func (s *Scrubber) scrubSecrets(value string) string {
+	for _, secret := range s.Secrets {
+		if secret != "" {
+			value = strings.ReplaceAll(value, secret, Redacted)
+			value = strings.ReplaceAll(value, url.QueryEscape(secret), Redacted)
+		}
+	}
+	return value
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
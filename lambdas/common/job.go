@@ -4,16 +4,25 @@ package common
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
 	"github.com/godaddy/asherah/go/appencryption"
 )
 
+// JobTimeout is how long we wait for the modules of a job to report before giving up on them
+const JobTimeout = time.Minute * 15
+
 // JobSNSMessage is the structure sent via the SNS topic to represent a job ready for processing
 type JobSNSMessage struct {
 	JobID      string                        `json:"jobId"`
 	Submission events.APIGatewayProxyRequest `json:"submission"`
+	// The owner of the job, whose quota of each module the calls of the module count against
+	Username string `json:"username,omitempty"`
 }
 
 // CompletedJobData is a set of completed data from a job.
@@ -22,19 +31,45 @@ type CompletedJobData struct {
 	ModuleName string `json:"module_name" dynamodbav:"module_name"`
 	JobID      string `json:"jobId" dynamodbav:"jobId"`
 	Response   string `json:"response" dynamodbav:"response"`
+	// Status of the module for this job, stored next to the response
+	Status *ModuleStatus `json:"status,omitempty" dynamodbav:"status,omitempty"`
+	// Set instead of the response when the response was too large to send inline, see OffloadLargeResponse
+	ResponseReference *ResponseReference `json:"responseReference,omitempty" dynamodbav:"-"`
 }
 
 // JobDBEntry is a job entry stored in the database.
 // This is also used as the standard structure to return to API responses
 type JobDBEntry struct {
 	JobID string `dynamodbav:"jobId" json:"jobId"`
+	// Requester of the job, and the original requester of jobs submitted through a proxy
+	Username        string `dynamodbav:"username" json:"-"`
+	OriginRequester string `dynamodbav:"originrequester,omitempty" json:"-"`
 	// Map of module name to the encrypted data
 	Responses  map[string]appencryption.DataRowRecord `dynamodbav:"responses" json:"-"`
 	Submission appencryption.DataRowRecord            `dynamodbav:"submission" json:"-"`
 	// Epoch start time
 	StartTime float64 `dynamodbav:"startTime" json:"startTime"`
+	// Epoch time the job expires, see JobTTL
+	TTL int64 `dynamodbav:"ttl,omitempty" json:"-"`
+	// Epoch time modules were last sent this job, set when modules are retried
+	LastDispatchTime float64 `dynamodbav:"lastDispatchTime,omitempty" json:"lastDispatchTime,omitempty"`
 	// Array of requested modules
 	RequestedModules []string `dynamodbav:"requestedModules" json:"requestedModules"`
+	// Set when the requester cancelled the job
+	Cancelled bool `dynamodbav:"cancelled,omitempty" json:"cancelled,omitempty"`
+	// Map of module name to the status of that module, jobs created before module statuses were added don't have this
+	ModuleStatuses map[string]*ModuleStatus `dynamodbav:"moduleStatus" json:"moduleStatus,omitempty"`
+	// Set when the submission has a callback URL, the URL itself is only stored in the encrypted submission
+	Callback bool `dynamodbav:"callback,omitempty" json:"-"`
+	// Set once the callback was claimed for sending, so it is only sent once
+	CallbackSent bool `dynamodbav:"callbackSent,omitempty" json:"-"`
+	// Every attempt at delivering the callback
+	CallbackDeliveries []CallbackDelivery `dynamodbav:"callbackDeliveries,omitempty" json:"callbackDeliveries,omitempty"`
+	// Unencrypted copies of the parts of the submission needed to list and filter jobs.
+	// Jobs created before these were added don't have IOCTypes set.
+	IOCTypes []string               `dynamodbav:"iocTypes" json:"iocTypes,omitempty"`
+	Tags     []string               `dynamodbav:"tags,omitempty" json:"tags,omitempty"`
+	Metadata map[string]interface{} `dynamodbav:"metadata,omitempty" json:"-"`
 
 	// Decrypted data
 	// The ignore tags in dynamodbav are to prevent the json tags
@@ -45,6 +80,19 @@ type JobDBEntry struct {
 
 // Decrypt will use asherah to decrypt the Responses and Submission
 func (j *JobDBEntry) Decrypt(ctx context.Context, t *toolbox.Toolbox) {
+	j.decrypt(ctx, t, func(moduleName string) bool { return true })
+}
+
+// DecryptModules will use asherah to decrypt the Submission and only the Responses of these modules
+func (j *JobDBEntry) DecryptModules(ctx context.Context, t *toolbox.Toolbox, modules []string) {
+	include := map[string]bool{}
+	for _, moduleName := range modules {
+		include[moduleName] = true
+	}
+	j.decrypt(ctx, t, func(moduleName string) bool { return include[moduleName] })
+}
+
+func (j *JobDBEntry) decrypt(ctx context.Context, t *toolbox.Toolbox, include func(moduleName string) bool) {
 	span, ctx := t.TracerLogger.StartSpan(ctx, "DecryptJobDBEntry", "job", "db", "decrypt")
 	defer span.End(ctx)
 
@@ -53,6 +101,8 @@ func (j *JobDBEntry) Decrypt(ctx context.Context, t *toolbox.Toolbox) {
 	decryptedData, err := t.Decrypt(ctx, j.JobID, j.Submission)
 	if err == nil {
 		json.Unmarshal(decryptedData, &j.DecryptedSubmission)
+		// The callback secret is only for signing callbacks, never hand it back out
+		delete(j.DecryptedSubmission, "callbackSecret")
 	}
 	span.End(ctx)
 
@@ -60,10 +110,21 @@ func (j *JobDBEntry) Decrypt(ctx context.Context, t *toolbox.Toolbox) {
 	span, ctx = t.TracerLogger.StartSpan(ctx, "DecryptResponses", "job", "responses", "decrypt")
 	j.DecryptedResponses = map[string]interface{}{}
 	for moduleName, response := range j.Responses {
+		if !include(moduleName) {
+			continue
+		}
 		decryptedData, err := t.Decrypt(ctx, j.JobID, response)
 		if err != nil {
 			continue
 		}
+		// Responses too large for the job DB are stored in the job bucket
+		if reference := getResponseReference(decryptedData); reference != nil {
+			decryptedData, err = fetchLargeResponse(ctx, t, j.JobID, reference)
+			if err != nil {
+				span.LogKV("error", err)
+				decryptedData, _ = json.Marshal([]map[string]string{{"error": fmt.Sprintf("error fetching the response: %s", err)}})
+			}
+		}
 		// Try to unmarshal the response data
 		var unmarshalledDecryptedData interface{}
 		err = json.Unmarshal(decryptedData, &unmarshalledDecryptedData)
@@ -82,6 +143,28 @@ type JobSubmission struct {
 	Modules []string `json:"modules"` // List of modules to run
 	IOCs    []string `json:"iocs"`    // List of IOCs
 	IOCType string   `json:"iocType"`
+	// IOCs grouped by type, set instead of IOCType when a submission contains multiple IOC types
+	IOCGroups map[triage.IOCType][]string `json:"iocGroups,omitempty"`
+	// Skip cached module results and fetch fresh data from the vendors
+	NoCache bool `json:"noCache,omitempty"`
+	// Free form data about the job, stored unencrypted so it can be listed without decrypting the job
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	// Tags to filter the job list by, stored unencrypted
+	Tags []string `json:"tags,omitempty"`
+	// URL to POST a notification to when the job finishes
+	CallbackURL string `json:"callbackUrl,omitempty"`
+	// Optional secret used to sign the notification
+	CallbackSecret string `json:"callbackSecret,omitempty"`
+}
+
+// GetIOCGroups returns the IOCs of this submission grouped by IOC type
+func (j JobSubmission) GetIOCGroups() map[triage.IOCType][]string {
+	if len(j.IOCGroups) > 0 {
+		return j.IOCGroups
+	}
+	return map[triage.IOCType][]string{
+		triage.IOCType(strings.ToUpper(j.IOCType)): j.IOCs,
+	}
 }
 
 // GetJobSubmission Pulls out the job submission from a AWS proxy event
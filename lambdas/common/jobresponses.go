@@ -0,0 +1,199 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
+	"github.com/godaddy/asherah/go/appencryption"
+)
+
+// JobTTL is how long jobs and their responses are kept,
+// the expiration of the job bucket in SC-JobResponseBucket.yaml must match it
+const JobTTL = time.Hour * 24 * 30
+
+// Each module response is its own item in the job responses DB, so a job isn't limited by the size of a single item.
+// Jobs created before this have their responses in the responses map of the job itself, see MigrateJobResponses.
+const (
+	jobResponsesJobIDKey  = "jobId"
+	jobResponsesModuleKey = "module_name"
+	// DynamoDB writes at most 25 items per batch
+	maxBatchWriteItems = 25
+)
+
+// JobResponseDBEntry is a module response stored in the job responses DB
+type JobResponseDBEntry struct {
+	JobID      string                      `dynamodbav:"jobId"`
+	ModuleName string                      `dynamodbav:"module_name"`
+	Response   appencryption.DataRowRecord `dynamodbav:"response"`
+	TTL        int64                       `dynamodbav:"ttl"`
+}
+
+// NewJobResponseDBItem builds the job responses DB item of an encrypted module response
+func NewJobResponseDBItem(jobID string, moduleName string, response appencryption.DataRowRecord) (map[string]*dynamodb.AttributeValue, error) {
+	return dynamodbattribute.MarshalMap(JobResponseDBEntry{
+		JobID:      jobID,
+		ModuleName: moduleName,
+		Response:   response,
+		TTL:        time.Now().Add(JobTTL).Unix(),
+	})
+}
+
+// LoadResponses adds the responses of this job stored in the job responses DB to its Responses.
+// They replace responses of the same module stored in the job itself.
+func (j *JobDBEntry) LoadResponses(ctx context.Context, t *toolbox.Toolbox) error {
+	span, ctx := t.TracerLogger.StartSpan(ctx, "LoadJobResponses", "job", "responses", "get")
+	defer span.End(ctx)
+	span.LogKV("jobID", j.JobID)
+
+	if t.AWSSession == nil {
+		return toolbox.ErrNoAWSSession
+	}
+	dynamodbClient := dynamodb.New(t.AWSSession)
+
+	keyCondition := expression.Key(jobResponsesJobIDKey).Equal(expression.Value(j.JobID))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCondition).Build()
+	if err != nil {
+		return fmt.Errorf("error creating query expression: %w", err)
+	}
+
+	if j.Responses == nil {
+		j.Responses = map[string]appencryption.DataRowRecord{}
+	}
+	input := &dynamodb.QueryInput{
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		KeyConditionExpression:    expr.KeyCondition(),
+		TableName:                 &t.JobResponsesDBTableName,
+	}
+	for {
+		output, err := dynamodbClient.Query(input)
+		if err != nil {
+			span.LogKV("error", err)
+			return fmt.Errorf("error querying job responses: %w", err)
+		}
+		for _, item := range output.Items {
+			entry := JobResponseDBEntry{}
+			err = dynamodbattribute.UnmarshalMap(item, &entry)
+			if err != nil {
+				span.LogKV("error", err)
+				continue
+			}
+			j.Responses[entry.ModuleName] = entry.Response
+		}
+		if len(output.LastEvaluatedKey) == 0 {
+			break
+		}
+		input.ExclusiveStartKey = output.LastEvaluatedKey
+	}
+	span.LogKV("responses", len(j.Responses))
+
+	return nil
+}
+
+// DeleteJobResponses deletes the responses of these modules from the job responses DB
+func DeleteJobResponses(ctx context.Context, t *toolbox.Toolbox, jobID string, modules []string) error {
+	span, ctx := t.TracerLogger.StartSpan(ctx, "DeleteJobResponses", "job", "responses", "delete")
+	defer span.End(ctx)
+	span.LogKV("jobID", jobID)
+
+	if t.AWSSession == nil {
+		return toolbox.ErrNoAWSSession
+	}
+	dynamodbClient := dynamodb.New(t.AWSSession)
+
+	for start := 0; start < len(modules); start += maxBatchWriteItems {
+		end := start + maxBatchWriteItems
+		if end > len(modules) {
+			end = len(modules)
+		}
+		writeRequests := []*dynamodb.WriteRequest{}
+		for _, module := range modules[start:end] {
+			writeRequests = append(writeRequests, &dynamodb.WriteRequest{DeleteRequest: &dynamodb.DeleteRequest{
+				Key: map[string]*dynamodb.AttributeValue{
+					jobResponsesJobIDKey:  {S: aws.String(jobID)},
+					jobResponsesModuleKey: {S: aws.String(module)},
+				},
+			}})
+		}
+		requestItems := map[string][]*dynamodb.WriteRequest{t.JobResponsesDBTableName: writeRequests}
+		// Throttled deletes are returned as unprocessed, try them again
+		for attempt := 0; len(requestItems) > 0 && attempt < 3; attempt++ {
+			output, err := dynamodbClient.BatchWriteItem(&dynamodb.BatchWriteItemInput{RequestItems: requestItems})
+			if err != nil {
+				span.LogKV("error", err)
+				return fmt.Errorf("error deleting job responses: %w", err)
+			}
+			requestItems = output.UnprocessedItems
+		}
+		if len(requestItems) > 0 {
+			return fmt.Errorf("error deleting job responses: %d responses were not deleted", len(requestItems[t.JobResponsesDBTableName]))
+		}
+	}
+
+	return nil
+}
+
+// MigrateJobResponses moves the responses stored in a job created before the job responses DB to it.
+// Responses already in the job responses DB are newer and are kept.
+// It returns the number of responses moved.
+func MigrateJobResponses(ctx context.Context, t *toolbox.Toolbox, jobEntry *JobDBEntry) (int, error) {
+	span, ctx := t.TracerLogger.StartSpan(ctx, "MigrateJobResponses", "job", "responses", "migrate")
+	defer span.End(ctx)
+	span.LogKV("jobID", jobEntry.JobID)
+
+	if t.AWSSession == nil {
+		return 0, toolbox.ErrNoAWSSession
+	}
+	dynamodbClient := dynamodb.New(t.AWSSession)
+
+	moved := 0
+	for moduleName, response := range jobEntry.Responses {
+		item, err := NewJobResponseDBItem(jobEntry.JobID, moduleName, response)
+		if err != nil {
+			return moved, fmt.Errorf("error marshalling job response: %w", err)
+		}
+		_, err = dynamodbClient.PutItem(&dynamodb.PutItemInput{
+			Item:                item,
+			ConditionExpression: aws.String("attribute_not_exists(jobId)"),
+			TableName:           &t.JobResponsesDBTableName,
+		})
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			continue
+		}
+		if err != nil {
+			span.LogKV("error", err)
+			return moved, fmt.Errorf("error storing job response: %w", err)
+		}
+		moved++
+	}
+
+	// Keep an empty map so removing the response of a retried module still works
+	update := expression.Set(expression.Name("responses"), expression.Value(map[string]interface{}{}))
+	expr, err := expression.NewBuilder().WithUpdate(update).Build()
+	if err != nil {
+		return moved, fmt.Errorf("error creating update expression: %w", err)
+	}
+	_, err = dynamodbClient.UpdateItem(&dynamodb.UpdateItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			"jobId": {S: aws.String(jobEntry.JobID)},
+		},
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		UpdateExpression:          expr.Update(),
+		TableName:                 &t.JobDBTableName,
+	})
+	if err != nil {
+		span.LogKV("error", err)
+		return moved, fmt.Errorf("error removing responses from job: %w", err)
+	}
+	span.LogKV("moved", moved)
+
+	return moved, nil
+}
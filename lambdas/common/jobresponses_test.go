@@ -0,0 +1,72 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/agiledragon/gomonkey/v2"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
+	"github.com/godaddy/asherah/go/appencryption"
+)
+
+func TestLoadResponses(t *testing.T) {
+	tb := toolbox.GetToolbox()
+	storedItem, err := NewJobResponseDBItem("job", "shodan", appencryption.DataRowRecord{Data: []byte("new")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var queries []*dynamodb.QueryInput
+	patches := gomonkey.ApplyMethod(reflect.TypeOf(&dynamodb.DynamoDB{}), "Query", func(_ *dynamodb.DynamoDB, input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+		queries = append(queries, input)
+		// Return the stored response on the second page
+		if input.ExclusiveStartKey == nil {
+			return &dynamodb.QueryOutput{LastEvaluatedKey: storedItem}, nil
+		}
+		return &dynamodb.QueryOutput{Items: []map[string]*dynamodb.AttributeValue{storedItem}}, nil
+	})
+	defer patches.Reset()
+
+	// Responses in the job responses DB replace the ones stored in the job
+	jobEntry := &JobDBEntry{
+		JobID: "job",
+		Responses: map[string]appencryption.DataRowRecord{
+			"shodan":  {Data: []byte("old")},
+			"urlhaus": {Data: []byte("legacy")},
+		},
+	}
+	if err := jobEntry.LoadResponses(context.Background(), tb); err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 2 || *queries[0].TableName != tb.JobResponsesDBTableName {
+		t.Errorf("expected 2 queries of the job responses DB, got %v", queries)
+	}
+	if string(jobEntry.Responses["shodan"].Data) != "new" || string(jobEntry.Responses["urlhaus"].Data) != "legacy" {
+		t.Errorf("expected the stored response to replace the one in the job, got %v", jobEntry.Responses)
+	}
+}
+
+func TestDeleteJobResponses(t *testing.T) {
+	tb := toolbox.GetToolbox()
+
+	var batches []int
+	patches := gomonkey.ApplyMethod(reflect.TypeOf(&dynamodb.DynamoDB{}), "BatchWriteItem", func(_ *dynamodb.DynamoDB, input *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+		batches = append(batches, len(input.RequestItems[tb.JobResponsesDBTableName]))
+		return &dynamodb.BatchWriteItemOutput{}, nil
+	})
+	defer patches.Reset()
+
+	modules := []string{}
+	for i := 0; i < 30; i++ {
+		modules = append(modules, fmt.Sprintf("module%d", i))
+	}
+	if err := DeleteJobResponses(context.Background(), tb, "job", modules); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(batches, []int{25, 5}) {
+		t.Errorf("expected the deletes to be split in batches of 25, got %v", batches)
+	}
+}
@@ -0,0 +1,603 @@
+package jobstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/godaddy/asherah/go/appencryption"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// jobsBucket maps job IDs to jobs, stored as the same items as in the jobs table
+	jobsBucket = []byte("jobs")
+	// userJobsBucket has a bucket of job keys per user, sorted by start time so they can be listed in order
+	userJobsBucket = []byte("userJobs")
+	// responsesBucket has a bucket per job, mapping module names to their encrypted responses
+	responsesBucket = []byte("responses")
+	// keysBucket has a bucket per encryption key ID, mapping when the keys were created to the keys
+	keysBucket = []byte("keys")
+	// sightingsBucket has a bucket per IOC hash, mapping job IDs to the sightings of the IOC in them
+	sightingsBucket = []byte("sightings")
+)
+
+// BoltDB files can only be opened once, so the stores are shared within a process
+var (
+	boltStoresMutex sync.Mutex
+	boltStores      = map[string]*BoltStore{}
+)
+
+// BoltStore stores jobs in an embedded BoltDB file, for local runs and integration tests.
+// Jobs are kept until they are deleted, their TTL is ignored.
+// It is also an asherah metastore, so the keys jobs are encrypted with are kept with them.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// OpenBoltStore opens the job store in the BoltDB file at this path, creating it if needed
+func OpenBoltStore(path string) (*BoltStore, error) {
+	boltStoresMutex.Lock()
+	defer boltStoresMutex.Unlock()
+	if store, ok := boltStores[path]; ok {
+		return store, nil
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second * 5})
+	if err != nil {
+		return nil, fmt.Errorf("error opening job store: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{jobsBucket, userJobsBucket, responsesBucket, keysBucket, sightingsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating job store buckets: %w", err)
+	}
+
+	store := &BoltStore{db: db}
+	boltStores[path] = store
+	return store, nil
+}
+
+// Close closes the BoltDB file of the store
+func (s *BoltStore) Close() error {
+	boltStoresMutex.Lock()
+	defer boltStoresMutex.Unlock()
+	delete(boltStores, s.db.Path())
+	return s.db.Close()
+}
+
+// CreateJob stores a new job
+func (s *BoltStore) CreateJob(ctx context.Context, job *common.JobDBEntry) error {
+	item, err := dynamodbattribute.NewEncoder(func(e *dynamodbattribute.Encoder) {
+		e.EnableEmptyCollections = true
+	}).Encode(job)
+	if err != nil {
+		return fmt.Errorf("error marshalling job: %w", err)
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		err := putJobItem(tx, job.JobID, item.M)
+		if err != nil {
+			return err
+		}
+		userJobs, err := tx.Bucket(userJobsBucket).CreateBucketIfNotExists([]byte(job.Username))
+		if err != nil {
+			return fmt.Errorf("error storing job of user: %w", err)
+		}
+		return userJobs.Put(userJobKey(int64(job.StartTime), job.JobID), []byte{})
+	})
+}
+
+// GetJob gets a job without its responses, it returns nil if there is no such job
+func (s *BoltStore) GetJob(ctx context.Context, jobID string) (job *common.JobDBEntry, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		job, err = getJob(tx, jobID)
+		return err
+	})
+	return job, err
+}
+
+// LoadResponses adds the responses of the job to its Responses
+func (s *BoltStore) LoadResponses(ctx context.Context, job *common.JobDBEntry) error {
+	if job.Responses == nil {
+		job.Responses = map[string]appencryption.DataRowRecord{}
+	}
+	return s.db.View(func(tx *bolt.Tx) error {
+		responses := tx.Bucket(responsesBucket).Bucket([]byte(job.JobID))
+		if responses == nil {
+			return nil
+		}
+		return responses.ForEach(func(moduleName, data []byte) error {
+			response := appencryption.DataRowRecord{}
+			if err := json.Unmarshal(data, &response); err != nil {
+				return fmt.Errorf("error unmarshalling response of %s: %w", moduleName, err)
+			}
+			job.Responses[string(moduleName)] = response
+			return nil
+		})
+	})
+}
+
+// ListJobs lists the jobs of a user matching the query, newest first
+func (s *BoltStore) ListJobs(ctx context.Context, username string, query JobsQuery) ([]*common.JobDBEntry, *Cursor, error) {
+	jobs := []*common.JobDBEntry{}
+	var next *Cursor
+	err := s.db.View(func(tx *bolt.Tx) error {
+		userJobs := tx.Bucket(userJobsBucket).Bucket([]byte(username))
+		if userJobs == nil {
+			return nil
+		}
+
+		// Pages start right after the last job of the previous page
+		cursor := userJobs.Cursor()
+		key, _ := cursor.Last()
+		if query.Start != nil {
+			startTime, _ := strconv.ParseFloat(query.Start.StartTime, 64)
+			if key, _ = cursor.Seek(userJobKey(int64(startTime), query.Start.JobID)); key != nil {
+				key, _ = cursor.Prev()
+			} else {
+				key, _ = cursor.Last()
+			}
+		}
+
+		for ; key != nil; key, _ = cursor.Prev() {
+			startTime, jobID := parseUserJobKey(key)
+			if query.To != 0 && startTime > query.To {
+				continue
+			}
+			if query.From != 0 && startTime < query.From {
+				break
+			}
+			job, err := getJob(tx, jobID)
+			if err != nil {
+				return err
+			}
+			if job == nil || !jobMatchesQuery(job, query) {
+				continue
+			}
+			if query.Limit > 0 && int64(len(jobs)) == query.Limit {
+				next = JobCursor(jobs[len(jobs)-1])
+				break
+			}
+			jobs = append(jobs, job)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting jobs from database: %w", err)
+	}
+	return jobs, next, nil
+}
+
+// UpdateResponse stores the encrypted response of a module of a job, and its status if it is set
+func (s *BoltStore) UpdateResponse(ctx context.Context, jobID string, moduleName string, response appencryption.DataRowRecord, status *common.ModuleStatus) error {
+	responseMarshalled, err := json.Marshal(response)
+	if err != nil {
+		return fmt.Errorf("error marshalling job response: %w", err)
+	}
+	var statusMarshalled *dynamodb.AttributeValue
+	if status != nil {
+		statusMarshalled, err = dynamodbattribute.Marshal(status)
+		if err != nil {
+			return fmt.Errorf("error marshalling module status: %w", err)
+		}
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		responses, err := tx.Bucket(responsesBucket).CreateBucketIfNotExists([]byte(jobID))
+		if err != nil {
+			return fmt.Errorf("error storing job response: %w", err)
+		}
+		err = responses.Put([]byte(moduleName), responseMarshalled)
+		if err != nil {
+			return fmt.Errorf("error storing job response: %w", err)
+		}
+
+		if statusMarshalled == nil {
+			return nil
+		}
+		item, err := getJobItem(tx, jobID)
+		if err != nil || item == nil {
+			return err
+		}
+		moduleStatuses, ok := item["moduleStatus"]
+		if !ok || moduleStatuses.M == nil {
+			return nil
+		}
+		moduleStatuses.M[moduleName] = statusMarshalled
+		return putJobItem(tx, jobID, item)
+	})
+}
+
+// DeleteJob deletes a job and its responses
+func (s *BoltStore) DeleteJob(ctx context.Context, jobID string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		job, err := getJob(tx, jobID)
+		if err != nil || job == nil {
+			return err
+		}
+		err = tx.Bucket(jobsBucket).Delete([]byte(jobID))
+		if err != nil {
+			return err
+		}
+		if userJobs := tx.Bucket(userJobsBucket).Bucket([]byte(job.Username)); userJobs != nil {
+			err = userJobs.Delete(userJobKey(int64(job.StartTime), jobID))
+			if err != nil {
+				return err
+			}
+		}
+		err = tx.Bucket(responsesBucket).DeleteBucket([]byte(jobID))
+		if err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+		return nil
+	})
+}
+
+// GetJobStatuses gets these jobs whole, mapped by job ID
+func (s *BoltStore) GetJobStatuses(ctx context.Context, jobIDs []string) (map[string]*common.JobDBEntry, error) {
+	jobs := map[string]*common.JobDBEntry{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		for _, jobID := range jobIDs {
+			job, err := getJob(tx, jobID)
+			if err != nil {
+				return err
+			}
+			if job != nil {
+				jobs[jobID] = job
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting jobs from database: %w", err)
+	}
+	return jobs, nil
+}
+
+// CancelJob sets the cancelled flag of a job, if it still exists
+func (s *BoltStore) CancelJob(ctx context.Context, jobID string) error {
+	return s.updateJobItem(jobID, func(item map[string]*dynamodb.AttributeValue) error {
+		item["cancelled"] = &dynamodb.AttributeValue{BOOL: aws.Bool(true)}
+		return nil
+	})
+}
+
+// IsJobCancelled returns true if the requester cancelled this job
+func (s *BoltStore) IsJobCancelled(ctx context.Context, jobID string) (bool, error) {
+	job, err := s.GetJob(ctx, jobID)
+	if err != nil || job == nil {
+		return false, err
+	}
+	return job.Cancelled, nil
+}
+
+// AddModules appends these modules to the requested modules of a job
+func (s *BoltStore) AddModules(ctx context.Context, job *common.JobDBEntry, modules []string) error {
+	return s.updateJobItem(job.JobID, func(item map[string]*dynamodb.AttributeValue) error {
+		requestedModules, ok := item["requestedModules"]
+		if !ok || requestedModules.L == nil {
+			requestedModules = &dynamodb.AttributeValue{L: []*dynamodb.AttributeValue{}}
+			item["requestedModules"] = requestedModules
+		}
+		for _, module := range modules {
+			requestedModules.L = append(requestedModules.L, &dynamodb.AttributeValue{S: aws.String(module)})
+		}
+		return resetModuleItems(item, modules)
+	})
+}
+
+// ResetModules removes the responses of these modules and marks them as pending again
+func (s *BoltStore) ResetModules(ctx context.Context, job *common.JobDBEntry, modules []string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if responses := tx.Bucket(responsesBucket).Bucket([]byte(job.JobID)); responses != nil {
+			for _, module := range modules {
+				if err := responses.Delete([]byte(module)); err != nil {
+					return fmt.Errorf("error deleting job response: %w", err)
+				}
+			}
+		}
+
+		item, err := getJobItem(tx, job.JobID)
+		if err != nil || item == nil {
+			return err
+		}
+		if responses, ok := item["responses"]; ok && responses.M != nil {
+			for _, module := range modules {
+				delete(responses.M, module)
+			}
+		}
+		err = resetModuleItems(item, modules)
+		if err != nil {
+			return err
+		}
+		return putJobItem(tx, job.JobID, item)
+	})
+}
+
+// resetModuleItems marks these modules of a job item as pending, sets its dispatch time to now and clears its callback to be sent again.
+// Jobs created before module statuses were added are tracked by their responses only, so their modules aren't marked as pending.
+func resetModuleItems(item map[string]*dynamodb.AttributeValue, modules []string) error {
+	dispatchTime, err := dynamodbattribute.Marshal(common.EpochTime(time.Now()))
+	if err != nil {
+		return fmt.Errorf("error marshalling dispatch time: %w", err)
+	}
+	item["lastDispatchTime"] = dispatchTime
+	delete(item, "callbackSent")
+
+	moduleStatuses, ok := item["moduleStatus"]
+	if !ok || len(moduleStatuses.M) == 0 {
+		return nil
+	}
+	pending, err := dynamodbattribute.Marshal(common.ModuleStatus{Status: common.ModulePending})
+	if err != nil {
+		return fmt.Errorf("error marshalling module status: %w", err)
+	}
+	for _, module := range modules {
+		moduleStatuses.M[module] = pending
+	}
+	return nil
+}
+
+// SetModuleRunning marks the module as running on the job, if it is still pending
+func (s *BoltStore) SetModuleRunning(ctx context.Context, jobID string, moduleName string, startTime time.Time) error {
+	return s.updateJobItem(jobID, func(item map[string]*dynamodb.AttributeValue) error {
+		moduleStatuses, ok := item["moduleStatus"]
+		if !ok || moduleStatuses.M == nil {
+			return nil
+		}
+		status := &common.ModuleStatus{}
+		if moduleStatus, ok := moduleStatuses.M[moduleName]; ok {
+			if err := dynamodbattribute.Unmarshal(moduleStatus, status); err != nil {
+				return fmt.Errorf("error unmarshalling module status: %w", err)
+			}
+		}
+		// The module already finished
+		if status.Status != common.ModulePending {
+			return nil
+		}
+		status.Status = common.ModuleRunning
+		status.StartTime = common.EpochTime(startTime)
+		moduleStatus, err := dynamodbattribute.Marshal(status)
+		if err != nil {
+			return fmt.Errorf("error marshalling module status: %w", err)
+		}
+		moduleStatuses.M[moduleName] = moduleStatus
+		return nil
+	})
+}
+
+// ClaimCallback sets the callbackSent flag of the job if it isn't set yet
+func (s *BoltStore) ClaimCallback(ctx context.Context, jobID string) (claimed bool, err error) {
+	err = s.updateJobItem(jobID, func(item map[string]*dynamodb.AttributeValue) error {
+		if _, ok := item["callbackSent"]; ok {
+			return nil
+		}
+		item["callbackSent"] = &dynamodb.AttributeValue{BOOL: aws.Bool(true)}
+		claimed = true
+		return nil
+	})
+	return claimed, err
+}
+
+// SetCallbackDeliveries stores the delivery attempts of the callback on the job
+func (s *BoltStore) SetCallbackDeliveries(ctx context.Context, jobID string, deliveries []common.CallbackDelivery) error {
+	deliveriesMarshalled, err := dynamodbattribute.Marshal(deliveries)
+	if err != nil {
+		return fmt.Errorf("error marshalling callback deliveries: %w", err)
+	}
+	return s.updateJobItem(jobID, func(item map[string]*dynamodb.AttributeValue) error {
+		item["callbackDeliveries"] = deliveriesMarshalled
+		return nil
+	})
+}
+
+// PutSightings stores the sightings, their TTL is ignored like the one of jobs
+func (s *BoltStore) PutSightings(ctx context.Context, sightings []*Sighting) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, sighting := range sightings {
+			sightingMarshalled, err := json.Marshal(sighting)
+			if err != nil {
+				return fmt.Errorf("error marshalling sighting: %w", err)
+			}
+			jobSightings, err := tx.Bucket(sightingsBucket).CreateBucketIfNotExists([]byte(sighting.IOCHash))
+			if err != nil {
+				return fmt.Errorf("error storing sighting: %w", err)
+			}
+			err = jobSightings.Put([]byte(sighting.JobID), sightingMarshalled)
+			if err != nil {
+				return fmt.Errorf("error storing sighting: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// GetSightings gets every sighting of the IOC hash
+func (s *BoltStore) GetSightings(ctx context.Context, iocHash string) ([]*Sighting, error) {
+	sightings := []*Sighting{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		jobSightings := tx.Bucket(sightingsBucket).Bucket([]byte(iocHash))
+		if jobSightings == nil {
+			return nil
+		}
+		return jobSightings.ForEach(func(jobID, data []byte) error {
+			sighting := &Sighting{}
+			if err := json.Unmarshal(data, sighting); err != nil {
+				return fmt.Errorf("error unmarshalling sighting: %w", err)
+			}
+			sightings = append(sightings, sighting)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting sightings from database: %w", err)
+	}
+	return sightings, nil
+}
+
+// updateJobItem applies the update to the item of the job and stores it, it does nothing if there is no such job
+func (s *BoltStore) updateJobItem(jobID string, update func(item map[string]*dynamodb.AttributeValue) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		item, err := getJobItem(tx, jobID)
+		if err != nil || item == nil {
+			return err
+		}
+		err = update(item)
+		if err != nil {
+			return err
+		}
+		return putJobItem(tx, jobID, item)
+	})
+}
+
+// Load gets the encryption key with this ID created at this time, it returns nil if there is no such key
+func (s *BoltStore) Load(ctx context.Context, keyID string, created int64) (key *appencryption.EnvelopeKeyRecord, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		keys := tx.Bucket(keysBucket).Bucket([]byte(keyID))
+		if keys == nil {
+			return nil
+		}
+		key, err = unmarshalKey(keyID, keys.Get(keyCreatedKey(created)))
+		return err
+	})
+	return key, err
+}
+
+// LoadLatest gets the latest encryption key with this ID, it returns nil if there is no such key
+func (s *BoltStore) LoadLatest(ctx context.Context, keyID string) (key *appencryption.EnvelopeKeyRecord, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		keys := tx.Bucket(keysBucket).Bucket([]byte(keyID))
+		if keys == nil {
+			return nil
+		}
+		_, data := keys.Cursor().Last()
+		key, err = unmarshalKey(keyID, data)
+		return err
+	})
+	return key, err
+}
+
+// Store stores an encryption key, it returns false if there already is a key with this ID created at this time
+func (s *BoltStore) Store(ctx context.Context, keyID string, created int64, key *appencryption.EnvelopeKeyRecord) (stored bool, err error) {
+	keyMarshalled, err := json.Marshal(key)
+	if err != nil {
+		return false, fmt.Errorf("error marshalling key: %w", err)
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		keys, err := tx.Bucket(keysBucket).CreateBucketIfNotExists([]byte(keyID))
+		if err != nil {
+			return fmt.Errorf("error storing key: %w", err)
+		}
+		if keys.Get(keyCreatedKey(created)) != nil {
+			return nil
+		}
+		stored = true
+		return keys.Put(keyCreatedKey(created), keyMarshalled)
+	})
+	return stored, err
+}
+
+// unmarshalKey unmarshals a stored encryption key, it returns nil if there is no key
+func unmarshalKey(keyID string, data []byte) (*appencryption.EnvelopeKeyRecord, error) {
+	if data == nil {
+		return nil, nil
+	}
+	key := &appencryption.EnvelopeKeyRecord{}
+	if err := json.Unmarshal(data, key); err != nil {
+		return nil, fmt.Errorf("error unmarshalling key: %w", err)
+	}
+	key.ID = keyID
+	return key, nil
+}
+
+// keyCreatedKey is the key of an encryption key in the bucket of its ID, zero padded so keys sort by creation time
+func keyCreatedKey(created int64) []byte {
+	return []byte(fmt.Sprintf("%020d", created))
+}
+
+// getJobItem gets the item of a job, it returns nil if there is no such job
+func getJobItem(tx *bolt.Tx, jobID string) (map[string]*dynamodb.AttributeValue, error) {
+	data := tx.Bucket(jobsBucket).Get([]byte(jobID))
+	if data == nil {
+		return nil, nil
+	}
+	item := map[string]*dynamodb.AttributeValue{}
+	err := json.Unmarshal(data, &item)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling job: %w", err)
+	}
+	return item, nil
+}
+
+// putJobItem stores the item of a job
+func putJobItem(tx *bolt.Tx, jobID string, item map[string]*dynamodb.AttributeValue) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("error marshalling job: %w", err)
+	}
+	return tx.Bucket(jobsBucket).Put([]byte(jobID), data)
+}
+
+// getJob gets a job, it returns nil if there is no such job
+func getJob(tx *bolt.Tx, jobID string) (*common.JobDBEntry, error) {
+	item, err := getJobItem(tx, jobID)
+	if err != nil || item == nil {
+		return nil, err
+	}
+	job := &common.JobDBEntry{}
+	err = dynamodbattribute.UnmarshalMap(item, job)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling job: %w", err)
+	}
+	if job.IOCTypes == nil {
+		job.IOCTypes = []string{}
+	}
+	return job, nil
+}
+
+// userJobKey is the key of a job in the bucket of its user, zero padded so keys sort by start time
+func userJobKey(startTime int64, jobID string) []byte {
+	return []byte(fmt.Sprintf("%020d/%s", startTime, jobID))
+}
+
+// parseUserJobKey gets the start time and ID of a job from its key in the bucket of its user
+func parseUserJobKey(key []byte) (int64, string) {
+	parts := strings.SplitN(string(key), "/", 2)
+	startTime, _ := strconv.ParseInt(parts[0], 10, 64)
+	if len(parts) < 2 {
+		return startTime, ""
+	}
+	return startTime, parts[1]
+}
+
+// jobMatchesQuery returns true if the job has the module, IOC type and tag of the query
+func jobMatchesQuery(job *common.JobDBEntry, query JobsQuery) bool {
+	return (query.Module == "" || stringInSlice(query.Module, job.RequestedModules)) &&
+		(query.IOCType == "" || stringInSlice(query.IOCType, job.IOCTypes)) &&
+		(query.Tag == "" || stringInSlice(query.Tag, job.Tags))
+}
+
+func stringInSlice(s string, slice []string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
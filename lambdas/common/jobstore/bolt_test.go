@@ -0,0 +1,288 @@
+package jobstore
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/godaddy/asherah/go/appencryption"
+)
+
+func openTestBoltStore(t *testing.T) *BoltStore {
+	dir, err := ioutil.TempDir("", "jobstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := OpenBoltStore(filepath.Join(dir, "jobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		store.Close()
+		os.RemoveAll(dir)
+	})
+	return store
+}
+
+func TestBoltStoreJob(t *testing.T) {
+	ctx := context.Background()
+	store := openTestBoltStore(t)
+
+	err := store.CreateJob(ctx, &common.JobDBEntry{
+		JobID:            "job",
+		Username:         "user",
+		StartTime:        1610000000,
+		Submission:       appencryption.DataRowRecord{Data: []byte("submission")},
+		Responses:        map[string]appencryption.DataRowRecord{},
+		RequestedModules: []string{"shodan"},
+		ModuleStatuses:   map[string]*common.ModuleStatus{"shodan": {Status: common.ModulePending}},
+		IOCTypes:         []string{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := store.GetJob(ctx, "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job == nil || job.Username != "user" || string(job.Submission.Data) != "submission" || job.IOCTypes == nil {
+		t.Fatalf("expected to get the stored job, got %+v", job)
+	}
+	if job, err := store.GetJob(ctx, "missing"); job != nil || err != nil {
+		t.Errorf("expected no job, got %v %v", job, err)
+	}
+
+	// Responses are stored apart from the job, and update its module status
+	err = store.UpdateResponse(ctx, "job", "shodan", appencryption.DataRowRecord{Data: []byte("response")}, &common.ModuleStatus{Status: common.ModuleSucceeded})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, _ = store.GetJob(ctx, "job")
+	if job.ModuleStatuses["shodan"].Status != common.ModuleSucceeded {
+		t.Errorf("expected the module status to be updated, got %v", job.ModuleStatuses["shodan"])
+	}
+	if len(job.Responses) != 0 {
+		t.Errorf("expected the job to have no responses until they are loaded, got %v", job.Responses)
+	}
+	if err := store.LoadResponses(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	if string(job.Responses["shodan"].Data) != "response" {
+		t.Errorf("expected the stored response, got %v", job.Responses)
+	}
+
+	// Deleting the job deletes its responses and removes it from the jobs of its user
+	if err := store.DeleteJob(ctx, "job"); err != nil {
+		t.Fatal(err)
+	}
+	if job, _ := store.GetJob(ctx, "job"); job != nil {
+		t.Errorf("expected the job to be deleted, got %+v", job)
+	}
+	jobs, _, _ := store.ListJobs(ctx, "user", JobsQuery{})
+	if len(jobs) != 0 {
+		t.Errorf("expected no jobs of the user, got %d", len(jobs))
+	}
+	job = &common.JobDBEntry{JobID: "job"}
+	store.LoadResponses(ctx, job)
+	if len(job.Responses) != 0 {
+		t.Errorf("expected the responses to be deleted, got %v", job.Responses)
+	}
+}
+
+func TestBoltStoreListJobs(t *testing.T) {
+	ctx := context.Background()
+	store := openTestBoltStore(t)
+
+	for i := 0; i < 5; i++ {
+		job := &common.JobDBEntry{
+			JobID:            fmt.Sprintf("job%d", i),
+			Username:         "user",
+			StartTime:        float64(1610000000 + i),
+			RequestedModules: []string{"shodan"},
+			IOCTypes:         []string{"IP"},
+		}
+		if i%2 == 0 {
+			job.IOCTypes = []string{"DOMAIN"}
+			job.Tags = []string{"phishing"}
+		}
+		if err := store.CreateJob(ctx, job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.CreateJob(ctx, &common.JobDBEntry{JobID: "other", Username: "other", StartTime: 1610000002})
+
+	listJobIDs := func(query JobsQuery) ([]string, *Cursor) {
+		jobs, next, err := store.ListJobs(ctx, "user", query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		jobIDs := []string{}
+		for _, job := range jobs {
+			jobIDs = append(jobIDs, job.JobID)
+		}
+		return jobIDs, next
+	}
+
+	// Jobs are listed newest first, a page at a time
+	jobIDs, next := listJobIDs(JobsQuery{Limit: 2})
+	if fmt.Sprint(jobIDs) != "[job4 job3]" || next == nil {
+		t.Fatalf("expected the first page, got %v %v", jobIDs, next)
+	}
+	jobIDs, next = listJobIDs(JobsQuery{Limit: 2, Start: next})
+	if fmt.Sprint(jobIDs) != "[job2 job1]" || next == nil {
+		t.Fatalf("expected the second page, got %v %v", jobIDs, next)
+	}
+	jobIDs, next = listJobIDs(JobsQuery{Limit: 2, Start: next})
+	if fmt.Sprint(jobIDs) != "[job0]" || next != nil {
+		t.Fatalf("expected the last page, got %v %v", jobIDs, next)
+	}
+
+	// Filters
+	if jobIDs, _ := listJobIDs(JobsQuery{IOCType: "DOMAIN", Tag: "phishing"}); fmt.Sprint(jobIDs) != "[job4 job2 job0]" {
+		t.Errorf("expected the jobs with the IOC type and tag, got %v", jobIDs)
+	}
+	if jobIDs, _ := listJobIDs(JobsQuery{From: 1610000001, To: 1610000003}); fmt.Sprint(jobIDs) != "[job3 job2 job1]" {
+		t.Errorf("expected the jobs in the start time range, got %v", jobIDs)
+	}
+	if jobIDs, _ := listJobIDs(JobsQuery{Module: "urlhaus"}); len(jobIDs) != 0 {
+		t.Errorf("expected no jobs with the module, got %v", jobIDs)
+	}
+}
+
+func TestBoltStoreJobUpdates(t *testing.T) {
+	ctx := context.Background()
+	store := openTestBoltStore(t)
+
+	job := &common.JobDBEntry{
+		JobID:            "job",
+		Username:         "user",
+		StartTime:        1610000000,
+		RequestedModules: []string{"shodan"},
+		ModuleStatuses:   map[string]*common.ModuleStatus{"shodan": {Status: common.ModulePending}},
+		Callback:         true,
+	}
+	if err := store.CreateJob(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+
+	// Modules only start running once
+	if err := store.SetModuleRunning(ctx, "job", "shodan", time.Unix(1610000001, 0)); err != nil {
+		t.Fatal(err)
+	}
+	store.SetModuleRunning(ctx, "job", "shodan", time.Unix(1610000002, 0))
+	job, _ = store.GetJob(ctx, "job")
+	if status := job.ModuleStatuses["shodan"]; status.Status != common.ModuleRunning || status.StartTime != 1610000001 {
+		t.Errorf("expected the module to be running since it was first started, got %+v", status)
+	}
+
+	// Callbacks are only claimed once
+	if claimed, err := store.ClaimCallback(ctx, "job"); !claimed || err != nil {
+		t.Errorf("expected the callback to be claimed, got %v %v", claimed, err)
+	}
+	if claimed, err := store.ClaimCallback(ctx, "job"); claimed || err != nil {
+		t.Errorf("expected the callback to be claimed already, got %v %v", claimed, err)
+	}
+	deliveries := []common.CallbackDelivery{{Attempt: 1, Time: 1610000003, StatusCode: 200}}
+	if err := store.SetCallbackDeliveries(ctx, "job", deliveries); err != nil {
+		t.Fatal(err)
+	}
+
+	// Adding and resetting modules marks them as pending and clears the callback to be sent again
+	err := store.UpdateResponse(ctx, "job", "shodan", appencryption.DataRowRecord{Data: []byte("response")}, &common.ModuleStatus{Status: common.ModuleFailed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddModules(ctx, job, []string{"urlhaus"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.ResetModules(ctx, job, []string{"shodan"}); err != nil {
+		t.Fatal(err)
+	}
+	job, _ = store.GetJob(ctx, "job")
+	if fmt.Sprint(job.RequestedModules) != "[shodan urlhaus]" || job.CallbackSent || job.LastDispatchTime == 0 {
+		t.Errorf("expected the added modules to be dispatched again, got %+v", job)
+	}
+	if len(job.CallbackDeliveries) != 1 {
+		t.Errorf("expected the callback deliveries, got %v", job.CallbackDeliveries)
+	}
+	for _, module := range []string{"shodan", "urlhaus"} {
+		if job.ModuleStatuses[module].Status != common.ModulePending {
+			t.Errorf("expected %s to be pending, got %+v", module, job.ModuleStatuses[module])
+		}
+	}
+	store.LoadResponses(ctx, job)
+	if len(job.Responses) != 0 {
+		t.Errorf("expected the reset responses to be deleted, got %v", job.Responses)
+	}
+
+	// Modules poll the cancelled flag
+	if cancelled, err := store.IsJobCancelled(ctx, "job"); cancelled || err != nil {
+		t.Errorf("expected the job not to be cancelled, got %v %v", cancelled, err)
+	}
+	if err := store.CancelJob(ctx, "job"); err != nil {
+		t.Fatal(err)
+	}
+	if cancelled, err := store.IsJobCancelled(ctx, "job"); !cancelled || err != nil {
+		t.Errorf("expected the job to be cancelled, got %v %v", cancelled, err)
+	}
+	jobs, err := store.GetJobStatuses(ctx, []string{"job", "missing"})
+	if err != nil || len(jobs) != 1 || !jobs["job"].Cancelled {
+		t.Errorf("expected the status of the existing job, got %v %v", jobs, err)
+	}
+}
+
+func TestBoltStoreSightings(t *testing.T) {
+	ctx := context.Background()
+	store := openTestBoltStore(t)
+
+	err := store.PutSightings(ctx, []*Sighting{
+		{IOCHash: "hash", JobID: "job1", Username: "user", IOCType: "DOMAIN", StartTime: 1610000000},
+		{IOCHash: "hash", JobID: "job2", Username: "other", IOCType: "URL", StartTime: 1610000001},
+		{IOCHash: "other hash", JobID: "job1", Username: "user", IOCType: "IP", StartTime: 1610000000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sightings, err := store.GetSightings(ctx, "hash")
+	if err != nil || len(sightings) != 2 || sightings[0].JobID != "job1" || sightings[1].Username != "other" {
+		t.Errorf("expected the sightings of the hash, got %v %v", sightings, err)
+	}
+	if sightings, err := store.GetSightings(ctx, "missing"); len(sightings) != 0 || err != nil {
+		t.Errorf("expected no sightings, got %v %v", sightings, err)
+	}
+}
+
+func TestBoltStoreKeys(t *testing.T) {
+	ctx := context.Background()
+	store := openTestBoltStore(t)
+
+	if key, err := store.LoadLatest(ctx, "key"); key != nil || err != nil {
+		t.Errorf("expected no key, got %v %v", key, err)
+	}
+	for _, created := range []int64{1610000001, 1610000000} {
+		stored, err := store.Store(ctx, "key", created, &appencryption.EnvelopeKeyRecord{Created: created, EncryptedKey: []byte("key")})
+		if err != nil || !stored {
+			t.Fatalf("expected the key to be stored, got %v %v", stored, err)
+		}
+	}
+
+	// Keys are never overwritten
+	if stored, err := store.Store(ctx, "key", 1610000000, &appencryption.EnvelopeKeyRecord{Created: 1610000000}); stored || err != nil {
+		t.Errorf("expected the existing key not to be stored, got %v %v", stored, err)
+	}
+	key, err := store.Load(ctx, "key", 1610000000)
+	if err != nil || key == nil || key.ID != "key" || string(key.EncryptedKey) != "key" {
+		t.Errorf("expected the stored key, got %+v %v", key, err)
+	}
+	key, err = store.LoadLatest(ctx, "key")
+	if err != nil || key == nil || key.Created != 1610000001 {
+		t.Errorf("expected the latest key, got %+v %v", key, err)
+	}
+}
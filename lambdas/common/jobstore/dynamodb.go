@@ -0,0 +1,530 @@
+package jobstore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
+	"github.com/godaddy/asherah/go/appencryption"
+)
+
+const (
+	jobIDKey     = "jobId"
+	usernameKey  = "username"
+	startTimeKey = "startTime"
+	// jobsByUserIndex is the index of the jobs table keyed by username and startTime
+	jobsByUserIndex = "username-startTime-index"
+	iocHashKey      = "iocHash"
+
+	// Most items a single BatchWriteItem call can take, and how many times unprocessed items are sent again
+	sightingsWriteBatchSize = 25
+	batchAttempts           = 3
+)
+
+// DynamoDBStore stores jobs in the jobs table, and the responses of their modules in the job responses table
+type DynamoDBStore struct {
+	t      *toolbox.Toolbox
+	client *dynamodb.DynamoDB
+}
+
+// NewDynamoDBStore creates a job store using the tables of the toolbox
+func NewDynamoDBStore(t *toolbox.Toolbox) *DynamoDBStore {
+	return &DynamoDBStore{t: t, client: dynamodb.New(t.AWSSession)}
+}
+
+// CreateJob stores a new job
+func (s *DynamoDBStore) CreateJob(ctx context.Context, job *common.JobDBEntry) error {
+	// Empty IOC types tell jobs apart from the ones created before they were stored,
+	// and retrying modules removes their responses from the responses map, so both are stored even if empty
+	item, err := dynamodbattribute.NewEncoder(func(e *dynamodbattribute.Encoder) {
+		e.EnableEmptyCollections = true
+	}).Encode(job)
+	if err != nil {
+		return fmt.Errorf("error marshalling job: %w", err)
+	}
+	_, err = s.client.PutItem(&dynamodb.PutItemInput{
+		Item:      item.M,
+		TableName: &s.t.JobDBTableName,
+	})
+	return err
+}
+
+// GetJob gets a job without the responses in the job responses table, it returns nil if there is no such job.
+// The read is consistent, callbacks need every module status that was stored before.
+func (s *DynamoDBStore) GetJob(ctx context.Context, jobID string) (*common.JobDBEntry, error) {
+	item, err := s.client.GetItem(&dynamodb.GetItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			jobIDKey: {S: aws.String(jobID)},
+		},
+		ConsistentRead: aws.Bool(true),
+		TableName:      &s.t.JobDBTableName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if item.Item == nil {
+		return nil, nil
+	}
+
+	job := &common.JobDBEntry{}
+	err = dynamodbattribute.UnmarshalMap(item.Item, job)
+	if err != nil {
+		s.t.Logger.WithError(err).Error("error unmarshaling dynamodb item")
+	}
+	return job, nil
+}
+
+// LoadResponses adds the responses in the job responses table to the job
+func (s *DynamoDBStore) LoadResponses(ctx context.Context, job *common.JobDBEntry) error {
+	return job.LoadResponses(ctx, s.t)
+}
+
+// ListJobs queries the jobs of a user from the index of the jobs table, which only has what is needed to list them
+func (s *DynamoDBStore) ListJobs(ctx context.Context, username string, query JobsQuery) ([]*common.JobDBEntry, *Cursor, error) {
+	expr, err := buildJobsQuery(username, query)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	output, err := s.client.Query(&dynamodb.QueryInput{
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		KeyConditionExpression:    expr.KeyCondition(),
+		FilterExpression:          expr.Filter(),
+		ExclusiveStartKey:         getJobsStartKey(username, query.Start),
+		Limit:                     aws.Int64(query.Limit),
+		ScanIndexForward:          aws.Bool(false),
+		IndexName:                 aws.String(jobsByUserIndex),
+		TableName:                 &s.t.JobDBTableName,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting jobs from database: %w", err)
+	}
+
+	jobs := []*common.JobDBEntry{}
+	for _, item := range output.Items {
+		job := &common.JobDBEntry{}
+		err = dynamodbattribute.UnmarshalMap(item, job)
+		if err != nil {
+			s.t.Logger.WithError(err).Error("error unmarshaling dynamodb item")
+			continue
+		}
+		// Empty IOC types are still stored, unlike in jobs created before they were
+		if _, ok := item["iocTypes"]; ok && job.IOCTypes == nil {
+			job.IOCTypes = []string{}
+		}
+		jobs = append(jobs, job)
+	}
+
+	var next *Cursor
+	if len(output.LastEvaluatedKey) > 0 {
+		next = &Cursor{}
+		if jobID, ok := output.LastEvaluatedKey[jobIDKey]; ok && jobID.S != nil {
+			next.JobID = *jobID.S
+		}
+		if startTime, ok := output.LastEvaluatedKey[startTimeKey]; ok && startTime.N != nil {
+			next.StartTime = *startTime.N
+		}
+	}
+	return jobs, next, nil
+}
+
+// buildJobsQuery builds the query of the jobs of this user matching the filter
+func buildJobsQuery(username string, query JobsQuery) (expression.Expression, error) {
+	keyCondition := expression.Key(usernameKey).Equal(expression.Value(username))
+	startTime := expression.Key(startTimeKey)
+	switch {
+	case query.From != 0 && query.To != 0:
+		keyCondition = keyCondition.And(startTime.Between(expression.Value(query.From), expression.Value(query.To)))
+	case query.From != 0:
+		keyCondition = keyCondition.And(startTime.GreaterThanEqual(expression.Value(query.From)))
+	case query.To != 0:
+		keyCondition = keyCondition.And(startTime.LessThanEqual(expression.Value(query.To)))
+	}
+	builder := expression.NewBuilder().WithKeyCondition(keyCondition)
+
+	// Jobs created before IOC types and tags were stored never match these filters
+	conditions := []expression.ConditionBuilder{}
+	if query.Module != "" {
+		conditions = append(conditions, expression.Name("requestedModules").Contains(query.Module))
+	}
+	if query.IOCType != "" {
+		conditions = append(conditions, expression.Name("iocTypes").Contains(query.IOCType))
+	}
+	if query.Tag != "" {
+		conditions = append(conditions, expression.Name("tags").Contains(query.Tag))
+	}
+	switch len(conditions) {
+	case 0:
+	case 1:
+		builder = builder.WithFilter(conditions[0])
+	default:
+		builder = builder.WithFilter(expression.And(conditions[0], conditions[1], conditions[2:]...))
+	}
+
+	return builder.Build()
+}
+
+// getJobsStartKey gets the key of the index to start a page of this user's jobs at
+func getJobsStartKey(username string, cursor *Cursor) map[string]*dynamodb.AttributeValue {
+	if cursor == nil {
+		return nil
+	}
+	return map[string]*dynamodb.AttributeValue{
+		jobIDKey:     {S: aws.String(cursor.JobID)},
+		usernameKey:  {S: aws.String(username)},
+		startTimeKey: {N: aws.String(cursor.StartTime)},
+	}
+}
+
+// UpdateResponse stores the response as its own item in the job responses table, then updates the module status in the job.
+// The response is stored first so a module is never marked as finished before its response can be read.
+func (s *DynamoDBStore) UpdateResponse(ctx context.Context, jobID string, moduleName string, response appencryption.DataRowRecord, status *common.ModuleStatus) error {
+	item, err := common.NewJobResponseDBItem(jobID, moduleName, response)
+	if err != nil {
+		return fmt.Errorf("error marshalling job response: %w", err)
+	}
+	_, err = s.client.PutItem(&dynamodb.PutItemInput{
+		Item:      item,
+		TableName: &s.t.JobResponsesDBTableName,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Jobs created before module statuses were added are tracked by their responses only
+	if status == nil {
+		return nil
+	}
+	update := expression.Set(expression.Name(fmt.Sprintf("moduleStatus.%s", moduleName)), expression.Value(status))
+	condition := expression.Name("moduleStatus").AttributeExists()
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+	if err != nil {
+		return fmt.Errorf("error creating update expression: %w", err)
+	}
+	_, err = s.client.UpdateItem(&dynamodb.UpdateItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			jobIDKey: {S: aws.String(jobID)},
+		},
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		UpdateExpression:          expr.Update(),
+		TableName:                 &s.t.JobDBTableName,
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		// The job was deleted, or was created before module statuses were added and has no moduleStatus map to update
+		return nil
+	}
+	return err
+}
+
+// DeleteJob deletes a job, then the responses of its modules from the job responses table and the job bucket
+func (s *DynamoDBStore) DeleteJob(ctx context.Context, jobID string) error {
+	output, err := s.client.DeleteItem(&dynamodb.DeleteItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			jobIDKey: {S: aws.String(jobID)},
+		},
+		ReturnValues: aws.String(dynamodb.ReturnValueAllOld),
+		TableName:    &s.t.JobDBTableName,
+	})
+	if err != nil {
+		return err
+	}
+	if output == nil || output.Attributes == nil {
+		return nil
+	}
+
+	// The job is gone, so its responses can't be read anymore even if deleting them fails
+	job := &common.JobDBEntry{}
+	dynamodbattribute.UnmarshalMap(output.Attributes, job)
+	err = common.DeleteJobResponses(ctx, s.t, jobID, job.RequestedModules)
+	if err != nil {
+		s.t.Logger.WithField("jobID", jobID).WithError(err).Error("error deleting job responses")
+	}
+	err = common.DeleteLargeResponses(ctx, s.t, jobID, job.RequestedModules)
+	if err != nil {
+		s.t.Logger.WithField("jobID", jobID).WithError(err).Error("error deleting job responses from the job bucket")
+	}
+	return nil
+}
+
+// GetJobStatuses gets what is needed for the status of these jobs with a single BatchGetItem call, so there can be at most 100 of them
+func (s *DynamoDBStore) GetJobStatuses(ctx context.Context, jobIDs []string) (map[string]*common.JobDBEntry, error) {
+	jobs := map[string]*common.JobDBEntry{}
+	if len(jobIDs) == 0 {
+		return jobs, nil
+	}
+
+	keys := []map[string]*dynamodb.AttributeValue{}
+	for _, jobID := range jobIDs {
+		keys = append(keys, map[string]*dynamodb.AttributeValue{jobIDKey: {S: aws.String(jobID)}})
+	}
+	projection := expression.NamesList(
+		expression.Name(jobIDKey),
+		expression.Name(startTimeKey),
+		expression.Name("lastDispatchTime"),
+		expression.Name("requestedModules"),
+		expression.Name("moduleStatus"),
+		expression.Name("cancelled"),
+	)
+	expr, err := expression.NewBuilder().WithProjection(projection).Build()
+	if err != nil {
+		return nil, fmt.Errorf("error building jobs projection: %w", err)
+	}
+
+	request := map[string]*dynamodb.KeysAndAttributes{s.t.JobDBTableName: {
+		Keys:                     keys,
+		ExpressionAttributeNames: expr.Names(),
+		ProjectionExpression:     expr.Projection(),
+	}}
+	for attempt := 1; len(request) > 0; attempt++ {
+		if attempt > batchAttempts {
+			return nil, fmt.Errorf("error getting jobs from database: %d jobs were not processed", len(request[s.t.JobDBTableName].Keys))
+		}
+		output, err := s.client.BatchGetItem(&dynamodb.BatchGetItemInput{RequestItems: request})
+		if err != nil {
+			return nil, fmt.Errorf("error getting jobs from database: %w", err)
+		}
+		for _, item := range output.Responses[s.t.JobDBTableName] {
+			job := &common.JobDBEntry{}
+			err = dynamodbattribute.UnmarshalMap(item, job)
+			if err != nil {
+				s.t.Logger.WithError(err).Error("error unmarshaling dynamodb item")
+				continue
+			}
+			jobs[job.JobID] = job
+		}
+		request = output.UnprocessedKeys
+	}
+	return jobs, nil
+}
+
+// CancelJob sets the cancelled flag of a job, if it still exists
+func (s *DynamoDBStore) CancelJob(ctx context.Context, jobID string) error {
+	update := expression.Set(expression.Name("cancelled"), expression.Value(true))
+	condition := expression.Name(jobIDKey).AttributeExists()
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+	if err != nil {
+		return fmt.Errorf("error creating update expression: %w", err)
+	}
+	_, err = s.client.UpdateItem(&dynamodb.UpdateItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			jobIDKey: {S: aws.String(jobID)},
+		},
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		UpdateExpression:          expr.Update(),
+		TableName:                 &s.t.JobDBTableName,
+	})
+	return err
+}
+
+// IsJobCancelled only gets the cancelled flag of the job
+func (s *DynamoDBStore) IsJobCancelled(ctx context.Context, jobID string) (bool, error) {
+	item, err := s.client.GetItem(&dynamodb.GetItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			jobIDKey: {S: aws.String(jobID)},
+		},
+		ProjectionExpression: aws.String("cancelled"),
+		TableName:            &s.t.JobDBTableName,
+	})
+	if err != nil {
+		return false, fmt.Errorf("error getting job: %w", err)
+	}
+	cancelled, ok := item.Item["cancelled"]
+	return ok && cancelled.BOOL != nil && *cancelled.BOOL, nil
+}
+
+// AddModules appends these modules to the requested modules of a job.
+// Jobs created before module statuses were added are tracked by their responses only, so their modules aren't marked as pending.
+func (s *DynamoDBStore) AddModules(ctx context.Context, job *common.JobDBEntry, modules []string) error {
+	update := expression.
+		Set(expression.Name("requestedModules"), expression.ListAppend(expression.Name("requestedModules"), expression.Value(modules))).
+		Set(expression.Name("lastDispatchTime"), expression.Value(common.EpochTime(time.Now())))
+	if len(job.ModuleStatuses) > 0 {
+		for _, module := range modules {
+			update = update.Set(expression.Name(fmt.Sprintf("moduleStatus.%s", module)), expression.Value(common.ModuleStatus{Status: common.ModulePending}))
+		}
+	}
+	// The job finishes again once the added modules report, so it gets a new callback
+	if job.Callback {
+		update = update.Remove(expression.Name("callbackSent"))
+	}
+	return s.updateJob(job.JobID, update)
+}
+
+// ResetModules removes the responses of these modules from the job, then from the job responses table and the job bucket.
+// Jobs created before module statuses were added are tracked by their responses only, so their modules aren't marked as pending.
+func (s *DynamoDBStore) ResetModules(ctx context.Context, job *common.JobDBEntry, modules []string) error {
+	update := expression.Set(expression.Name("lastDispatchTime"), expression.Value(common.EpochTime(time.Now())))
+	for _, module := range modules {
+		update = update.Remove(expression.Name(fmt.Sprintf("responses.%s", module)))
+		if len(job.ModuleStatuses) > 0 {
+			update = update.Set(expression.Name(fmt.Sprintf("moduleStatus.%s", module)), expression.Value(common.ModuleStatus{Status: common.ModulePending}))
+		}
+	}
+	// The job finishes again once the retried modules report, so it gets a new callback
+	if job.Callback {
+		update = update.Remove(expression.Name("callbackSent"))
+	}
+	err := s.updateJob(job.JobID, update)
+	if err != nil {
+		return err
+	}
+	err = common.DeleteJobResponses(ctx, s.t, job.JobID, modules)
+	if err != nil {
+		return err
+	}
+	return common.DeleteLargeResponses(ctx, s.t, job.JobID, modules)
+}
+
+// updateJob applies the update to the job
+func (s *DynamoDBStore) updateJob(jobID string, update expression.UpdateBuilder) error {
+	expr, err := expression.NewBuilder().WithUpdate(update).Build()
+	if err != nil {
+		return fmt.Errorf("error creating update expression: %w", err)
+	}
+	_, err = s.client.UpdateItem(&dynamodb.UpdateItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			jobIDKey: {S: aws.String(jobID)},
+		},
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		UpdateExpression:          expr.Update(),
+		TableName:                 &s.t.JobDBTableName,
+	})
+	return err
+}
+
+// SetModuleRunning marks the module as running on the job, if it is still pending
+func (s *DynamoDBStore) SetModuleRunning(ctx context.Context, jobID string, moduleName string, startTime time.Time) error {
+	statusName := expression.Name(fmt.Sprintf("moduleStatus.%s.status", moduleName))
+	update := expression.
+		Set(statusName, expression.Value(common.ModuleRunning)).
+		Set(expression.Name(fmt.Sprintf("moduleStatus.%s.startTime", moduleName)), expression.Value(common.EpochTime(startTime)))
+	condition := expression.Name(jobIDKey).AttributeExists().And(statusName.Equal(expression.Value(common.ModulePending)))
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+	if err != nil {
+		return fmt.Errorf("error creating update expression: %w", err)
+	}
+
+	_, err = s.client.UpdateItem(&dynamodb.UpdateItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			jobIDKey: {S: aws.String(jobID)},
+		},
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		UpdateExpression:          expr.Update(),
+		TableName:                 &s.t.JobDBTableName,
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		// The job was deleted or the module already finished
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error updating module status: %w", err)
+	}
+	return nil
+}
+
+// ClaimCallback sets the callbackSent flag of the job if it isn't set yet
+func (s *DynamoDBStore) ClaimCallback(ctx context.Context, jobID string) (bool, error) {
+	claim, err := expression.NewBuilder().
+		WithUpdate(expression.Set(expression.Name("callbackSent"), expression.Value(true))).
+		WithCondition(expression.AttributeNotExists(expression.Name("callbackSent"))).
+		Build()
+	if err != nil {
+		return false, fmt.Errorf("error creating update expression: %w", err)
+	}
+	_, err = s.client.UpdateItem(&dynamodb.UpdateItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			jobIDKey: {S: aws.String(jobID)},
+		},
+		ConditionExpression:       claim.Condition(),
+		ExpressionAttributeNames:  claim.Names(),
+		ExpressionAttributeValues: claim.Values(),
+		UpdateExpression:          claim.Update(),
+		TableName:                 &s.t.JobDBTableName,
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// SetCallbackDeliveries stores the delivery attempts of the callback on the job
+func (s *DynamoDBStore) SetCallbackDeliveries(ctx context.Context, jobID string, deliveries []common.CallbackDelivery) error {
+	return s.updateJob(jobID, expression.Set(expression.Name("callbackDeliveries"), expression.Value(deliveries)))
+}
+
+// PutSightings stores the sightings in the sightings table, in batches
+func (s *DynamoDBStore) PutSightings(ctx context.Context, sightings []*Sighting) error {
+	writeRequests := []*dynamodb.WriteRequest{}
+	for _, sighting := range sightings {
+		item, err := dynamodbattribute.MarshalMap(sighting)
+		if err != nil {
+			return fmt.Errorf("error marshalling sighting: %w", err)
+		}
+		writeRequests = append(writeRequests, &dynamodb.WriteRequest{PutRequest: &dynamodb.PutRequest{Item: item}})
+	}
+
+	for start := 0; start < len(writeRequests); start += sightingsWriteBatchSize {
+		end := start + sightingsWriteBatchSize
+		if end > len(writeRequests) {
+			end = len(writeRequests)
+		}
+		batch := map[string][]*dynamodb.WriteRequest{s.t.SightingDBTableName: writeRequests[start:end]}
+		for attempt := 1; len(batch) > 0; attempt++ {
+			if attempt > batchAttempts {
+				return fmt.Errorf("error storing sightings: %d sightings were not processed", len(batch[s.t.SightingDBTableName]))
+			}
+			output, err := s.client.BatchWriteItem(&dynamodb.BatchWriteItemInput{RequestItems: batch})
+			if err != nil {
+				return fmt.Errorf("error storing sightings: %w", err)
+			}
+			batch = output.UnprocessedItems
+		}
+	}
+	return nil
+}
+
+// GetSightings queries every sighting of the IOC hash from the sightings table
+func (s *DynamoDBStore) GetSightings(ctx context.Context, iocHash string) ([]*Sighting, error) {
+	expr, err := expression.NewBuilder().
+		WithKeyCondition(expression.Key(iocHashKey).Equal(expression.Value(iocHash))).
+		Build()
+	if err != nil {
+		return nil, fmt.Errorf("error building sightings query: %w", err)
+	}
+
+	sightings := []*Sighting{}
+	var unmarshalErr error
+	err = s.client.QueryPages(&dynamodb.QueryInput{
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		KeyConditionExpression:    expr.KeyCondition(),
+		TableName:                 &s.t.SightingDBTableName,
+	}, func(output *dynamodb.QueryOutput, lastPage bool) bool {
+		page := []*Sighting{}
+		unmarshalErr = dynamodbattribute.UnmarshalListOfMaps(output.Items, &page)
+		sightings = append(sightings, page...)
+		return unmarshalErr == nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting sightings from database: %w", err)
+	}
+	if unmarshalErr != nil {
+		return nil, fmt.Errorf("error unmarshalling sightings: %w", unmarshalErr)
+	}
+	return sightings, nil
+}
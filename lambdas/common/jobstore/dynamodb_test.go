@@ -0,0 +1,58 @@
+package jobstore
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestBuildJobsQuery(t *testing.T) {
+	// Only the jobs of the user are queried
+	queryExpression, err := buildJobsQuery("user", JobsQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *queryExpression.KeyCondition() != "#0 = :0" || queryExpression.Filter() != nil {
+		t.Errorf("expected to only query the jobs of the user, got %s", *queryExpression.KeyCondition())
+	}
+	if !reflect.DeepEqual(queryExpression.Names(), map[string]*string{"#0": aws.String(usernameKey)}) {
+		t.Errorf("expected to query the username, got %v", queryExpression.Names())
+	}
+
+	// The start time range is part of the key, the rest is filtered
+	queryExpression, err = buildJobsQuery("user", JobsQuery{
+		Module:  "apivoid",
+		IOCType: "DOMAIN",
+		Tag:     "phishing",
+		From:    1610000000,
+		To:      1620000000,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *queryExpression.KeyCondition() != "(#3 = :3) AND (#4 BETWEEN :4 AND :5)" {
+		t.Errorf("expected to query the start time range, got %s", *queryExpression.KeyCondition())
+	}
+	if *queryExpression.Filter() != "(contains (#0, :0)) AND (contains (#1, :1)) AND (contains (#2, :2))" {
+		t.Errorf("expected to filter the module, IOC type and tag, got %s", *queryExpression.Filter())
+	}
+}
+
+func TestGetJobsStartKey(t *testing.T) {
+	if getJobsStartKey("user", nil) != nil {
+		t.Error("expected the first page to have no start key")
+	}
+
+	// The username comes from the caller, not the cursor
+	startKey := getJobsStartKey("user", &Cursor{JobID: "job", StartTime: "1610000000"})
+	expected := map[string]*dynamodb.AttributeValue{
+		jobIDKey:     {S: aws.String("job")},
+		usernameKey:  {S: aws.String("user")},
+		startTimeKey: {N: aws.String("1610000000")},
+	}
+	if !reflect.DeepEqual(startKey, expected) {
+		t.Errorf("expected start key %v, got %v", expected, startKey)
+	}
+}
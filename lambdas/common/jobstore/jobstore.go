@@ -0,0 +1,136 @@
+// Package jobstore stores jobs and the responses of their modules.
+// Lambdas use DynamoDB, local runs and integration tests can use an embedded BoltDB file instead.
+package jobstore
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
+	"github.com/godaddy/asherah/go/appencryption"
+)
+
+// Job store backends, set in the JobStore of the toolbox
+const (
+	BackendDynamoDB = "dynamodb"
+	BackendBolt     = "bolt"
+)
+
+// JobStore stores jobs and the responses of their modules
+type JobStore interface {
+	// CreateJob stores a new job
+	CreateJob(ctx context.Context, job *common.JobDBEntry) error
+	// GetJob gets a job without the responses stored apart from it, it returns nil if there is no such job
+	GetJob(ctx context.Context, jobID string) (*common.JobDBEntry, error)
+	// LoadResponses adds the stored responses of the job to its Responses
+	LoadResponses(ctx context.Context, job *common.JobDBEntry) error
+	// ListJobs lists the jobs of a user matching the query, newest first.
+	// Listed jobs only have what is needed to list them, jobs created before IOC types were stored have no IOCTypes.
+	// It returns where the next page starts, or nil if there are no more jobs.
+	ListJobs(ctx context.Context, username string, query JobsQuery) ([]*common.JobDBEntry, *Cursor, error)
+	// UpdateResponse stores the encrypted response of a module of a job, and its status if it is set
+	UpdateResponse(ctx context.Context, jobID string, moduleName string, response appencryption.DataRowRecord, status *common.ModuleStatus) error
+	// DeleteJob deletes a job and its responses
+	DeleteJob(ctx context.Context, jobID string) error
+	// GetJobStatuses gets at least what is needed for the status of these jobs, mapped by job ID.
+	// The jobs may have no submission or responses, and jobs that don't exist are left out.
+	GetJobStatuses(ctx context.Context, jobIDs []string) (map[string]*common.JobDBEntry, error)
+	// CancelJob flags a job as cancelled, modules working on it stop and return the results they have so far
+	CancelJob(ctx context.Context, jobID string) error
+	// IsJobCancelled returns true if the requester cancelled this job
+	IsJobCancelled(ctx context.Context, jobID string) (bool, error)
+	// AddModules appends these modules to the requested modules of a job, marks them as pending and sets its dispatch time to now
+	AddModules(ctx context.Context, job *common.JobDBEntry, modules []string) error
+	// ResetModules removes the responses of these modules of a job, marks them as pending again and sets its dispatch time to now
+	ResetModules(ctx context.Context, job *common.JobDBEntry, modules []string) error
+	// SetModuleRunning marks a module of a job as running.
+	// It only updates modules that are still pending so a slow update can't overwrite a finished module.
+	SetModuleRunning(ctx context.Context, jobID string, moduleName string, startTime time.Time) error
+	common.JobCallbackStore
+	// PutSightings stores sightings of IOCs in jobs
+	PutSightings(ctx context.Context, sightings []*Sighting) error
+	// GetSightings gets every sighting of this IOC hash
+	GetSightings(ctx context.Context, iocHash string) ([]*Sighting, error)
+}
+
+// Sighting is a single submission of an IOC in a job.
+// The IOC is only stored as a keyed hash so sightings can't be used to list the IOCs that were submitted.
+type Sighting struct {
+	IOCHash   string  `dynamodbav:"iocHash"`
+	JobID     string  `dynamodbav:"jobId"`
+	Username  string  `dynamodbav:"username"`
+	IOCType   string  `dynamodbav:"iocType"`
+	StartTime float64 `dynamodbav:"startTime"`
+	TTL       int64   `dynamodbav:"ttl"`
+}
+
+// JobsQuery is the filters and page of a job list
+type JobsQuery struct {
+	Module  string
+	IOCType string
+	Tag     string
+	// Epoch start time range, 0 if not set
+	From int64
+	To   int64
+	// Page size and where the page starts, nil for the first page
+	Limit int64
+	Start *Cursor
+}
+
+// Cursor is where a page of jobs starts, the username always comes from the caller
+type Cursor struct {
+	JobID     string `json:"jobId"`
+	StartTime string `json:"startTime"`
+}
+
+// JobCursor returns the cursor of the page that starts right after this listed job
+func JobCursor(job *common.JobDBEntry) *Cursor {
+	return &Cursor{JobID: job.JobID, StartTime: strconv.FormatFloat(job.StartTime, 'f', -1, 64)}
+}
+
+// EncodeCursor encodes where a page of jobs starts to hand it to clients
+func EncodeCursor(cursor *Cursor) string {
+	cursorMarshalled, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(cursorMarshalled)
+}
+
+// DecodeCursor decodes a cursor from EncodeCursor
+func DecodeCursor(encoded string) (*Cursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	cursor := &Cursor{}
+	err = json.Unmarshal(decoded, cursor)
+	if err != nil {
+		return nil, err
+	}
+	if cursor.JobID == "" {
+		return nil, fmt.Errorf("missing jobId")
+	}
+	// Start times are stored with fractions of seconds
+	if _, err := strconv.ParseFloat(cursor.StartTime, 64); err != nil {
+		return nil, err
+	}
+	return cursor, nil
+}
+
+// New gets the job store of the backend set in the toolbox
+func New(t *toolbox.Toolbox) (JobStore, error) {
+	switch t.JobStore {
+	case BackendDynamoDB:
+		if t.AWSSession == nil {
+			return nil, toolbox.ErrNoAWSSession
+		}
+		return NewDynamoDBStore(t), nil
+	case BackendBolt:
+		return OpenBoltStore(t.JobStorePath)
+	default:
+		return nil, fmt.Errorf("unknown job store %q", t.JobStore)
+	}
+}
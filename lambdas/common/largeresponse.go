@@ -0,0 +1,121 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
+	"github.com/godaddy/asherah/go/appencryption"
+)
+
+// MaxInlineResponseSize is the largest module response sent back through SQS and stored in the job DB.
+// SQS messages are limited to 256KB and DynamoDB items, which hold an encrypted response each, to 400KB.
+// Larger responses are stored in the job bucket instead.
+var MaxInlineResponseSize = 64 * 1024
+
+// ResponseReference points to a module response stored in the job bucket
+type ResponseReference struct {
+	Bucket string `json:"bucket" dynamodbav:"bucket"`
+	Key    string `json:"key" dynamodbav:"key"`
+	// Size of the unencrypted response in bytes
+	Size int `json:"size" dynamodbav:"size"`
+}
+
+// storedResponseReference is what is stored in the job DB in place of a response stored in the job bucket
+type storedResponseReference struct {
+	ResponseReference *ResponseReference `json:"responseReference"`
+}
+
+// OffloadLargeResponse stores the response of the completed job in the job bucket, encrypted, if it is too large to send back inline.
+// The response is then replaced by a reference to it.
+func OffloadLargeResponse(ctx context.Context, t *toolbox.Toolbox, completedJob *CompletedJobData) error {
+	if len(completedJob.Response) <= MaxInlineResponseSize {
+		return nil
+	}
+	span, ctx := t.TracerLogger.StartSpan(ctx, "OffloadLargeResponse", "job", "response", "offload")
+	defer span.End(ctx)
+	span.LogKV("jobID", completedJob.JobID)
+	span.LogKV("responseSizeBytes", len(completedJob.Response))
+
+	encryptedData, err := t.Encrypt(ctx, completedJob.JobID, []byte(completedJob.Response))
+	if err != nil {
+		span.LogKV("error", err)
+		return fmt.Errorf("error encrypting response: %w", err)
+	}
+	encryptedDataMarshalled, err := json.Marshal(encryptedData)
+	if err != nil {
+		span.LogKV("error", err)
+		return fmt.Errorf("error marshalling encrypted response: %w", err)
+	}
+
+	reference := &ResponseReference{
+		Bucket: t.GetJobBucketName(),
+		Key:    largeResponseKey(completedJob.JobID, completedJob.ModuleName),
+		Size:   len(completedJob.Response),
+	}
+	err = t.PutJobObject(ctx, reference.Bucket, reference.Key, encryptedDataMarshalled)
+	if err != nil {
+		span.LogKV("error", err)
+		return err
+	}
+
+	completedJob.Response = ""
+	completedJob.ResponseReference = reference
+	return nil
+}
+
+// largeResponseKey is the key the response of a module is stored under in the job bucket
+func largeResponseKey(jobID string, moduleName string) string {
+	return fmt.Sprintf("responses/%s/%s.json", jobID, moduleName)
+}
+
+// DeleteLargeResponses deletes the responses of these modules from the job bucket, modules whose response wasn't stored there are skipped.
+// Jobs are deleted with their responses, and retried modules store their response again.
+func DeleteLargeResponses(ctx context.Context, t *toolbox.Toolbox, jobID string, modules []string) error {
+	keys := []string{}
+	for _, module := range modules {
+		keys = append(keys, largeResponseKey(jobID, module))
+	}
+	return t.DeleteJobObjects(ctx, t.GetJobBucketName(), keys)
+}
+
+// StoredResponse returns the response to store in the job DB, which is a reference to the response if it is stored in the job bucket
+func (c CompletedJobData) StoredResponse() string {
+	if c.ResponseReference == nil {
+		return c.Response
+	}
+	storedReference, _ := json.Marshal(storedResponseReference{ResponseReference: c.ResponseReference})
+	return string(storedReference)
+}
+
+// getResponseReference returns the reference to the response stored in the job bucket, or nil if this is the response itself
+func getResponseReference(storedResponse []byte) *ResponseReference {
+	// Module responses are lists, don't bother parsing them
+	if len(storedResponse) == 0 || storedResponse[0] != '{' {
+		return nil
+	}
+	storedReference := storedResponseReference{}
+	if err := json.Unmarshal(storedResponse, &storedReference); err != nil {
+		return nil
+	}
+	return storedReference.ResponseReference
+}
+
+// fetchLargeResponse fetches and decrypts a response stored in the job bucket
+func fetchLargeResponse(ctx context.Context, t *toolbox.Toolbox, jobID string, reference *ResponseReference) ([]byte, error) {
+	encryptedDataMarshalled, err := t.GetJobObject(ctx, reference.Bucket, reference.Key)
+	if err != nil {
+		return nil, err
+	}
+	encryptedData := appencryption.DataRowRecord{}
+	err = json.Unmarshal(encryptedDataMarshalled, &encryptedData)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling encrypted response: %w", err)
+	}
+	decryptedData, err := t.Decrypt(ctx, jobID, encryptedData)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting response: %w", err)
+	}
+	return decryptedData, nil
+}
@@ -0,0 +1,159 @@
+package common
+
+import (
+	"context"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/agiledragon/gomonkey/v2"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
+	"github.com/godaddy/asherah/go/appencryption"
+)
+
+// localS3 is a stand-in for S3 that keeps objects in memory
+type localS3 struct {
+	mutex   sync.Mutex
+	objects map[string][]byte
+}
+
+func (s *localS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	switch r.Method {
+	case http.MethodPost:
+		if _, ok := r.URL.Query()["delete"]; !ok {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		request := struct {
+			Objects []struct{ Key string } `xml:"Object"`
+		}{}
+		body, _ := ioutil.ReadAll(r.Body)
+		xml.Unmarshal(body, &request)
+		for _, object := range request.Objects {
+			delete(s.objects, r.URL.Path+"/"+object.Key)
+		}
+		w.Write([]byte(`<DeleteResult></DeleteResult>`))
+	case http.MethodPut:
+		s.objects[r.URL.Path], _ = ioutil.ReadAll(r.Body)
+	case http.MethodGet:
+		object, ok := s.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`))
+			return
+		}
+		w.Write(object)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// largeResponseToolbox returns a toolbox using a local S3 and a fake encryption that reverses the data
+func largeResponseToolbox(t *testing.T) (*toolbox.Toolbox, *localS3) {
+	s3 := &localS3{objects: map[string][]byte{}}
+	server := httptest.NewServer(s3)
+	t.Cleanup(server.Close)
+
+	tb := toolbox.GetToolbox()
+	tb.JobBucketName = "job-bucket"
+	tb.AWSSession = session.New(aws.NewConfig().
+		WithRegion("us-west-2").
+		WithCredentials(credentials.NewStaticCredentials("id", "secret", "")).
+		WithEndpoint(server.URL).
+		WithS3ForcePathStyle(true))
+
+	reverse := func(data []byte) []byte {
+		reversed := make([]byte, len(data))
+		for i := range data {
+			reversed[len(data)-1-i] = data[i]
+		}
+		return reversed
+	}
+	patches := gomonkey.ApplyMethod(reflect.TypeOf(tb), "Encrypt", func(_ *toolbox.Toolbox, ctx context.Context, jobID string, data []byte) (*appencryption.DataRowRecord, error) {
+		return &appencryption.DataRowRecord{Data: reverse(data)}, nil
+	})
+	patches.ApplyMethod(reflect.TypeOf(tb), "Decrypt", func(_ *toolbox.Toolbox, ctx context.Context, jobID string, decryptionRecord appencryption.DataRowRecord) ([]byte, error) {
+		return reverse(decryptionRecord.Data), nil
+	})
+	t.Cleanup(patches.Reset)
+
+	return tb, s3
+}
+
+func TestOffloadLargeResponse(t *testing.T) {
+	ctx := context.Background()
+	tb, s3 := largeResponseToolbox(t)
+
+	// Small responses are sent as is
+	completedJob := &CompletedJobData{JobID: "job", ModuleName: "shodan", Response: `[{"Title":"small"}]`}
+	if err := OffloadLargeResponse(ctx, tb, completedJob); err != nil {
+		t.Fatal(err)
+	}
+	if completedJob.ResponseReference != nil || completedJob.StoredResponse() != `[{"Title":"small"}]` {
+		t.Errorf("expected the small response to be kept, got %+v", completedJob)
+	}
+
+	// Large responses are stored encrypted in the job bucket
+	largeResponse := `[{"Title":"large","Data":"` + strings.Repeat("a", MaxInlineResponseSize) + `"}]`
+	completedJob = &CompletedJobData{JobID: "job", ModuleName: "shodan", Response: largeResponse}
+	if err := OffloadLargeResponse(ctx, tb, completedJob); err != nil {
+		t.Fatal(err)
+	}
+	expectedReference := &ResponseReference{Bucket: "job-bucket", Key: "responses/job/shodan.json", Size: len(largeResponse)}
+	if completedJob.Response != "" || !reflect.DeepEqual(completedJob.ResponseReference, expectedReference) {
+		t.Errorf("expected the reference %+v instead of the response, got %+v", expectedReference, completedJob.ResponseReference)
+	}
+	object, ok := s3.objects["/job-bucket/responses/job/shodan.json"]
+	if !ok {
+		t.Fatal("expected the response to be stored in the job bucket")
+	}
+	if strings.Contains(string(object), `"Title":"large"`) {
+		t.Error("expected the stored response to be encrypted")
+	}
+
+	// Jobs resolve the reference to the response
+	storedResponse, _ := tb.Encrypt(ctx, "job", []byte(completedJob.StoredResponse()))
+	missingResponse, _ := tb.Encrypt(ctx, "job", []byte(`{"responseReference":{"bucket":"job-bucket","key":"responses/job/missing.json"}}`))
+	jobEntry := &JobDBEntry{
+		JobID: "job",
+		Responses: map[string]appencryption.DataRowRecord{
+			"shodan":  *storedResponse,
+			"missing": *missingResponse,
+		},
+	}
+	jobEntry.Decrypt(ctx, tb)
+	shodanResponse, _ := jobEntry.DecryptedResponses["shodan"].([]interface{})
+	if len(shodanResponse) != 1 || shodanResponse[0].(map[string]interface{})["Title"] != "large" {
+		t.Errorf("expected the response from the job bucket, got %v", jobEntry.DecryptedResponses["shodan"])
+	}
+	missing, _ := jobEntry.DecryptedResponses["missing"].([]interface{})
+	if len(missing) != 1 || !strings.HasPrefix(missing[0].(map[string]interface{})["error"].(string), "error fetching the response") {
+		t.Errorf("expected an error for a response missing from the job bucket, got %v", jobEntry.DecryptedResponses["missing"])
+	}
+}
+
+func TestDeleteLargeResponses(t *testing.T) {
+	ctx := context.Background()
+	tb, s3 := largeResponseToolbox(t)
+	s3.objects["/job-bucket/responses/job/shodan.json"] = []byte("shodan")
+	s3.objects["/job-bucket/responses/job/whois.json"] = []byte("whois")
+	s3.objects["/job-bucket/responses/other/shodan.json"] = []byte("other")
+
+	// Modules whose response wasn't stored in the job bucket are skipped
+	if err := DeleteLargeResponses(ctx, tb, "job", []string{"shodan", "whois", "nvd"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(s3.objects) != 1 || s3.objects["/job-bucket/responses/other/shodan.json"] == nil {
+		t.Errorf("expected only the responses of the job to be deleted, got %v", s3.objects)
+	}
+}
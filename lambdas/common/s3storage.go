@@ -15,13 +15,13 @@ import (
 var pathPrefix = "/responses"
 var expiration = 7 * 24 * time.Hour // expiration of Presigned URL set to 7 days
 
+// PutObjectInS3 uploads an object to the job bucket and returns a presigned URL to download it
 func PutObjectInS3(filename string, object io.Reader) (string, error) {
 	sess, err := session.NewSession(&aws.Config{
 		Region: aws.String("us-west-2")},
 	)
 	if err != nil {
-		fmt.Errorf("Unable to create session in AWS for S3 Upload %v\n", err)
-		return "", err
+		return "", fmt.Errorf("unable to create session in AWS for S3 upload: %w", err)
 	}
 	cd := time.Now()
 	keyName := pathPrefix + "/" + fmt.Sprintf("%d/%d/%d/%d_%d_%d_%d_%s",
@@ -34,16 +34,19 @@ func PutObjectInS3(filename string, object io.Reader) (string, error) {
 	}
 	uploader := s3manager.NewUploader(sess)
 	// Perform an upload.
-	result, err := uploader.Upload(upLoadParams)
+	_, err = uploader.Upload(upLoadParams)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload object to S3: %w", err)
+	}
 
 	svc := s3.New(sess)
 	req, _ := svc.GetObjectRequest(&s3.GetObjectInput{
 		Bucket: aws.String(responseBucket),
-		Key:    aws.String(result.Location),
+		Key:    aws.String(keyName),
 	})
 	urlStr, err := req.Presign(expiration)
 	if err != nil {
-		fmt.Errorf("Failed to Presign Object in AWS for S3 Upload %v\n", err)
+		return "", fmt.Errorf("failed to presign object in S3: %w", err)
 	}
-	return urlStr, err
+	return urlStr, nil
 }
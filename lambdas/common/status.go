@@ -0,0 +1,93 @@
+package common
+
+import (
+	"time"
+)
+
+// ModuleStatusCode is the state of a single module within a job
+type ModuleStatusCode string
+
+// ModuleStatusCodes
+const (
+	// The job was created but the module has not picked it up yet
+	ModulePending ModuleStatusCode = "PENDING"
+	// The module is working on the job
+	ModuleRunning ModuleStatusCode = "RUNNING"
+	// The module finished, note that a module that found no data still succeeded
+	ModuleSucceeded ModuleStatusCode = "SUCCEEDED"
+	// The module ran out of time and returned the results it had so far
+	ModulePartial ModuleStatusCode = "PARTIAL"
+	// The module (or the vendor behind it) had an error
+	ModuleFailed ModuleStatusCode = "FAILED"
+	// The module lambda timed out without returning any results
+	ModuleTimedOut ModuleStatusCode = "TIMED_OUT"
+	// The module does not support any of the IOC types in the job
+	ModuleSkippedUnsupported ModuleStatusCode = "SKIPPED_UNSUPPORTED"
+	// The requester is not allowed to run the module
+	ModuleSkippedUnauthorized ModuleStatusCode = "SKIPPED_UNAUTHORIZED"
+	// The vendor of the module is failing, so the module was skipped until it is tried again
+	ModuleSkippedUnavailable ModuleStatusCode = "SKIPPED_UNAVAILABLE"
+	// The module used up its quota, or the requester's quota of the module, before looking up any IOC
+	ModuleSkippedQuota ModuleStatusCode = "SKIPPED_QUOTA"
+	// The job was cancelled, the module returned the results it had so far
+	ModuleCancelled ModuleStatusCode = "CANCELLED"
+)
+
+// ModuleErrorCode describes why a module did not succeed
+type ModuleErrorCode string
+
+// ModuleErrorCodes
+const (
+	ModuleErrorCodeModule             ModuleErrorCode = "MODULE_ERROR"
+	ModuleErrorCodeTimeout            ModuleErrorCode = "TIMEOUT"
+	ModuleErrorCodeUnauthorized       ModuleErrorCode = "UNAUTHORIZED"
+	ModuleErrorCodeUnsupportedIOCType ModuleErrorCode = "UNSUPPORTED_IOC_TYPE"
+	ModuleErrorCodeLambdaFailure      ModuleErrorCode = "LAMBDA_FAILURE"
+	ModuleErrorCodeCancelled          ModuleErrorCode = "CANCELLED"
+	ModuleErrorCodeResponseTooLarge   ModuleErrorCode = "RESPONSE_TOO_LARGE"
+	ModuleErrorCodeVendorUnavailable  ModuleErrorCode = "VENDOR_UNAVAILABLE"
+	ModuleErrorCodeQuotaExceeded      ModuleErrorCode = "QUOTA_EXCEEDED"
+)
+
+// ModuleStatus is the status of a single module within a job.
+// It is stored unencrypted next to the module's response, so it must never contain IOCs or vendor data.
+type ModuleStatus struct {
+	Status    ModuleStatusCode `json:"status" dynamodbav:"status"`
+	ErrorCode ModuleErrorCode  `json:"errorCode,omitempty" dynamodbav:"errorCode,omitempty"`
+	// Whether running the module again could give a different result
+	Retryable bool `json:"retryable" dynamodbav:"retryable"`
+	// Epoch start and end time of the module
+	StartTime float64 `json:"startTime,omitempty" dynamodbav:"startTime,omitempty"`
+	EndTime   float64 `json:"endTime,omitempty" dynamodbav:"endTime,omitempty"`
+	// Number of IOCs the module was given and the number of results it returned
+	IOCCount    int `json:"iocCount" dynamodbav:"iocCount"`
+	ResultCount int `json:"resultCount" dynamodbav:"resultCount"`
+}
+
+// Finished returns true if the module will not report anything else for this job
+func (s *ModuleStatus) Finished() bool {
+	return s != nil && s.Status != ModulePending && s.Status != ModuleRunning
+}
+
+// Failed returns true if the module finished without giving us its results
+func (s *ModuleStatus) Failed() bool {
+	switch s.Status {
+	case ModuleFailed, ModuleTimedOut, ModuleSkippedUnauthorized, ModuleSkippedUnavailable, ModuleSkippedQuota:
+		return true
+	}
+	return false
+}
+
+// NewPendingModuleStatuses returns a pending status for each of the modules
+func NewPendingModuleStatuses(modules []string) map[string]*ModuleStatus {
+	ret := map[string]*ModuleStatus{}
+	for _, moduleName := range modules {
+		ret[moduleName] = &ModuleStatus{Status: ModulePending}
+	}
+	return ret
+}
+
+// EpochTime converts the time to the epoch format used in job entries
+func EpochTime(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
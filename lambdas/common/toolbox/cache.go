@@ -0,0 +1,193 @@
+package toolbox
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
+	"github.com/godaddy/asherah/go/appencryption"
+)
+
+const (
+	// cachePartitionID is the asherah partition used to encrypt cached results.
+	// Cached results are shared across jobs, so they can't be encrypted under a job ID.
+	cachePartitionID = "EnrichmentCache"
+	cacheKeyKey      = "cacheKey"
+)
+
+// CachedResult is a module result for a single IOC that can be reused by other jobs
+type CachedResult struct {
+	// When the module fetched this data from the vendor
+	FetchedAt time.Time
+	// The marshalled module output
+	Data []byte
+}
+
+// cacheDBEntry is how a cached result is stored in the database
+type cacheDBEntry struct {
+	CacheKey  string                      `dynamodbav:"cacheKey"`
+	FetchedAt int64                       `dynamodbav:"fetchedAt"`
+	TTL       int64                       `dynamodbav:"ttl"`
+	Result    appencryption.DataRowRecord `dynamodbav:"result"`
+}
+
+// caseInsensitiveIOCTypes are the types of IOCs that are the same however they are capitalized
+var caseInsensitiveIOCTypes = map[triage.IOCType]bool{
+	triage.DomainType:          true,
+	triage.EmailType:           true,
+	triage.CVEType:             true,
+	triage.CWEType:             true,
+	triage.CAPECType:           true,
+	triage.MD5Type:             true,
+	triage.SHA1Type:            true,
+	triage.SHA256Type:          true,
+	triage.SHA512Type:          true,
+	triage.IPType:              true,
+	triage.AWSHostnameType:     true,
+	triage.GoDaddyHostnameType: true,
+}
+
+// CacheKey builds the key a module result is cached under.
+// The IOC is hashed so it is never stored in plaintext.
+func CacheKey(moduleName string, iocType triage.IOCType, ioc string) string {
+	iocType = triage.IOCType(strings.ToUpper(string(iocType)))
+	key := sha256.Sum256([]byte(strings.Join([]string{
+		moduleName,
+		string(iocType),
+		NormalizeIOC(iocType, ioc),
+	}, "\x00")))
+	return fmt.Sprintf("%x", key)
+}
+
+// NormalizeIOC returns the IOC the way it is compared in cache keys, so the same IOC written differently is cached once.
+// Only IOCs of case insensitive types are lowercased, URLs only have their scheme and host lowercased
+// since their path and query are case sensitive.
+func NormalizeIOC(iocType triage.IOCType, ioc string) string {
+	ioc = strings.TrimSpace(ioc)
+	switch {
+	case caseInsensitiveIOCTypes[iocType]:
+		return strings.ToLower(ioc)
+	case iocType == triage.URLType:
+		u, err := url.Parse(ioc)
+		if err != nil || u.Host == "" {
+			return ioc
+		}
+		u.Scheme = strings.ToLower(u.Scheme)
+		u.Host = strings.ToLower(u.Host)
+		return u.String()
+	}
+	return ioc
+}
+
+// GetCachedResult looks up a previously fetched result for this module and IOC.
+// It returns nil if there is no result or the result has expired.
+func (t *Toolbox) GetCachedResult(ctx context.Context, moduleName string, iocType triage.IOCType, ioc string) (*CachedResult, error) {
+	span, ctx := t.TracerLogger.StartSpan(ctx, "GetCachedResult", "cache", "result", "get")
+	defer span.End(ctx)
+	span.LogKV("moduleName", moduleName)
+
+	if t.AWSSession == nil {
+		return nil, ErrNoAWSSession
+	}
+	dynamoDBClient := dynamodb.New(t.AWSSession)
+
+	item, err := dynamoDBClient.GetItem(&dynamodb.GetItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			cacheKeyKey: {S: aws.String(CacheKey(moduleName, iocType, ioc))},
+		},
+		TableName: &t.CacheDBTableName,
+	})
+	if err != nil {
+		span.LogKV("error", err)
+		return nil, fmt.Errorf("error fetching cached result: %w", err)
+	}
+	if item.Item == nil {
+		span.LogKV("cacheHit", false)
+		return nil, nil
+	}
+
+	entry := cacheDBEntry{}
+	err = dynamodbattribute.UnmarshalMap(item.Item, &entry)
+	if err != nil {
+		span.LogKV("error", err)
+		return nil, fmt.Errorf("error unmarshalling cached result: %w", err)
+	}
+	// DynamoDB removes expired items lazily, so check the expiration ourselves
+	if time.Unix(entry.TTL, 0).Before(time.Now()) {
+		span.LogKV("cacheHit", false)
+		return nil, nil
+	}
+
+	data, err := t.Decrypt(ctx, cachePartitionID, entry.Result)
+	if err != nil {
+		span.LogKV("error", err)
+		return nil, fmt.Errorf("error decrypting cached result: %w", err)
+	}
+
+	span.LogKV("cacheHit", true)
+	return &CachedResult{
+		FetchedAt: time.Unix(entry.FetchedAt, 0),
+		Data:      data,
+	}, nil
+}
+
+// PutCachedResult stores a module result for this IOC so other jobs can reuse it until the ttl expires
+func (t *Toolbox) PutCachedResult(ctx context.Context, moduleName string, iocType triage.IOCType, ioc string, result *CachedResult, ttl time.Duration) error {
+	span, ctx := t.TracerLogger.StartSpan(ctx, "PutCachedResult", "cache", "result", "put")
+	defer span.End(ctx)
+	span.LogKV("moduleName", moduleName)
+
+	if t.AWSSession == nil {
+		return ErrNoAWSSession
+	}
+	dynamoDBClient := dynamodb.New(t.AWSSession)
+
+	encryptedData, err := t.Encrypt(ctx, cachePartitionID, result.Data)
+	if err != nil {
+		span.LogKV("error", err)
+		return fmt.Errorf("error encrypting result: %w", err)
+	}
+
+	item, err := dynamodbattribute.MarshalMap(cacheDBEntry{
+		CacheKey:  CacheKey(moduleName, iocType, ioc),
+		FetchedAt: result.FetchedAt.Unix(),
+		TTL:       result.FetchedAt.Add(ttl).Unix(),
+		Result:    *encryptedData,
+	})
+	if err != nil {
+		span.LogKV("error", err)
+		return fmt.Errorf("error marshalling result: %w", err)
+	}
+
+	_, err = dynamoDBClient.PutItem(&dynamodb.PutItemInput{
+		Item:      item,
+		TableName: &t.CacheDBTableName,
+	})
+	if err != nil {
+		span.LogKV("error", err)
+		return fmt.Errorf("error storing result: %w", err)
+	}
+
+	return nil
+}
+
+// GetModuleCacheTTL returns how long results from this module may be cached.
+// Modules that don't declare a cacheTTL in their metadata are not cached.
+func (t *Toolbox) GetModuleCacheTTL(ctx context.Context, moduleName string) (time.Duration, error) {
+	modules, err := t.GetModules(ctx)
+	if err != nil {
+		return 0, err
+	}
+	metadata, ok := modules[moduleName]
+	if !ok {
+		return 0, nil
+	}
+	return metadata.GetCacheTTL(), nil
+}
@@ -0,0 +1,78 @@
+package toolbox
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
+)
+
+func TestCacheKey(t *testing.T) {
+	key := CacheKey("virustotal", triage.DomainType, "godaddy.com")
+
+	// Keys should not depend on formatting of the IOC or IOC type
+	if otherKey := CacheKey("virustotal", "domain", " GoDaddy.com "); otherKey != key {
+		t.Errorf("expected the same key for the same IOC, got %s and %s", key, otherKey)
+	}
+
+	// But should be different for different modules, types, and IOCs
+	for _, otherKey := range []string{
+		CacheKey("shodan", triage.DomainType, "godaddy.com"),
+		CacheKey("virustotal", triage.URLType, "godaddy.com"),
+		CacheKey("virustotal", triage.DomainType, "example.com"),
+	} {
+		if otherKey == key {
+			t.Errorf("expected different keys, got %s for both", key)
+		}
+	}
+
+	// The path and query of URLs are case sensitive
+	if CacheKey("urlhaus", triage.URLType, "HTTPS://X.example.com/Payload.exe") != CacheKey("urlhaus", triage.URLType, "https://x.example.com/Payload.exe") {
+		t.Error("expected the same key for URLs whose scheme and host only differ in case")
+	}
+	if CacheKey("urlhaus", triage.URLType, "https://x.example.com/Payload.exe") == CacheKey("urlhaus", triage.URLType, "https://x.example.com/payload.exe") {
+		t.Error("expected different keys for URLs whose paths differ in case")
+	}
+
+	// The IOC should never be stored in plaintext
+	if len(key) != 64 {
+		t.Errorf("expected a sha256 hex key, got %s", key)
+	}
+}
+
+func TestNormalizeIOC(t *testing.T) {
+	for _, test := range []struct {
+		iocType  triage.IOCType
+		ioc      string
+		expected string
+	}{
+		{triage.MD5Type, " 44D88612FEA8A8F36DE82E1278ABB02F ", "44d88612fea8a8f36de82e1278abb02f"},
+		{triage.DomainType, "GoDaddy.com", "godaddy.com"},
+		{triage.EmailType, "Security@GoDaddy.com", "security@godaddy.com"},
+		{triage.URLType, "HTTPS://WWW.GoDaddy.com/Payload.exe?Id=AbC", "https://www.godaddy.com/Payload.exe?Id=AbC"},
+		{triage.URLType, "not a URL", "not a URL"},
+		{triage.GoDaddyUsernameType, "JDoe", "JDoe"},
+	} {
+		if normalized := NormalizeIOC(test.iocType, test.ioc); normalized != test.expected {
+			t.Errorf("expected %s %q to be normalized to %q, got %q", test.iocType, test.ioc, test.expected, normalized)
+		}
+	}
+}
+
+func TestLambdaMetadataCacheTTL(t *testing.T) {
+	metadata := LambdaMetadata{}
+	err := json.Unmarshal([]byte(`{"supportedIOCTypes":["DOMAIN"],"cacheTTL":3600}`), &metadata)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if metadata.GetCacheTTL() != time.Hour {
+		t.Errorf("expected a cache ttl of 1h, got %s", metadata.GetCacheTTL())
+	}
+
+	// Modules without a cacheTTL are not cached
+	if (LambdaMetadata{}).GetCacheTTL() != 0 {
+		t.Errorf("expected no cache ttl by default")
+	}
+}
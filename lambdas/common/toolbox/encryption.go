@@ -93,16 +93,15 @@ func (t *Toolbox) CloseAsherahSessions(ctx context.Context) error {
 
 // getAsherahSession Performs all the setup for getting an asherah session
 func (t *Toolbox) getAsherahSession(ctx context.Context, sessionID string) (*appencryption.Session, error) {
-	if t.AWSSession == nil {
-		return nil, ErrNoAWSSession
-	}
-
 	var span *appsectracing.Span
 	span, ctx = t.TracerLogger.StartSpan(ctx, "SetUpAsherahSession", "asherah", "session", "setup")
 	defer span.End(ctx)
 
-	// Build session factory if we haven't already
+	// Build session factory if we haven't already, local runs set their own
 	if t.AsherahSessionFactory == nil {
+		if t.AWSSession == nil {
+			return nil, ErrNoAWSSession
+		}
 		err := t.getAsherahSessionFactory(ctx)
 		if err != nil {
 			return nil, fmt.Errorf("error getting session factory: %w", err)
@@ -0,0 +1,152 @@
+package toolbox
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// rateLimiters are the rate limiters of each vendor, shared by every fan out of this process
+var (
+	rateLimiters      = map[string]*RateLimiter{}
+	rateLimitersMutex sync.Mutex
+)
+
+// RateLimiter is a token bucket limiting how often a vendor is called.
+// Tokens are added at a steady rate up to the burst, each call takes one.
+type RateLimiter struct {
+	mutex     sync.Mutex
+	perSecond float64
+	burst     float64
+	tokens    float64
+	updatedAt time.Time
+}
+
+// NewRateLimiter creates a rate limiter allowing perSecond calls a second, and bursts of up to burst calls.
+// A rate that isn't positive and finite doesn't limit calls.
+func NewRateLimiter(perSecond float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		perSecond: perSecond,
+		burst:     float64(burst),
+		tokens:    float64(burst),
+		updatedAt: time.Now(),
+	}
+}
+
+// VendorRateLimiter gets the rate limiter of a vendor, creating it with these limits the first time.
+// Every module calling the vendor in this process shares it, like the concurrent triages of a job.
+func VendorRateLimiter(vendor string, perSecond float64, burst int) *RateLimiter {
+	rateLimitersMutex.Lock()
+	defer rateLimitersMutex.Unlock()
+	limiter, ok := rateLimiters[vendor]
+	if !ok {
+		limiter = NewRateLimiter(perSecond, burst)
+		rateLimiters[vendor] = limiter
+	}
+	return limiter
+}
+
+// Wait blocks until a call is allowed, or returns the error of the context if it is done first
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l.unlimited() {
+		return nil
+	}
+	l.mutex.Lock()
+	now := time.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.updatedAt).Seconds()*l.perSecond)
+	l.updatedAt = now
+	// Take the next token even if it isn't there yet, so calls are allowed in the order they wait
+	l.tokens--
+	wait := time.Duration(-l.tokens / l.perSecond * float64(time.Second))
+	l.mutex.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// Give the token back, this call won't be made
+		l.mutex.Lock()
+		l.tokens++
+		l.mutex.Unlock()
+		return ctx.Err()
+	}
+}
+
+// unlimited returns true if the rate of the limiter doesn't limit calls, there are no tokens to wait for then
+func (l *RateLimiter) unlimited() bool {
+	return !(l.perSecond > 0) || math.IsInf(l.perSecond, 1)
+}
+
+// FanOutOptions limit how IOCs are processed by FanOut
+type FanOutOptions struct {
+	// How many IOCs are processed at a time (default: 1)
+	MaxConcurrency int
+	// Limits how often IOCs are processed, like VendorRateLimiter of the vendor the IOCs are looked up with
+	RateLimiter *RateLimiter
+}
+
+// IOCResult is the result of processing an IOC in a fan out
+type IOCResult struct {
+	IOC   string
+	Value interface{}
+	// The error processing the IOC, or the error of the context if it was skipped
+	Err error
+	// Set if the IOC wasn't processed because the context was done first
+	Skipped bool
+}
+
+// FanOut processes each IOC with the lookup function concurrently, within the limits of the options.
+// Once the context is done no more IOCs are processed, the IOCs processed so far are waited for.
+// The results are in the order of the IOCs.
+func FanOut(ctx context.Context, iocs []string, options FanOutOptions, lookup func(ctx context.Context, ioc string) (interface{}, error)) []IOCResult {
+	results := make([]IOCResult, len(iocs))
+	for i, ioc := range iocs {
+		results[i].IOC = ioc
+	}
+	maxConcurrency := options.MaxConcurrency
+	if maxConcurrency < 1 {
+		maxConcurrency = 1
+	}
+
+	wg := sync.WaitGroup{}
+	slots := make(chan struct{}, maxConcurrency)
+	started := 0
+	for ; started < len(iocs); started++ {
+		// Wait for a free slot, then for the rate limit
+		select {
+		case <-ctx.Done():
+		case slots <- struct{}{}:
+		}
+		if ctx.Err() == nil && options.RateLimiter != nil {
+			options.RateLimiter.Wait(ctx)
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(result *IOCResult) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			result.Value, result.Err = lookup(ctx, result.IOC)
+		}(&results[started])
+	}
+	for i := started; i < len(results); i++ {
+		results[i].Err = ctx.Err()
+		results[i].Skipped = true
+	}
+
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,129 @@
+package toolbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFanOut(t *testing.T) {
+	iocs := []string{"1.1.1.1", "2.2.2.2", "3.3.3.3", "4.4.4.4", "5.5.5.5", "6.6.6.6"}
+	running, maxRunning := int32(0), int32(0)
+	results := FanOut(context.Background(), iocs, FanOutOptions{MaxConcurrency: 2}, func(ctx context.Context, ioc string) (interface{}, error) {
+		now := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if now <= max || atomic.CompareAndSwapInt32(&maxRunning, max, now) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond * 10)
+		if ioc == "3.3.3.3" {
+			return nil, errors.New("not found")
+		}
+		return "report of " + ioc, nil
+	})
+
+	if maxRunning != 2 {
+		t.Errorf("expected 2 IOCs to be processed at a time, got %d", maxRunning)
+	}
+	if len(results) != len(iocs) {
+		t.Fatalf("expected a result for each IOC, got %d", len(results))
+	}
+	for i, result := range results {
+		if result.IOC != iocs[i] || result.Skipped {
+			t.Errorf("expected the result of %s in order, got %+v", iocs[i], result)
+		}
+		if result.IOC == "3.3.3.3" {
+			if result.Err == nil || result.Value != nil {
+				t.Errorf("expected the error of %s, got %+v", result.IOC, result)
+			}
+		} else if result.Err != nil || result.Value != "report of "+result.IOC {
+			t.Errorf("expected the report of %s, got %+v", result.IOC, result)
+		}
+	}
+}
+
+func TestFanOutCancellation(t *testing.T) {
+	iocs := make([]string, 20)
+	for i := range iocs {
+		iocs[i] = fmt.Sprintf("10.0.0.%d", i)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The first IOC runs out of time, the ones after it are skipped
+	results := FanOut(ctx, iocs, FanOutOptions{MaxConcurrency: 1}, func(ctx context.Context, ioc string) (interface{}, error) {
+		cancel()
+		return ioc, nil
+	})
+	if results[0].Value != iocs[0] || results[0].Skipped {
+		t.Errorf("expected the first IOC to be processed, got %+v", results[0])
+	}
+	for _, result := range results[1:] {
+		if !result.Skipped || !errors.Is(result.Err, context.Canceled) {
+			t.Errorf("expected %s to be skipped, got %+v", result.IOC, result)
+		}
+	}
+
+	// Nothing is processed once cancelled, even waiting on the rate limit
+	limiter := NewRateLimiter(0.001, 1)
+	limiter.Wait(context.Background())
+	start := time.Now()
+	results = FanOut(ctx, iocs, FanOutOptions{MaxConcurrency: 5, RateLimiter: limiter}, func(ctx context.Context, ioc string) (interface{}, error) {
+		t.Errorf("expected %s not to be processed", ioc)
+		return nil, nil
+	})
+	if time.Since(start) > time.Second || !results[0].Skipped {
+		t.Errorf("expected every IOC to be skipped right away, got %+v after %s", results[0], time.Since(start))
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := NewRateLimiter(100, 2)
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The burst is allowed right away, the other 4 calls wait 10ms each
+	if elapsed := time.Since(start); elapsed < time.Millisecond*35 {
+		t.Errorf("expected the calls after the burst to be limited, took %s", elapsed)
+	}
+
+	// Calls given up on don't take a token
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	limiter = NewRateLimiter(1, 1)
+	limiter.Wait(context.Background())
+	if err := limiter.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the wait to time out, got %v", err)
+	}
+	if limiter.tokens < -0.01 {
+		t.Errorf("expected the token to be given back, got %f tokens", limiter.tokens)
+	}
+
+	// Rates that aren't positive and finite don't limit calls
+	for _, perSecond := range []float64{0, -1, math.NaN(), math.Inf(1)} {
+		limiter = NewRateLimiter(perSecond, 1)
+		start = time.Now()
+		for i := 0; i < 3; i++ {
+			if err := limiter.Wait(context.Background()); err != nil {
+				t.Fatalf("expected a rate of %f not to limit calls, got %v", perSecond, err)
+			}
+		}
+		if elapsed := time.Since(start); elapsed > time.Millisecond*10 {
+			t.Errorf("expected a rate of %f not to limit calls, took %s", perSecond, elapsed)
+		}
+	}
+
+	if VendorRateLimiter("test", 1, 1) != VendorRateLimiter("test", 2, 2) {
+		t.Error("expected the same rate limiter for the same vendor")
+	}
+}
@@ -0,0 +1,257 @@
+package toolbox
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+)
+
+// CircuitState is the state of the circuit breaker of a module
+type CircuitState string
+
+// CircuitStates
+const (
+	// The module runs as usual
+	CircuitClosed CircuitState = "closed"
+	// The vendor of the module is failing, jobs skip the module until it is tried again
+	CircuitOpen CircuitState = "open"
+	// A job is trying the vendor again, other jobs skip the module until it succeeds or fails
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+const (
+	healthModuleNameKey = "moduleName"
+	// The error rate of a module is the share of its latest runs that failed
+	healthWindow = 20
+	// A module isn't opened before it ran this many times, so a couple of errors don't open it
+	healthMinRuns = 5
+	// The error rate opening a module
+	healthOpenErrorRate = 0.5
+	// How long a module stays open before the vendor is tried again
+	healthOpenDuration = time.Minute * 5
+	// How many times a health update is tried again when another lambda updated the health first
+	healthUpdateRetries = 5
+)
+
+// ModuleHealth is the circuit breaker of a module, shared by every lambda running it.
+// It is listed with the modules to every user, so it must never contain IOCs or vendor data.
+type ModuleHealth struct {
+	ModuleName string       `json:"-" dynamodbav:"moduleName"`
+	State      CircuitState `json:"state" dynamodbav:"state"`
+	// The share of the latest runs of the module that failed, from 0 to 1
+	ErrorRate float64 `json:"errorRate" dynamodbav:"errorRate"`
+	// The error code of the last run that failed, error messages aren't kept as they can contain IOCs
+	LastError   string `json:"lastError,omitempty" dynamodbav:"lastError,omitempty"`
+	LastErrorAt int64  `json:"lastErrorAt,omitempty" dynamodbav:"lastErrorAt,omitempty"`
+	// Epoch time of the last state change
+	ChangedAt int64 `json:"changedAt,omitempty" dynamodbav:"changedAt,omitempty"`
+	// Epoch time the vendor of an open module is tried again
+	RetryAt int64 `json:"retryAt,omitempty" dynamodbav:"retryAt,omitempty"`
+	// Whether each of the latest runs failed, oldest first
+	Runs []bool `json:"-" dynamodbav:"runs"`
+	// Incremented by every update, so lambdas updating the health at the same time don't overwrite each other
+	Version int64 `json:"-" dynamodbav:"version"`
+}
+
+// allow returns whether the module may run, a module open long enough is moved to half open for this run to try the vendor again.
+// It returns whether the health changed as well.
+func (h *ModuleHealth) allow(now time.Time) (allowed bool, changed bool) {
+	if h.State != CircuitOpen && h.State != CircuitHalfOpen {
+		return true, false
+	}
+	if now.Unix() < h.RetryAt {
+		return false, false
+	}
+	// A half open module whose run never finished is tried again too
+	h.setState(CircuitHalfOpen, now)
+	return true, true
+}
+
+// record records the outcome of a run of the module, with the error code of the run if it failed
+func (h *ModuleHealth) record(errorCode string, now time.Time) {
+	failed := errorCode != ""
+	h.Runs = append(h.Runs, failed)
+	if len(h.Runs) > healthWindow {
+		h.Runs = h.Runs[len(h.Runs)-healthWindow:]
+	}
+	failures := 0
+	for _, runFailed := range h.Runs {
+		if runFailed {
+			failures++
+		}
+	}
+	h.ErrorRate = float64(failures) / float64(len(h.Runs))
+	if failed {
+		h.LastError = errorCode
+		h.LastErrorAt = now.Unix()
+	}
+
+	switch {
+	case h.State == CircuitHalfOpen && failed:
+		h.setState(CircuitOpen, now)
+	case h.State == CircuitHalfOpen:
+		// The vendor is back, the failures before it went down don't count anymore
+		h.setState(CircuitClosed, now)
+		h.Runs = []bool{false}
+		h.ErrorRate = 0
+	case h.State == CircuitClosed && len(h.Runs) >= healthMinRuns && h.ErrorRate >= healthOpenErrorRate:
+		h.setState(CircuitOpen, now)
+	}
+}
+
+func (h *ModuleHealth) setState(state CircuitState, now time.Time) {
+	h.State = state
+	h.ChangedAt = now.Unix()
+	h.RetryAt = 0
+	if state != CircuitClosed {
+		h.RetryAt = now.Add(healthOpenDuration).Unix()
+	}
+}
+
+// GetModuleHealth gets the health of a module, modules without any runs recorded are closed
+func (t *Toolbox) GetModuleHealth(ctx context.Context, moduleName string) (*ModuleHealth, error) {
+	span, ctx := t.TracerLogger.StartSpan(ctx, "GetModuleHealth", "health", "module", "get")
+	defer span.End(ctx)
+	span.LogKV("moduleName", moduleName)
+
+	if t.AWSSession == nil {
+		return nil, ErrNoAWSSession
+	}
+	dynamoDBClient := dynamodb.New(t.AWSSession)
+
+	item, err := dynamoDBClient.GetItem(&dynamodb.GetItemInput{
+		Key: map[string]*dynamodb.AttributeValue{
+			healthModuleNameKey: {S: aws.String(moduleName)},
+		},
+		ConsistentRead: aws.Bool(true),
+		TableName:      &t.ModuleHealthDBTableName,
+	})
+	if err != nil {
+		span.LogKV("error", err)
+		return nil, fmt.Errorf("error fetching module health: %w", err)
+	}
+
+	health := &ModuleHealth{ModuleName: moduleName, State: CircuitClosed}
+	if item.Item == nil {
+		return health, nil
+	}
+	err = dynamodbattribute.UnmarshalMap(item.Item, health)
+	if err != nil {
+		span.LogKV("error", err)
+		return nil, fmt.Errorf("error unmarshalling module health: %w", err)
+	}
+	return health, nil
+}
+
+// GetModulesHealth gets the health of every module that has runs recorded
+func (t *Toolbox) GetModulesHealth(ctx context.Context) (map[string]*ModuleHealth, error) {
+	span, ctx := t.TracerLogger.StartSpan(ctx, "GetModulesHealth", "health", "module", "list")
+	defer span.End(ctx)
+
+	if t.AWSSession == nil {
+		return nil, ErrNoAWSSession
+	}
+	dynamoDBClient := dynamodb.New(t.AWSSession)
+
+	ret := map[string]*ModuleHealth{}
+	var unmarshalErr error
+	err := dynamoDBClient.ScanPagesWithContext(ctx, &dynamodb.ScanInput{
+		TableName: &t.ModuleHealthDBTableName,
+	}, func(output *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range output.Items {
+			health := &ModuleHealth{}
+			if unmarshalErr = dynamodbattribute.UnmarshalMap(item, health); unmarshalErr != nil {
+				return false
+			}
+			ret[health.ModuleName] = health
+		}
+		return true
+	})
+	if err == nil {
+		err = unmarshalErr
+	}
+	if err != nil {
+		span.LogKV("error", err)
+		return nil, fmt.Errorf("error fetching modules health: %w", err)
+	}
+	return ret, nil
+}
+
+// AllowModuleRun returns whether the module may run, or should be skipped because its vendor is failing.
+// Once a module was open long enough, a single run is allowed to try the vendor again.
+func (t *Toolbox) AllowModuleRun(ctx context.Context, moduleName string) (bool, *ModuleHealth, error) {
+	allowed := true
+	health, err := t.updateModuleHealth(ctx, moduleName, func(health *ModuleHealth) bool {
+		var changed bool
+		allowed, changed = health.allow(time.Now())
+		return changed
+	})
+	return allowed, health, err
+}
+
+// RecordModuleRun records the outcome of a run of the module in its health, with the error code of the run if it failed
+func (t *Toolbox) RecordModuleRun(ctx context.Context, moduleName string, errorCode string) (*ModuleHealth, error) {
+	return t.updateModuleHealth(ctx, moduleName, func(health *ModuleHealth) bool {
+		health.record(errorCode, time.Now())
+		return true
+	})
+}
+
+// updateModuleHealth applies the update to the health of the module and stores it if the update changed it.
+// If another lambda stored the health in the meantime the update is applied again to its health.
+func (t *Toolbox) updateModuleHealth(ctx context.Context, moduleName string, update func(health *ModuleHealth) bool) (*ModuleHealth, error) {
+	span, ctx := t.TracerLogger.StartSpan(ctx, "UpdateModuleHealth", "health", "module", "update")
+	defer span.End(ctx)
+	span.LogKV("moduleName", moduleName)
+
+	for try := 0; try < healthUpdateRetries; try++ {
+		health, err := t.GetModuleHealth(ctx, moduleName)
+		if err != nil {
+			return nil, err
+		}
+		if !update(health) {
+			return health, nil
+		}
+
+		version := health.Version
+		health.Version++
+		item, err := dynamodbattribute.MarshalMap(health)
+		if err != nil {
+			span.LogKV("error", err)
+			return nil, fmt.Errorf("error marshalling module health: %w", err)
+		}
+		condition := expression.AttributeNotExists(expression.Name(healthModuleNameKey)).
+			Or(expression.Name("version").Equal(expression.Value(version)))
+		expr, err := expression.NewBuilder().WithCondition(condition).Build()
+		if err != nil {
+			return nil, fmt.Errorf("error creating condition expression: %w", err)
+		}
+
+		dynamoDBClient := dynamodb.New(t.AWSSession)
+		_, err = dynamoDBClient.PutItem(&dynamodb.PutItemInput{
+			Item:                      item,
+			ConditionExpression:       expr.Condition(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			TableName:                 &t.ModuleHealthDBTableName,
+		})
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			// Another lambda updated the health first, update its health instead
+			continue
+		}
+		if err != nil {
+			span.LogKV("error", err)
+			return nil, fmt.Errorf("error storing module health: %w", err)
+		}
+		return health, nil
+	}
+	err := fmt.Errorf("error storing module health: it was updated by other lambdas %d times", healthUpdateRetries)
+	span.LogKV("error", err)
+	return nil, err
+}
@@ -0,0 +1,72 @@
+package toolbox
+
+import (
+	"testing"
+	"time"
+)
+
+func TestModuleHealthOpens(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	health := &ModuleHealth{State: CircuitClosed}
+
+	// A couple of errors don't open the module
+	health.record("MODULE_ERROR", now)
+	health.record("TIMEOUT", now)
+	if health.State != CircuitClosed || health.ErrorRate != 1 {
+		t.Errorf("expected the module to stay closed until it ran %d times, got %+v", healthMinRuns, health)
+	}
+	health.record("", now)
+	health.record("", now)
+	if health.State != CircuitClosed || health.ErrorRate != 0.5 {
+		t.Errorf("expected the module to be closed with an error rate of 0.5, got %+v", health)
+	}
+	health.record("MODULE_ERROR", now)
+	if health.State != CircuitOpen || health.LastError != "MODULE_ERROR" || health.RetryAt != now.Add(healthOpenDuration).Unix() {
+		t.Errorf("expected the module to be opened, got %+v", health)
+	}
+
+	// Only the latest runs count
+	health = &ModuleHealth{State: CircuitClosed, Runs: []bool{true}}
+	for i := 0; i < healthWindow; i++ {
+		health.record("", now)
+	}
+	if len(health.Runs) != healthWindow || health.ErrorRate != 0 || health.State != CircuitClosed {
+		t.Errorf("expected the old errors to be forgotten, got %+v", health)
+	}
+}
+
+func TestModuleHealthAllow(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	health := &ModuleHealth{State: CircuitClosed}
+	if allowed, changed := health.allow(now); !allowed || changed {
+		t.Errorf("expected a closed module to run, got %+v", health)
+	}
+
+	health.setState(CircuitOpen, now)
+	if allowed, _ := health.allow(now.Add(time.Minute)); allowed {
+		t.Errorf("expected an open module to be skipped, got %+v", health)
+	}
+
+	// A single run tries the vendor again
+	later := now.Add(healthOpenDuration)
+	if allowed, changed := health.allow(later); !allowed || !changed || health.State != CircuitHalfOpen {
+		t.Errorf("expected the module to be tried again, got %+v", health)
+	}
+	if allowed, _ := health.allow(later); allowed {
+		t.Errorf("expected other runs to be skipped while the module is tried again, got %+v", health)
+	}
+
+	// The vendor is still down
+	health.record("TIMEOUT", later)
+	if health.State != CircuitOpen || health.RetryAt != later.Add(healthOpenDuration).Unix() {
+		t.Errorf("expected the module to be opened again, got %+v", health)
+	}
+
+	// The vendor is back
+	later = later.Add(healthOpenDuration)
+	health.allow(later)
+	health.record("", later)
+	if health.State != CircuitClosed || health.ErrorRate != 0 || health.RetryAt != 0 || health.LastError != "TIMEOUT" {
+		t.Errorf("expected the module to be closed, got %+v", health)
+	}
+}
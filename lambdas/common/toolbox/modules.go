@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ssm"
@@ -18,6 +19,10 @@ func (t *Toolbox) GetModules(ctx context.Context) (map[string]LambdaMetadata, er
 	span, ctx = t.TracerLogger.StartSpan(ctx, "GetModules", "modules", "modules", "list")
 	defer span.End(ctx)
 
+	if t.Modules != nil {
+		return t.Modules, nil
+	}
+
 	ssmClient := ssm.New(t.AWSSession)
 
 	ret := map[string]LambdaMetadata{}
@@ -56,6 +61,31 @@ type LambdaMetadata struct {
 	SupportedIOCTypes []triage.IOCType `json:"supportedIOCTypes"`
 	// AuthZ Actions that can be performed in this module
 	Actions map[string]ActionSpecification `json:"actions"`
+	// How long (in seconds) results of this module can be reused across jobs.
+	// Leave blank to disable caching for this module.
+	CacheTTL int64 `json:"cacheTTL,omitempty"`
+	// How much the scores of this module count in the verdict of an IOC compared to other modules.
+	// Leave blank to weigh this module 1, 0 ignores its scores.
+	VerdictWeight *float64 `json:"verdictWeight,omitempty"`
+	// How many calls this module may make to its vendor, for vendors that charge per call.
+	// Leave blank to not limit this module.
+	Quota *ModuleQuota `json:"quota,omitempty"`
+}
+
+// GetCacheTTL returns the CacheTTL as a duration
+func (m LambdaMetadata) GetCacheTTL() time.Duration {
+	return time.Duration(m.CacheTTL) * time.Second
+}
+
+// GetVerdictWeight returns the VerdictWeight, 1 if not set
+func (m LambdaMetadata) GetVerdictWeight() float64 {
+	if m.VerdictWeight == nil {
+		return 1
+	}
+	if *m.VerdictWeight < 0 {
+		return 0
+	}
+	return *m.VerdictWeight
 }
 
 // ActionSpecification describes an action and what permissions are required to perform it
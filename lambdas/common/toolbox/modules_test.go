@@ -0,0 +1,25 @@
+package toolbox
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestLambdaMetadataVerdictWeight(t *testing.T) {
+	for metadataJSON, expected := range map[string]float64{
+		`{"supportedIOCTypes":["DOMAIN"]}`:                     1,
+		`{"supportedIOCTypes":["DOMAIN"],"verdictWeight":2.5}`: 2.5,
+		`{"supportedIOCTypes":["DOMAIN"],"verdictWeight":0}`:   0,
+		`{"supportedIOCTypes":["DOMAIN"],"verdictWeight":-1}`:  0,
+	} {
+		metadata := LambdaMetadata{}
+		err := json.Unmarshal([]byte(metadataJSON), &metadata)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if metadata.GetVerdictWeight() != expected {
+			t.Errorf("expected a verdict weight of %v for %s, got %v", expected, metadataJSON, metadata.GetVerdictWeight())
+		}
+	}
+}
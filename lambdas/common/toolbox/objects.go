@@ -0,0 +1,167 @@
+package toolbox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// GetJobBucketName returns the name of the bucket job objects too large for the job DB are stored in
+func (t *Toolbox) GetJobBucketName() string {
+	if t.JobBucketName != "" {
+		return t.JobBucketName
+	}
+	return "gd-" + os.Getenv("AWS_DEV_TEAM") + "-" + os.Getenv("AWS_DEV_ENV") + "-threat-api-job-bucket"
+}
+
+// PutJobObject stores an object in the job bucket
+func (t *Toolbox) PutJobObject(ctx context.Context, bucket string, key string, data []byte) error {
+	span, ctx := t.TracerLogger.StartSpan(ctx, "PutJobObject", "s3", "object", "put")
+	defer span.End(ctx)
+	span.LogKV("dataSizeBytes", len(data))
+
+	if t.JobObjectsPath != "" {
+		path, err := t.jobObjectPath(bucket, key)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			span.LogKV("error", err)
+			return fmt.Errorf("error storing object: %w", err)
+		}
+		if err := ioutil.WriteFile(path, data, 0600); err != nil {
+			span.LogKV("error", err)
+			return fmt.Errorf("error storing object: %w", err)
+		}
+		return nil
+	}
+	if t.AWSSession == nil {
+		return ErrNoAWSSession
+	}
+	s3Client := s3.New(t.AWSSession)
+
+	_, err := s3Client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(data),
+	})
+	if err != nil {
+		span.LogKV("error", err)
+		return fmt.Errorf("error storing object: %w", err)
+	}
+
+	return nil
+}
+
+// GetJobObject fetches an object from the job bucket
+func (t *Toolbox) GetJobObject(ctx context.Context, bucket string, key string) ([]byte, error) {
+	span, ctx := t.TracerLogger.StartSpan(ctx, "GetJobObject", "s3", "object", "get")
+	defer span.End(ctx)
+
+	if t.JobObjectsPath != "" {
+		path, err := t.jobObjectPath(bucket, key)
+		if err != nil {
+			return nil, err
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			span.LogKV("error", err)
+			return nil, fmt.Errorf("error fetching object: %w", err)
+		}
+		return data, nil
+	}
+	if t.AWSSession == nil {
+		return nil, ErrNoAWSSession
+	}
+	s3Client := s3.New(t.AWSSession)
+
+	object, err := s3Client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		span.LogKV("error", err)
+		return nil, fmt.Errorf("error fetching object: %w", err)
+	}
+	defer object.Body.Close()
+
+	data, err := ioutil.ReadAll(object.Body)
+	if err != nil {
+		span.LogKV("error", err)
+		return nil, fmt.Errorf("error reading object: %w", err)
+	}
+	span.LogKV("dataSizeBytes", len(data))
+
+	return data, nil
+}
+
+// maxDeleteObjects is the most objects S3 deletes in a single request
+const maxDeleteObjects = 1000
+
+// DeleteJobObjects deletes these objects from the job bucket, objects that don't exist are skipped
+func (t *Toolbox) DeleteJobObjects(ctx context.Context, bucket string, keys []string) error {
+	span, ctx := t.TracerLogger.StartSpan(ctx, "DeleteJobObjects", "s3", "object", "delete")
+	defer span.End(ctx)
+	span.LogKV("objects", len(keys))
+
+	if t.JobObjectsPath != "" {
+		for _, key := range keys {
+			path, err := t.jobObjectPath(bucket, key)
+			if err != nil {
+				return err
+			}
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				span.LogKV("error", err)
+				return fmt.Errorf("error deleting object: %w", err)
+			}
+		}
+		return nil
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	if t.AWSSession == nil {
+		return ErrNoAWSSession
+	}
+	s3Client := s3.New(t.AWSSession)
+
+	for start := 0; start < len(keys); start += maxDeleteObjects {
+		end := start + maxDeleteObjects
+		if end > len(keys) {
+			end = len(keys)
+		}
+		objects := []*s3.ObjectIdentifier{}
+		for _, key := range keys[start:end] {
+			objects = append(objects, &s3.ObjectIdentifier{Key: aws.String(key)})
+		}
+		output, err := s3Client.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &s3.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err == nil && len(output.Errors) > 0 {
+			err = fmt.Errorf("%d objects were not deleted, the first because of %s", len(output.Errors), aws.StringValue(output.Errors[0].Message))
+		}
+		if err != nil {
+			span.LogKV("error", err)
+			return fmt.Errorf("error deleting objects: %w", err)
+		}
+	}
+	return nil
+}
+
+// jobObjectPath returns the file an object of the job bucket is stored in under JobObjectsPath
+func (t *Toolbox) jobObjectPath(bucket string, key string) (string, error) {
+	root := filepath.Clean(t.JobObjectsPath)
+	path := filepath.Join(root, bucket, filepath.FromSlash(key))
+	if bucket == "" || !strings.HasPrefix(path, root+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid object key %q", key)
+	}
+	return path, nil
+}
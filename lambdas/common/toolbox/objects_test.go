@@ -0,0 +1,48 @@
+package toolbox
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestLocalJobObjects(t *testing.T) {
+	dir, err := ioutil.TempDir("", "objects")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	toolbox := GetToolbox()
+	toolbox.AWSSession = nil
+	toolbox.JobObjectsPath = dir
+	ctx := context.Background()
+
+	if err := toolbox.PutJobObject(ctx, "bucket", "responses/job/module.json", []byte("response")); err != nil {
+		t.Fatal(err)
+	}
+	data, err := toolbox.GetJobObject(ctx, "bucket", "responses/job/module.json")
+	if err != nil || string(data) != "response" {
+		t.Errorf("expected the stored object, got %q %v", data, err)
+	}
+	if _, err := toolbox.GetJobObject(ctx, "bucket", "responses/job/missing.json"); err == nil {
+		t.Error("expected an error fetching a missing object")
+	}
+
+	// Objects that don't exist are skipped
+	if err := toolbox.DeleteJobObjects(ctx, "bucket", []string{"responses/job/module.json", "responses/job/missing.json"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := toolbox.GetJobObject(ctx, "bucket", "responses/job/module.json"); err == nil {
+		t.Error("expected the object to be deleted")
+	}
+
+	// Keys can't escape the directory
+	if err := toolbox.PutJobObject(ctx, "bucket", "../../escaped.json", []byte("response")); err == nil {
+		t.Error("expected an error storing an object outside of the directory")
+	}
+	if err := toolbox.DeleteJobObjects(ctx, "bucket", []string{"../../escaped.json"}); err == nil {
+		t.Error("expected an error deleting an object outside of the directory")
+	}
+}
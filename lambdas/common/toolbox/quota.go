@@ -0,0 +1,437 @@
+package toolbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+)
+
+// QuotaPeriod is the period the calls of a module are counted in
+type QuotaPeriod string
+
+// QuotaPeriods
+const (
+	QuotaPeriodMinute QuotaPeriod = "minute"
+	QuotaPeriodDay    QuotaPeriod = "day"
+	QuotaPeriodMonth  QuotaPeriod = "month"
+)
+
+const (
+	usageKeyKey = "usageKey"
+	// How many times the usage is updated again when other lambdas updated it at the same time, or a minute is waited for
+	quotaUpdateRetries = 5
+)
+
+// ErrQuotaExceeded is returned when a module doesn't have enough calls left in its quota
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// ModuleQuota limits how many calls a module makes to its vendor, a call being the lookup of an IOC that wasn't cached.
+// Each limit is optional, 0 doesn't limit the calls.
+type ModuleQuota struct {
+	// Calls of every user, per minute (UTC) they are made in
+	PerMinute int64 `json:"perMinute,omitempty"`
+	// Calls of every user, per day (UTC)
+	PerDay int64 `json:"perDay,omitempty"`
+	// Calls of every user, per month (UTC)
+	PerMonth int64 `json:"perMonth,omitempty"`
+	// Calls of each user, per day and per month
+	UserPerDay   int64 `json:"userPerDay,omitempty"`
+	UserPerMonth int64 `json:"userPerMonth,omitempty"`
+}
+
+// Usage is the calls made by a module in a period, by a single user if Username is set
+type Usage struct {
+	Key        string      `json:"-" dynamodbav:"usageKey"`
+	ModuleName string      `json:"moduleName" dynamodbav:"moduleName"`
+	Username   string      `json:"username,omitempty" dynamodbav:"username,omitempty"`
+	Period     QuotaPeriod `json:"period" dynamodbav:"period"`
+	// The period the calls were made in, like 2021-01 for a month
+	Window string `json:"window" dynamodbav:"window"`
+	Calls  int64  `json:"calls" dynamodbav:"calls"`
+	// The most calls allowed in the period, 0 if they aren't limited
+	Limit int64 `json:"limit,omitempty" dynamodbav:"limit,omitempty"`
+	TTL   int64 `json:"-" dynamodbav:"ttl"`
+}
+
+// QuotaName describes the quota of the usage, like "the daily quota of jdoe for virustotal"
+func (u Usage) QuotaName() string {
+	period := map[QuotaPeriod]string{
+		QuotaPeriodMinute: "per minute",
+		QuotaPeriodDay:    "daily",
+		QuotaPeriodMonth:  "monthly",
+	}[u.Period]
+	if u.Username != "" {
+		return fmt.Sprintf("the %s quota of %s for %s", period, u.Username, u.ModuleName)
+	}
+	return fmt.Sprintf("the %s quota of %s", period, u.ModuleName)
+}
+
+// quotaWindows returns the window of each period at this time
+func quotaWindows(now time.Time) map[QuotaPeriod]string {
+	now = now.UTC()
+	return map[QuotaPeriod]string{
+		QuotaPeriodMinute: now.Format("2006-01-02T15:04"),
+		QuotaPeriodDay:    now.Format("2006-01-02"),
+		QuotaPeriodMonth:  now.Format("2006-01"),
+	}
+}
+
+// counters returns the usage counted for the calls of the user to the module at this time.
+// Daily and monthly calls are always counted so they can be reported, calls per minute only if they are limited.
+func (q *ModuleQuota) counters(moduleName string, username string, now time.Time) []Usage {
+	windows := quotaWindows(now)
+	ttls := map[QuotaPeriod]time.Duration{
+		QuotaPeriodMinute: time.Hour,
+		QuotaPeriodDay:    time.Hour * 24 * 32,
+		QuotaPeriodMonth:  time.Hour * 24 * 366,
+	}
+	counter := func(username string, period QuotaPeriod, limit int64) Usage {
+		key := []string{moduleName, string(period), windows[period]}
+		if username != "" {
+			key = append(key, username)
+		}
+		return Usage{
+			Key:        strings.Join(key, "#"),
+			ModuleName: moduleName,
+			Username:   username,
+			Period:     period,
+			Window:     windows[period],
+			Limit:      limit,
+			TTL:        now.Add(ttls[period]).Unix(),
+		}
+	}
+
+	ret := []Usage{}
+	if q.PerMinute > 0 {
+		ret = append(ret, counter("", QuotaPeriodMinute, q.PerMinute))
+	}
+	ret = append(ret, counter("", QuotaPeriodDay, q.PerDay), counter("", QuotaPeriodMonth, q.PerMonth))
+	if username != "" {
+		ret = append(ret, counter(username, QuotaPeriodDay, q.UserPerDay), counter(username, QuotaPeriodMonth, q.UserPerMonth))
+	}
+	return ret
+}
+
+// update builds the update adding the calls to the usage, on the condition they fit in its limit.
+// Calls per minute larger than their limit only fit in a minute without any other calls.
+func (u Usage) update(tableName string, calls int64) (*dynamodb.Update, error) {
+	update := expression.Add(expression.Name("calls"), expression.Value(calls)).
+		Set(expression.Name("moduleName"), expression.Value(u.ModuleName)).
+		Set(expression.Name("period"), expression.Value(u.Period)).
+		Set(expression.Name("window"), expression.Value(u.Window)).
+		Set(expression.Name("ttl"), expression.Value(u.TTL))
+	if u.Username != "" {
+		update = update.Set(expression.Name("username"), expression.Value(u.Username))
+	}
+	builder := expression.NewBuilder()
+	if u.Limit > 0 {
+		update = update.Set(expression.Name("limit"), expression.Value(u.Limit))
+		condition := expression.AttributeNotExists(expression.Name("calls"))
+		if calls <= u.Limit {
+			condition = condition.Or(expression.Name("calls").LessThanEqual(expression.Value(u.Limit - calls)))
+		}
+		builder = builder.WithCondition(condition)
+	}
+	expr, err := builder.WithUpdate(update).Build()
+	if err != nil {
+		return nil, err
+	}
+	return &dynamodb.Update{
+		Key: map[string]*dynamodb.AttributeValue{
+			usageKeyKey: {S: aws.String(u.Key)},
+		},
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		UpdateExpression:          expr.Update(),
+		TableName:                 aws.String(tableName),
+	}, nil
+}
+
+// refund creates the update giving calls back to the usage, as long as it counted them
+func (u Usage) refund(tableName string, calls int64) (*dynamodb.Update, error) {
+	expr, err := expression.NewBuilder().
+		WithUpdate(expression.Add(expression.Name("calls"), expression.Value(-calls))).
+		WithCondition(expression.Name("calls").GreaterThanEqual(expression.Value(calls))).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+	return &dynamodb.Update{
+		Key: map[string]*dynamodb.AttributeValue{
+			usageKeyKey: {S: aws.String(u.Key)},
+		},
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		UpdateExpression:          expr.Update(),
+		TableName:                 aws.String(tableName),
+	}, nil
+}
+
+// quotaExceeded returns the error of calls that don't fit in the quota of the usage
+func quotaExceeded(usage Usage) error {
+	return fmt.Errorf("%w: %s (%d calls) is used up", ErrQuotaExceeded, usage.QuotaName(), usage.Limit)
+}
+
+// remainingCalls returns how many calls are left in the usages, and the usage with the fewest calls left.
+// Usages without a limit have math.MaxInt64 calls left.
+func remainingCalls(usages []Usage) (int64, *Usage) {
+	remaining := int64(math.MaxInt64)
+	var tightest *Usage
+	for i, usage := range usages {
+		if usage.Limit <= 0 {
+			continue
+		}
+		left := usage.Limit - usage.Calls
+		if left < 0 {
+			left = 0
+		}
+		if left < remaining {
+			remaining = left
+			tightest = &usages[i]
+		}
+	}
+	return remaining, tightest
+}
+
+// ConsumeQuota takes the calls the module is about to make for the user out of its quota.
+// It returns ErrQuotaExceeded if the calls don't fit in the daily or monthly quotas of the module or the user, without taking any.
+// Calls that don't fit in the current minute wait for the next one, as long as the context allows.
+func (t *Toolbox) ConsumeQuota(ctx context.Context, moduleName string, username string, quota *ModuleQuota, calls int64) error {
+	if quota == nil || calls <= 0 {
+		return nil
+	}
+	span, ctx := t.TracerLogger.StartSpan(ctx, "ConsumeQuota", "quota", "usage", "update")
+	defer span.End(ctx)
+	span.LogKV("moduleName", moduleName)
+	span.LogKV("calls", calls)
+
+	if t.AWSSession == nil {
+		return ErrNoAWSSession
+	}
+	dynamoDBClient := dynamodb.New(t.AWSSession)
+
+	for try := 0; try < quotaUpdateRetries; try++ {
+		now := time.Now()
+		counters := quota.counters(moduleName, username, now)
+		input := &dynamodb.TransactWriteItemsInput{}
+		for _, counter := range counters {
+			if counter.Period != QuotaPeriodMinute && counter.Limit > 0 && calls > counter.Limit {
+				return quotaExceeded(counter)
+			}
+			update, err := counter.update(t.UsageDBTableName, calls)
+			if err != nil {
+				return fmt.Errorf("error creating usage update: %w", err)
+			}
+			input.TransactItems = append(input.TransactItems, &dynamodb.TransactWriteItem{Update: update})
+		}
+
+		// Every counter is updated or none is, so calls that don't fit aren't counted anywhere
+		_, err := dynamoDBClient.TransactWriteItems(input)
+		if err == nil {
+			return nil
+		}
+		var cancelled *dynamodb.TransactionCanceledException
+		if !errors.As(err, &cancelled) {
+			span.LogKV("error", err)
+			return fmt.Errorf("error updating usage: %w", err)
+		}
+		var exceeded *Usage
+		for i, reason := range cancelled.CancellationReasons {
+			if i < len(counters) && aws.StringValue(reason.Code) == "ConditionalCheckFailed" {
+				exceeded = &counters[i]
+				break
+			}
+		}
+		if exceeded == nil {
+			// Another lambda updated the same usage at the same time
+			continue
+		}
+		if exceeded.Period != QuotaPeriodMinute {
+			return quotaExceeded(*exceeded)
+		}
+
+		// Calls per minute are paced instead of refused, wait for the next minute if there is time for it
+		wait := now.UTC().Truncate(time.Minute).Add(time.Minute).Sub(now)
+		if deadline, ok := ctx.Deadline(); ok && now.Add(wait).After(deadline) {
+			return quotaExceeded(*exceeded)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return quotaExceeded(*exceeded)
+		case <-timer.C:
+		}
+	}
+	err := fmt.Errorf("error updating usage: it was updated by other lambdas %d times", quotaUpdateRetries)
+	span.LogKV("error", err)
+	return err
+}
+
+// RefundQuota gives back calls that were consumed but not made, like the calls of a module that failed.
+// The calls are given back to the minute, day and month they were consumed in, at consumedAt.
+func (t *Toolbox) RefundQuota(ctx context.Context, moduleName string, username string, quota *ModuleQuota, calls int64, consumedAt time.Time) error {
+	if quota == nil || calls <= 0 {
+		return nil
+	}
+	span, ctx := t.TracerLogger.StartSpan(ctx, "RefundQuota", "quota", "usage", "update")
+	defer span.End(ctx)
+	span.LogKV("moduleName", moduleName)
+	span.LogKV("calls", calls)
+
+	if t.AWSSession == nil {
+		return ErrNoAWSSession
+	}
+	dynamoDBClient := dynamodb.New(t.AWSSession)
+
+	input := &dynamodb.TransactWriteItemsInput{}
+	for _, counter := range quota.counters(moduleName, username, consumedAt) {
+		update, err := counter.refund(t.UsageDBTableName, calls)
+		if err != nil {
+			return fmt.Errorf("error creating usage refund: %w", err)
+		}
+		input.TransactItems = append(input.TransactItems, &dynamodb.TransactWriteItem{Update: update})
+	}
+	// Every counter is refunded or none is, so the calls are never given back twice
+	_, err := dynamoDBClient.TransactWriteItems(input)
+	if err != nil {
+		span.LogKV("error", err)
+		return fmt.Errorf("error refunding usage: %w", err)
+	}
+	return nil
+}
+
+// RemainingQuota gets how many calls the user has left in the daily and monthly quotas of the module,
+// and the usage of the quota with the fewest calls left (nil if the module has no daily or monthly limit).
+// Modules without a limit have math.MaxInt64 calls left. Calls per minute are paced rather than budgeted, so they are left out.
+func (t *Toolbox) RemainingQuota(ctx context.Context, moduleName string, username string, quota *ModuleQuota) (int64, *Usage, error) {
+	if quota == nil {
+		return math.MaxInt64, nil, nil
+	}
+	span, ctx := t.TracerLogger.StartSpan(ctx, "RemainingQuota", "quota", "usage", "get")
+	defer span.End(ctx)
+	span.LogKV("moduleName", moduleName)
+
+	counters := []Usage{}
+	for _, counter := range quota.counters(moduleName, username, time.Now()) {
+		if counter.Period != QuotaPeriodMinute && counter.Limit > 0 {
+			counters = append(counters, counter)
+		}
+	}
+	if len(counters) == 0 {
+		return math.MaxInt64, nil, nil
+	}
+
+	if t.AWSSession == nil {
+		return 0, nil, ErrNoAWSSession
+	}
+	dynamoDBClient := dynamodb.New(t.AWSSession)
+
+	keys := []map[string]*dynamodb.AttributeValue{}
+	for _, counter := range counters {
+		keys = append(keys, map[string]*dynamodb.AttributeValue{
+			usageKeyKey: {S: aws.String(counter.Key)},
+		})
+	}
+	output, err := dynamoDBClient.BatchGetItem(&dynamodb.BatchGetItemInput{
+		RequestItems: map[string]*dynamodb.KeysAndAttributes{
+			t.UsageDBTableName: {Keys: keys, ConsistentRead: aws.Bool(true)},
+		},
+	})
+	if err != nil {
+		span.LogKV("error", err)
+		return 0, nil, fmt.Errorf("error fetching usage: %w", err)
+	}
+
+	calls := map[string]int64{}
+	for _, item := range output.Responses[t.UsageDBTableName] {
+		usage := Usage{}
+		err = dynamodbattribute.UnmarshalMap(item, &usage)
+		if err != nil {
+			span.LogKV("error", err)
+			return 0, nil, fmt.Errorf("error unmarshalling usage: %w", err)
+		}
+		calls[usage.Key] = usage.Calls
+	}
+	for i := range counters {
+		counters[i].Calls = calls[counters[i].Key]
+	}
+	remaining, tightest := remainingCalls(counters)
+	return remaining, tightest, nil
+}
+
+// GetUsage gets the usage of every module in the current minute, day and month, and the usage of the user if set
+func (t *Toolbox) GetUsage(ctx context.Context, username string) ([]Usage, error) {
+	span, ctx := t.TracerLogger.StartSpan(ctx, "GetUsage", "quota", "usage", "list")
+	defer span.End(ctx)
+
+	if t.AWSSession == nil {
+		return nil, ErrNoAWSSession
+	}
+	dynamoDBClient := dynamodb.New(t.AWSSession)
+
+	windows := quotaWindows(time.Now())
+	filter := expression.Name("window").In(
+		expression.Value(windows[QuotaPeriodMinute]),
+		expression.Value(windows[QuotaPeriodDay]),
+		expression.Value(windows[QuotaPeriodMonth]),
+	)
+	users := expression.AttributeNotExists(expression.Name("username"))
+	if username != "" {
+		users = users.Or(expression.Name("username").Equal(expression.Value(username)))
+	}
+	expr, err := expression.NewBuilder().WithFilter(filter.And(users)).Build()
+	if err != nil {
+		return nil, fmt.Errorf("error creating filter expression: %w", err)
+	}
+
+	ret := []Usage{}
+	var unmarshalErr error
+	err = dynamoDBClient.ScanPagesWithContext(ctx, &dynamodb.ScanInput{
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		FilterExpression:          expr.Filter(),
+		TableName:                 &t.UsageDBTableName,
+	}, func(output *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range output.Items {
+			usage := Usage{}
+			if unmarshalErr = dynamodbattribute.UnmarshalMap(item, &usage); unmarshalErr != nil {
+				return false
+			}
+			ret = append(ret, usage)
+		}
+		return true
+	})
+	if err == nil {
+		err = unmarshalErr
+	}
+	if err != nil {
+		span.LogKV("error", err)
+		return nil, fmt.Errorf("error fetching usage: %w", err)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Key < ret[j].Key
+	})
+	return ret, nil
+}
+
+// GetModuleQuota returns the quota of this module, nil if its calls aren't limited
+func (t *Toolbox) GetModuleQuota(ctx context.Context, moduleName string) (*ModuleQuota, error) {
+	modules, err := t.GetModules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return modules[moduleName].Quota, nil
+}
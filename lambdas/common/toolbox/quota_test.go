@@ -0,0 +1,124 @@
+package toolbox
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestModuleQuotaCounters(t *testing.T) {
+	now := time.Date(2021, 1, 31, 23, 59, 30, 0, time.UTC)
+	quota := &ModuleQuota{PerDay: 1000, UserPerMonth: 100}
+
+	counters := quota.counters("virustotal", "jdoe", now)
+	expected := []Usage{
+		{Key: "virustotal#day#2021-01-31", Period: QuotaPeriodDay, Window: "2021-01-31", Limit: 1000},
+		{Key: "virustotal#month#2021-01", Period: QuotaPeriodMonth, Window: "2021-01"},
+		{Key: "virustotal#day#2021-01-31#jdoe", Username: "jdoe", Period: QuotaPeriodDay, Window: "2021-01-31"},
+		{Key: "virustotal#month#2021-01#jdoe", Username: "jdoe", Period: QuotaPeriodMonth, Window: "2021-01", Limit: 100},
+	}
+	if len(counters) != len(expected) {
+		t.Fatalf("expected %d counters, got %+v", len(expected), counters)
+	}
+	for i, counter := range counters {
+		if counter.ModuleName != "virustotal" || counter.TTL <= now.Unix() {
+			t.Errorf("expected the counter to be for virustotal and expire later, got %+v", counter)
+		}
+		counter.ModuleName = ""
+		counter.TTL = 0
+		if counter != expected[i] {
+			t.Errorf("expected the counter %+v, got %+v", expected[i], counter)
+		}
+	}
+
+	// Calls per minute are only counted when limited, and calls without a user only count for the module
+	quota.PerMinute = 10
+	counters = quota.counters("virustotal", "", now)
+	if len(counters) != 3 || counters[0].Key != "virustotal#minute#2021-01-31T23:59" || counters[0].Limit != 10 {
+		t.Errorf("expected the minute, day and month of the module to be counted, got %+v", counters)
+	}
+}
+
+func TestUsageUpdate(t *testing.T) {
+	usage := Usage{Key: "virustotal#day#2021-01-31", ModuleName: "virustotal", Period: QuotaPeriodDay, Window: "2021-01-31", Limit: 10}
+	update, err := usage.update("usage", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if update.ConditionExpression == nil || update.UpdateExpression == nil || *update.TableName != "usage" {
+		t.Errorf("expected a conditional update of the usage table, got %+v", update)
+	}
+	if values := update.ExpressionAttributeValues; len(values) != 7 {
+		t.Errorf("expected the calls, module, period, window, ttl, limit and the most calls the update fits in, got %+v", values)
+	}
+
+	usage.Limit = 0
+	update, err = usage.update("usage", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if update.ConditionExpression != nil {
+		t.Errorf("expected usage without a limit to be updated without condition, got %+v", update)
+	}
+}
+
+func TestUsageRefund(t *testing.T) {
+	usage := Usage{Key: "virustotal#day#2021-01-31", ModuleName: "virustotal", Period: QuotaPeriodDay, Window: "2021-01-31", Limit: 10}
+	update, err := usage.refund("usage", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if update.ConditionExpression == nil || update.UpdateExpression == nil || *update.TableName != "usage" || *update.Key[usageKeyKey].S != usage.Key {
+		t.Errorf("expected a conditional update of the usage in the usage table, got %+v", update)
+	}
+	if values := update.ExpressionAttributeValues; len(values) != 2 {
+		t.Errorf("expected the calls given back and the calls the usage must have counted, got %+v", values)
+	}
+}
+
+func TestRemainingCalls(t *testing.T) {
+	usages := []Usage{
+		{ModuleName: "virustotal", Period: QuotaPeriodDay, Calls: 500},
+		{ModuleName: "virustotal", Period: QuotaPeriodMonth, Calls: 900, Limit: 1000},
+		{ModuleName: "virustotal", Username: "jdoe", Period: QuotaPeriodDay, Calls: 20, Limit: 50},
+	}
+	remaining, tightest := remainingCalls(usages)
+	if remaining != 30 || tightest.QuotaName() != "the daily quota of jdoe for virustotal" {
+		t.Errorf("expected 30 calls left in the daily quota of the user, got %d in %+v", remaining, tightest)
+	}
+
+	usages[1].Calls = 1200
+	remaining, tightest = remainingCalls(usages)
+	if remaining != 0 || tightest.QuotaName() != "the monthly quota of virustotal" {
+		t.Errorf("expected no calls left in the monthly quota, got %d in %+v", remaining, tightest)
+	}
+
+	remaining, tightest = remainingCalls(usages[:1])
+	if remaining != math.MaxInt64 || tightest != nil {
+		t.Errorf("expected no limit, got %d in %+v", remaining, tightest)
+	}
+}
+
+func TestConsumeQuota(t *testing.T) {
+	toolbox := GetToolbox()
+	toolbox.AWSSession = nil
+
+	// Modules without a quota are never limited
+	if err := toolbox.ConsumeQuota(context.Background(), "virustotal", "jdoe", nil, 10); err != nil {
+		t.Errorf("expected a module without quota to not be limited, got %v", err)
+	}
+	if remaining, _, err := toolbox.RemainingQuota(context.Background(), "virustotal", "jdoe", &ModuleQuota{PerMinute: 10}); err != nil || remaining != math.MaxInt64 {
+		t.Errorf("expected calls per minute to not be budgeted, got %d %v", remaining, err)
+	}
+	if err := toolbox.ConsumeQuota(context.Background(), "virustotal", "jdoe", &ModuleQuota{PerDay: 10}, 1); !errors.Is(err, ErrNoAWSSession) {
+		t.Errorf("expected the quota to need AWS, got %v", err)
+	}
+	if err := toolbox.RefundQuota(context.Background(), "virustotal", "jdoe", nil, 10, time.Now()); err != nil {
+		t.Errorf("expected nothing to refund for a module without quota, got %v", err)
+	}
+	if err := toolbox.RefundQuota(context.Background(), "virustotal", "jdoe", &ModuleQuota{PerDay: 10}, 1, time.Now()); !errors.Is(err, ErrNoAWSSession) {
+		t.Errorf("expected the refund to need AWS, got %v", err)
+	}
+}
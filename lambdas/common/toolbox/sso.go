@@ -85,6 +85,10 @@ func (t *Toolbox) ValidateJWT(ctx context.Context, jwt string) (*gdtoken.Token,
 	span.LogKV("JWTLength", len(jwt))
 	defer span.End(ctx)
 
+	if t.JWTValidator != nil {
+		return t.JWTValidator(ctx, jwt)
+	}
+
 	// Check formatting and build token
 	token, err := gdtoken.FromStringV2(jwt)
 	if err != nil {
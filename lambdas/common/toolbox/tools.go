@@ -10,6 +10,7 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/gdcorp-golang/auth/gdtoken"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox/appsectracing"
 	"github.com/godaddy/asherah/go/appencryption"
 	"github.com/sirupsen/logrus"
@@ -20,6 +21,8 @@ const (
 	defaultTimeout             = time.Second * 5
 	asherahKMSKeyParameterName = "/AdminParams/Team/KMSKey"
 	ssoHostENVVar              = "SSO_HOST"
+	jobStoreENVVar             = "JOB_STORE"
+	jobStorePathENVVar         = "JOB_STORE_PATH"
 )
 
 // Toolbox is standardized useful things
@@ -27,6 +30,8 @@ type Toolbox struct {
 	Logger *logrus.Logger
 	// Defaults to defaultSSOEndpoint
 	SSOHostURL string `default:"sso.gdcorp.tools"`
+	// Validates JWTs instead of SSO if set, for local runs
+	JWTValidator func(ctx context.Context, jwt string) (*gdtoken.Token, error)
 
 	// Tracing
 	TracerLogger *appsectracing.TracerLogger
@@ -37,9 +42,36 @@ type Toolbox struct {
 
 	AWSSession *session.Session
 
+	// Available modules instead of the ones in the parameter store if set, for local runs
+	Modules map[string]LambdaMetadata
+
+	// Job store backend, dynamodb or bolt to store jobs in a local file at JobStorePath instead
+	JobStore     string `default:"dynamodb"`
+	JobStorePath string `default:"threatapi.db"`
+
 	// Job DB
 	JobDBTableName string `default:"jobs"`
 
+	// Job responses DB, each module response of a job is its own item
+	JobResponsesDBTableName string `default:"jobresponses"`
+
+	// Module results cache DB
+	CacheDBTableName string `default:"cache"`
+
+	// IOC sightings DB, maps hashed IOCs to the jobs they were submitted in
+	SightingDBTableName string `default:"sightings"`
+
+	// Module health DB, the circuit breaker of each module
+	ModuleHealthDBTableName string `default:"modulehealth"`
+
+	// Usage DB, the calls each module and user made against the quota of the module
+	UsageDBTableName string `default:"usage"`
+
+	// Bucket for job objects too large for the job DB, defaults to the job bucket of this environment
+	JobBucketName string
+	// Directory to store job objects in instead of the job bucket if set, for local runs
+	JobObjectsPath string
+
 	// Asherah
 	AsherahDBTableName    string                            `default:"EncryptionKey"`
 	AsherahSession        map[string]*appencryption.Session // Map of jobID to asherah sessions
@@ -76,6 +108,12 @@ func GetToolbox() *Toolbox {
 	if ssoHost := os.Getenv(ssoHostENVVar); ssoHost != "" {
 		t.SSOHostURL = ssoHost
 	}
+	if jobStore := os.Getenv(jobStoreENVVar); jobStore != "" {
+		t.JobStore = jobStore
+	}
+	if jobStorePath := os.Getenv(jobStorePathENVVar); jobStorePath != "" {
+		t.JobStorePath = jobStorePath
+	}
 
 	t.SetHTTPClient(&http.Client{Timeout: defaultTimeout})
 
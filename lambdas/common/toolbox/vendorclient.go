@@ -0,0 +1,357 @@
+package toolbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox/appsectracing"
+)
+
+const (
+	defaultVendorTimeout          = time.Second * 30
+	defaultVendorRetries          = 3
+	defaultVendorBackoff          = time.Millisecond * 500
+	defaultVendorMaxBackoff       = time.Second * 20
+	defaultVendorMaxResponseBytes = 10 << 20
+)
+
+// ErrResponseTooLarge is returned reading a vendor response larger than the MaxResponseBytes of the vendor
+var ErrResponseTooLarge = errors.New("vendor response too large")
+
+// vendorMetrics are the metrics of each vendor, shared by every vendor client of this process
+var (
+	vendorMetrics      = map[string]*VendorMetrics{}
+	vendorMetricsMutex sync.Mutex
+)
+
+// vendorClients are the http clients of each vendor, shared by every module of this process
+var (
+	vendorClients      = map[string]*http.Client{}
+	vendorClientsMutex sync.Mutex
+)
+
+// VendorClientOptions configure the HTTP client of a vendor, the zero value of each option uses its default
+type VendorClientOptions struct {
+	// How long each attempt of a request may take, including reading its response (default 30s)
+	Timeout time.Duration
+	// How many times a failed request is retried (default 3, -1 to never retry)
+	MaxRetries int
+	// The wait before the first retry, doubled for each retry after it (default 500ms)
+	Backoff time.Duration
+	// The longest wait before a retry, a vendor asking to wait longer with Retry-After isn't retried (default 20s)
+	MaxBackoff time.Duration
+	// The largest response read from the vendor (default 10MB)
+	MaxResponseBytes int64
+	// The transport the requests are sent with, like one trusting the certificate of the vendor (default http.DefaultTransport)
+	Transport http.RoundTripper
+	// Retry the POST requests of the vendor like GET requests, for vendors whose lookups are POST requests
+	RetryPOST bool
+}
+
+// VendorMetrics count the requests made to a vendor by this process
+type VendorMetrics struct {
+	// Requests made by modules
+	Requests int64
+	// Requests sent to the vendor, including retries
+	Attempts int64
+	Retries  int64
+	// Responses asking to slow down (429)
+	RateLimited int64
+	// Requests that failed after their retries, with an error or a 429 or 5xx response
+	Failures int64
+	// Responses larger than MaxResponseBytes
+	TooLarge int64
+}
+
+// Sub returns the metrics counted since the earlier snapshot of the metrics
+func (m VendorMetrics) Sub(earlier VendorMetrics) VendorMetrics {
+	return VendorMetrics{
+		Requests:    m.Requests - earlier.Requests,
+		Attempts:    m.Attempts - earlier.Attempts,
+		Retries:     m.Retries - earlier.Retries,
+		RateLimited: m.RateLimited - earlier.RateLimited,
+		Failures:    m.Failures - earlier.Failures,
+		TooLarge:    m.TooLarge - earlier.TooLarge,
+	}
+}
+
+// LogKV logs the metrics on the span, for the vendors that were called
+func (m VendorMetrics) LogKV(span *appsectracing.Span) {
+	if m.Requests == 0 {
+		return
+	}
+	span.LogKV("vendorRequests", m.Requests)
+	span.LogKV("vendorAttempts", m.Attempts)
+	span.LogKV("vendorRetries", m.Retries)
+	span.LogKV("vendorRateLimited", m.RateLimited)
+	span.LogKV("vendorFailures", m.Failures)
+	span.LogKV("vendorTooLarge", m.TooLarge)
+}
+
+// GetVendorMetrics gets a snapshot of the metrics of a vendor
+func GetVendorMetrics(vendor string) VendorMetrics {
+	metrics := getVendorMetrics(vendor)
+	return VendorMetrics{
+		Requests:    atomic.LoadInt64(&metrics.Requests),
+		Attempts:    atomic.LoadInt64(&metrics.Attempts),
+		Retries:     atomic.LoadInt64(&metrics.Retries),
+		RateLimited: atomic.LoadInt64(&metrics.RateLimited),
+		Failures:    atomic.LoadInt64(&metrics.Failures),
+		TooLarge:    atomic.LoadInt64(&metrics.TooLarge),
+	}
+}
+
+func getVendorMetrics(vendor string) *VendorMetrics {
+	vendorMetricsMutex.Lock()
+	defer vendorMetricsMutex.Unlock()
+	metrics, ok := vendorMetrics[vendor]
+	if !ok {
+		metrics = &VendorMetrics{}
+		vendorMetrics[vendor] = metrics
+	}
+	return metrics
+}
+
+// GetVendorHTTPClient gets the http client for calling a vendor, with tracing like GetHTTPClient.
+// Failed requests are retried with exponential backoff, honoring the Retry-After of the vendor.
+// Requests that may have changed something at the vendor (like a POST without an Idempotency-Key header)
+// are only retried if the vendor rate limited them.
+// The client is created with these options the first time, every module calling the vendor in this process shares it.
+func (t *Toolbox) GetVendorHTTPClient(vendor string, options VendorClientOptions) *http.Client {
+	vendorClientsMutex.Lock()
+	defer vendorClientsMutex.Unlock()
+	client, ok := vendorClients[vendor]
+	if !ok {
+		client = t.newVendorHTTPClient(vendor, options)
+		vendorClients[vendor] = client
+	}
+	return client
+}
+
+// newVendorHTTPClient creates the http client of a vendor, with the defaults of the options it doesn't set
+func (t *Toolbox) newVendorHTTPClient(vendor string, options VendorClientOptions) *http.Client {
+	if options.Timeout <= 0 {
+		options.Timeout = defaultVendorTimeout
+	}
+	if options.MaxRetries == 0 {
+		options.MaxRetries = defaultVendorRetries
+	}
+	if options.Backoff <= 0 {
+		options.Backoff = defaultVendorBackoff
+	}
+	if options.MaxBackoff <= 0 {
+		options.MaxBackoff = defaultVendorMaxBackoff
+	}
+	if options.MaxResponseBytes <= 0 {
+		options.MaxResponseBytes = defaultVendorMaxResponseBytes
+	}
+	if options.Transport == nil {
+		options.Transport = http.DefaultTransport
+	}
+	return t.GetHTTPClient(&http.Client{Transport: &vendorTransport{
+		vendor:  vendor,
+		options: options,
+		metrics: getVendorMetrics(vendor),
+	}})
+}
+
+// vendorTransport sends requests to a vendor, retrying them and limiting their responses
+type vendorTransport struct {
+	vendor  string
+	options VendorClientOptions
+	metrics *VendorMetrics
+}
+
+func (v *vendorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt64(&v.metrics.Requests, 1)
+	// The body of the request must be sent again to retry it
+	canRetry := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+
+	for attempt := 0; ; attempt++ {
+		resp, err := v.roundTrip(req, attempt)
+		if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
+			atomic.AddInt64(&v.metrics.RateLimited, 1)
+		}
+
+		wait, retry := v.retryWait(req, resp, err, attempt)
+		if !canRetry || !retry {
+			if err != nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+				atomic.AddInt64(&v.metrics.Failures, 1)
+			}
+			return resp, err
+		}
+
+		// Discard this attempt before waiting for the next
+		if resp != nil {
+			io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			atomic.AddInt64(&v.metrics.Failures, 1)
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+		atomic.AddInt64(&v.metrics.Retries, 1)
+	}
+}
+
+// roundTrip sends an attempt of the request within the timeout of the vendor
+func (v *vendorTransport) roundTrip(req *http.Request, attempt int) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), v.options.Timeout)
+	attemptReq := req.Clone(ctx)
+	if attempt > 0 && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		attemptReq.Body = body
+	}
+
+	atomic.AddInt64(&v.metrics.Attempts, 1)
+	resp, err := v.options.Transport.RoundTrip(attemptReq)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if resp.ContentLength > v.options.MaxResponseBytes {
+		resp.Body.Close()
+		cancel()
+		atomic.AddInt64(&v.metrics.TooLarge, 1)
+		return nil, fmt.Errorf("%w: %s sent %d bytes, the limit is %d", ErrResponseTooLarge, v.vendor, resp.ContentLength, v.options.MaxResponseBytes)
+	}
+	resp.Body = &vendorBody{
+		ReadCloser: resp.Body,
+		remaining:  v.options.MaxResponseBytes,
+		cancel:     cancel,
+		metrics:    v.metrics,
+	}
+	return resp, nil
+}
+
+// retryWait returns how long to wait before retrying an attempt of the request, if it should be retried
+func (v *vendorTransport) retryWait(req *http.Request, resp *http.Response, err error, attempt int) (time.Duration, bool) {
+	if attempt >= v.options.MaxRetries || req.Context().Err() != nil {
+		return 0, false
+	}
+	switch {
+	case err != nil:
+		if errors.Is(err, ErrResponseTooLarge) || !v.isIdempotent(req) {
+			return 0, false
+		}
+	case resp.StatusCode == http.StatusTooManyRequests:
+		// The vendor didn't process the request, so any request can be retried
+	case resp.StatusCode == http.StatusInternalServerError, resp.StatusCode == http.StatusBadGateway,
+		resp.StatusCode == http.StatusServiceUnavailable, resp.StatusCode == http.StatusGatewayTimeout:
+		if !v.isIdempotent(req) {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+
+	// Exponential backoff with jitter, so concurrent lookups don't retry together
+	wait := v.options.Backoff << attempt
+	if wait <= 0 || wait > v.options.MaxBackoff {
+		wait = v.options.MaxBackoff
+	}
+	wait = wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+	if resp != nil {
+		if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			if retryAfter > v.options.MaxBackoff {
+				return 0, false
+			}
+			wait = retryAfter
+		}
+	}
+
+	// Don't wait for a retry there isn't time for
+	if deadline, ok := req.Context().Deadline(); ok && time.Now().Add(wait).After(deadline) {
+		return 0, false
+	}
+	return wait, true
+}
+
+// isIdempotent returns true if sending the request again can't change anything more at the vendor, like net/http decides
+func (v *vendorTransport) isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	case http.MethodPost:
+		if v.options.RetryPOST {
+			return true
+		}
+	}
+	return req.Header.Get("Idempotency-Key") != "" || req.Header.Get("X-Idempotency-Key") != ""
+}
+
+// parseRetryAfter parses a Retry-After header, in seconds or as a date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	if wait := date.Sub(now); wait > 0 {
+		return wait, true
+	}
+	return 0, true
+}
+
+// vendorBody is the body of a vendor response, failing once it is larger than the limit of the vendor
+type vendorBody struct {
+	io.ReadCloser
+	remaining int64
+	// Cancels the timeout of the attempt once the body is closed
+	cancel   context.CancelFunc
+	metrics  *VendorMetrics
+	tooLarge bool
+}
+
+func (b *vendorBody) Read(p []byte) (int, error) {
+	if b.tooLarge {
+		return 0, ErrResponseTooLarge
+	}
+	if b.remaining <= 0 {
+		// Fail instead of cutting the response short if there is more
+		n, err := b.ReadCloser.Read(make([]byte, 1))
+		if n > 0 {
+			b.tooLarge = true
+			atomic.AddInt64(&b.metrics.TooLarge, 1)
+			return 0, ErrResponseTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+func (b *vendorBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,175 @@
+package toolbox
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testVendor answers with the statuses in order, then with 200
+func testVendor(t *testing.T, statuses ...int) (*httptest.Server, *int32) {
+	requests := int32(0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := int(atomic.AddInt32(&requests, 1))
+		if request <= len(statuses) {
+			if statuses[request-1] == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "0")
+			}
+			w.WriteHeader(statuses[request-1])
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write([]byte("ok " + string(body)))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestVendorHTTPClientRetries(t *testing.T) {
+	delete(vendorMetrics, "test-retries")
+	delete(vendorClients, "test-retries")
+	options := VendorClientOptions{Backoff: time.Millisecond, MaxBackoff: time.Millisecond * 10}
+	client := (&Toolbox{}).GetVendorHTTPClient("test-retries", options)
+
+	// Idempotent requests are retried on 5xx errors
+	server, requests := testVendor(t, http.StatusServiceUnavailable, http.StatusBadGateway)
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "ok " || *requests != 3 {
+		t.Errorf("expected the request to succeed after 2 retries, got %d %q after %d requests", resp.StatusCode, body, *requests)
+	}
+
+	// Other requests are only retried when rate limited, with their body
+	server, requests = testVendor(t, http.StatusTooManyRequests)
+	resp, err = client.Post(server.URL, "text/plain", strings.NewReader("body"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "ok body" || *requests != 2 {
+		t.Errorf("expected the rate limited request to be retried, got %q after %d requests", body, *requests)
+	}
+	server, requests = testVendor(t, http.StatusServiceUnavailable)
+	resp, err = client.Post(server.URL, "text/plain", strings.NewReader("body"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || *requests != 1 {
+		t.Errorf("expected the failed request not to be retried, got %d after %d requests", resp.StatusCode, *requests)
+	}
+
+	// Requests are given up on after their retries
+	server, requests = testVendor(t, 500, 500, 500, 500, 500)
+	resp, err = client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError || *requests != 4 {
+		t.Errorf("expected the request to fail after 3 retries, got %d after %d requests", resp.StatusCode, *requests)
+	}
+
+	metrics := GetVendorMetrics("test-retries")
+	expected := VendorMetrics{Requests: 4, Attempts: 10, Retries: 6, RateLimited: 1, Failures: 2}
+	if metrics != expected {
+		t.Errorf("expected the metrics %+v, got %+v", expected, metrics)
+	}
+}
+
+func TestVendorHTTPClientLimits(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(time.Millisecond * 100)
+		}
+		w.Write([]byte(strings.Repeat("a", 100)))
+		if r.URL.Path == "/chunked" {
+			// Sent without a Content-Length
+			w.(http.Flusher).Flush()
+			w.Write([]byte(strings.Repeat("a", 100)))
+		}
+	}))
+	defer server.Close()
+	delete(vendorMetrics, "test-limits")
+	delete(vendorClients, "test-limits")
+	client := (&Toolbox{}).GetVendorHTTPClient("test-limits", VendorClientOptions{
+		Timeout:          time.Millisecond * 20,
+		MaxRetries:       -1,
+		MaxResponseBytes: 10,
+	})
+
+	_, err := client.Get(server.URL + "/slow")
+	if err == nil || !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Errorf("expected the request to time out, got %v", err)
+	}
+
+	for _, path := range []string{"/", "/chunked"} {
+		resp, err := client.Get(server.URL + path)
+		if err == nil {
+			_, err = ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+		}
+		if !errors.Is(err, ErrResponseTooLarge) {
+			t.Errorf("expected the response of %s to be too large, got %v", path, err)
+		}
+	}
+	if metrics := GetVendorMetrics("test-limits"); metrics.TooLarge != 2 || metrics.Failures != 2 {
+		t.Errorf("expected the response too large and the timeout in the metrics, got %+v", metrics)
+	}
+}
+
+func TestVendorHTTPClientShared(t *testing.T) {
+	delete(vendorMetrics, "test-shared")
+	delete(vendorClients, "test-shared")
+	toolbox := &Toolbox{}
+	client := toolbox.GetVendorHTTPClient("test-shared", VendorClientOptions{Backoff: time.Millisecond, RetryPOST: true})
+	if toolbox.GetVendorHTTPClient("test-shared", VendorClientOptions{}) != client {
+		t.Error("expected the same client for the same vendor")
+	}
+
+	// The POST requests of vendors whose lookups are POST requests are retried like GET requests
+	earlier := GetVendorMetrics("test-shared")
+	server, requests := testVendor(t, http.StatusServiceUnavailable)
+	resp, err := client.Post(server.URL, "text/plain", strings.NewReader("body"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "ok body" || *requests != 2 {
+		t.Errorf("expected the failed lookup to be retried, got %q after %d requests", body, *requests)
+	}
+
+	expected := VendorMetrics{Requests: 1, Attempts: 2, Retries: 1}
+	if metrics := GetVendorMetrics("test-shared").Sub(earlier); metrics != expected {
+		t.Errorf("expected the metrics since the snapshot %+v, got %+v", expected, metrics)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	for value, expected := range map[string]time.Duration{
+		"120":                           time.Minute * 2,
+		"Fri, 01 Jan 2021 00:00:30 GMT": time.Second * 30,
+		"Thu, 31 Dec 2020 23:59:00 GMT": 0,
+	} {
+		if wait, ok := parseRetryAfter(value, now); !ok || wait != expected {
+			t.Errorf("expected to wait %s for %q, got %s", expected, value, wait)
+		}
+	}
+	for _, value := range []string{"", "-1", "soon"} {
+		if _, ok := parseRetryAfter(value, now); ok {
+			t.Errorf("expected %q to be invalid", value)
+		}
+	}
+}
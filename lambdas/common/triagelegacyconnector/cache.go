@@ -0,0 +1,222 @@
+package triagelegacyconnector
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
+)
+
+// splitTriageDatas splits the data the module returned for these IOCs into the data of each IOC, so each IOC can be cached on its own.
+// Records, scores and CSV rows are split by their IOC, IOCs are told apart the way they are in cache keys, see toolbox.NormalizeIOC.
+// The metadata can't be told apart by IOC, so every IOC keeps all of it.
+// It returns false if some of the data can't be told apart by IOC, like JSON data.
+func splitTriageDatas(triageDatas []*triage.Data, iocType triage.IOCType, iocs []string) (map[string][]*triage.Data, bool) {
+	ret := map[string][]*triage.Data{}
+	if len(iocs) == 1 {
+		ret[iocs[0]] = triageDatas
+		return ret, true
+	}
+
+	requested := map[string]string{}
+	for _, ioc := range iocs {
+		requested[toolbox.NormalizeIOC(iocType, ioc)] = ioc
+	}
+	for _, triageData := range triageDatas {
+		iocDatas := map[string]*triage.Data{}
+		for _, ioc := range iocs {
+			iocData := *triageData
+			iocData.Metadata = append([]string(nil), triageData.Metadata...)
+			iocData.Records = nil
+			iocData.Scores = nil
+			iocDatas[ioc] = &iocData
+		}
+		for _, record := range triageData.Records {
+			ioc, ok := requested[toolbox.NormalizeIOC(iocType, record.IOC)]
+			if !ok {
+				return nil, false
+			}
+			iocDatas[ioc].Records = append(iocDatas[ioc].Records, record)
+		}
+		for _, score := range triageData.Scores {
+			ioc, ok := requested[toolbox.NormalizeIOC(iocType, score.IOC)]
+			if !ok {
+				return nil, false
+			}
+			iocDatas[ioc].Scores = append(iocDatas[ioc].Scores, score)
+		}
+		if triageData.Data != "" {
+			if !isCSV(triageData) {
+				return nil, false
+			}
+			iocCSVs, ok := splitCSV(triageData.Data, iocType, requested)
+			if !ok {
+				return nil, false
+			}
+			for ioc, iocCSV := range iocCSVs {
+				iocDatas[ioc].Data = iocCSV
+			}
+		}
+		for _, ioc := range iocs {
+			ret[ioc] = append(ret[ioc], iocDatas[ioc])
+		}
+	}
+	return ret, true
+}
+
+// splitCSV splits CSV rows by their IOC, each IOC gets the headers and its rows.
+// The IOC of a row is in the first column where every row has one of the requested IOCs.
+func splitCSV(data string, iocType triage.IOCType, requested map[string]string) (map[string]string, bool) {
+	rows, err := readCSV(data)
+	if err != nil || len(rows) == 0 {
+		return nil, false
+	}
+	headers, rows := rows[0], rows[1:]
+
+	column := -1
+	for i := range headers {
+		matches := true
+		for _, row := range rows {
+			if _, ok := requested[toolbox.NormalizeIOC(iocType, cell(row, i))]; !ok {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			column = i
+			break
+		}
+	}
+	if column < 0 {
+		return nil, false
+	}
+
+	iocRows := map[string][][]string{}
+	for _, row := range rows {
+		ioc := requested[toolbox.NormalizeIOC(iocType, cell(row, column))]
+		iocRows[ioc] = append(iocRows[ioc], row)
+	}
+	ret := map[string]string{}
+	for _, ioc := range requested {
+		ret[ioc] = writeCSV(headers, iocRows[ioc])
+	}
+	return ret, true
+}
+
+// mergeTriageDatas merges data with the same title and type, like the cached data of some IOCs and the data fetched for the others,
+// so the job gets the data the module would have returned for all its IOCs.
+// Data that can't be merged, like JSON data or CSV with other headers, is kept apart.
+func mergeTriageDatas(triageDatas []*triage.Data) []*triage.Data {
+	ret := []*triage.Data{}
+	for _, triageData := range triageDatas {
+		merged := false
+		for _, mergedData := range ret {
+			if mergeTriageData(mergedData, triageData) {
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			mergedData := *triageData
+			mergedData.Metadata = append([]string(nil), triageData.Metadata...)
+			mergedData.Records = append([]triage.Record(nil), triageData.Records...)
+			mergedData.Scores = append([]triage.Score(nil), triageData.Scores...)
+			ret = append(ret, &mergedData)
+		}
+	}
+	return ret
+}
+
+// mergeTriageData merges the data into the merged data, it returns false if they can't be merged
+func mergeTriageData(merged *triage.Data, triageData *triage.Data) bool {
+	if merged.Title != triageData.Title || merged.DataType != triageData.DataType || schemaName(merged.Schema) != schemaName(triageData.Schema) {
+		return false
+	}
+	data, ok := mergeCSV(merged, triageData)
+	if !ok {
+		return false
+	}
+
+	merged.Data = data
+	for _, metadata := range triageData.Metadata {
+		if !stringInSlice(metadata, merged.Metadata) {
+			merged.Metadata = append(merged.Metadata, metadata)
+		}
+	}
+	merged.Records = append(merged.Records, triageData.Records...)
+	merged.Scores = append(merged.Scores, triageData.Scores...)
+	// The data is only a cache hit if all of it is, and it is as old as its oldest part
+	merged.CacheHit = merged.CacheHit && triageData.CacheHit
+	if merged.FetchedAt == nil || (triageData.FetchedAt != nil && triageData.FetchedAt.Before(*merged.FetchedAt)) {
+		merged.FetchedAt = triageData.FetchedAt
+	}
+	return true
+}
+
+// mergeCSV appends the rows of the CSV data to the merged CSV data, it returns false if the data isn't CSV with the same headers
+func mergeCSV(merged *triage.Data, triageData *triage.Data) (string, bool) {
+	if triageData.Data == "" {
+		return merged.Data, true
+	}
+	if merged.Data == "" {
+		return triageData.Data, true
+	}
+	if !isCSV(merged) {
+		return "", false
+	}
+
+	mergedRows, err := readCSV(merged.Data)
+	if err != nil || len(mergedRows) == 0 {
+		return "", false
+	}
+	rows, err := readCSV(triageData.Data)
+	if err != nil || len(rows) == 0 || strings.Join(rows[0], ",") != strings.Join(mergedRows[0], ",") {
+		return "", false
+	}
+	return writeCSV(mergedRows[0], append(mergedRows[1:], rows[1:]...)), true
+}
+
+// isCSV returns true if the data is CSV, the default type of data
+func isCSV(triageData *triage.Data) bool {
+	return triageData.DataType == triage.CSVType || triageData.DataType == ""
+}
+
+func readCSV(data string) ([][]string, error) {
+	reader := csv.NewReader(strings.NewReader(data))
+	reader.FieldsPerRecord = -1
+	return reader.ReadAll()
+}
+
+func writeCSV(headers []string, rows [][]string) string {
+	resp := bytes.Buffer{}
+	csvWriter := csv.NewWriter(&resp)
+	csvWriter.Write(headers)
+	csvWriter.WriteAll(rows)
+	return resp.String()
+}
+
+// cell returns the value of this column of the row, or an empty string if the row is too short
+func cell(row []string, column int) string {
+	if column >= len(row) {
+		return ""
+	}
+	return row[column]
+}
+
+func schemaName(schema *triage.Schema) string {
+	if schema == nil {
+		return ""
+	}
+	return schema.Name
+}
+
+func stringInSlice(s string, slice []string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package triagelegacyconnector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
+)
+
+func TestSplitTriageDatas(t *testing.T) {
+	iocs := []string{"godaddy.com", "gumblar.cn"}
+	triageDatas := []*triage.Data{{
+		Title:    "VirusTotal",
+		Metadata: []string{"Found 2 matching domains"},
+		DataType: triage.CSVType,
+		Data:     "Domain,Reputation\nGoDaddy.com,0\ngumblar.cn,-20\n",
+		Scores:   []triage.Score{{IOC: "gumblar.cn", Score: 80}},
+	}, {
+		Title:   "Hosts",
+		Schema:  &triage.Schema{Name: "test.host"},
+		Records: []triage.Record{{IOC: "godaddy.com"}, {IOC: "godaddy.com"}},
+	}}
+
+	iocDatas, ok := splitTriageDatas(triageDatas, triage.DomainType, iocs)
+	if !ok {
+		t.Fatal("expected the data to be split")
+	}
+	godaddy, gumblar := iocDatas["godaddy.com"], iocDatas["gumblar.cn"]
+	if len(godaddy) != 2 || len(gumblar) != 2 {
+		t.Fatalf("expected each IOC to get both data, got %+v", iocDatas)
+	}
+	if godaddy[0].Data != "Domain,Reputation\nGoDaddy.com,0\n" || len(godaddy[0].Scores) != 0 || len(godaddy[0].Metadata) != 1 {
+		t.Errorf("expected the CSV row and metadata of godaddy.com, got %+v", godaddy[0])
+	}
+	if gumblar[0].Data != "Domain,Reputation\ngumblar.cn,-20\n" || len(gumblar[0].Scores) != 1 || len(gumblar[0].Metadata) != 1 {
+		t.Errorf("expected the CSV row and score of gumblar.cn, got %+v", gumblar[0])
+	}
+	if len(godaddy[1].Records) != 2 || len(gumblar[1].Records) != 0 {
+		t.Errorf("expected the records of godaddy.com, got %+v and %+v", godaddy[1], gumblar[1])
+	}
+
+	// The data of a single IOC is all about it
+	if iocDatas, ok := splitTriageDatas(triageDatas, triage.DomainType, iocs[:1]); !ok || len(iocDatas["godaddy.com"][0].Metadata) != 1 {
+		t.Errorf("expected the data to be kept as is for a single IOC, got %+v", iocDatas)
+	}
+
+	// URLs that only differ in the case of their path are different IOCs
+	urls := []string{"https://x.example.com/Payload.exe", "HTTPS://X.example.com/payload.exe"}
+	iocDatas, ok = splitTriageDatas([]*triage.Data{{
+		Title: "URLhaus",
+		Data:  "IoC,Threat\nhttps://x.example.com/Payload.exe,malware_download\nhttps://x.example.com/payload.exe,\n",
+	}}, triage.URLType, urls)
+	if !ok || iocDatas[urls[0]][0].Data != "IoC,Threat\nhttps://x.example.com/Payload.exe,malware_download\n" || iocDatas[urls[1]][0].Data != "IoC,Threat\nhttps://x.example.com/payload.exe,\n" {
+		t.Errorf("expected each URL to get its own row, got %+v", iocDatas)
+	}
+
+	// Data that can't be told apart by IOC
+	for _, triageData := range []*triage.Data{
+		{DataType: triage.JSONType, Data: `{"godaddy.com": {}}`},
+		{Data: "Vendor,Count\nVirusTotal,2\n"},
+		{Records: []triage.Record{{IOC: "example.com"}}},
+	} {
+		if _, ok := splitTriageDatas([]*triage.Data{triageData}, triage.DomainType, iocs); ok {
+			t.Errorf("expected %+v not to be split", triageData)
+		}
+	}
+}
+
+func TestMergeTriageDatas(t *testing.T) {
+	fetchedAt := time.Unix(1610000000, 0)
+	cachedAt := fetchedAt.Add(-time.Hour)
+	triageDatas := []*triage.Data{
+		{Title: "VirusTotal", Metadata: []string{"Badness scores are weighted"}, Data: "Domain,Reputation\ngodaddy.com,0\n", CacheHit: true, FetchedAt: &cachedAt},
+		{Title: "VirusTotal", Metadata: []string{"Found 1 matching domains", "Badness scores are weighted"}, Data: "Domain,Reputation\ngumblar.cn,-20\n", FetchedAt: &fetchedAt},
+		{Title: "VirusTotal", DataType: triage.JSONType, Data: "{}"},
+	}
+
+	merged := mergeTriageDatas(triageDatas)
+	if len(merged) != 2 {
+		t.Fatalf("expected the CSV data to be merged and the JSON data kept apart, got %+v", merged)
+	}
+	if merged[0].Data != "Domain,Reputation\ngodaddy.com,0\ngumblar.cn,-20\n" || len(merged[0].Metadata) != 2 {
+		t.Errorf("expected the rows and metadata of both data, got %+v", merged[0])
+	}
+	if merged[0].CacheHit || !merged[0].FetchedAt.Equal(cachedAt) {
+		t.Errorf("expected the merged data to not be a cache hit and be as old as the cached data, got %+v", merged[0])
+	}
+	if triageDatas[0].Data != "Domain,Reputation\ngodaddy.com,0\n" || len(triageDatas[0].Metadata) != 1 {
+		t.Errorf("expected the data to not be changed, got %+v", triageDatas[0])
+	}
+}
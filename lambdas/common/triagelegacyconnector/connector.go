@@ -4,13 +4,14 @@ package triagelegacyconnector
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"strings"
 	"sync"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/jobstore"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
 )
@@ -23,6 +24,8 @@ const (
 	// before the lambda timeout so it can return partial results.
 	// For now this is hard coded to 5 minutes.
 	moduleTimeLimit = time.Minute * 5
+	// How often we check if the jobs we are working on were cancelled
+	cancellationPollInterval = time.Second * 15
 )
 
 // AWSToTriage acts as an interface from our new interface to the old threat api triage interface.
@@ -36,14 +39,25 @@ func AWSToTriage(ctx context.Context, t *toolbox.Toolbox, module triage.Module,
 	wg := sync.WaitGroup{}
 	jobErrors := make(chan error) // Channel to capture any error
 	jobsCtx, jobsCancel := context.WithCancel(ctx)
+	// Each job gets its own context so it can be cancelled on its own
+	jobCancels := map[string]context.CancelFunc{}
 	for _, event := range request.Records {
+		jobCtx, jobCancel := context.WithCancel(jobsCtx)
+		defer jobCancel()
+		jobMessage := common.JobSNSMessage{}
+		if err := json.Unmarshal([]byte(event.SNS.Message), &jobMessage); err == nil && jobMessage.JobID != "" {
+			jobCancels[jobMessage.JobID] = jobCancel
+		}
+
 		wg.Add(1)
 		// Spawn thread to handle this job
-		go func(event events.SNSEventRecord) {
+		go func(jobCtx context.Context, event events.SNSEventRecord) {
 			defer wg.Done()
 
-			completedJobData, err := triageSNSEvent(jobsCtx, t, module, event)
+			completedJobData, err := triageSNSEvent(jobCtx, t, module, event)
 			if completedJobData != nil {
+				// Use the lambda context, the job context may already be cancelled
+				offloadLargeResponse(ctx, t, completedJobData)
 				ret = append(ret, completedJobData)
 			}
 			if err != nil {
@@ -51,13 +65,12 @@ func AWSToTriage(ctx context.Context, t *toolbox.Toolbox, module triage.Module,
 				jobErrors <- fmt.Errorf("error processing event: %w", err)
 				return
 			}
-			// TODO: check if the returned data is too large for SNS, and therefore needs to be put in a S3 or something.
-
-		}(event)
+		}(jobCtx, event)
 	}
 
 	// Start thread to wait for all jobs to be done
-	allJobsDone := make(chan struct{})
+	// This is buffered so the signal isn't missed while we are checking for cancelled jobs
+	allJobsDone := make(chan struct{}, 1)
 	go func() {
 		// block until the WaitGroup counter goes back to 0
 		wg.Wait()
@@ -71,24 +84,84 @@ func AWSToTriage(ctx context.Context, t *toolbox.Toolbox, module triage.Module,
 	}()
 
 	// Wait for either each job to finish, or time to run out!
-	select {
-	case jobError := <-jobErrors: // A job had an error, cancel everything and return the error
-		jobsCancel()
-		wg.Wait()
+	timeLimit := time.After(moduleTimeLimit)
+	cancellationTicker := time.NewTicker(cancellationPollInterval)
+	defer cancellationTicker.Stop()
+	for waiting := true; waiting; {
+		select {
+		case jobError := <-jobErrors: // A job had an error, cancel everything and return the error
+			jobsCancel()
+			wg.Wait()
 
-		return nil, jobError
-	case <-time.After(moduleTimeLimit): // Out of time!  We need to wrap up!
-		// Cancel the context, this should cause all jobs to "wrap up"
-		// and return partial results (see the comments on the module.Triage interface)
-		jobsCancel()
-		// Wait for the job(s) to actually finish
-		wg.Wait()
-	case <-allJobsDone: // We are all done :)
+			return nil, jobError
+		case <-timeLimit: // Out of time!  We need to wrap up!
+			// Cancel the context, this should cause all jobs to "wrap up"
+			// and return partial results (see the comments on the module.Triage interface)
+			jobsCancel()
+			// Wait for the job(s) to actually finish
+			wg.Wait()
+			waiting = false
+		case <-cancellationTicker.C: // Stop working on jobs the requester cancelled, the same way as running out of time
+			cancelCancelledJobs(ctx, t, jobCancels)
+		case <-allJobsDone: // We are all done :)
+			waiting = false
+		}
 	}
 	jobsCancel()
 	return ret, nil
 }
 
+// cancelCancelledJobs cancels the context of each job that was cancelled by the requester
+func cancelCancelledJobs(ctx context.Context, t *toolbox.Toolbox, jobCancels map[string]context.CancelFunc) {
+	for jobID, jobCancel := range jobCancels {
+		cancelled, err := isJobCancelled(ctx, t, jobID)
+		if err != nil {
+			t.Logger.WithError(err).Error("error checking if job was cancelled")
+			continue
+		}
+		if cancelled {
+			jobCancel()
+			delete(jobCancels, jobID)
+		}
+	}
+}
+
+// isJobCancelled returns true if the requester cancelled this job
+func isJobCancelled(ctx context.Context, t *toolbox.Toolbox, jobID string) (bool, error) {
+	store, err := jobstore.New(t)
+	if err != nil {
+		return false, err
+	}
+	return store.IsJobCancelled(ctx, jobID)
+}
+
+// setModuleRunning marks the module as running on this job, if it is still pending
+func setModuleRunning(ctx context.Context, t *toolbox.Toolbox, jobID string, moduleName string, startTime time.Time) error {
+	store, err := jobstore.New(t)
+	if err != nil {
+		return err
+	}
+	return store.SetModuleRunning(ctx, jobID, moduleName, startTime)
+}
+
+// offloadLargeResponse stores responses too large to send back through SQS in the job bucket.
+// If that fails the response is replaced with the error, so the job isn't left waiting on a response that can't be delivered.
+func offloadLargeResponse(ctx context.Context, t *toolbox.Toolbox, completedJobData *common.CompletedJobData) {
+	err := common.OffloadLargeResponse(ctx, t, completedJobData)
+	if err == nil {
+		return
+	}
+	err = fmt.Errorf("error storing the response of this module: %w", err)
+	t.Logger.WithError(err).Error("error offloading large response")
+	errorResponse, _ := json.Marshal([]map[string]string{{"error": err.Error()}})
+	completedJobData.Response = string(errorResponse)
+	if completedJobData.Status != nil {
+		completedJobData.Status.Status = common.ModuleFailed
+		completedJobData.Status.ErrorCode = common.ModuleErrorCodeResponseTooLarge
+		completedJobData.Status.Retryable = true
+	}
+}
+
 // triageSNSEvent converts the aws to legacy interface for a single job
 func triageSNSEvent(ctx context.Context, t *toolbox.Toolbox, module triage.Module, request events.SNSEventRecord) (*common.CompletedJobData, error) {
 	span, spanCtx := t.TracerLogger.StartSpan(ctx, "TriageLegacyConnector", "triagelegacyconnector", "sns", "triage")
@@ -132,44 +205,218 @@ func triageSNSEvent(ctx context.Context, t *toolbox.Toolbox, module triage.Modul
 		}
 		return false
 	}
-	// Check if our module supports the IOC type
-	weSupportThisIOCType := func() bool {
-		for _, supportedType := range module.Supports() {
-			if strings.ToLower(string(supportedType)) == strings.ToLower(jobSubmission.IOCType) {
-				return true
-			}
+	// Find the IOC types of this job our module supports, a job can contain multiple IOC types
+	iocGroups := jobSubmission.GetIOCGroups()
+	supportedIOCTypes := []triage.IOCType{}
+	for _, supportedType := range module.Supports() {
+		if _, ok := iocGroups[supportedType]; ok {
+			supportedIOCTypes = append(supportedIOCTypes, supportedType)
 		}
-		return false
 	}
 	ourModuleMentionedOut := ourModuleMentioned()
-	weSupportThisIOCTypeOut := weSupportThisIOCType()
+	weSupportThisIOCTypeOut := len(supportedIOCTypes) > 0
 	span.LogKV("ourModuleMentioned", ourModuleMentionedOut)
 	span.LogKV("weSupportThisIOC", weSupportThisIOCTypeOut)
-	if !ourModuleMentionedOut || !weSupportThisIOCTypeOut {
-		fmt.Printf("Not processing, mentioned %v, support this IOC type: %v\n", ourModuleMentionedOut, weSupportThisIOCTypeOut)
+	if !ourModuleMentionedOut {
+		fmt.Printf("Not processing, not mentioned\n")
 		return nil, nil
 	}
+	startTime := time.Now()
+	if !weSupportThisIOCTypeOut {
+		// Report that we skipped this job so it isn't left waiting on us
+		fmt.Printf("Not processing, we do not support these IOC types\n")
+		response.Response = "[]"
+		response.Status = &common.ModuleStatus{
+			Status:    common.ModuleSkippedUnsupported,
+			ErrorCode: common.ModuleErrorCodeUnsupportedIOCType,
+			StartTime: common.EpochTime(startTime),
+			EndTime:   common.EpochTime(time.Now()),
+		}
+		return response, nil
+	}
 
-	// Convert request to triage.TriageRequest
-	triageRequest := &triage.Request{
-		IOCs:     jobSubmission.IOCs,
-		IOCsType: triage.IOCType(strings.ToUpper(jobSubmission.IOCType)),
-		JWT:      JWT,
+	// Don't start working on jobs that were already cancelled
+	cancelled, err := isJobCancelled(ctx, t, jobMessage.JobID)
+	if err != nil {
+		span.LogKV("error", err)
+	}
+	if cancelled {
+		response.Response = "[]"
+		response.Status = &common.ModuleStatus{
+			Status:    common.ModuleCancelled,
+			ErrorCode: common.ModuleErrorCodeCancelled,
+			StartTime: common.EpochTime(startTime),
+			EndTime:   common.EpochTime(time.Now()),
+		}
+		return response, nil
+	}
+
+	// Don't wait on a vendor that is failing, the module is tried again once it was skipped for a while
+	allowed, health, err := t.AllowModuleRun(ctx, response.ModuleName)
+	if err != nil {
+		span.LogKV("error", fmt.Errorf("error checking module health: %w", err))
+	}
+	if !allowed {
+		fmt.Printf("Not processing, the vendor of this module is unavailable\n")
+		errorResponse, _ := json.Marshal([]map[string]string{{"error": fmt.Sprintf("vendor unavailable, the module is tried again after %s", time.Unix(health.RetryAt, 0).UTC().Format(time.RFC3339))}})
+		response.Response = string(errorResponse)
+		response.Status = &common.ModuleStatus{
+			Status:    common.ModuleSkippedUnavailable,
+			ErrorCode: common.ModuleErrorCodeVendorUnavailable,
+			Retryable: true,
+			StartTime: common.EpochTime(startTime),
+			EndTime:   common.EpochTime(time.Now()),
+		}
+		return response, nil
 	}
 
 	spanExecute, spanExecuteCtx := t.TracerLogger.StartSpan(spanCtx, "Execute", "module", "", "execute")
 	defer spanExecute.End(spanExecuteCtx)
 	spanExecute.LogKV("moduleName", module.GetDocs().Name)
 	spanExecute.LogKV("jobID", jobMessage.JobID)
-	spanExecute.LogKV("iocType", jobSubmission.IOCType)
+	spanExecute.LogKV("iocTypes", supportedIOCTypes)
+	// Report the calls this run made to the vendor of the module, which is named after it.
+	// Jobs triaged at the same time in this invocation share the vendor, so their counts can overlap.
+	vendorMetrics := toolbox.GetVendorMetrics(response.ModuleName)
+	defer func() {
+		toolbox.GetVendorMetrics(response.ModuleName).Sub(vendorMetrics).LogKV(spanExecute)
+	}()
 
-	triageDatas, err := module.Triage(ctx, triageRequest)
+	err = setModuleRunning(ctx, t, jobMessage.JobID, response.ModuleName, startTime)
 	if err != nil {
-		err = fmt.Errorf("this module had an error processing this request: %s", err)
-		span.AddError(err)
-		response.Response = err.Error()
-		return nil, err
+		span.LogKV("error", err)
+	}
+
+	// Modules that declare a cache TTL can reuse results other jobs already paid for
+	cacheTTL, err := t.GetModuleCacheTTL(ctx, response.ModuleName)
+	if err != nil {
+		span.LogKV("error", fmt.Errorf("error getting module cache ttl: %w", err))
 	}
+	span.LogKV("cacheTTL", cacheTTL.String())
+
+	// Modules of vendors that charge per call take their calls out of the quotas of the module and the job owner
+	quota, err := t.GetModuleQuota(ctx, response.ModuleName)
+	if err != nil {
+		span.LogKV("error", fmt.Errorf("error getting module quota: %w", err))
+	}
+	// The calls charged for the IOC type being triaged, given back if the module fails
+	var charged int64
+	var chargedAt time.Time
+	chargeQuota := func(ctx context.Context, calls int) error {
+		err := t.ConsumeQuota(ctx, response.ModuleName, jobMessage.Username, quota, int64(calls))
+		if err == nil && quota != nil {
+			charged += int64(calls)
+			chargedAt = time.Now()
+		}
+		if err != nil && !errors.Is(err, toolbox.ErrQuotaExceeded) {
+			// The module runs anyway if its quota can't be checked
+			span.LogKV("error", fmt.Errorf("error consuming quota: %w", err))
+			return nil
+		}
+		return err
+	}
+	refundQuota := func(ctx context.Context) {
+		err := t.RefundQuota(ctx, response.ModuleName, jobMessage.Username, quota, charged, chargedAt)
+		if err != nil {
+			span.LogKV("error", fmt.Errorf("error refunding quota: %w", err))
+		}
+	}
+
+	status := &common.ModuleStatus{
+		Status:    common.ModuleSucceeded,
+		StartTime: common.EpochTime(startTime),
+	}
+	for _, iocType := range supportedIOCTypes {
+		status.IOCCount += len(iocGroups[iocType])
+	}
+	response.Status = status
+
+	// Triage each group of IOCs our module supports
+	triageDatas := []*triage.Data{}
+	var quotaErr error
+	for _, iocType := range supportedIOCTypes {
+		// We are out of time, return what we have so far
+		if ctx.Err() != nil {
+			break
+		}
+		charged = 0
+
+		// Convert request to triage.TriageRequest
+		triageRequest := &triage.Request{
+			IOCs:     iocGroups[iocType],
+			IOCsType: iocType,
+			JWT:      JWT,
+		}
+
+		var iocTypeTriageDatas []*triage.Data
+		if cacheTTL > 0 {
+			iocTypeTriageDatas, err = triageWithCache(ctx, t, module, triageRequest, cacheTTL, jobSubmission.NoCache, chargeQuota)
+		} else {
+			err = chargeQuota(ctx, len(triageRequest.IOCs))
+			if err == nil {
+				iocTypeTriageDatas, err = module.Triage(ctx, triageRequest)
+			}
+		}
+		quotaExceeded := errors.Is(err, toolbox.ErrQuotaExceeded)
+		if err != nil && !quotaExceeded {
+			// Report the error as this module's result instead of failing every job in this invocation
+			err = fmt.Errorf("this module had an error processing this request: %w", err)
+			span.AddError(err)
+			status.Status = common.ModuleFailed
+			status.ErrorCode = common.ModuleErrorCodeModule
+			status.Retryable = true
+			if errors.Is(err, triage.ErrUnauthorized) {
+				status.Status = common.ModuleSkippedUnauthorized
+				status.ErrorCode = common.ModuleErrorCodeUnauthorized
+				status.Retryable = false
+			}
+			status.EndTime = common.EpochTime(time.Now())
+			errorResponse, _ := json.Marshal([]map[string]string{{"error": err.Error()}})
+			response.Response = string(errorResponse)
+			// The vendor calls of the failed run aren't held against the quota
+			refundQuota(spanCtx)
+			recordModuleHealth(spanCtx, t, response.ModuleName, status)
+			return response, nil
+		}
+		for _, triageData := range iocTypeTriageDatas {
+			triageData.IOCType = iocType
+			// Clients that only read CSV still get the findings of modules that return records
+			triageData.RenderCSV()
+		}
+		triageDatas = append(triageDatas, iocTypeTriageDatas...)
+		if quotaExceeded {
+			// The IOCs left would go over the quota, return what we have so far
+			quotaErr = err
+			break
+		}
+	}
+	if quotaErr != nil {
+		status.Status = common.ModulePartial
+		status.ErrorCode = common.ModuleErrorCodeQuotaExceeded
+		// The quota may have calls left once its period is over
+		status.Retryable = true
+		if len(triageDatas) == 0 {
+			status.Status = common.ModuleSkippedQuota
+			status.EndTime = common.EpochTime(time.Now())
+			errorResponse, _ := json.Marshal([]map[string]string{{"error": quotaErr.Error()}})
+			response.Response = string(errorResponse)
+			return response, nil
+		}
+	} else if ctx.Err() != nil {
+		// The module was canceled before it finished, so these results may be incomplete
+		status.Status = common.ModulePartial
+		status.ErrorCode = common.ModuleErrorCodeTimeout
+		status.Retryable = true
+		// Either we ran out of time, or the requester cancelled the job
+		if cancelled, _ := isJobCancelled(spanCtx, t, jobMessage.JobID); cancelled {
+			status.Status = common.ModuleCancelled
+			status.ErrorCode = common.ModuleErrorCodeCancelled
+			status.Retryable = false
+		}
+	}
+	status.ResultCount = len(triageDatas)
+	status.EndTime = common.EpochTime(time.Now())
+	recordModuleHealth(spanCtx, t, response.ModuleName, status)
 
 	// Combine the triage data list into a single CompletedJobData.  For now just marshal it
 	triageDataMarshal, err := json.Marshal(triageDatas)
@@ -183,3 +430,140 @@ func triageSNSEvent(ctx context.Context, t *toolbox.Toolbox, module triage.Modul
 
 	return response, nil
 }
+
+// recordModuleHealth records the outcome of the module run in the health of the module.
+// Runs the requester cancelled or wasn't allowed to make say nothing about the vendor, so they aren't recorded.
+func recordModuleHealth(ctx context.Context, t *toolbox.Toolbox, moduleName string, status *common.ModuleStatus) {
+	errorCode := ""
+	switch {
+	case status.Status == common.ModuleSucceeded:
+	case status.ErrorCode == common.ModuleErrorCodeModule, status.ErrorCode == common.ModuleErrorCodeTimeout:
+		errorCode = string(status.ErrorCode)
+	default:
+		return
+	}
+	_, err := t.RecordModuleRun(ctx, moduleName, errorCode)
+	if err != nil {
+		t.Logger.WithError(err).Error("error recording module health")
+	}
+}
+
+// triageWithCache sends the IOCs without a cached result to the module in a single request, so it keeps its own concurrency.
+// IOCs with a cached result are not sent to the module, unless refresh is set,
+// in which case fresh results are fetched and replace the cached ones.
+// The cached and fetched data are merged back into the data the module would have returned for all the IOCs.
+// Only the IOCs sent to the module are charged to its quota.
+func triageWithCache(ctx context.Context, t *toolbox.Toolbox, module triage.Module, triageRequest *triage.Request, cacheTTL time.Duration, refresh bool, chargeQuota func(ctx context.Context, calls int) error) ([]*triage.Data, error) {
+	span, ctx := t.TracerLogger.StartSpan(ctx, "TriageWithCache", "triagelegacyconnector", "cache", "triage")
+	defer span.End(ctx)
+
+	moduleName := module.GetDocs().Name
+	cachedDatas := []*triage.Data{}
+	missedIOCs := []string{}
+	seen := map[string]bool{}
+	for _, ioc := range triageRequest.IOCs {
+		// IOCs are cached the same way however they are written, so each is only looked up once
+		normalizedIOC := toolbox.NormalizeIOC(triageRequest.IOCsType, ioc)
+		if seen[normalizedIOC] {
+			continue
+		}
+		seen[normalizedIOC] = true
+		if !refresh {
+			iocCachedDatas, err := getCachedTriageData(ctx, t, moduleName, triageRequest.IOCsType, ioc)
+			if err != nil {
+				span.LogKV("error", err)
+			}
+			if iocCachedDatas != nil {
+				cachedDatas = append(cachedDatas, iocCachedDatas...)
+				continue
+			}
+		}
+		missedIOCs = append(missedIOCs, ioc)
+	}
+	span.LogKV("cacheHits", len(seen)-len(missedIOCs))
+
+	// We are out of time, return what we have so far
+	if len(missedIOCs) == 0 || ctx.Err() != nil {
+		return mergeTriageDatas(cachedDatas), nil
+	}
+
+	err := chargeQuota(ctx, len(missedIOCs))
+	if err != nil {
+		return mergeTriageDatas(cachedDatas), err
+	}
+	missRequest := *triageRequest
+	missRequest.IOCs = missedIOCs
+	triageDatas, err := module.Triage(ctx, &missRequest)
+	if err != nil {
+		return mergeTriageDatas(cachedDatas), err
+	}
+	fetchedAt := time.Now()
+	for _, triageData := range triageDatas {
+		triageData.FetchedAt = &fetchedAt
+	}
+
+	// A canceled context means the module may have only returned partial results, don't cache those
+	if ctx.Err() == nil {
+		cacheTriageDatas(ctx, t, moduleName, triageRequest.IOCsType, missedIOCs, triageDatas, fetchedAt, cacheTTL)
+	}
+
+	// The module's data is returned as is unless there is cached data to merge it with
+	if len(cachedDatas) == 0 {
+		return triageDatas, nil
+	}
+	return mergeTriageDatas(append(cachedDatas, triageDatas...)), nil
+}
+
+// cacheTriageDatas caches the data the module returned for these IOCs, under each IOC.
+// Data with an error, or that can't be split by IOC, is not cached.
+func cacheTriageDatas(ctx context.Context, t *toolbox.Toolbox, moduleName string, iocType triage.IOCType, iocs []string, triageDatas []*triage.Data, fetchedAt time.Time, cacheTTL time.Duration) {
+	span, ctx := t.TracerLogger.StartSpan(ctx, "CacheTriageDatas", "triagelegacyconnector", "cache", "put")
+	defer span.End(ctx)
+
+	for _, triageData := range triageDatas {
+		if triageData.HasError() {
+			span.LogKV("notCached", "the module returned an error")
+			return
+		}
+	}
+	iocDatas, ok := splitTriageDatas(triageDatas, iocType, iocs)
+	if !ok {
+		span.LogKV("notCached", "the data can't be split by IOC")
+		return
+	}
+
+	for ioc, triageDatas := range iocDatas {
+		triageDatasMarshalled, err := json.Marshal(triageDatas)
+		if err != nil {
+			span.LogKV("error", err)
+			continue
+		}
+		err = t.PutCachedResult(ctx, moduleName, iocType, ioc, &toolbox.CachedResult{
+			FetchedAt: fetchedAt,
+			Data:      triageDatasMarshalled,
+		}, cacheTTL)
+		if err != nil {
+			span.LogKV("error", err)
+		}
+	}
+}
+
+// getCachedTriageData returns the cached triage data for this IOC, or nil if there isn't any
+func getCachedTriageData(ctx context.Context, t *toolbox.Toolbox, moduleName string, iocType triage.IOCType, ioc string) ([]*triage.Data, error) {
+	cachedResult, err := t.GetCachedResult(ctx, moduleName, iocType, ioc)
+	if err != nil || cachedResult == nil {
+		return nil, err
+	}
+
+	triageDatas := []*triage.Data{}
+	err = json.Unmarshal(cachedResult.Data, &triageDatas)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling cached triage data: %w", err)
+	}
+	for _, triageData := range triageDatas {
+		triageData.CacheHit = true
+		triageData.FetchedAt = &cachedResult.FetchedAt
+	}
+
+	return triageDatas, nil
+}
@@ -0,0 +1,146 @@
+package triage
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Record is a finding of a module about an IOC
+type Record struct {
+	IOC string `json:"ioc"`
+	// The values of the attributes in the schema of the data, by attribute name
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	Tags       []string               `json:"tags,omitempty"`
+	// How bad the IOC is, 0 (benign) to 100 (malicious)
+	Score *float64 `json:"score,omitempty"`
+	// Links to more about this finding
+	References []string `json:"references,omitempty"`
+}
+
+// Schema describes the records of a data
+type Schema struct {
+	// Name of the kind of records, like "urlhaus.host"
+	Name string `json:"name"`
+	// Header of the IOC column in CSV (default: IoC)
+	IOCColumn string `json:"iocColumn,omitempty"`
+	// Put the IOC column after the attributes in CSV, so CSV that didn't have it keeps its columns in order
+	IOCColumnLast bool        `json:"iocColumnLast,omitempty"`
+	Attributes    []Attribute `json:"attributes"`
+}
+
+// Attribute describes an attribute of records
+type Attribute struct {
+	Name        string        `json:"name"`
+	Type        AttributeType `json:"type"`
+	Description string        `json:"description,omitempty"`
+}
+
+// AttributeType is the type of the values of an attribute
+type AttributeType string
+
+// AttributeTypes
+const (
+	StringAttribute   AttributeType = "string"
+	NumberAttribute   AttributeType = "number"
+	BooleanAttribute  AttributeType = "boolean"
+	DateTimeAttribute AttributeType = "datetime"
+	// A list of values, space separated in CSV
+	ListAttribute AttributeType = "list"
+)
+
+// RecordsToCSV renders records as CSV, one row per record, with the IOC first (or last if the schema says so)
+// and the attributes in the order of the schema. Tags and references are added as the last columns if any record has some.
+func RecordsToCSV(schema *Schema, records []Record) string {
+	if schema == nil {
+		schema = &Schema{}
+	}
+	hasTags, hasReferences := false, false
+	for _, record := range records {
+		hasTags = hasTags || len(record.Tags) > 0
+		hasReferences = hasReferences || len(record.References) > 0
+	}
+
+	resp := bytes.Buffer{}
+	csvWriter := csv.NewWriter(&resp)
+
+	// Headers
+	iocColumn := schema.IOCColumn
+	if iocColumn == "" {
+		iocColumn = "IoC"
+	}
+	headers := []string{}
+	if !schema.IOCColumnLast {
+		headers = append(headers, iocColumn)
+	}
+	for _, attribute := range schema.Attributes {
+		headers = append(headers, attribute.Name)
+	}
+	if schema.IOCColumnLast {
+		headers = append(headers, iocColumn)
+	}
+	if hasTags {
+		headers = append(headers, "Tags")
+	}
+	if hasReferences {
+		headers = append(headers, "References")
+	}
+	csvWriter.Write(headers)
+
+	// Rows
+	for _, record := range records {
+		cols := []string{}
+		if !schema.IOCColumnLast {
+			cols = append(cols, record.IOC)
+		}
+		for _, attribute := range schema.Attributes {
+			cols = append(cols, formatAttribute(record.Attributes[attribute.Name]))
+		}
+		if schema.IOCColumnLast {
+			cols = append(cols, record.IOC)
+		}
+		if hasTags {
+			cols = append(cols, strings.Join(record.Tags, " "))
+		}
+		if hasReferences {
+			cols = append(cols, strings.Join(record.References, " "))
+		}
+		csvWriter.Write(cols)
+	}
+	csvWriter.Flush()
+
+	return resp.String()
+}
+
+// RenderCSV renders the records of data that has no other data as CSV, so clients that only read CSV still get them.
+// Data with a schema but no records renders as the CSV headers only.
+func (d *Data) RenderCSV() {
+	if d.Data != "" || (d.Schema == nil && len(d.Records) == 0) {
+		return
+	}
+	d.DataType = CSVType
+	d.Data = RecordsToCSV(d.Schema, d.Records)
+}
+
+// formatAttribute formats an attribute value for CSV, lists are space separated
+func formatAttribute(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	if reflectValue := reflect.ValueOf(value); reflectValue.Kind() == reflect.Slice {
+		values := make([]string, reflectValue.Len())
+		for i := range values {
+			values[i] = formatAttribute(reflectValue.Index(i).Interface())
+		}
+		return strings.Join(values, " ")
+	}
+	return fmt.Sprint(value)
+}
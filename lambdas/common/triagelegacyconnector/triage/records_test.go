@@ -0,0 +1,93 @@
+package triage
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var testSchema = &Schema{
+	Name:      "test.host",
+	IOCColumn: "Domain",
+	Attributes: []Attribute{
+		{Name: "Ports", Type: ListAttribute},
+		{Name: "Badness", Type: NumberAttribute},
+		{Name: "Owner", Type: StringAttribute},
+	},
+}
+
+func TestRecordsToCSV(t *testing.T) {
+	records := []Record{
+		{IOC: "godaddy.com", Attributes: map[string]interface{}{"Ports": []int{80, 443}, "Badness": 0.25, "Owner": "GoDaddy, LLC"}},
+		{IOC: "gumblar.cn", Attributes: map[string]interface{}{"Badness": 1}},
+	}
+	expected := "Domain,Ports,Badness,Owner\ngodaddy.com,80 443,0.25,\"GoDaddy, LLC\"\ngumblar.cn,,1,\n"
+	if actual := RecordsToCSV(testSchema, records); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+
+	// Records read back from JSON render the same
+	recordsJSON, _ := json.Marshal(records)
+	readRecords := []Record{}
+	if err := json.Unmarshal(recordsJSON, &readRecords); err != nil {
+		t.Fatal(err)
+	}
+	if actual := RecordsToCSV(testSchema, readRecords); actual != expected {
+		t.Errorf("expected %q from JSON records, got %q", expected, actual)
+	}
+
+	// Tags and references get their own columns
+	records = []Record{{IOC: "gumblar.cn", Tags: []string{"malware", "c2"}, References: []string{"https://urlhaus.abuse.ch/host/gumblar.cn/"}}}
+	expected = "IoC,Tags,References\ngumblar.cn,malware c2,https://urlhaus.abuse.ch/host/gumblar.cn/\n"
+	if actual := RecordsToCSV(&Schema{}, records); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+
+	// The IOC column can come after the attributes
+	records = []Record{{IOC: "gumblar.cn", Attributes: map[string]interface{}{"Owner": "Gumblar"}, Tags: []string{"c2"}}}
+	expected = "Owner,IoC,Tags\nGumblar,gumblar.cn,c2\n"
+	if actual := RecordsToCSV(&Schema{IOCColumnLast: true, Attributes: []Attribute{{Name: "Owner"}}}, records); actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestRenderCSV(t *testing.T) {
+	data := &Data{Schema: testSchema, Records: []Record{{IOC: "godaddy.com"}}}
+	data.RenderCSV()
+	if data.DataType != CSVType || data.Data != "Domain,Ports,Badness,Owner\ngodaddy.com,,,\n" {
+		t.Errorf("unexpected rendered data %s %q", data.DataType, data.Data)
+	}
+
+	// Data without records renders the headers
+	data = &Data{Schema: testSchema}
+	data.RenderCSV()
+	if data.Data != "Domain,Ports,Badness,Owner\n" {
+		t.Errorf("expected the headers, got %q", data.Data)
+	}
+	data = &Data{}
+	data.RenderCSV()
+	if data.Data != "" {
+		t.Errorf("expected no data without a schema, got %q", data.Data)
+	}
+
+	// Data the module already returned is kept
+	data = &Data{DataType: JSONType, Data: "{}", Records: []Record{{IOC: "godaddy.com"}}}
+	data.RenderCSV()
+	if data.DataType != JSONType || data.Data != "{}" {
+		t.Errorf("expected the data of the module to be kept, got %s %q", data.DataType, data.Data)
+	}
+}
+
+func TestDataHasError(t *testing.T) {
+	for data, expected := range map[string]bool{
+		"error from apivoid: 500":                   true,
+		"Error retrieving secret with key":          true,
+		"Passive Total returned an error: 401":      true,
+		"IoC,Reputation\nerror.example.com,0\n":     false,
+		"Domain,Reputation\nerrors.example.com,0\n": false,
+		"": false,
+	} {
+		if actual := (&Data{Data: data}).HasError(); actual != expected {
+			t.Errorf("expected %q to have an error: %v, got %v", data, expected, actual)
+		}
+	}
+}
@@ -2,8 +2,15 @@ package triage
 
 import (
 	"context"
+	"errors"
+	"math"
+	"strings"
+	"time"
 )
 
+// ErrUnauthorized should be returned by a module's Triage when the requester is not allowed to run it
+var ErrUnauthorized = errors.New("not authorized to run this module")
+
 // Data is data we found on an ioc
 // This must be stored in a separate package due to import cycle constraints
 type Data struct {
@@ -19,6 +26,50 @@ type Data struct {
 	// If this is blank it will be ignored
 	DataType DataType
 	Data     string
+	// The type of IOCs this data is about
+	IOCType IOCType `json:"iocType,omitempty"`
+	// Set when this data was reused from a previous job instead of fetched from the vendor
+	CacheHit bool `json:"cacheHit,omitempty"`
+	// When this data was fetched from the vendor, only set for modules that cache their results
+	FetchedAt *time.Time `json:"fetchedAt,omitempty"`
+	// How bad the vendor thinks each IOC of this data is, for modules that score IOCs
+	Scores []Score `json:"scores,omitempty"`
+	// The findings of this data, for modules that return structured results.
+	// The connector renders them as CSV in Data for clients that don't read them.
+	Records []Record `json:"records,omitempty"`
+	// Describes the attributes of the records
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+// HasError returns true if the module put an error in the data instead of returning it,
+// like "error from apivoid: ..." or "Passive Total returned an error: ...".
+func (d *Data) HasError() bool {
+	data := strings.ToLower(strings.TrimSpace(d.Data))
+	return strings.HasPrefix(data, "error") || strings.Contains(data, "returned an error")
+}
+
+// Score is how bad a vendor thinks an IOC is, normalized so scores of different modules can be compared
+type Score struct {
+	IOC string `json:"ioc"`
+	// 0 (benign) to 100 (malicious)
+	Score float64 `json:"score"`
+	// Where the score comes from, like the vendor score it was normalized from
+	Source string `json:"source"`
+	// 0 to 1, how much the vendor score can be trusted, like how many engines analyzed the IOC
+	Confidence float64 `json:"confidence"`
+}
+
+// NewScore normalizes a vendor score of 0 to max, ok is false if there is no usable score
+func NewScore(ioc string, score, max float64, source string, confidence float64) (Score, bool) {
+	if max <= 0 || math.IsNaN(score) || math.IsInf(score, 0) || math.IsNaN(confidence) {
+		return Score{}, false
+	}
+	return Score{
+		IOC:        ioc,
+		Score:      math.Max(0, math.Min(100, score/max*100)),
+		Source:     source,
+		Confidence: math.Max(0, math.Min(1, confidence)),
+	}, true
 }
 
 // DataType is the type of data of this data (default: csv)
@@ -0,0 +1,343 @@
+// Package triagetest checks that triage modules follow the contract of triage.Module, so the connector can rely on it.
+// Module tests run every check with RunConformance:
+//
+//	func TestConformance(t *testing.T) {
+//		module := &TriageModule{Client: cassette.Wrap(t, "conformance", nil)}
+//		triagetest.RunConformance(t, module, triagetest.Options{
+//			IOCs: map[triage.IOCType][]string{triage.CVEType: {"CVE-2020-29292"}},
+//		})
+//	}
+package triagetest
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
+)
+
+const (
+	// Path of the lambda.json of a module, relative to the directory of its tests
+	defaultLambdaJSON = "lambda.json"
+	// How long modules can take to return once their context is cancelled
+	defaultCancelTimeout = time.Second * 5
+	// How many IOCs are triaged once cancelled, enough to fill the worker pools of modules so they have lookups left to skip
+	cancellationIOCCount = 20
+)
+
+// pngSignature starts every PNG file
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// Options of the conformance checks of a module
+type Options struct {
+	// IOCs to triage for each IOC type the module supports, the module must return data for them.
+	// Types without IOCs here are triaged with their SampleIOCs.
+	IOCs map[triage.IOCType][]string
+	// Path of the lambda.json of the module (default: lambda.json)
+	LambdaJSON string
+	// Skip the lambda.json checks, for modules that aren't deployed as a lambda
+	NoLambdaJSON bool
+	// How long Triage can take to return once its context is cancelled (default: 5 seconds)
+	CancelTimeout time.Duration
+	// Skip the checks that run Triage, for modules that can't run without their vendor
+	SkipTriage bool
+}
+
+// SampleIOCs are IOCs of each type, for the IOC types the tests of a module don't give IOCs for
+var SampleIOCs = map[triage.IOCType][]string{
+	triage.DomainType:            {"godaddy.com"},
+	triage.EmailType:             {"security@godaddy.com"},
+	triage.CVEType:               {"CVE-2021-44228"},
+	triage.CWEType:               {"CWE-79"},
+	triage.CAPECType:             {"CAPEC-66"},
+	triage.CPEType:               {"cpe:2.3:a:apache:log4j:2.14.1:*:*:*:*:*:*:*"},
+	triage.URLType:               {"https://www.godaddy.com/"},
+	triage.MD5Type:               {"44d88612fea8a8f36de82e1278abb02f"},
+	triage.SHA1Type:              {"3395856ce81f2b7382dee72602f798b642f14140"},
+	triage.SHA256Type:            {"275a021bbfb6489e54d471899f7db9d1663fc695ec2fe2a2c4538aabf651fd0f"},
+	triage.SHA512Type:            {"cc805d5fab1fd71a4ab352a9c533e65fb2d5b885518f4e565e68847223b8e6b85cb48f3afad842726d99239c9e36505c64b0dc9a061d9e507d833277ada336ab"},
+	triage.IPType:                {"8.8.8.8"},
+	triage.AWSHostnameType:       {"ip-10-0-0-1.ec2.internal"},
+	triage.GoDaddyUsernameType:   {"security"},
+	triage.GoDaddyHostnameType:   {"github.cloud.ppp.gdg"},
+	triage.MitreMatrixType:       {"MA1057"},
+	triage.MitreTacticType:       {"TA0001"},
+	triage.MitreTechniqueType:    {"T1566"},
+	triage.MitreSubTechniqueType: {"T1566.001"},
+	triage.MitreMitigationType:   {"M1049"},
+	triage.MitreGroupType:        {"G0007"},
+	triage.MitreSoftwareType:     {"S0002"},
+	triage.MitreDetectionType:    {"DS0017"},
+}
+
+// lambdaJSON is the part of the lambda.json of a module the connector relies on
+type lambdaJSON struct {
+	Handler  string `json:"handler"`
+	Metadata struct {
+		SupportedIOCTypes []triage.IOCType `json:"supportedIOCTypes"`
+	} `json:"metadata"`
+}
+
+// RunConformance runs every conformance check on a module, each as a subtest of t
+func RunConformance(t *testing.T, module triage.Module, options Options) {
+	t.Helper()
+	if options.LambdaJSON == "" {
+		options.LambdaJSON = defaultLambdaJSON
+	}
+	if options.CancelTimeout == 0 {
+		options.CancelTimeout = defaultCancelTimeout
+	}
+
+	t.Run("Docs", func(t *testing.T) {
+		if err := checkDocs(module); err != nil {
+			t.Error(err)
+		}
+	})
+	supported := t.Run("Supports", func(t *testing.T) {
+		if err := checkSupports(module); err != nil {
+			t.Error(err)
+		}
+	})
+	if !options.NoLambdaJSON {
+		t.Run("LambdaJSON", func(t *testing.T) {
+			if err := checkLambdaJSON(module, options.LambdaJSON); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	if options.SkipTriage || !supported {
+		return
+	}
+
+	for _, iocType := range module.Supports() {
+		iocs := options.IOCs[iocType]
+		if len(iocs) == 0 {
+			iocs = SampleIOCs[iocType]
+		}
+		t.Run("Triage/"+string(iocType), func(t *testing.T) {
+			if err := checkIOCType(module, iocType, iocs); err != nil {
+				t.Error(err)
+			}
+		})
+		t.Run("Cancellation/"+string(iocType), func(t *testing.T) {
+			if err := checkCancellation(module, iocType, iocs, options.CancelTimeout); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// checkDocs checks that the module has a name and a description.
+// The name of a module is how jobs request it, so it can't have spaces.
+func checkDocs(module triage.Module) error {
+	doc := module.GetDocs()
+	switch {
+	case doc == nil:
+		return errors.New("GetDocs returned no docs")
+	case doc.Name == "":
+		return errors.New("the docs have no module name")
+	case strings.IndexFunc(doc.Name, unicode.IsSpace) >= 0:
+		return fmt.Errorf("the module name %q has spaces", doc.Name)
+	case strings.TrimSpace(doc.Description) == "":
+		return fmt.Errorf("the docs of %s have no description", doc.Name)
+	}
+	return nil
+}
+
+// checkSupports checks that the module supports known IOC types, each once
+func checkSupports(module triage.Module) error {
+	iocTypes := module.Supports()
+	if len(iocTypes) == 0 {
+		return errors.New("the module supports no IOC types")
+	}
+	seen := map[triage.IOCType]bool{}
+	for _, iocType := range iocTypes {
+		if !isKnownIOCType(iocType) {
+			return fmt.Errorf("the module supports the unknown IOC type %q", iocType)
+		}
+		if seen[iocType] {
+			return fmt.Errorf("the module supports %s more than once", iocType)
+		}
+		seen[iocType] = true
+	}
+	return nil
+}
+
+// checkLambdaJSON checks that the lambda.json of the module is named after it, and lists the IOC types it supports.
+// The manager only sends a module the IOC types listed there, and the connector only triages the ones it supports.
+func checkLambdaJSON(module triage.Module, path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading lambda.json: %w", err)
+	}
+	lambda := lambdaJSON{}
+	if err := json.Unmarshal(data, &lambda); err != nil {
+		return fmt.Errorf("error unmarshalling %s: %w", path, err)
+	}
+	if doc := module.GetDocs(); doc != nil && lambda.Handler != doc.Name {
+		return fmt.Errorf("the handler %q of %s isn't the module name %q", lambda.Handler, path, doc.Name)
+	}
+
+	listed := map[triage.IOCType]bool{}
+	for _, iocType := range lambda.Metadata.SupportedIOCTypes {
+		listed[iocType] = true
+	}
+	var problems []string
+	for _, iocType := range module.Supports() {
+		if !listed[iocType] {
+			problems = append(problems, fmt.Sprintf("%s is supported but not listed, so jobs never send it", iocType))
+		}
+		delete(listed, iocType)
+	}
+	for _, iocType := range lambda.Metadata.SupportedIOCTypes {
+		if listed[iocType] {
+			problems = append(problems, fmt.Sprintf("%s is listed but not supported, so it is never triaged", iocType))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("the supportedIOCTypes of %s don't match Supports(): %s", path, strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// checkIOCType checks that the module returns data for IOCs of this type, and that its data is what it says it is
+func checkIOCType(module triage.Module, iocType triage.IOCType, iocs []string) error {
+	if len(iocs) == 0 {
+		return fmt.Errorf("no IOCs to triage as %s", iocType)
+	}
+	triageDatas, err := triageIOCs(context.Background(), module, iocType, iocs)
+	if err != nil {
+		return err
+	}
+	handled := false
+	for _, triageData := range triageDatas {
+		if err := checkData(triageData); err != nil {
+			return err
+		}
+		handled = handled || triageData.Data != "" || len(triageData.Records) > 0
+	}
+	if !handled {
+		return fmt.Errorf("the module returned no data for the %s IOCs %v, it doesn't handle them", iocType, iocs)
+	}
+	return nil
+}
+
+// checkCancellation checks that the module returns its partial results soon after its context is cancelled.
+// Returning an error instead fails the module, and throws away the results of its other IOC types.
+func checkCancellation(module triage.Module, iocType triage.IOCType, iocs []string, timeout time.Duration) error {
+	if len(iocs) == 0 {
+		return fmt.Errorf("no IOCs to triage as %s", iocType)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Repeat the IOCs to have more of them than the module looks up at a time
+	batch := make([]string, cancellationIOCCount)
+	for i := range batch {
+		batch[i] = iocs[i%len(iocs)]
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		triageDatas, err := triageIOCs(ctx, module, iocType, batch)
+		if err == nil {
+			for _, triageData := range triageDatas {
+				if err = checkData(triageData); err != nil {
+					break
+				}
+			}
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("once its context is cancelled: %w", err)
+		}
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("the module didn't return within %s of its context being cancelled", timeout)
+	}
+}
+
+// checkData checks that the data of a triage data is of its data type
+func checkData(triageData *triage.Data) error {
+	if triageData == nil {
+		return errors.New("the module returned nil data")
+	}
+	if triageData.HasError() {
+		return fmt.Errorf("the module put an error in the data instead of returning it: %q", triageData.Data)
+	}
+	if triageData.Data == "" {
+		return nil
+	}
+
+	var err error
+	switch triageData.DataType {
+	case "", triage.CSVType:
+		reader := csv.NewReader(strings.NewReader(triageData.Data))
+		// Modules can dump several tables one after the other
+		reader.FieldsPerRecord = -1
+		_, err = reader.ReadAll()
+	case triage.JSONType:
+		if !json.Valid([]byte(triageData.Data)) {
+			err = errors.New("invalid JSON")
+		}
+	case triage.PNGType:
+		var image []byte
+		image, err = base64.StdEncoding.DecodeString(triageData.Data)
+		if err == nil && !bytes.HasPrefix(image, pngSignature) {
+			err = errors.New("not a base64 encoded PNG")
+		}
+	case triage.TextType:
+		if !utf8.ValidString(triageData.Data) {
+			err = errors.New("invalid UTF-8")
+		}
+	default:
+		return fmt.Errorf("the data %q has the unknown data type %q", triageData.Title, triageData.DataType)
+	}
+	if err != nil {
+		dataType := triageData.DataType
+		if dataType == "" {
+			dataType = triage.CSVType
+		}
+		return fmt.Errorf("the data %q isn't %s: %v", triageData.Title, dataType, err)
+	}
+	return nil
+}
+
+// triageIOCs triages IOCs of this type, returning an error if the module does or panics
+func triageIOCs(ctx context.Context, module triage.Module, iocType triage.IOCType, iocs []string) (triageDatas []*triage.Data, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("the module panicked triaging %s: %v", iocType, r)
+		}
+	}()
+	triageDatas, err = module.Triage(ctx, &triage.Request{IOCs: iocs, IOCsType: iocType})
+	if err != nil {
+		return nil, fmt.Errorf("the module returned an error triaging %s: %w", iocType, err)
+	}
+	return triageDatas, nil
+}
+
+// isKnownIOCType returns true if the IOC type is one the manager classifies IOCs as
+func isKnownIOCType(iocType triage.IOCType) bool {
+	for _, knownIOCType := range triage.AllIOCTypes {
+		if iocType == knownIOCType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,179 @@
+package triagetest
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
+)
+
+// testModule answers the IOCs of the types it supports with a CSV row each
+type testModule struct {
+	doc      *triage.Doc
+	supports []triage.IOCType
+	// IOC types the module advertises but returns nothing for
+	unhandled map[triage.IOCType]bool
+	// Makes the module ignore cancellation, and take this long
+	delay time.Duration
+	// Makes the module return an error once cancelled
+	errOnCancel bool
+}
+
+func newTestModule() *testModule {
+	return &testModule{
+		doc:      &triage.Doc{Name: "test", Description: "Test module"},
+		supports: []triage.IOCType{triage.DomainType, triage.IPType},
+	}
+}
+
+func (m *testModule) GetDocs() *triage.Doc {
+	return m.doc
+}
+
+func (m *testModule) Supports() []triage.IOCType {
+	return m.supports
+}
+
+func (m *testModule) Triage(ctx context.Context, triageRequest *triage.Request) ([]*triage.Data, error) {
+	if m.unhandled[triageRequest.IOCsType] {
+		return nil, nil
+	}
+	time.Sleep(m.delay)
+	if ctx.Err() != nil && m.errOnCancel {
+		return nil, ctx.Err()
+	}
+	return []*triage.Data{{
+		Title:    "Test data",
+		DataType: triage.CSVType,
+		Data:     "IoC\n" + strings.Join(triageRequest.IOCs, "\n") + "\n",
+	}}, nil
+}
+
+func writeLambdaJSON(t *testing.T, contents string) string {
+	dir, err := ioutil.TempDir("", "triagetest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "lambda.json")
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRunConformance(t *testing.T) {
+	RunConformance(t, newTestModule(), Options{
+		LambdaJSON: writeLambdaJSON(t, `{"handler": "test", "metadata": {"supportedIOCTypes": ["IP", "DOMAIN"]}}`),
+	})
+}
+
+func TestCheckDocs(t *testing.T) {
+	module := newTestModule()
+	if err := checkDocs(module); err != nil {
+		t.Errorf("expected valid docs, got %v", err)
+	}
+	for _, doc := range []*triage.Doc{nil, {Description: "Test module"}, {Name: "test module", Description: "Test module"}, {Name: "test"}} {
+		module.doc = doc
+		if err := checkDocs(module); err == nil {
+			t.Errorf("expected an error for the docs %+v", doc)
+		}
+	}
+}
+
+func TestCheckSupports(t *testing.T) {
+	module := newTestModule()
+	if err := checkSupports(module); err != nil {
+		t.Errorf("expected valid IOC types, got %v", err)
+	}
+	for _, supports := range [][]triage.IOCType{nil, {"HOSTNAME"}, {triage.IPType, triage.IPType}} {
+		module.supports = supports
+		if err := checkSupports(module); err == nil {
+			t.Errorf("expected an error for the IOC types %v", supports)
+		}
+	}
+}
+
+func TestCheckLambdaJSON(t *testing.T) {
+	module := newTestModule()
+	for contents, expected := range map[string]string{
+		`{"handler": "other", "metadata": {"supportedIOCTypes": ["DOMAIN", "IP"]}}`:        `isn't the module name "test"`,
+		`{"handler": "test", "metadata": {"supportedIOCTypes": ["DOMAIN"]}}`:               "IP is supported but not listed",
+		`{"handler": "test", "metadata": {"supportedIOCTypes": ["DOMAIN", "IP", "SHA1"]}}`: "SHA1 is listed but not supported",
+	} {
+		err := checkLambdaJSON(module, writeLambdaJSON(t, contents))
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected an error containing %q for %s, got %v", expected, contents, err)
+		}
+	}
+	if err := checkLambdaJSON(module, filepath.Join("missing", "lambda.json")); err == nil {
+		t.Error("expected an error for a missing lambda.json")
+	}
+}
+
+func TestCheckIOCType(t *testing.T) {
+	module := newTestModule()
+	if err := checkIOCType(module, triage.IPType, SampleIOCs[triage.IPType]); err != nil {
+		t.Errorf("expected the IOCs to be handled, got %v", err)
+	}
+
+	// Advertised but unhandled, like SHA1 hashes used to be in virustotal
+	module.unhandled = map[triage.IOCType]bool{triage.IPType: true}
+	if err := checkIOCType(module, triage.IPType, SampleIOCs[triage.IPType]); err == nil || !strings.Contains(err.Error(), "doesn't handle them") {
+		t.Errorf("expected an error for unhandled IOCs, got %v", err)
+	}
+}
+
+func TestCheckCancellation(t *testing.T) {
+	module := newTestModule()
+	if err := checkCancellation(module, triage.IPType, SampleIOCs[triage.IPType], time.Second); err != nil {
+		t.Errorf("expected the module to return once cancelled, got %v", err)
+	}
+
+	module.errOnCancel = true
+	if err := checkCancellation(module, triage.IPType, SampleIOCs[triage.IPType], time.Second); err == nil {
+		t.Error("expected an error for a module failing once cancelled")
+	}
+
+	// Ignoring the context, like breaking out of a select instead of the loop around it
+	module = newTestModule()
+	module.delay = time.Millisecond * 100
+	if err := checkCancellation(module, triage.IPType, SampleIOCs[triage.IPType], time.Millisecond*10); err == nil {
+		t.Error("expected an error for a module ignoring cancellation")
+	}
+}
+
+func TestCheckData(t *testing.T) {
+	for _, triageData := range []*triage.Data{
+		{},
+		{Data: "IoC,Badness\ngodaddy.com,0\nIoC\ngodaddy.com\n"},
+		{DataType: triage.JSONType, Data: `{"ioc": "godaddy.com"}`},
+		{DataType: triage.PNGType, Data: "iVBORw0KGgo="},
+		{DataType: triage.TextType, Data: "godaddy.com is fine"},
+	} {
+		if err := checkData(triageData); err != nil {
+			t.Errorf("expected valid data for %+v, got %v", triageData, err)
+		}
+	}
+
+	for _, triageData := range []*triage.Data{
+		nil,
+		{Data: `error: "godaddy.com" not found`},
+		{Data: "error from apivoid: timeout"},
+		{DataType: triage.TextType, Data: "The vendor returned an error"},
+		{DataType: triage.JSONType, Data: "godaddy.com,0"},
+		{DataType: triage.PNGType, Data: "not an image"},
+		{DataType: triage.PNGType, Data: "R0lGODlh"},
+		{DataType: triage.TextType, Data: "\xff"},
+		{DataType: "xml", Data: "<ioc/>"},
+	} {
+		if err := checkData(triageData); err == nil {
+			t.Errorf("expected an error for %+v", triageData)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/jobstore"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
+	"github.com/sirupsen/logrus"
+	_ "go.elastic.co/apm/module/apmlambda"
+)
+
+var t *toolbox.Toolbox
+
+// handler is a lambda function that takes an array of SQS events, each asking to send the callback of a job if it finished.
+// Callbacks are sent from here so a slow callback receiver never holds up the processing of module responses.
+func handler(ctx context.Context, request events.SQSEvent) (string, error) {
+	t = toolbox.GetToolbox()
+	t.Logger.SetFormatter(&logrus.JSONFormatter{})
+
+	store, err := jobstore.New(t)
+	if err != nil {
+		return "", err
+	}
+
+	for _, sqsRecord := range request.Records {
+		message := common.JobCallbackMessage{}
+		err := json.Unmarshal([]byte(sqsRecord.Body), &message)
+		if err != nil || message.JobID == "" {
+			t.Logger.WithFields(logrus.Fields{"error": err, "body": sqsRecord.Body}).Error("Error unmarshaling job callback message")
+			continue
+		}
+
+		err = processJobCallback(store, ctx, message, time.Now())
+		if err != nil {
+			t.Logger.WithFields(logrus.Fields{"jobID": message.JobID, "error": err}).Error("Error sending job callback")
+		}
+	}
+	return "", nil
+}
+
+// processJobCallback sends the callback of the job if it finished.
+// Messages that wait for the job to time out longer than SQS can delay them are sent again until they are due.
+func processJobCallback(store jobstore.JobStore, ctx context.Context, message common.JobCallbackMessage, now time.Time) error {
+	span, ctx := t.TracerLogger.StartSpan(ctx, "ProcessJobCallback", "job", "callback", "process")
+	defer span.End(ctx)
+	span.LogKV("jobID", message.JobID)
+
+	if notBefore := time.Unix(int64(message.NotBefore), 0); notBefore.After(now) {
+		return common.EnqueueJobCallback(ctx, t, message.JobID, notBefore.Sub(now))
+	}
+	return common.NotifyJobFinished(ctx, t, store, message.JobID)
+}
+
+func main() {
+	lambda.Start(handler)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/agiledragon/gomonkey/v2"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/jobstore"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHandler(test *testing.T) {
+
+	Convey("Job callbacks handler", test, func() {
+		// setup stubs\mocks
+		patches := []*Patches{}
+		ctx := context.Background()
+		patches = append(patches, ApplyFunc(jobstore.New,
+			func(t *toolbox.Toolbox) (jobstore.JobStore, error) {
+				return &jobstore.DynamoDBStore{}, nil
+			}))
+
+		notifiedJobIDs := []string{}
+		patches = append(patches, ApplyFunc(common.NotifyJobFinished,
+			func(ctx context.Context, t *toolbox.Toolbox, store common.JobCallbackStore, jobID string) error {
+				notifiedJobIDs = append(notifiedJobIDs, jobID)
+				return nil
+			}))
+		enqueuedDelays := map[string]time.Duration{}
+		patches = append(patches, ApplyFunc(common.EnqueueJobCallback,
+			func(ctx context.Context, t *toolbox.Toolbox, jobID string, delay time.Duration) error {
+				enqueuedDelays[jobID] = delay
+				return nil
+			}))
+
+		Reset(func() {
+			// deferred reset all stubs\mocks after every test suite running
+			for i := len(patches) - 1; i >= 0; i-- {
+				patches[i].Reset()
+			}
+		})
+
+		Convey("should send the callbacks of the jobs that are due", func() {
+			request := events.SQSEvent{Records: []events.SQSMessage{
+				{Body: `{"jobId": "job 1"}`},
+				{Body: `{"jobId": "job 2", "notBefore": 1610000000}`},
+				{Body: `I am not JSON`},
+			}}
+			_, err := handler(ctx, request)
+			So(err, ShouldBeNil)
+			So(notifiedJobIDs, ShouldResemble, []string{"job 1", "job 2"})
+			So(enqueuedDelays, ShouldBeEmpty)
+		})
+
+		Convey("should send the checks that are not due yet again", func() {
+			t = toolbox.GetToolbox()
+			now := time.Unix(1610000000, 0)
+			message := common.JobCallbackMessage{JobID: "job 1", NotBefore: common.EpochTime(now.Add(time.Minute * 20))}
+			err := processJobCallback(&jobstore.DynamoDBStore{}, ctx, message, now)
+			So(err, ShouldBeNil)
+			So(notifiedJobIDs, ShouldBeEmpty)
+			So(enqueuedDelays, ShouldResemble, map[string]time.Duration{"job 1": time.Minute * 20})
+		})
+	})
+}
@@ -0,0 +1,7 @@
+#!/bin/bash
+
+set -eu
+
+./build.sh
+
+aws lambda update-function-code --function-name jobcallbacks --zip-file fileb://function.zip
@@ -0,0 +1,77 @@
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
+)
+
+// anyIOC is the key of the results of a fixture module for every IOC without results of its own
+const anyIOC = "*"
+
+// FixtureModule is a module answering with fixed results, so jobs can run without calling any vendor
+type FixtureModule struct {
+	Name              string           `json:"-"`
+	Description       string           `json:"description"`
+	SupportedIOCTypes []triage.IOCType `json:"supportedIOCTypes"`
+	// Results of each IOC, the results of anyIOC are used for IOCs that aren't listed
+	Results map[string][]*triage.Data `json:"results"`
+}
+
+// LoadFixtureModules loads a fixture module from each <module name>.json file in this directory
+func LoadFixtureModules(dir string) ([]triage.Module, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	modules := []triage.Module{}
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading fixture module: %w", err)
+		}
+		module := &FixtureModule{}
+		if err := json.Unmarshal(data, module); err != nil {
+			return nil, fmt.Errorf("error unmarshalling fixture module %s: %w", path, err)
+		}
+		module.Name = strings.TrimSuffix(filepath.Base(path), ".json")
+		modules = append(modules, module)
+	}
+	return modules, nil
+}
+
+// GetDocs of this module
+func (m *FixtureModule) GetDocs() *triage.Doc {
+	return &triage.Doc{Name: m.Name, Description: m.Description}
+}
+
+// Supports returns the IOC types of this module
+func (m *FixtureModule) Supports() []triage.IOCType {
+	return m.SupportedIOCTypes
+}
+
+// Triage returns the results of each IOC
+func (m *FixtureModule) Triage(ctx context.Context, triageRequest *triage.Request) ([]*triage.Data, error) {
+	triageDatas := []*triage.Data{}
+	for _, ioc := range triageRequest.IOCs {
+		// Return partial results once we are out of time, like a real module
+		if ctx.Err() != nil {
+			break
+		}
+		results, ok := m.Results[ioc]
+		if !ok {
+			results = m.Results[anyIOC]
+		}
+		// The connector sets the IOC type of the data, so each job gets its own copy
+		for _, result := range results {
+			triageData := *result
+			triageDatas = append(triageDatas, &triageData)
+		}
+	}
+	return triageDatas, nil
+}
@@ -0,0 +1,24 @@
+package local
+
+import (
+	"testing"
+
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage/triagetest"
+)
+
+func TestFixtureModuleConformance(t *testing.T) {
+	modules, err := LoadFixtureModules("testdata/fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, module := range modules {
+		t.Run(module.GetDocs().Name, func(t *testing.T) {
+			triagetest.RunConformance(t, module, triagetest.Options{
+				IOCs: map[triage.IOCType][]string{triage.DomainType: {"example.com"}},
+				// Fixture modules aren't deployed
+				NoLambdaJSON: true,
+			})
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package local
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/gdcorp-infosec/threat-api/lambdas/manager/api"
+)
+
+// resources are the resources of the API gateway that are served by the manager, see sceptre/resources/api-setup.json
+var resources = []string{
+	"/v1/jobs",
+	"/v1/jobs/{jobId}",
+	"/v1/jobs/{jobId}/retry",
+	"/v1/jobs/{jobId}/cancel",
+	"/v1/jobs/{jobId}/export",
+	"/v1/iocs/{ioc}/jobs",
+	"/v1/classifications",
+	"/v1/modules",
+	"/v1/usage",
+}
+
+// ServeHTTP converts the request to the one the API gateway sends the manager, and the response of the manager back
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	resource, pathParameters, ok := matchResource(r.URL.EscapedPath())
+	if !ok {
+		http.Error(w, `{"message":"Missing Authentication Token"}`, http.StatusForbidden)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	request := events.APIGatewayProxyRequest{
+		Resource:                        resource,
+		Path:                            r.URL.Path,
+		HTTPMethod:                      r.Method,
+		Headers:                         map[string]string{},
+		MultiValueHeaders:               r.Header,
+		QueryStringParameters:           map[string]string{},
+		MultiValueQueryStringParameters: r.URL.Query(),
+		PathParameters:                  pathParameters,
+		Body:                            string(body),
+	}
+	// Like the API gateway, the last value of a header or query parameter given more than once is used
+	for name, values := range r.Header {
+		request.Headers[name] = values[len(values)-1]
+	}
+	for name, values := range r.URL.Query() {
+		request.QueryStringParameters[name] = values[len(values)-1]
+	}
+
+	s.managerMutex.Lock()
+	response, err := api.Handler(r.Context(), request)
+	s.managerMutex.Unlock()
+	if err != nil {
+		// The API gateway hides the errors of the manager, they are only logged
+		s.Logger.WithField("path", r.URL.Path).WithError(err).Error("error handling request")
+		http.Error(w, `{"message": "Internal server error"}`, http.StatusBadGateway)
+		return
+	}
+
+	for name, value := range response.Headers {
+		w.Header().Set(name, value)
+	}
+	for name, values := range response.MultiValueHeaders {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+	responseBody := []byte(response.Body)
+	if response.IsBase64Encoded {
+		responseBody, _ = base64.StdEncoding.DecodeString(response.Body)
+	}
+	w.WriteHeader(response.StatusCode)
+	w.Write(responseBody)
+}
+
+// matchResource finds the resource of this escaped path, and the values of its path parameters
+func matchResource(path string) (string, map[string]string, bool) {
+	pathParts := strings.Split(strings.Trim(path, "/"), "/")
+	for _, resource := range resources {
+		if pathParameters, ok := matchPathParts(strings.Split(strings.Trim(resource, "/"), "/"), pathParts); ok {
+			return resource, pathParameters, true
+		}
+	}
+	return "", nil, false
+}
+
+// matchPathParts matches the parts of an escaped path to the parts of a resource, returning the values of its path parameters
+func matchPathParts(resourceParts []string, pathParts []string) (map[string]string, bool) {
+	if len(resourceParts) != len(pathParts) {
+		return nil, false
+	}
+	pathParameters := map[string]string{}
+	for i, resourcePart := range resourceParts {
+		if !strings.HasPrefix(resourcePart, "{") || !strings.HasSuffix(resourcePart, "}") {
+			if resourcePart != pathParts[i] {
+				return nil, false
+			}
+			continue
+		}
+		// Path parameters can contain escaped slashes, like URLs in the IOC of /v1/iocs/{ioc}/jobs
+		value, err := url.PathUnescape(pathParts[i])
+		if err != nil || value == "" {
+			return nil, false
+		}
+		pathParameters[strings.Trim(resourcePart, "{}")] = value
+	}
+	return pathParameters, true
+}
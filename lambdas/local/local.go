@@ -0,0 +1,186 @@
+// Package local runs the whole job pipeline of the API in a single process, to develop modules without deploying them.
+// The manager serves its REST routes over plain HTTP, new jobs are handed to the modules over a channel instead of SNS,
+// and their responses are stored over a channel instead of SQS, in a BoltDB job store.
+package local
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gdcorp-golang/auth/gdtoken"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/jobstore"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox/appsectracing"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
+	"github.com/gdcorp-infosec/threat-api/lambdas/manager/api"
+	"github.com/godaddy/asherah/go/appencryption"
+	"github.com/godaddy/asherah/go/appencryption/pkg/crypto/aead"
+	"github.com/godaddy/asherah/go/appencryption/pkg/kms"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// Username of requests without a JWT, or with one that has no account name
+	localUsername = "local"
+	// Master key of the encryption keys of local jobs, there is no KMS to protect it
+	localMasterKey = "threatapi-local-master-key-32byt"
+	// Key IOCs are hashed with in the sightings of local jobs, there is no credentials store to keep it in
+	localSightingKey = "threatapi-local-sighting-key"
+	// Bucket of the responses too large to store in the job store, it's a directory next to the BoltDB file
+	localJobBucket = "jobs"
+	// SSO host JWTs are validated with unless AcceptAnyJWT is set, SSO_HOST overrides it like it does for the lambdas
+	defaultSSOHost = "sso.gdcorp.tools"
+	// How long modules can take for each request to their vendor
+	moduleHTTPTimeout = time.Second * 30
+	// How many jobs can be waiting for the modules before creating jobs blocks
+	jobRequestsBuffer = 100
+)
+
+// Server serves the API of the manager and runs the jobs it creates on its modules.
+// Only one server can run in a process at a time, the manager is configured through package variables.
+type Server struct {
+	Logger *logrus.Logger
+	// Accept any JWT without validating it with SSO, requests are made as the account of the JWT or the local user.
+	// This is only meant for development, anyone who can reach the server can act as anyone.
+	AcceptAnyJWT bool
+
+	ssoHostURL  string
+	storePath   string
+	objectsPath string
+	store       *jobstore.BoltStore
+	kms         appencryption.KeyManagementService
+	modules     []triage.Module
+	metadata    map[string]toolbox.LambdaMetadata
+
+	// The manager keeps the state of each request in package variables, so it handles one request at a time
+	managerMutex sync.Mutex
+
+	// Replace the job requests SNS topic and the completed jobs SQS queue
+	jobRequests   chan common.JobSNSMessage
+	completedJobs chan *common.CompletedJobData
+
+	// Cancelled when the server is closed, so the modules wrap up and return partial results
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	dispatcherDone  chan struct{}
+	modulesRunning  sync.WaitGroup
+	responsesStored chan struct{}
+}
+
+// NewServer creates a server storing its jobs in the BoltDB file at this path, running them on these modules
+func NewServer(storePath string, modules ...triage.Module) (*Server, error) {
+	store, err := jobstore.OpenBoltStore(storePath)
+	if err != nil {
+		return nil, err
+	}
+	keyManagementService, err := kms.NewStatic(localMasterKey, aead.NewAES256GCM())
+	if err != nil {
+		store.Close()
+		return nil, fmt.Errorf("error creating key management service: %w", err)
+	}
+
+	s := &Server{
+		Logger:          logrus.New(),
+		ssoHostURL:      defaultSSOHost,
+		storePath:       storePath,
+		objectsPath:     storePath + ".objects",
+		store:           store,
+		kms:             keyManagementService,
+		modules:         modules,
+		metadata:        map[string]toolbox.LambdaMetadata{},
+		jobRequests:     make(chan common.JobSNSMessage, jobRequestsBuffer),
+		completedJobs:   make(chan *common.CompletedJobData),
+		dispatcherDone:  make(chan struct{}),
+		responsesStored: make(chan struct{}),
+	}
+	if ssoHost := os.Getenv("SSO_HOST"); ssoHost != "" {
+		s.ssoHostURL = ssoHost
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	for _, module := range modules {
+		s.metadata[module.GetDocs().Name] = toolbox.LambdaMetadata{SupportedIOCTypes: module.Supports()}
+	}
+
+	api.NewToolbox = s.newToolbox
+	api.PublishJob = s.publishJob
+	api.SightingKey = []byte(localSightingKey)
+	go s.dispatchJobs()
+	go s.storeResponses()
+
+	return s, nil
+}
+
+// Close stops the modules, waits for their responses to be stored, then closes the job store.
+// The HTTP server serving this server should be shut down first.
+func (s *Server) Close() error {
+	s.cancel()
+	close(s.jobRequests)
+	<-s.dispatcherDone
+	s.modulesRunning.Wait()
+	close(s.completedJobs)
+	<-s.responsesStored
+
+	api.NewToolbox = toolbox.GetToolbox
+	api.PublishJob = nil
+	api.SightingKey = nil
+	return s.store.Close()
+}
+
+// newToolbox gets a toolbox that needs no AWS.
+// Jobs are stored in the BoltDB file, encrypted with keys stored next to them, and their large responses in a directory next to it.
+// JWTs are validated with SSO unless AcceptAnyJWT is set.
+// Anything else that needs AWS, like the results cache, fails with toolbox.ErrNoAWSSession.
+func (s *Server) newToolbox() *toolbox.Toolbox {
+	t := &toolbox.Toolbox{
+		Logger:         logrus.New(),
+		TracerLogger:   appsectracing.NewTracerLogger(nil, nil),
+		SSOHostURL:     s.ssoHostURL,
+		Modules:        s.metadata,
+		JobStore:       jobstore.BackendBolt,
+		JobStorePath:   s.storePath,
+		JobBucketName:  localJobBucket,
+		JobObjectsPath: s.objectsPath,
+		AsherahSession: map[string]*appencryption.Session{},
+	}
+	if s.AcceptAnyJWT {
+		t.JWTValidator = validateJWT
+	}
+	t.SetHTTPClient(&http.Client{Timeout: moduleHTTPTimeout})
+	t.AsherahSessionFactory = appencryption.NewSessionFactory(
+		&appencryption.Config{
+			Service: "ThreatAPI",
+			Product: "Threat Research",
+			Policy:  appencryption.NewCryptoPolicy(),
+		},
+		s.store,
+		s.kms,
+		aead.NewAES256GCM(),
+	)
+	return t
+}
+
+// closeToolbox closes the encryption sessions of a toolbox of the modules.
+// The tracer is shared by every toolbox, and is left to the manager to close.
+func closeToolbox(ctx context.Context, t *toolbox.Toolbox) {
+	if err := t.CloseAsherahSessions(ctx); err != nil {
+		t.Logger.WithError(err).Error("error closing asherah sessions")
+	}
+	if err := t.AsherahSessionFactory.Close(); err != nil {
+		t.Logger.WithError(err).Error("error closing asherah session factory")
+	}
+}
+
+// validateJWT accepts any JWT, for development without SSO.
+// Requests are made as the account of the JWT if it has one, and as the local user otherwise.
+func validateJWT(ctx context.Context, jwt string) (*gdtoken.Token, error) {
+	if token, err := gdtoken.FromStringV2(jwt); err == nil && token.BaseToken.AccountName != "" {
+		return token, nil
+	}
+	return &gdtoken.Token{BaseToken: gdtoken.BaseToken{AccountName: localUsername}}, nil
+}
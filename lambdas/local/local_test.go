@@ -0,0 +1,215 @@
+package local
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	modules, err := LoadFixtureModules("testdata/fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := NewServer(filepath.Join(dir, "threatapi.db"), modules...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.AcceptAnyJWT = true
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(func() {
+		httpServer.Close()
+		server.Close()
+		os.RemoveAll(dir)
+	})
+	return httpServer
+}
+
+// localJob is the status of a job and the responses of its modules
+type localJob struct {
+	JobID     string                     `json:"jobId"`
+	JobStatus string                     `json:"jobStatus"`
+	Responses map[string]json.RawMessage `json:"responses"`
+}
+
+// runTestJob creates a job with this submission and polls it until its modules finished, like clients do
+func runTestJob(t *testing.T, httpServer *httptest.Server, submission string) localJob {
+	response, err := http.Post(httpServer.URL+"/v1/jobs", "application/json", strings.NewReader(submission))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	job := localJob{}
+	if err := json.NewDecoder(response.Body).Decode(&job); err != nil || job.JobID == "" {
+		t.Fatalf("expected the job to be created, got %d %v", response.StatusCode, err)
+	}
+
+	for deadline := time.Now().Add(time.Second * 10); job.JobStatus != "Completed"; time.Sleep(time.Millisecond * 50) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the job to complete, got %q", job.JobStatus)
+		}
+		response, err := http.Get(httpServer.URL + "/v1/jobs/" + job.JobID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = json.NewDecoder(response.Body).Decode(&job)
+		response.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return job
+}
+
+func TestServerJob(t *testing.T) {
+	httpServer := newTestServer(t)
+	job := runTestJob(t, httpServer, `{"iocType":"DOMAIN","iocs":["example.com","example.org"],"modules":["fixture"]}`)
+
+	triageDatas := []struct {
+		Title   string
+		Data    string
+		IOCType string `json:"iocType"`
+	}{}
+	if err := json.Unmarshal(job.Responses["fixture"], &triageDatas); err != nil {
+		t.Fatalf("expected the response of the module, got %s", job.Responses["fixture"])
+	}
+	if len(triageDatas) != 1 || triageDatas[0].Title != "Example" || triageDatas[0].IOCType != "DOMAIN" {
+		t.Errorf("expected the fixture of the IOC, got %+v", triageDatas)
+	}
+
+	// The job is listed with the jobs of the local user
+	response, err := http.Get(httpServer.URL + "/v1/jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, _ := ioutil.ReadAll(response.Body)
+	if response.StatusCode != http.StatusOK || !strings.Contains(string(body), job.JobID) {
+		t.Errorf("expected the job to be listed, got %d %s", response.StatusCode, body)
+	}
+}
+
+func TestServerModules(t *testing.T) {
+	httpServer := newTestServer(t)
+
+	response, err := http.Get(httpServer.URL + "/v1/modules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body, _ := ioutil.ReadAll(response.Body)
+	if !strings.Contains(string(body), `"fixture":{"supportedIOCTypes":["DOMAIN"]`) {
+		t.Errorf("expected the fixture module, got %s", body)
+	}
+
+	// Jobs that aren't in the job store aren't owned by anyone
+	response, err = http.Post(httpServer.URL+"/v1/jobs/job/cancel", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusForbidden {
+		t.Errorf("expected cancelling an unknown job to be forbidden, got %d", response.StatusCode)
+	}
+}
+
+func TestServerJobRoutes(t *testing.T) {
+	httpServer := newTestServer(t)
+	job := runTestJob(t, httpServer, `{"iocType":"DOMAIN","iocs":["example.com"],"modules":["fixture"]}`)
+
+	request := func(method string, path string) (int, string) {
+		httpRequest, err := http.NewRequest(method, httpServer.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, err := http.DefaultClient.Do(httpRequest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		body, _ := ioutil.ReadAll(response.Body)
+		return response.StatusCode, string(body)
+	}
+
+	// The job is found by its IOC
+	if statusCode, body := request(http.MethodGet, "/v1/iocs/EXAMPLE.com/jobs"); statusCode != http.StatusOK || !strings.Contains(body, job.JobID) {
+		t.Errorf("expected the job to be found by its IOC, got %d %s", statusCode, body)
+	}
+	// There are no quotas without AWS
+	if statusCode, body := request(http.MethodGet, "/v1/usage"); statusCode != http.StatusOK || body != `{"modules":[],"user":[]}` {
+		t.Errorf("expected no usage, got %d %s", statusCode, body)
+	}
+	// Nothing failed, so there is nothing to retry
+	if statusCode, body := request(http.MethodPost, "/v1/jobs/"+job.JobID+"/retry"); statusCode != http.StatusConflict {
+		t.Errorf("expected no modules to retry, got %d %s", statusCode, body)
+	}
+	if statusCode, body := request(http.MethodPost, "/v1/jobs/"+job.JobID+"/cancel"); statusCode != http.StatusOK {
+		t.Errorf("expected the job to be cancelled, got %d %s", statusCode, body)
+	}
+	if statusCode, body := request(http.MethodPost, "/v1/jobs/"+job.JobID+"/retry"); statusCode != http.StatusConflict || body != "Job is cancelled" {
+		t.Errorf("expected cancelled jobs not to be retried, got %d %s", statusCode, body)
+	}
+}
+
+func TestServerLargeResponse(t *testing.T) {
+	defer func(maxInlineResponseSize int) { common.MaxInlineResponseSize = maxInlineResponseSize }(common.MaxInlineResponseSize)
+	common.MaxInlineResponseSize = 10
+	httpServer := newTestServer(t)
+
+	// The response is stored next to the job store and loaded back with the job
+	job := runTestJob(t, httpServer, `{"iocType":"DOMAIN","iocs":["example.com"],"modules":["fixture"]}`)
+	if !strings.Contains(string(job.Responses["fixture"]), `"Title":"Example"`) {
+		t.Errorf("expected the large response of the module, got %s", job.Responses["fixture"])
+	}
+}
+
+func TestServerJWT(t *testing.T) {
+	httpServer := newTestServer(t)
+	httpServer.Config.Handler.(*Server).AcceptAnyJWT = false
+
+	httpRequest, _ := http.NewRequest(http.MethodGet, httpServer.URL+"/v1/jobs", nil)
+	httpRequest.Header.Set("Authorization", "sso-jwt not-a-jwt")
+	response, err := http.DefaultClient.Do(httpRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	// The manager fails requests with invalid JWTs, the API gateway hides why
+	if response.StatusCode == http.StatusOK {
+		t.Errorf("expected JWTs to be validated unless any JWT is accepted, got %d", response.StatusCode)
+	}
+}
+
+func TestMatchResource(t *testing.T) {
+	tests := []struct {
+		path           string
+		resource       string
+		pathParameters map[string]string
+	}{
+		{"/v1/jobs", "/v1/jobs", map[string]string{}},
+		{"/v1/jobs/job/", "/v1/jobs/{jobId}", map[string]string{"jobId": "job"}},
+		{"/v1/jobs/job/export", "/v1/jobs/{jobId}/export", map[string]string{"jobId": "job"}},
+		{"/v1/iocs/https:%2F%2Fexample.com%2F/jobs", "/v1/iocs/{ioc}/jobs", map[string]string{"ioc": "https://example.com/"}},
+		{"/v1/jobs/job/unknown", "", nil},
+		{"/v2/jobs", "", nil},
+	}
+	for _, test := range tests {
+		resource, pathParameters, _ := matchResource(test.path)
+		if resource != test.resource || !reflect.DeepEqual(pathParameters, test.pathParameters) {
+			t.Errorf("expected %s to match %s %v, got %s %v", test.path, test.resource, test.pathParameters, resource, pathParameters)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
+	"github.com/sirupsen/logrus"
+)
+
+// publishJob queues a new job for the modules, in place of the job requests SNS topic
+func (s *Server) publishJob(ctx context.Context, message common.JobSNSMessage) error {
+	select {
+	case s.jobRequests <- message:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// dispatchJobs sends every job to every module, like the subscriptions of the modules to the job requests SNS topic
+func (s *Server) dispatchJobs() {
+	defer close(s.dispatcherDone)
+	for message := range s.jobRequests {
+		for _, module := range s.modules {
+			s.modulesRunning.Add(1)
+			go func(module triage.Module, message common.JobSNSMessage) {
+				defer s.modulesRunning.Done()
+				s.runModule(module, message)
+			}(module, message)
+		}
+	}
+}
+
+// runModule runs a module on a job the same way as its lambda, and queues its response to be stored
+func (s *Server) runModule(module triage.Module, message common.JobSNSMessage) {
+	t := s.newToolbox()
+	defer closeToolbox(s.ctx, t)
+	moduleName := module.GetDocs().Name
+
+	messageMarshalled, err := json.Marshal(message)
+	if err != nil {
+		s.Logger.WithError(err).Error("error marshalling job message")
+		return
+	}
+	completedJobs, err := triagelegacyconnector.AWSToTriage(s.ctx, t, module, events.SNSEvent{
+		Records: []events.SNSEventRecord{{SNS: events.SNSEntity{Message: string(messageMarshalled)}}},
+	})
+	if err != nil {
+		// Like a failed lambda invocation, the job shouldn't be left waiting on this module
+		s.Logger.WithFields(logrus.Fields{"jobID": message.JobID, "moduleName": moduleName}).WithError(err).Error("error running module")
+		if !moduleRequested(message, moduleName) {
+			return
+		}
+		response, _ := json.Marshal([]map[string]string{{"error": err.Error()}})
+		completedJobs = []*common.CompletedJobData{{
+			ModuleName: moduleName,
+			JobID:      message.JobID,
+			Response:   string(response),
+			Status: &common.ModuleStatus{
+				Status:    common.ModuleFailed,
+				ErrorCode: common.ModuleErrorCodeLambdaFailure,
+				Retryable: true,
+				EndTime:   common.EpochTime(time.Now()),
+			},
+		}}
+	}
+	for _, completedJob := range completedJobs {
+		s.completedJobs <- completedJob
+	}
+}
+
+// moduleRequested returns true if the job requested this module
+func moduleRequested(message common.JobSNSMessage, moduleName string) bool {
+	jobSubmission, err := common.GetJobSubmission(message.Submission)
+	if err != nil {
+		return false
+	}
+	for _, requestedModule := range jobSubmission.Modules {
+		if requestedModule == moduleName {
+			return true
+		}
+	}
+	return false
+}
+
+// storeResponses stores the responses of the modules, in place of the response processor
+func (s *Server) storeResponses() {
+	defer close(s.responsesStored)
+	for completedJob := range s.completedJobs {
+		err := s.storeResponse(context.Background(), completedJob)
+		if err != nil {
+			s.Logger.WithFields(logrus.Fields{"jobID": completedJob.JobID, "moduleName": completedJob.ModuleName}).WithError(err).Error("error storing module response")
+		}
+	}
+}
+
+// storeResponse encrypts the response of a module and adds it to its job, the same way as the response processor.
+// Jobs are not called back when they finish, callbacks need the jobs table.
+func (s *Server) storeResponse(ctx context.Context, completedJob *common.CompletedJobData) error {
+	// Convert blank responses to blank lists
+	if completedJob.Response == "" && completedJob.ResponseReference == nil {
+		completedJob.Response = "[]"
+	}
+	// Modules that don't report a status finished successfully if they sent us a response
+	if completedJob.Status == nil {
+		completedJob.Status = &common.ModuleStatus{
+			Status:  common.ModuleSucceeded,
+			EndTime: common.EpochTime(time.Now()),
+		}
+	}
+
+	t := s.newToolbox()
+	defer closeToolbox(ctx, t)
+	encryptedData, err := t.Encrypt(ctx, completedJob.JobID, []byte(completedJob.StoredResponse()))
+	if err != nil {
+		return fmt.Errorf("error encrypting response: %w", err)
+	}
+	return s.store.UpdateResponse(ctx, completedJob.JobID, completedJob.ModuleName, *encryptedData, completedJob.Status)
+}
@@ -1,13 +1,15 @@
-package main
+package api
 
 import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"strings"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/gdcorp-infosec/go-ioc/ioc"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
 )
 
@@ -105,3 +107,60 @@ func getIOCsTypes(iocs []string) map[triage.IOCType][]string {
 
 	return iocsMap
 }
+
+// normalizeIOC returns the IOC the way it is compared across jobs, so the same IOC submitted differently still matches.
+// IOCs are refanged and classified like submissions, lowercased, and URLs lose what doesn't change where they point to,
+// so "hxxps://Example[.]com:443/" and "https://example.com" are the same.
+func normalizeIOC(iocInput string) string {
+	iocInput = strings.TrimSpace(iocInput)
+	iocParsed := ioc.ParseIOC(iocInput)
+	if iocParsed == nil || iocParsed.Type == ioc.Unknown || iocParsed.IOC == "" {
+		return strings.ToLower(iocInput)
+	}
+	if iocParsed.Type == ioc.URL {
+		return strings.ToLower(canonicalURL(iocParsed.IOC))
+	}
+	return strings.ToLower(iocParsed.IOC)
+}
+
+// canonicalURL drops the default port, the fragment and a bare trailing slash of a URL
+func canonicalURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if port := u.Port(); (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		u.Host = u.Hostname()
+	}
+	u.Fragment = ""
+	if u.Path == "/" && u.RawQuery == "" {
+		u.Path = ""
+	}
+	return u.String()
+}
+
+// classifySubmission detects the IOC types of a job submission that doesn't specify an iocType,
+// grouping the IOCs by type so each module only receives the IOCs it supports.
+// The body is returned unchanged if it already specifies the IOC types, or can't be parsed.
+func classifySubmission(body string) string {
+	jobSubmission := common.JobSubmission{}
+	err := json.Unmarshal([]byte(body), &jobSubmission)
+	if err != nil || jobSubmission.IOCType != "" || len(jobSubmission.IOCGroups) > 0 {
+		return body
+	}
+
+	// Keep everything else (metadata etc.) the submitter sent us
+	submission := map[string]interface{}{}
+	err = json.Unmarshal([]byte(body), &submission)
+	if err != nil {
+		return body
+	}
+	submission["iocGroups"] = getIOCsTypes(jobSubmission.IOCs)
+
+	submissionMarshalled, err := json.Marshal(submission)
+	if err != nil {
+		return body
+	}
+	return string(submissionMarshalled)
+}
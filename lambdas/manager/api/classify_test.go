@@ -0,0 +1,85 @@
+package api
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
+)
+
+func TestGetIOCsTypes(t *testing.T) {
+	tests := map[triage.IOCType][]string{
+		triage.URLType:               {"https://test.net/click?upn=2O3VkQHsxfsYUWZiYC6-2Bl8IM6", "https://test.net/click?upn=2O3VkQHsxfsYUWZiYC6-M1015"},
+		triage.MitreMatrixType:       {"MA1056"},
+		triage.MitreTacticType:       {"TA0043"},
+		triage.MitreTechniqueType:    {"T1548"},
+		triage.MitreSubTechniqueType: {"T1548.004"},
+		triage.MitreMitigationType:   {"M1015"},
+		triage.MitreGroupType:        {"G0130"},
+		triage.MitreSoftwareType:     {"S0066"},
+		triage.DomainType:            {"TA0043.004.com"},
+		triage.UnknownType:           {"M6"},
+	}
+
+	var testIOCs []string
+	for _, test := range tests {
+		testIOCs = append(testIOCs, test...)
+	}
+
+	results := getIOCsTypes(testIOCs)
+
+	if !reflect.DeepEqual(tests, results) {
+		t.Fatal("results don't match test cases")
+	}
+}
+
+func TestClassifySubmission(t *testing.T) {
+	tests := []struct {
+		Name           string
+		Body           string
+		ExpectedGroups map[triage.IOCType][]string
+	}{
+		{
+			Name:           "mixed types",
+			Body:           `{"modules":["whois"],"iocs":["godaddy.com","https://godaddy.com"],"metadata":{"name":"test"}}`,
+			ExpectedGroups: map[triage.IOCType][]string{triage.DomainType: {"godaddy.com"}, triage.URLType: {"https://godaddy.com"}},
+		},
+		{
+			Name: "typed submission",
+			Body: `{"modules":["whois"],"iocs":["godaddy.com"],"iocType":"DOMAIN"}`,
+		},
+		{
+			Name: "invalid body",
+			Body: `not json`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			body := classifySubmission(test.Body)
+			if test.ExpectedGroups == nil {
+				if body != test.Body {
+					t.Errorf("expected body to be unchanged, got %s", body)
+				}
+				return
+			}
+
+			submission := struct {
+				common.JobSubmission
+				Metadata map[string]interface{} `json:"metadata"`
+			}{}
+			err := json.Unmarshal([]byte(body), &submission)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(submission.IOCGroups, test.ExpectedGroups) {
+				t.Errorf("expected groups %v but got %v", test.ExpectedGroups, submission.IOCGroups)
+			}
+			if submission.Metadata["name"] != "test" {
+				t.Errorf("expected metadata to be kept, got %v", submission.Metadata)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
+)
+
+// jobExporter converts a decrypted job to a format other tools can import
+type jobExporter struct {
+	ContentType string
+	Extension   string
+	Export      func(jobEntry *common.JobDBEntry) ([]byte, error)
+}
+
+// jobExporters are the formats jobs can be exported to, by the name used in the format query parameter
+var jobExporters = map[string]jobExporter{
+	"stix": {ContentType: "application/stix+json;version=2.1", Extension: "stix.json", Export: exportSTIX},
+	"misp": {ContentType: "application/json", Extension: "misp.json", Export: exportMISP},
+	"md":   {ContentType: "text/markdown; charset=utf-8", Extension: "md", Export: exportMarkdown},
+	"html": {ContentType: "text/html; charset=utf-8", Extension: "html", Export: exportHTML},
+}
+
+// exportFormats returns the sorted names of the formats jobs can be exported to
+func exportFormats() []string {
+	formats := []string{}
+	for format := range jobExporters {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// exportJob replies with a job converted to the requested format
+func exportJob(ctx context.Context, request events.APIGatewayProxyRequest, jobID string) (events.APIGatewayProxyResponse, error) {
+	span, ctx := to.TracerLogger.StartSpan(ctx, "ExportJob", "job", "manager", "export")
+	span.LogKV("jobID", jobID)
+	defer span.End(ctx)
+
+	jwt, err := to.ValidateJWT(ctx, toolbox.GetJWTFromRequest(request))
+	if err != nil {
+		err = fmt.Errorf("error validating jwt: %w", err)
+		span.LogKV("error", err)
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusUnauthorized}, err
+	}
+	span.LogKV("username", jwt.BaseToken.AccountName)
+
+	if jobID == "" {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusBadRequest, Body: "Missing jobId"}, nil
+	}
+
+	format := strings.ToLower(request.QueryStringParameters["format"])
+	exporter, ok := jobExporters[format]
+	if !ok {
+		return events.APIGatewayProxyResponse{
+			StatusCode: http.StatusBadRequest,
+			Body:       fmt.Sprintf("Invalid format, must be one of: %s", strings.Join(exportFormats(), ", ")),
+		}, nil
+	}
+	span.LogKV("format", format)
+
+	jobDB, err := fetchJob(ctx, jobID)
+	if err != nil {
+		span.LogKV("error", err)
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
+	}
+	if jobDB == nil {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusNotFound}, nil
+	}
+
+	err = jobStore.LoadResponses(ctx, jobDB)
+	if err != nil {
+		span.LogKV("error", err)
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
+	}
+	jobDB.Decrypt(ctx, to)
+	if jobDB.DecryptedSubmission == nil {
+		err = fmt.Errorf("error decrypting the job submission")
+		span.LogKV("error", err)
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
+	}
+
+	exported, err := exporter.Export(jobDB)
+	if err != nil {
+		err = fmt.Errorf("error exporting job: %w", err)
+		span.LogKV("error", err)
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
+	}
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: http.StatusOK,
+		Headers: map[string]string{
+			"Content-Type":        exporter.ContentType,
+			"Content-Disposition": fmt.Sprintf("attachment; filename=\"%s.%s\"", jobID, exporter.Extension),
+		},
+		Body: string(exported),
+	}, nil
+}
+
+// getExportSubmission gets the submission of a decrypted job
+func getExportSubmission(jobEntry *common.JobDBEntry) (common.JobSubmission, error) {
+	jobSubmission := common.JobSubmission{}
+	submission, err := json.Marshal(jobEntry.DecryptedSubmission)
+	if err != nil {
+		return jobSubmission, err
+	}
+	err = json.Unmarshal(submission, &jobSubmission)
+	return jobSubmission, err
+}
+
+// getExportResponses gets the data every module of a decrypted job returned,
+// responses that aren't module data, like errors, are skipped
+func getExportResponses(jobEntry *common.JobDBEntry) map[string][]triage.Data {
+	ret := map[string][]triage.Data{}
+	for moduleName, response := range jobEntry.DecryptedResponses {
+		if _, ok := response.([]interface{}); !ok {
+			continue
+		}
+		responseData, err := json.Marshal(response)
+		if err != nil {
+			continue
+		}
+		datas := []triage.Data{}
+		if err = json.Unmarshal(responseData, &datas); err != nil {
+			continue
+		}
+		ret[moduleName] = datas
+	}
+	return ret
+}
+
+// sortedModules returns the module names of the responses in a stable order
+func sortedModules(responses map[string][]triage.Data) []string {
+	modules := []string{}
+	for moduleName := range responses {
+		modules = append(modules, moduleName)
+	}
+	sort.Strings(modules)
+	return modules
+}
+
+// jobStartTime returns when a job was started
+func jobStartTime(jobEntry *common.JobDBEntry) time.Time {
+	return time.Unix(0, int64(jobEntry.StartTime*float64(time.Second)))
+}
+
+// nameUUID returns the name based (version 5) UUID of a name in a namespace
+func nameUUID(namespace []byte, name string) string {
+	hash := sha1.New()
+	hash.Write(namespace)
+	hash.Write([]byte(name))
+	uuid := hash.Sum(nil)[:16]
+	uuid[6] = (uuid[6] & 0x0f) | 0x50
+	uuid[8] = (uuid[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:])
+}
+
+// mustParseUUID parses a UUID to its bytes
+func mustParseUUID(uuid string) []byte {
+	ret, err := hex.DecodeString(strings.ReplaceAll(uuid, "-", ""))
+	if err != nil || len(ret) != 16 {
+		panic(fmt.Sprintf("invalid uuid %s", uuid))
+	}
+	return ret
+}
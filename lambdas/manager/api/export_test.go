@@ -0,0 +1,91 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	. "github.com/agiledragon/gomonkey/v2"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/gdcorp-golang/auth/gdtoken"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/jobstore"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestExportJob(t *testing.T) {
+
+	Convey("exportJob", t, func() {
+		patches := []*Patches{}
+		ctx1 := context.Background()
+		actualDynamoDBClient := &dynamodb.DynamoDB{}
+		patches = append(patches, ApplyFunc(dynamodb.New,
+			func(p client.ConfigProvider, cfgs ...*aws.Config) *dynamodb.DynamoDB {
+				return actualDynamoDBClient
+			}))
+
+		to = toolbox.GetToolbox()
+		jobStore = jobstore.NewDynamoDBStore(to)
+		request := events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{"format": "STIX"}}
+
+		patches = append(patches, ApplyFunc(toolbox.GetJWTFromRequest,
+			func(request events.APIGatewayProxyRequest) string {
+				return "jwt"
+			}))
+		patches = append(patches, ApplyMethod(reflect.TypeOf(to), "ValidateJWT",
+			func(t *toolbox.Toolbox, ctx context.Context, token string) (*gdtoken.Token, error) {
+				return &gdtoken.Token{BaseToken: gdtoken.BaseToken{AccountName: "user"}}, nil
+			}))
+
+		jobID := "job 245y245"
+		var jobDB *common.JobDBEntry
+		patches = append(patches, ApplyFunc(fetchJob,
+			func(ctx context.Context, jobID string) (*common.JobDBEntry, error) {
+				return jobDB, nil
+			}))
+		patches = append(patches, ApplyMethod(reflect.TypeOf(&common.JobDBEntry{}), "LoadResponses",
+			func(job *common.JobDBEntry, ctx context.Context, box *toolbox.Toolbox) error {
+				return nil
+			}))
+		patches = append(patches, ApplyMethod(reflect.TypeOf(&common.JobDBEntry{}), "Decrypt",
+			func(job *common.JobDBEntry, ctx context.Context, box *toolbox.Toolbox) {
+				job.DecryptedSubmission = map[string]interface{}{"iocType": "domain", "iocs": []interface{}{"godaddy.com"}}
+			}))
+
+		Reset(func() {
+			for i := len(patches) - 1; i >= 0; i-- {
+				patches[i].Reset()
+			}
+			jobStore = nil
+		})
+
+		Convey("should reject unknown formats", func() {
+			request.QueryStringParameters["format"] = "pdf"
+			response, err := exportJob(ctx1, request, jobID)
+			So(err, ShouldBeNil)
+			So(response.StatusCode, ShouldEqual, http.StatusBadRequest)
+			So(response.Body, ShouldEqual, "Invalid format, must be one of: html, md, misp, stix")
+		})
+
+		Convey("should return not found for unknown jobs", func() {
+			response, err := exportJob(ctx1, request, jobID)
+			So(err, ShouldBeNil)
+			So(response.StatusCode, ShouldEqual, http.StatusNotFound)
+		})
+
+		Convey("should reply with the exported job", func() {
+			jobDB = &common.JobDBEntry{JobID: jobID, StartTime: 1610000000}
+			response, err := exportJob(ctx1, request, jobID)
+			So(err, ShouldBeNil)
+			So(response.StatusCode, ShouldEqual, http.StatusOK)
+			So(response.Headers["Content-Type"], ShouldEqual, "application/stix+json;version=2.1")
+			So(response.Headers["Content-Disposition"], ShouldEqual, `attachment; filename="job 245y245.stix.json"`)
+			So(response.Body, ShouldContainSubstring, `"type":"domain-name"`)
+		})
+	})
+}
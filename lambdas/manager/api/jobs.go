@@ -0,0 +1,861 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/gdcorp-golang/auth/gdtoken"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/jobstore"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
+	"github.com/godaddy/asherah/go/appencryption"
+)
+
+// Build modified / simplified JobDBEntry for each job
+// Adding jobpercentage to the returned data for UI calculations
+type ResponseData struct {
+	JobDB         common.JobDBEntry
+	JobPercentage float64 `json:"jobPercentage"`
+}
+
+func encryptSubmission(box *toolbox.Toolbox, ctx context.Context, jobID string, body string) (*appencryption.DataRowRecord, error) {
+	span, ctx := box.TracerLogger.StartSpan(ctx, "EncryptSubmission", "job", "manager", "encrypt")
+	defer span.End(ctx)
+	span.LogKV("jobID", jobID)
+
+	encryptedData, err := box.Encrypt(ctx, jobID, []byte(body))
+	if err != nil {
+		span.LogKV("error", err)
+		return nil, fmt.Errorf("error encrypting submission: %w", err)
+	}
+
+	return encryptedData, nil
+}
+
+func countTopicSubscriptions(box *toolbox.Toolbox, ctx context.Context, snsClient *sns.SNS) (int, string, error) {
+	span, ctx := box.TracerLogger.StartSpan(ctx, "GetSNSTopicInfo", "job", "sns", "getinfo")
+	defer span.End(ctx)
+
+	topicARN, err := box.GetFromParameterStore(ctx, snsTopicARNParameterName, false)
+	if err != nil || topicARN.Value == nil {
+		span.LogKV("error", fmt.Errorf("error getting SNS topic ARN: %w", err))
+		return 0, "", err
+	}
+
+	// Count total subscriptions to the SNS topic
+	// Note this may only work up to 100 subscriptions
+	subscriptionsOutput, err := snsClient.ListSubscriptionsByTopic(&sns.ListSubscriptionsByTopicInput{
+		TopicArn: topicARN.Value,
+	})
+	if err != nil {
+		span.LogKV("error", fmt.Errorf("error getting SNS topic subscriptions: %w", err))
+		return 0, "", err
+	}
+	totalModuleCount := len(subscriptionsOutput.Subscriptions)
+	span.LogKV("SNSSubscriptionSize", totalModuleCount)
+
+	return totalModuleCount, *topicARN.Value, nil
+}
+
+func storeRequestedModulesList(box *toolbox.Toolbox, ctx context.Context, jwt *gdtoken.Token, request *events.APIGatewayProxyRequest, originRequester string, jobID string, encryptedData *appencryption.DataRowRecord) error {
+	span, ctx := box.TracerLogger.StartSpan(ctx, "StoreJob", "job", "manager", "store")
+	defer span.End(ctx)
+	span.LogKV("jobID", jobID)
+
+	jobSubmission, err := common.GetJobSubmission(*request)
+	if err != nil {
+		e := fmt.Errorf("error getting the jobSubmission: %w", err)
+		span.LogKV("error", e)
+		return e
+	}
+
+	now := time.Now()
+	jobEntry := &common.JobDBEntry{
+		JobID:           jobID,
+		Username:        jwt.BaseToken.AccountName,
+		OriginRequester: originRequester,
+		StartTime:       float64(now.Unix()),
+		TTL:             now.Add(common.JobTTL).Unix(),
+		Submission:      *encryptedData,
+		Responses:       map[string]appencryption.DataRowRecord{},
+		// Every requested module starts out pending until it picks up the job
+		RequestedModules: jobSubmission.Modules,
+		ModuleStatuses:   common.NewPendingModuleStatuses(jobSubmission.Modules),
+		// The IOC types, tags and metadata are stored unencrypted so jobs can be listed without decrypting them.
+		// The IOC types are always stored, even if empty, to tell these jobs apart from older ones.
+		IOCTypes: getSubmissionIOCTypes(jobSubmission),
+		// The callback URL stays in the encrypted submission, the response processor only needs to know there is one
+		Callback: jobSubmission.CallbackURL != "",
+	}
+	if len(jobSubmission.Tags) > 0 {
+		jobEntry.Tags = jobSubmission.Tags
+	}
+	if len(jobSubmission.Metadata) > 0 {
+		jobEntry.Metadata = jobSubmission.Metadata
+	}
+	err = jobStore.CreateJob(ctx, jobEntry)
+	if err != nil {
+		span.LogKV("error", err)
+		return err
+	}
+
+	return nil
+}
+
+func publishToSns(box *toolbox.Toolbox, ctx context.Context, message common.JobSNSMessage, snsClient *sns.SNS, topicARN string) error {
+	span, ctx := box.TracerLogger.StartSpan(ctx, "SendSNS", "job", "manager", "sendsns")
+	defer span.End(ctx)
+	span.LogKV("jobID", message.JobID)
+
+	// Marshal body
+	submissionMarshalled, err := json.Marshal(message)
+	if err != nil {
+		span.LogKV("error", err)
+		return err
+	}
+	submissionMarshalledString := string(submissionMarshalled)
+
+	// Send the entire request marshalled along with the jobID
+	_, err = snsClient.Publish(&sns.PublishInput{
+		Message:  &submissionMarshalledString,
+		TopicArn: &topicARN,
+	})
+	if err != nil {
+		span.LogKV("error", err)
+		return err
+	}
+
+	return nil
+}
+
+// createJob creates a new job ID in dynamo DB and sends it to the appropriate SNS topics
+func createJob(box *toolbox.Toolbox, ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	span, ctx := box.TracerLogger.StartSpan(ctx, "CreateJob", "job", "manager", "create")
+	defer span.End(ctx)
+
+	// Generate jobID
+	jobID := box.GenerateJobID(ctx)
+	span.LogKV("jobID", jobID)
+
+	// Retrieve the requester username from the JWT
+	jwt, err := box.ValidateJWT(ctx, toolbox.GetJWTFromRequest(request))
+	if err != nil {
+		return events.APIGatewayProxyResponse{StatusCode: 401}, err
+	}
+	originRequester := toolbox.GetOriginalRequester(request)
+	if originRequester != "" {
+		span.LogKV("username", originRequester+"-proxy")
+	} else {
+		span.LogKV("username", jwt.BaseToken.AccountName)
+	}
+
+	// We only call back to public https URLs, the notification is signed but not encrypted
+	callback := false
+	if jobSubmission, err := common.GetJobSubmission(request); err == nil && jobSubmission.CallbackURL != "" {
+		err = common.ValidateCallbackURL(ctx, jobSubmission.CallbackURL)
+		if err != nil {
+			span.LogKV("error", err)
+			return events.APIGatewayProxyResponse{StatusCode: 400, Body: "Invalid callbackUrl"}, nil
+		}
+		callback = true
+	}
+
+	// Submissions without an IOC type can mix types, group them by type for the modules
+	request.Body = classifySubmission(request.Body)
+
+	// Modules without enough quota left for this job are left out of it, the job is rejected if no module is left
+	var modules []string
+	var trimmedModules map[string]string
+	request.Body, modules, trimmedModules = trimModulesOverQuota(box, ctx, jwt.BaseToken.AccountName, request.Body)
+	if len(trimmedModules) > 0 && len(modules) == 0 {
+		responseBytes, _ := json.Marshal(struct {
+			Error          string            `json:"error"`
+			TrimmedModules map[string]string `json:"trimmedModules"`
+		}{Error: "no module has enough quota left for this job", TrimmedModules: trimmedModules})
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusTooManyRequests, Body: string(responseBytes)}, nil
+	}
+
+	encryptedData, err := encryptSubmission(box, ctx, jobID, request.Body)
+	if err != nil {
+		return events.APIGatewayProxyResponse{StatusCode: 500}, err
+	}
+
+	// Local runs hand the job to their modules directly
+	var snsClient *sns.SNS
+	var topicARN string
+	if PublishJob == nil {
+		snsClient = sns.New(box.AWSSession)
+		var subscriptionsCount int
+		subscriptionsCount, topicARN, err = countTopicSubscriptions(box, ctx, snsClient)
+		if err != nil {
+			return events.APIGatewayProxyResponse{StatusCode: 500}, err
+		}
+		span.LogKV("subscriptionsCount", subscriptionsCount)
+	}
+
+	err = storeRequestedModulesList(box, ctx, jwt, &request, originRequester, jobID, encryptedData)
+	if err != nil {
+		return events.APIGatewayProxyResponse{StatusCode: 500}, err
+	}
+
+	// Sightings are only used to find this job again by its IOCs, the job runs fine without them
+	err = storeIOCSightings(box, ctx, jwt.BaseToken.AccountName, jobID, request)
+	if err != nil {
+		box.Logger.WithError(err).Error("error storing IOC sightings")
+	}
+
+	message := common.JobSNSMessage{Submission: request, JobID: jobID, Username: jwt.BaseToken.AccountName}
+	if PublishJob != nil {
+		err = PublishJob(ctx, message)
+	} else {
+		err = publishToSns(box, ctx, message, snsClient, topicARN)
+	}
+	if err != nil {
+		return events.APIGatewayProxyResponse{StatusCode: 500}, err
+	}
+	if callback {
+		scheduleCallbackTimeout(box, ctx, jobID)
+	}
+
+	response := struct {
+		JobID string `json:"jobId"`
+		// The modules left out of the job, and why
+		TrimmedModules map[string]string `json:"trimmedModules,omitempty"`
+	}{JobID: jobID, TrimmedModules: trimmedModules}
+	responseBytes, _ := json.Marshal(response)
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Body:       string(responseBytes),
+	}, nil
+}
+
+// scheduleCallbackTimeout makes sure the job is called back once it times out, even if some of its modules never report.
+// The job still runs without it, so errors are only logged.
+func scheduleCallbackTimeout(box *toolbox.Toolbox, ctx context.Context, jobID string) {
+	// Local runs don't call back jobs
+	if PublishJob != nil {
+		return
+	}
+	err := common.EnqueueJobCallback(ctx, box, jobID, common.JobTimeout)
+	if err != nil {
+		box.Logger.WithError(err).WithField("jobID", jobID).Error("error scheduling the job callback")
+	}
+}
+
+// deleteJob deletes a job by JobID
+func deleteJob(ctx context.Context, request events.APIGatewayProxyRequest, jobID string) (events.APIGatewayProxyResponse, error) {
+	span, ctx := to.TracerLogger.StartSpan(ctx, "DeleteJob", "job", "manager", "delete")
+	span.LogKV("job_id", jobID)
+	defer span.End(ctx)
+
+	// Check to make sure this user owns this job
+
+	// Check JWT
+	jwt, err := to.ValidateJWT(ctx, toolbox.GetJWTFromRequest(request))
+	if err != nil {
+		err = fmt.Errorf("error validating jwt: %w", err)
+		span.LogKV("error", err)
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusUnauthorized}, err
+	}
+
+	// Check this user owns this job
+	span.LogKV("username", jwt.BaseToken.AccountName)
+	jobDB, err := fetchJob(ctx, jobID)
+	if err != nil {
+		err = fmt.Errorf("error getting job from DB: %w", err)
+		span.LogKV("error", err)
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
+	}
+	if jobDB == nil || jobDB.Username != jwt.BaseToken.AccountName {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusForbidden}, nil
+	}
+
+	// Delete the job and its responses
+	err = jobStore.DeleteJob(ctx, jobID)
+	if err != nil {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, fmt.Errorf("error deleting job in DB: %w", err)
+	}
+
+	return events.APIGatewayProxyResponse{StatusCode: http.StatusOK}, nil
+}
+
+// findOwnedJob gets this job from the DB if this username owns it.
+// It returns nil if there is no such job or this user does not own it.
+func findOwnedJob(ctx context.Context, username string, jobID string) (*common.JobDBEntry, error) {
+	span, ctx := to.TracerLogger.StartSpan(ctx, "FindOwnedJob", "job", "manager", "findowned")
+	defer span.End(ctx)
+
+	jobDB, err := jobStore.GetJob(ctx, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting job from db: %w", err)
+	}
+	if jobDB == nil || jobDB.Username != username {
+		return nil, nil
+	}
+	return jobDB, nil
+}
+
+// retryJob re-runs the modules of a job that failed or never finished
+func retryJob(ctx context.Context, request events.APIGatewayProxyRequest, jobID string) (events.APIGatewayProxyResponse, error) {
+	span, ctx := to.TracerLogger.StartSpan(ctx, "RetryJob", "job", "manager", "retry")
+	span.LogKV("jobID", jobID)
+	defer span.End(ctx)
+
+	jwt, err := to.ValidateJWT(ctx, toolbox.GetJWTFromRequest(request))
+	if err != nil {
+		err = fmt.Errorf("error validating jwt: %w", err)
+		span.LogKV("error", err)
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusUnauthorized}, err
+	}
+
+	// Check to make sure this user owns this job
+	span.LogKV("username", jwt.BaseToken.AccountName)
+	jobDB, err := findOwnedJob(ctx, jwt.BaseToken.AccountName, jobID)
+	if err != nil {
+		span.LogKV("error", err)
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
+	}
+	if jobDB == nil {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusForbidden}, nil
+	}
+
+	// Jobs created before module statuses were added find their failed modules in their responses
+	if len(jobDB.ModuleStatuses) == 0 {
+		err = jobStore.LoadResponses(ctx, jobDB)
+		if err != nil {
+			span.LogKV("error", err)
+			return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
+		}
+	}
+	jobDB.Decrypt(ctx, to)
+	if jobDB.DecryptedSubmission == nil {
+		err = fmt.Errorf("error decrypting the job submission")
+		span.LogKV("error", err)
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
+	}
+
+	if jobDB.Cancelled {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusConflict, Body: "Job is cancelled"}, nil
+	}
+
+	retryModules := getRetryableModules(ctx, jobDB)
+	span.LogKV("retryModules", retryModules)
+	if len(retryModules) == 0 {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusConflict, Body: "No failed modules to retry"}, nil
+	}
+
+	err = resetModules(ctx, jobDB, retryModules)
+	if err != nil {
+		span.LogKV("error", err)
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
+	}
+
+	// Send the original submission again, restricted to the modules we are retrying
+	err = publishToModules(ctx, request, jobDB, retryModules)
+	if err != nil {
+		span.LogKV("error", err)
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
+	}
+	if jobDB.Callback {
+		scheduleCallbackTimeout(to, ctx, jobID)
+	}
+
+	responseBytes, _ := json.Marshal(jobModulesResponse{JobID: jobID, Modules: retryModules})
+	return events.APIGatewayProxyResponse{StatusCode: http.StatusOK, Body: string(responseBytes)}, nil
+}
+
+// extendJob adds modules to an existing job, running them on the same submission
+func extendJob(ctx context.Context, request events.APIGatewayProxyRequest, jobID string) (events.APIGatewayProxyResponse, error) {
+	span, ctx := to.TracerLogger.StartSpan(ctx, "ExtendJob", "job", "manager", "extend")
+	span.LogKV("jobID", jobID)
+	defer span.End(ctx)
+
+	jwt, err := to.ValidateJWT(ctx, toolbox.GetJWTFromRequest(request))
+	if err != nil {
+		err = fmt.Errorf("error validating jwt: %w", err)
+		span.LogKV("error", err)
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusUnauthorized}, err
+	}
+
+	extension := struct {
+		Modules []string `json:"modules"`
+	}{}
+	err = json.Unmarshal([]byte(request.Body), &extension)
+	if err != nil || len(extension.Modules) == 0 {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusBadRequest, Body: "Missing modules"}, nil
+	}
+
+	// Check to make sure this user owns this job
+	span.LogKV("username", jwt.BaseToken.AccountName)
+	jobDB, err := findOwnedJob(ctx, jwt.BaseToken.AccountName, jobID)
+	if err != nil {
+		span.LogKV("error", err)
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
+	}
+	if jobDB == nil {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusForbidden}, nil
+	}
+
+	jobDB.Decrypt(ctx, to)
+	if jobDB.DecryptedSubmission == nil {
+		err = fmt.Errorf("error decrypting the job submission")
+		span.LogKV("error", err)
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
+	}
+
+	if jobDB.Cancelled {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusConflict, Body: "Job is cancelled"}, nil
+	}
+
+	// Only run modules that aren't already part of this job
+	newModules := []string{}
+	for _, module := range extension.Modules {
+		if !stringInSlice(module, jobDB.RequestedModules) && !stringInSlice(module, newModules) {
+			newModules = append(newModules, module)
+		}
+	}
+	span.LogKV("newModules", newModules)
+	if len(newModules) == 0 {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusConflict, Body: "All modules are already part of this job"}, nil
+	}
+
+	err = addModules(ctx, jobDB, newModules)
+	if err != nil {
+		span.LogKV("error", err)
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
+	}
+
+	err = publishToModules(ctx, request, jobDB, newModules)
+	if err != nil {
+		span.LogKV("error", err)
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
+	}
+	if jobDB.Callback {
+		scheduleCallbackTimeout(to, ctx, jobID)
+	}
+
+	responseBytes, _ := json.Marshal(jobModulesResponse{JobID: jobID, Modules: newModules})
+	return events.APIGatewayProxyResponse{StatusCode: http.StatusOK, Body: string(responseBytes)}, nil
+}
+
+// cancelJob marks a job as cancelled, modules working on it stop and return the results they have so far
+func cancelJob(ctx context.Context, request events.APIGatewayProxyRequest, jobID string) (events.APIGatewayProxyResponse, error) {
+	span, ctx := to.TracerLogger.StartSpan(ctx, "CancelJob", "job", "manager", "cancel")
+	span.LogKV("jobID", jobID)
+	defer span.End(ctx)
+
+	jwt, err := to.ValidateJWT(ctx, toolbox.GetJWTFromRequest(request))
+	if err != nil {
+		err = fmt.Errorf("error validating jwt: %w", err)
+		span.LogKV("error", err)
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusUnauthorized}, err
+	}
+
+	// Check to make sure this user owns this job
+	span.LogKV("username", jwt.BaseToken.AccountName)
+	jobDB, err := findOwnedJob(ctx, jwt.BaseToken.AccountName, jobID)
+	if err != nil {
+		span.LogKV("error", err)
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
+	}
+	if jobDB == nil {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusForbidden}, nil
+	}
+
+	// Modules poll this flag while they work on the job
+	err = jobStore.CancelJob(ctx, jobDB.JobID)
+	if err != nil {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, fmt.Errorf("error cancelling job in DB: %w", err)
+	}
+
+	return events.APIGatewayProxyResponse{StatusCode: http.StatusOK}, nil
+}
+
+// jobModulesResponse is the response to a request that runs modules on an existing job
+type jobModulesResponse struct {
+	JobID   string   `json:"jobId"`
+	Modules []string `json:"modules"`
+}
+
+// publishToModules sends the decrypted submission of an existing job to SNS, restricted to these modules
+func publishToModules(ctx context.Context, request events.APIGatewayProxyRequest, jobEntry *common.JobDBEntry, modules []string) error {
+	jobEntry.DecryptedSubmission["modules"] = modules
+	submission, err := json.Marshal(jobEntry.DecryptedSubmission)
+	if err != nil {
+		return fmt.Errorf("error marshalling submission: %w", err)
+	}
+	request.Body = string(submission)
+
+	message := common.JobSNSMessage{Submission: request, JobID: jobEntry.JobID, Username: jobEntry.Username}
+	if PublishJob != nil {
+		return PublishJob(ctx, message)
+	}
+	snsClient := sns.New(to.AWSSession)
+	_, topicARN, err := countTopicSubscriptions(to, ctx, snsClient)
+	if err != nil {
+		return err
+	}
+	return publishToSns(to, ctx, message, snsClient, topicARN)
+}
+
+// addModules appends these modules to the requested modules of a job and marks them as pending.
+// The dispatch time is updated so the new modules get the full time to finish.
+func addModules(ctx context.Context, jobEntry *common.JobDBEntry, modules []string) error {
+	span, ctx := to.TracerLogger.StartSpan(ctx, "AddModules", "job", "manager", "addmodules")
+	defer span.End(ctx)
+
+	err := jobStore.AddModules(ctx, jobEntry, modules)
+	if err != nil {
+		return fmt.Errorf("error adding modules in DB: %w", err)
+	}
+	return nil
+}
+
+// getRetryableModules returns the requested modules of this job that failed, or never finished before the job timed out
+func getRetryableModules(ctx context.Context, jobEntry *common.JobDBEntry) []string {
+	// Computing the progress marks modules that never finished as timed out
+	jobStatus, _, _ := getJobProgress(ctx, jobEntry)
+
+	ret := []string{}
+	for _, module := range jobEntry.RequestedModules {
+		if len(jobEntry.ModuleStatuses) > 0 {
+			if status, ok := jobEntry.ModuleStatuses[module]; ok && status.Finished() && status.Retryable {
+				ret = append(ret, module)
+			}
+			continue
+		}
+
+		// Jobs created before module statuses were added
+		responseData, ok := jobEntry.DecryptedResponses[module]
+		switch {
+		case !ok || responseData == nil:
+			if jobStatus == JobIncomplete {
+				ret = append(ret, module)
+			}
+		case reflect.ValueOf(responseData).Kind() == reflect.Slice && moduleError(ctx, reflect.ValueOf(responseData)):
+			ret = append(ret, module)
+		}
+	}
+	return ret
+}
+
+// resetModules removes the responses of these modules and marks them as pending again.
+// The dispatch time is updated so the job doesn't immediately time out again.
+func resetModules(ctx context.Context, jobEntry *common.JobDBEntry, modules []string) error {
+	span, ctx := to.TracerLogger.StartSpan(ctx, "ResetModules", "job", "manager", "resetmodules")
+	defer span.End(ctx)
+
+	err := jobStore.ResetModules(ctx, jobEntry, modules)
+	if err != nil {
+		return fmt.Errorf("error resetting modules in DB: %w", err)
+	}
+	return nil
+}
+
+// getJob gets the job status from dynamoDB and send it as a response
+func getJob(ctx context.Context, request events.APIGatewayProxyRequest, jobID string) (events.APIGatewayProxyResponse, error) {
+	span, ctx := to.TracerLogger.StartSpan(ctx, "GetJobStatus", "job", "manager", "getstatus")
+	span.LogKV("jobID", jobID)
+	defer span.End(ctx)
+
+	jwt, err := to.ValidateJWT(ctx, toolbox.GetJWTFromRequest(request))
+	if err != nil {
+		err = fmt.Errorf("error validating jwt: %w", err)
+		span.LogKV("error", err)
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusUnauthorized}, err
+	}
+	span.LogKV("username", jwt.BaseToken.AccountName)
+
+	if jobID == "" {
+		return events.APIGatewayProxyResponse{StatusCode: 400}, nil
+	}
+
+	wait, since, err := getPollParameters(request)
+	if err != nil {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusBadRequest, Body: err.Error()}, nil
+	}
+
+	jobDB, err := fetchJob(ctx, jobID)
+	if err != nil {
+		span.LogKV("error", err)
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
+	}
+	if jobDB == nil {
+		return events.APIGatewayProxyResponse{StatusCode: 404}, nil
+	}
+
+	// Long polling, wait for modules to finish before replying
+	if wait > 0 {
+		jobDB, err = waitForJobUpdate(ctx, jobDB, since, wait)
+		if err != nil {
+			span.LogKV("error", err)
+			return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
+		}
+		if jobDB == nil {
+			return events.APIGatewayProxyResponse{StatusCode: 404}, nil
+		}
+	}
+
+	err = jobStore.LoadResponses(ctx, jobDB)
+	if err != nil {
+		span.LogKV("error", err)
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
+	}
+
+	// Asherah decrypt, skipping the responses the client already has
+	if since != nil && len(jobDB.ModuleStatuses) > 0 {
+		jobDB.DecryptModules(ctx, to, modulesFinishedSince(jobDB, since))
+	} else {
+		jobDB.Decrypt(ctx, to)
+	}
+
+	jobStatus, jobPercentage, err := getJobProgress(ctx, jobDB)
+	if err != nil {
+		to.Logger.WithError(err).Error("error getting job status")
+	}
+
+	// Clients pass the cursor back as since to only get the modules that finish after this
+	cursor := ""
+	if len(jobDB.ModuleStatuses) > 0 {
+		cursor = jobCursor(jobDB)
+	}
+
+	// Jobs with multiple IOC types also get their responses grouped by type
+	var responsesByType map[triage.IOCType]map[string][]interface{}
+	if _, ok := jobDB.DecryptedSubmission["iocGroups"]; ok {
+		responsesByType = groupResponsesByType(jobDB)
+	}
+
+	// Verdicts need the scores of every module, so only jobs that were fully decrypted get them
+	var verdicts []iocVerdict
+	if since == nil {
+		var modules map[string]toolbox.LambdaMetadata
+		if hasScores(jobDB) {
+			modules = getModuleMetadata(ctx)
+		}
+		verdicts = getVerdicts(jobDB, modules)
+	}
+
+	// Marshal and reply
+	responseData, err := json.Marshal(struct {
+		common.JobDBEntry
+		JobStatus       JobStatus                                   `json:"jobStatus"`
+		JobPercentage   float64                                     `json:"jobPercentage"`
+		ResponsesByType map[triage.IOCType]map[string][]interface{} `json:"responsesByType,omitempty"`
+		Verdicts        []iocVerdict                                `json:"verdicts,omitempty"`
+		Cursor          string                                      `json:"cursor,omitempty"`
+	}{
+		JobDBEntry:      *jobDB,
+		JobStatus:       jobStatus,
+		JobPercentage:   jobPercentage * 100,
+		ResponsesByType: responsesByType,
+		Verdicts:        verdicts,
+		Cursor:          cursor,
+	})
+	if err != nil {
+		span.LogKV("error", err)
+		return events.APIGatewayProxyResponse{StatusCode: 500}, nil
+	}
+	return events.APIGatewayProxyResponse{StatusCode: 200, Body: string(responseData)}, nil
+}
+
+// fetchJob gets a job from the database, it returns nil if there is no such job
+func fetchJob(ctx context.Context, jobID string) (*common.JobDBEntry, error) {
+	return jobStore.GetJob(ctx, jobID)
+}
+
+// groupResponsesByType regroups the module responses of a job by the IOC type each piece of data is about
+func groupResponsesByType(jobEntry *common.JobDBEntry) map[triage.IOCType]map[string][]interface{} {
+	ret := map[triage.IOCType]map[string][]interface{}{}
+	for moduleName, response := range jobEntry.DecryptedResponses {
+		responseDatas, ok := response.([]interface{})
+		if !ok {
+			continue
+		}
+		for _, responseData := range responseDatas {
+			iocType := triage.UnknownType
+			if responseDataMap, ok := responseData.(map[string]interface{}); ok {
+				if dataIOCType, ok := responseDataMap["iocType"].(string); ok {
+					iocType = triage.IOCType(dataIOCType)
+				}
+			}
+			if _, ok := ret[iocType]; !ok {
+				ret[iocType] = map[string][]interface{}{}
+			}
+			ret[iocType][moduleName] = append(ret[iocType][moduleName], responseData)
+		}
+	}
+	return ret
+}
+
+func getJobs(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	span, ctx := to.TracerLogger.StartSpan(ctx, "GetUserJobs", "job", "manager", "listuserjobs")
+	defer span.End(ctx)
+
+	jwt, err := to.ValidateJWT(ctx, toolbox.GetJWTFromRequest(request))
+	if err != nil {
+		err = fmt.Errorf("error validating jwt: %w", err)
+		span.LogKV("error", err)
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusUnauthorized}, err
+	}
+
+	// TODO: Extract username from request
+	span.LogKV("username", jwt.BaseToken.AccountName)
+	filter, err := getJobsFilter(request)
+	if err != nil {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusBadRequest, Body: err.Error()}, nil
+	}
+	response, next, err := listJobs(ctx, jwt.BaseToken.AccountName, filter)
+	if err != nil {
+		span.LogKV("error", err)
+		return events.APIGatewayProxyResponse{StatusCode: 500}, err
+	}
+
+	// There are more jobs, the client passes this back as the cursor to get them
+	var headers map[string]string
+	if next != nil {
+		headers = map[string]string{nextCursorHeader: jobstore.EncodeCursor(next)}
+	}
+
+	responseBytes, err := json.Marshal(response)
+	if err != nil {
+		err = fmt.Errorf("error marshalling the response: %w", err)
+		span.LogKV("error", err)
+		return events.APIGatewayProxyResponse{StatusCode: 500}, err
+	}
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    headers,
+		Body:       string(responseBytes),
+	}, err
+}
+
+// getJobProgress takes a job entry and finds out it's completion state.  It will find out if the job is complete,
+// or we are still waiting on modules to finish.  It will also compute the percentage complete of the job
+// as len(responses) / len(modules requested by the user)
+func getJobProgress(ctx context.Context, jobEntry *common.JobDBEntry) (JobStatus, float64, error) {
+	span, ctx := to.TracerLogger.StartSpan(ctx, "GetJobProgress", "job", "manager", "getprogress")
+	defer span.End(ctx)
+
+	var success, failure int
+	if len(jobEntry.ModuleStatuses) > 0 {
+		success, failure = countModuleStatuses(jobEntry)
+	} else {
+		// Jobs created before module statuses were added
+		success, failure = countModuleResponses(ctx, jobEntry)
+	}
+
+	jobStatus := JobInProgress
+	switch {
+	case (success + failure) == len(jobEntry.RequestedModules):
+		jobStatus = JobCompleted
+	case time.Unix(int64(math.Max(jobEntry.StartTime, jobEntry.LastDispatchTime)), 0).Before(time.Now().Add(-common.JobTimeout)):
+		// Jobs have timed out at this point, job is timed out, assign the rest modules as failure
+		failure = len(jobEntry.RequestedModules) - success
+		jobStatus = JobIncomplete
+		for _, status := range jobEntry.ModuleStatuses {
+			if !status.Finished() {
+				status.Status = common.ModuleTimedOut
+				status.ErrorCode = common.ModuleErrorCodeTimeout
+				status.Retryable = true
+			}
+		}
+	}
+
+	if jobEntry.Cancelled {
+		jobStatus = JobCancelled
+	}
+
+	jobPercentage := float64(float64(success+failure) / float64(len(jobEntry.RequestedModules)))
+
+	span.LogKV("JobStatus", jobStatus)
+	span.LogKV("JobPercentage", jobPercentage)
+
+	if math.IsNaN(jobPercentage) {
+		err := fmt.Errorf("error in percentage calculation leading to NaN, defaulting to 0 percent complete")
+		span.LogKV("error", err)
+		return JobIncomplete, 0, err
+	}
+
+	return jobStatus, jobPercentage, nil
+}
+
+// countModuleStatuses counts the requested modules that finished successfully and that failed using their statuses
+func countModuleStatuses(jobEntry *common.JobDBEntry) (success int, failure int) {
+	for _, module := range jobEntry.RequestedModules {
+		status, ok := jobEntry.ModuleStatuses[module]
+		if !ok || !status.Finished() {
+			continue
+		}
+		if status.Failed() {
+			failure += 1
+		} else {
+			success += 1
+		}
+	}
+	return success, failure
+}
+
+// countModuleResponses counts the requested modules that finished successfully and that failed by looking for errors in their responses
+func countModuleResponses(ctx context.Context, jobEntry *common.JobDBEntry) (success int, failure int) {
+	span, ctx := to.TracerLogger.StartSpan(ctx, "CountModuleResponses", "job", "manager", "countresponses")
+	defer span.End(ctx)
+
+	//Calculate the job succeed failure for counting below
+	for module, responseData := range jobEntry.DecryptedResponses {
+		if responseData != nil {
+			if stringInSlice(module, jobEntry.RequestedModules) {
+				respDataSlice := reflect.ValueOf(responseData)
+				if moduleError(ctx, respDataSlice) {
+					failure += 1
+				} else {
+					success += 1
+				}
+			}
+		} else {
+			err := fmt.Errorf("response from module %s is still unavailable", module)
+			span.LogKV("error", err)
+		}
+	}
+	return success, failure
+}
+
+func stringInSlice(a string, list []string) bool {
+	for _, b := range list {
+		if b == a {
+			return true
+		}
+	}
+	return false
+}
+
+func moduleError(ctx context.Context, respDataSlice reflect.Value) bool {
+	span, ctx := to.TracerLogger.StartSpan(ctx, "ModuleErrorCheck", "job", "manager", "moduleerror")
+	defer span.End(ctx)
+
+	for i := 0; i < respDataSlice.Len(); i++ {
+		triageResultMap := respDataSlice.Index(i).Interface()
+
+		// Inside this is a map safe to type cast
+		responseDataMap, ok := triageResultMap.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		for key, _ := range responseDataMap {
+			if key == "error" {
+				return true
+			}
+		}
+	}
+	return false
+}
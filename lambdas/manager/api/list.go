@@ -0,0 +1,196 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/jobstore"
+)
+
+const (
+	// nextCursorHeader is the response header with the cursor of the next page of jobs
+	nextCursorHeader = "X-Next-Cursor"
+
+	defaultJobsLimit = 50
+	maxJobsLimit     = 100
+	// maxJobsQueries is how many times the job store is queried to fill a page of jobs
+	maxJobsQueries = 5
+)
+
+// jobsFilter is the filters and page of a job list request.
+// The job status depends on the time, so it is filtered after querying the job store.
+type jobsFilter struct {
+	jobstore.JobsQuery
+	Status JobStatus
+}
+
+// getSubmissionIOCTypes returns the IOC types of a submission, sorted so they are stored in a stable order
+func getSubmissionIOCTypes(jobSubmission common.JobSubmission) []string {
+	iocTypes := []string{}
+	for iocType := range jobSubmission.GetIOCGroups() {
+		if iocType != "" {
+			iocTypes = append(iocTypes, string(iocType))
+		}
+	}
+	sort.Strings(iocTypes)
+	return iocTypes
+}
+
+// getJobsFilter gets the filters and page of a job list request from its query string
+func getJobsFilter(request events.APIGatewayProxyRequest) (jobsFilter, error) {
+	parameters := request.QueryStringParameters
+	filter := jobsFilter{JobsQuery: jobstore.JobsQuery{
+		Module:  parameters["module"],
+		IOCType: strings.ToUpper(parameters["iocType"]),
+		Tag:     parameters["tag"],
+		Limit:   defaultJobsLimit,
+	}}
+
+	if status, ok := parameters["status"]; ok {
+		filter.Status = JobStatus(status)
+		switch filter.Status {
+		case JobInProgress, JobIncomplete, JobCompleted, JobCancelled:
+		default:
+			return jobsFilter{}, fmt.Errorf("invalid status, it must be one of %s, %s, %s or %s", JobInProgress, JobIncomplete, JobCompleted, JobCancelled)
+		}
+	}
+
+	var err error
+	for name, value := range map[string]*int64{"from": &filter.From, "to": &filter.To, "limit": &filter.Limit} {
+		parameter, ok := parameters[name]
+		if !ok {
+			continue
+		}
+		*value, err = strconv.ParseInt(parameter, 10, 64)
+		if err != nil || *value <= 0 {
+			return jobsFilter{}, fmt.Errorf("invalid %s, it must be a positive number", name)
+		}
+	}
+	if filter.From != 0 && filter.To != 0 && filter.From > filter.To {
+		return jobsFilter{}, fmt.Errorf("invalid date range, from must be before to")
+	}
+	if filter.Limit > maxJobsLimit {
+		filter.Limit = maxJobsLimit
+	}
+
+	if cursorParameter, ok := parameters["cursor"]; ok {
+		filter.Start, err = jobstore.DecodeCursor(cursorParameter)
+		if err != nil {
+			return jobsFilter{}, fmt.Errorf("invalid cursor, it must be the %s header of an earlier response", nextCursorHeader)
+		}
+	}
+
+	return filter, nil
+}
+
+// getListedJob gets the job entry to list from a job listed by the job store.
+// Only jobs created before the listing metadata was stored are decrypted.
+func getListedJob(ctx context.Context, jobDB *common.JobDBEntry) (*common.JobDBEntry, error) {
+	if jobDB.IOCTypes != nil {
+		jobDB.DecryptedSubmission = map[string]interface{}{
+			"modules": jobDB.RequestedModules,
+		}
+		if jobDB.Metadata != nil {
+			jobDB.DecryptedSubmission["metadata"] = jobDB.Metadata
+		}
+		jobDB.DecryptedResponses = map[string]interface{}{}
+		for module, status := range jobDB.ModuleStatuses {
+			if status.Finished() {
+				jobDB.DecryptedResponses[module] = nil
+			}
+		}
+		return jobDB, nil
+	}
+
+	// The index doesn't have the submission of older jobs, so get the whole job
+	jobDB, err := fetchJob(ctx, jobDB.JobID)
+	if err != nil || jobDB == nil {
+		return jobDB, err
+	}
+	// Older jobs without module statuses are listed with the modules that responded
+	err = jobStore.LoadResponses(ctx, jobDB)
+	if err != nil {
+		return nil, err
+	}
+	// Decrypt because we need the original request to pull out metadata if it's there
+	jobDB.Decrypt(ctx, to)
+
+	// Remove submission data except metadata and modules list
+	for key := range jobDB.DecryptedSubmission {
+		switch key {
+		case "metadata":
+			continue
+		case "modules":
+			continue
+		}
+
+		delete(jobDB.DecryptedSubmission, key)
+	}
+
+	// Remove actual response data
+	for moduleName := range jobDB.DecryptedResponses {
+		jobDB.DecryptedResponses[moduleName] = nil
+	}
+	return jobDB, nil
+}
+
+// listJobs lists a page of the jobs of the user matching the filter, newest first.
+// The job store applies the limit before the filters, and the status can only be filtered here,
+// so the job store is queried again until the page is full or there are no more jobs.
+// It gives up after maxJobsQueries queries, so a page can be short, even empty, while there are more jobs:
+// clients should keep asking for pages while they get a cursor.
+func listJobs(ctx context.Context, username string, filter jobsFilter) ([]ResponseData, *jobstore.Cursor, error) {
+	span, ctx := to.TracerLogger.StartSpan(ctx, "ListJobs", "job", "manager", "listjobs")
+	defer span.End(ctx)
+
+	response := []ResponseData{}
+	query := filter.JobsQuery
+	for queries := 1; ; queries++ {
+		// Newest jobs first, listed jobs only have what we need to list them
+		listedJobs, next, err := jobStore.ListJobs(ctx, username, query)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for i, listedJob := range listedJobs {
+			jobDB, err := getListedJob(ctx, listedJob)
+			if err != nil || jobDB == nil {
+				// TODO: Log?
+				continue
+			}
+
+			// get the jobPercentage completion for UI
+			jobStatus, jobPercentage, err := getJobProgress(ctx, jobDB)
+			if err != nil {
+				// error handles the percentage to 0,set it if not and just log it
+				jobPercentage = 0
+				span.LogKV("error", err)
+			}
+			if filter.Status != "" && jobStatus != filter.Status {
+				continue
+			}
+
+			response = append(response, ResponseData{
+				JobDB:         *jobDB,
+				JobPercentage: jobPercentage * 100,
+			})
+			// The next page starts right after the last job of this page
+			if int64(len(response)) == filter.Limit {
+				if i < len(listedJobs)-1 {
+					next = jobstore.JobCursor(listedJob)
+				}
+				return response, next, nil
+			}
+		}
+
+		if next == nil || queries == maxJobsQueries {
+			return response, next, nil
+		}
+		query.Start = next
+	}
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/jobstore"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGetSubmissionIOCTypes(t *testing.T) {
+
+	Convey("getSubmissionIOCTypes", t, func() {
+
+		Convey("should return the sorted types of grouped IOCs", func() {
+			jobSubmission := common.JobSubmission{IOCGroups: map[triage.IOCType][]string{
+				triage.URLType:    {"https://godaddy.com"},
+				triage.DomainType: {"godaddy.com"},
+			}}
+			So(getSubmissionIOCTypes(jobSubmission), ShouldResemble, []string{"DOMAIN", "URL"})
+		})
+
+		Convey("should return the type of single type submissions", func() {
+			jobSubmission := common.JobSubmission{IOCType: "domain", IOCs: []string{"godaddy.com"}}
+			So(getSubmissionIOCTypes(jobSubmission), ShouldResemble, []string{"DOMAIN"})
+		})
+
+		Convey("should return an empty list without a type", func() {
+			So(getSubmissionIOCTypes(common.JobSubmission{}), ShouldResemble, []string{})
+		})
+	})
+}
+
+func TestGetJobsFilter(t *testing.T) {
+
+	Convey("getJobsFilter", t, func() {
+		request := events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{}}
+
+		Convey("should use the default limit without parameters", func() {
+			filter, err := getJobsFilter(request)
+			So(err, ShouldBeNil)
+			So(filter, ShouldResemble, jobsFilter{JobsQuery: jobstore.JobsQuery{Limit: defaultJobsLimit}})
+		})
+
+		Convey("should read every filter", func() {
+			request.QueryStringParameters = map[string]string{
+				"status":  "Completed",
+				"module":  "apivoid",
+				"iocType": "domain",
+				"tag":     "phishing",
+				"from":    "1610000000",
+				"to":      "1620000000",
+				"limit":   "1000",
+			}
+			filter, err := getJobsFilter(request)
+			So(err, ShouldBeNil)
+			So(filter, ShouldResemble, jobsFilter{
+				Status: JobCompleted,
+				JobsQuery: jobstore.JobsQuery{
+					Module:  "apivoid",
+					IOCType: "DOMAIN",
+					Tag:     "phishing",
+					From:    1610000000,
+					To:      1620000000,
+					Limit:   maxJobsLimit,
+				},
+			})
+		})
+
+		Convey("should reject invalid filters", func() {
+			for _, parameters := range []map[string]string{
+				{"status": "Done"},
+				{"from": "yesterday"},
+				{"limit": "0"},
+				{"from": "1620000000", "to": "1610000000"},
+				{"cursor": "not a cursor"},
+			} {
+				request.QueryStringParameters = parameters
+				_, err := getJobsFilter(request)
+				So(err, ShouldNotBeNil)
+			}
+		})
+
+		Convey("should start pages at the cursor", func() {
+			cursor := &jobstore.Cursor{JobID: "job 2v45y245", StartTime: "1610000000"}
+			request.QueryStringParameters["cursor"] = jobstore.EncodeCursor(cursor)
+			filter, err := getJobsFilter(request)
+			So(err, ShouldBeNil)
+			So(filter.Start, ShouldResemble, cursor)
+
+			// Start times have fractions of seconds
+			cursor = jobstore.JobCursor(&common.JobDBEntry{JobID: "job 2v45y245", StartTime: 1610000000.25})
+			request.QueryStringParameters["cursor"] = jobstore.EncodeCursor(cursor)
+			filter, err = getJobsFilter(request)
+			So(err, ShouldBeNil)
+			So(filter.Start, ShouldResemble, &jobstore.Cursor{JobID: "job 2v45y245", StartTime: "1610000000.25"})
+		})
+	})
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/jobstore"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
+)
+
+const (
+	resourceName             = "geoip"
+	snsTopicARNParameterName = "/ThreatTools/JobRequests"
+	// jobIDKey used in DB and API
+	jobIDKey           = "jobId"
+	usernameKey        = "username"
+	originRequesterKey = "originrequester"
+	// API Version and API path prefix
+	version = "v1"
+)
+
+// Normall I wouldn't use global variables like this, but in such a small
+// lambda function, this is simpler than passing in paramaters, and/or using closures
+var to *toolbox.Toolbox
+var jobStore jobstore.JobStore
+
+// NewToolbox gets the toolbox of each request, local runs replace it with one that needs no AWS
+var NewToolbox = toolbox.GetToolbox
+
+// PublishJob hands new jobs to the modules instead of the job requests SNS topic if set, for local runs
+var PublishJob func(ctx context.Context, message common.JobSNSMessage) error
+
+// JobStatus is the statuses a job can have
+type JobStatus string
+
+// Job statuses
+const (
+	JobInProgress JobStatus = "InProgress"
+	JobIncomplete JobStatus = "Incomplete"
+	JobCompleted  JobStatus = "Completed"
+	JobCancelled  JobStatus = "Cancelled"
+)
+
+// Handler handles the requests of the ThreatTools API to create jobs and retrieve their status and output
+func Handler(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	// Get the toolbox
+	// This helps standardize things across services
+	to = NewToolbox()
+	defer to.Close(ctx)
+
+	// Load the job store, DynamoDB unless this is a local run
+	var err error
+	jobStore, err = jobstore.New(to)
+	if err != nil {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
+	}
+
+	// Check if they are requesting their user's jobs
+	path := strings.Trim(request.Path, "/")
+	switch {
+	case strings.HasPrefix(path, version+"/jobs"):
+		switch request.HTTPMethod {
+		case http.MethodPost:
+			if jobID, ok := request.PathParameters[jobIDKey]; ok && strings.HasSuffix(path, "/retry") {
+				// They want to retry the failed modules of a job
+				return retryJob(ctx, request, jobID)
+			}
+			if jobID, ok := request.PathParameters[jobIDKey]; ok && strings.HasSuffix(path, "/cancel") {
+				// They want to stop the modules working on a job
+				return cancelJob(ctx, request, jobID)
+			}
+			// They want to create a new job
+			return createJob(to, ctx, request)
+		case http.MethodGet:
+			if jobID, ok := request.PathParameters[jobIDKey]; ok && strings.HasSuffix(path, "/export") {
+				// They want the job in a format other tools can import
+				return exportJob(ctx, request, jobID)
+			}
+			if jobID, ok := request.PathParameters[jobIDKey]; ok {
+				// They are checking the status of a job
+				return getJob(ctx, request, jobID)
+			}
+			// They are getting all their jobs
+			return getJobs(ctx, request)
+		case http.MethodDelete:
+			if jobID, ok := request.PathParameters[jobIDKey]; ok {
+				// They deleting this job
+				return deleteJob(ctx, request, jobID)
+			}
+			return events.APIGatewayProxyResponse{StatusCode: http.StatusBadRequest, Body: "Missing jobId"}, nil
+		case http.MethodPatch:
+			if jobID, ok := request.PathParameters[jobIDKey]; ok {
+				// They are adding modules to this job
+				return extendJob(ctx, request, jobID)
+			}
+			return events.APIGatewayProxyResponse{StatusCode: http.StatusBadRequest, Body: "Missing jobId"}, nil
+		default:
+			return events.APIGatewayProxyResponse{StatusCode: http.StatusMethodNotAllowed}, nil
+		}
+	case strings.HasPrefix(path, version+"/iocs/") && strings.HasSuffix(path, "/jobs"):
+		if request.HTTPMethod != http.MethodGet {
+			return events.APIGatewayProxyResponse{StatusCode: http.StatusMethodNotAllowed}, nil
+		}
+		// They want the past jobs with this IOC
+		return getIOCJobs(ctx, request)
+	case strings.HasSuffix(path, version+"/classifications"):
+		return classifyIOCs(ctx, request)
+	case strings.HasSuffix(path, version+"/modules"):
+		return GetModules(ctx, request)
+	case strings.HasSuffix(path, version+"/usage"):
+		if request.HTTPMethod != http.MethodGet {
+			return events.APIGatewayProxyResponse{StatusCode: http.StatusMethodNotAllowed}, nil
+		}
+		return getUsage(ctx, request)
+	default:
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusNotFound}, nil
+	}
+}
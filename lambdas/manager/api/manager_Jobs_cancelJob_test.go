@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	. "github.com/agiledragon/gomonkey/v2"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/gdcorp-golang/auth/gdtoken"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/jobstore"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCancelJob(t *testing.T) {
+
+	Convey("cancelJob", t, func() {
+		// setup stubs\mocks
+		patches := []*Patches{}
+		ctx1 := context.Background()
+		actualDynamoDBClient := &dynamodb.DynamoDB{}
+		patches = append(patches, ApplyFunc(dynamodb.New,
+			func(p client.ConfigProvider, cfgs ...*aws.Config) *dynamodb.DynamoDB {
+				return actualDynamoDBClient
+			}))
+		to = toolbox.GetToolbox()
+		dynamoDBClient := dynamodb.New(to.AWSSession)
+		jobStore = jobstore.NewDynamoDBStore(to)
+
+		jobID := "Generatedjob 9834562"
+		APIGatewayRequest := &events.APIGatewayProxyRequest{
+			Path: "v1/jobs/Generatedjob 9834562/cancel",
+		}
+
+		jwtToken := &gdtoken.Token{
+			BaseToken: gdtoken.BaseToken{
+				AccountName: "Account Name 2q34tg",
+			},
+		}
+		patches = append(patches, ApplyMethod(reflect.TypeOf(to), "ValidateJWT",
+			func(t *toolbox.Toolbox, ctx context.Context, token string) (*gdtoken.Token, error) {
+				return jwtToken, nil
+			}))
+
+		actualOwner := ""
+		foundJob := &common.JobDBEntry{JobID: jobID}
+		patches = append(patches, ApplyFunc(findOwnedJob,
+			func(ctx context.Context, username string, jobID string) (*common.JobDBEntry, error) {
+				actualOwner = username
+				return foundJob, nil
+			}))
+
+		var actualUpdateItemInput *dynamodb.UpdateItemInput
+		patches = append(patches, ApplyMethod(reflect.TypeOf(dynamoDBClient), "UpdateItem",
+			func(client *dynamodb.DynamoDB, input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+				actualUpdateItemInput = input
+				return &dynamodb.UpdateItemOutput{}, nil
+			}))
+
+		Reset(func() {
+			// deferred reset all stubs\mocks after every test suite running
+			for i := len(patches) - 1; i >= 0; i-- {
+				patches[i].Reset()
+			}
+			jobStore = nil
+			to = nil
+		})
+
+		Convey("should successfully cancel job", func() {
+			actualResponse, err := cancelJob(ctx1, *APIGatewayRequest, jobID)
+			So(err, ShouldBeNil)
+			So(actualResponse, ShouldResemble, events.APIGatewayProxyResponse{StatusCode: http.StatusOK})
+			So(actualOwner, ShouldEqual, jwtToken.BaseToken.AccountName)
+		})
+
+		Convey("should mark the job as cancelled in DB", func() {
+			cancelJob(ctx1, *APIGatewayRequest, jobID)
+			So(actualUpdateItemInput.Key, ShouldResemble, map[string]*dynamodb.AttributeValue{jobIDKey: {S: &jobID}})
+			So(actualUpdateItemInput.ExpressionAttributeValues, ShouldContainKey, ":0")
+			So(*actualUpdateItemInput.ExpressionAttributeValues[":0"].BOOL, ShouldBeTrue)
+		})
+
+		Convey("should return forbidden status if the user does not own the job", func() {
+			patches = append(patches, ApplyFunc(findOwnedJob,
+				func(ctx context.Context, username string, jobID string) (*common.JobDBEntry, error) {
+					return nil, nil
+				}))
+			actualResponse, _ := cancelJob(ctx1, *APIGatewayRequest, jobID)
+			So(actualResponse, ShouldResemble, events.APIGatewayProxyResponse{StatusCode: http.StatusForbidden})
+			So(actualUpdateItemInput, ShouldBeNil)
+		})
+
+		Convey("should return error if JWT validation failed", func() {
+			err := errors.New("I am JWT Validation for cancelled job error")
+			patches = append(patches, ApplyMethod(reflect.TypeOf(to), "ValidateJWT",
+				func(t *toolbox.Toolbox, ctx context.Context, token string) (*gdtoken.Token, error) {
+					return nil, err
+				}))
+			actualResponse, actualError := cancelJob(ctx1, *APIGatewayRequest, jobID)
+			So(actualError, ShouldResemble, fmt.Errorf("error validating jwt: %w", err))
+			So(actualResponse, ShouldResemble, events.APIGatewayProxyResponse{StatusCode: http.StatusUnauthorized})
+		})
+
+		Convey("should return error if updating job in DynamoDB failed", func() {
+			err := errors.New("I am update error for cancelled job")
+			patches = append(patches, ApplyMethod(reflect.TypeOf(dynamoDBClient), "UpdateItem",
+				func(client *dynamodb.DynamoDB, input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+					return nil, err
+				}))
+			actualResponse, actualError := cancelJob(ctx1, *APIGatewayRequest, jobID)
+			So(actualError, ShouldResemble, fmt.Errorf("error cancelling job in DB: %w", err))
+			So(actualResponse, ShouldResemble, events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError})
+		})
+	})
+}
@@ -1,4 +1,4 @@
-package main
+package api
 
 import (
 	"context"
@@ -13,14 +13,15 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/client"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 	da "github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 	"github.com/aws/aws-sdk-go/service/sns"
 	. "github.com/aws/aws-sdk-go/service/sns"
 	"github.com/aws/aws-sdk-go/service/ssm"
 	"github.com/gdcorp-golang/auth/gdtoken"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/jobstore"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
 	"github.com/godaddy/asherah/go/appencryption"
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -46,15 +47,6 @@ func TestEncryptSubmission(t *testing.T) {
 			func(tbox *toolbox.Toolbox, ctx context.Context, jobID string, data []byte) (*appencryption.DataRowRecord, error) {
 				return encryptedData, nil
 			}))
-		expectedData := &dynamodb.AttributeValue{}
-		patches = append(patches, ApplyFunc(dynamodbattribute.Marshal,
-			func(input interface{}) (*dynamodb.AttributeValue, error) {
-				if reflect.DeepEqual(input, encryptedData) {
-					return expectedData, nil
-				}
-				encodeValue, _ := da.NewEncoder().Encode(input)
-				return encodeValue, nil
-			}))
 
 		Reset(func() {
 			// deferred reset all stubs\mocks after every test suite running
@@ -64,8 +56,8 @@ func TestEncryptSubmission(t *testing.T) {
 		})
 
 		Convey("encrypt submission body properly", func() {
-			actualEncryptedDataMarshalled, _ := encryptSubmission(tb, ctx1, jobID, submission)
-			So(actualEncryptedDataMarshalled, ShouldResemble, expectedData)
+			actualEncryptedData, _ := encryptSubmission(tb, ctx1, jobID, submission)
+			So(actualEncryptedData, ShouldResemble, encryptedData)
 		})
 
 		Convey("should return error if encryption didn't go well", func() {
@@ -78,20 +70,6 @@ func TestEncryptSubmission(t *testing.T) {
 			So(actualError, ShouldResemble, fmt.Errorf("error encrypting submission: %w", err))
 		})
 
-		Convey("should return error if dynamodb marshalling didn't go well", func() {
-			err := errors.New("I am marshalling error")
-			patches = append(patches, ApplyFunc(dynamodbattribute.Marshal,
-				func(input interface{}) (*dynamodb.AttributeValue, error) {
-					if reflect.DeepEqual(input, encryptedData) {
-						return nil, err
-					}
-					encodeValue, _ := da.NewEncoder().Encode(input)
-					return encodeValue, nil
-				}))
-			_, actualError := encryptSubmission(tb, ctx1, jobID, submission)
-			So(actualError, ShouldResemble, fmt.Errorf("error marshalling encrypted data: %w", err))
-		})
-
 	})
 }
 
@@ -171,18 +149,19 @@ func TestStoreRequestedModulesList(t *testing.T) {
 
 	Convey("storeRequestedModulesList", t, func() {
 		tb := toolbox.GetToolbox()
+		jobStore = jobstore.NewDynamoDBStore(tb)
 		// setup stubs\mocks
 		patches := []*Patches{}
 		ctx1 := context.Background()
-		jwtToken := &gdtoken.Token{}
+		jwtToken := &gdtoken.Token{BaseToken: gdtoken.BaseToken{AccountName: "Account Name 2v45"}}
 		dynamoDBClient := &dynamodb.DynamoDB{}
 		dynamoDBRequest := &events.APIGatewayProxyRequest{}
 
 		originRequester := "Some_requester"
 		jobID := "ID_2345"
 		submittedModule := "APIVOID"
-		encryptedDataMarshalled := &dynamodb.AttributeValue{
-			S: &submittedModule,
+		encryptedData := &appencryption.DataRowRecord{
+			Data: []byte(submittedModule),
 		}
 		var actualItem map[string]*dynamodb.AttributeValue
 		patches = append(patches, ApplyMethod(reflect.TypeOf(dynamoDBClient), "PutItem",
@@ -198,24 +177,18 @@ func TestStoreRequestedModulesList(t *testing.T) {
 				return jobSubmission, nil
 			}))
 
-		requestedModules := &dynamodb.AttributeValue{
-			SS: []*string{&submittedModule},
-		}
-
-		patches = append(patches, ApplyFunc(dynamodbattribute.Marshal,
-			func(input interface{}) (*dynamodb.AttributeValue, error) {
-				if reflect.DeepEqual(input, jobSubmission.Modules) {
-					return requestedModules, nil
-				}
-				encodeValue, _ := da.NewEncoder().Encode(input)
-				return encodeValue, nil
-			}))
+		submission, _ := da.NewEncoder().Encode(encryptedData)
+		moduleStatuses, _ := da.NewEncoder().Encode(map[string]*common.ModuleStatus{
+			submittedModule: {Status: common.ModulePending},
+		})
 
 		Reset(func() {
 			// deferred reset all stubs\mocks after every test suite running
-			for _, patch := range patches {
-				patch.Reset()
+			// reset in reverse order so functions patched more than once are restored
+			for i := len(patches) - 1; i >= 0; i-- {
+				patches[i].Reset()
 			}
+			jobStore = nil
 		})
 
 		Convey("stores submitted job modules", func() {
@@ -224,52 +197,55 @@ func TestStoreRequestedModulesList(t *testing.T) {
 				usernameKey:        {S: &jwtToken.BaseToken.AccountName},
 				"startTime":        {N: aws.String(fmt.Sprintf("%d", time.Now().Unix()))},
 				"ttl":              {N: aws.String(fmt.Sprintf("%d", time.Now().Add(time.Hour*24*30).Unix()))},
-				"submission":       encryptedDataMarshalled,
+				"submission":       submission,
 				"responses":        {M: map[string]*dynamodb.AttributeValue{}},
-				"requestedModules": requestedModules,
+				"requestedModules": {L: []*dynamodb.AttributeValue{{S: &submittedModule}}},
+				"moduleStatus":     moduleStatuses,
+				"iocTypes":         {L: []*dynamodb.AttributeValue{}},
+				originRequesterKey: {S: &originRequester},
 			}
-			expectedItem[originRequesterKey] = &dynamodb.AttributeValue{S: &originRequester}
-			err := storeRequestedModulesList(tb, ctx1, jwtToken, dynamoDBRequest, originRequester, jobID, encryptedDataMarshalled)
+			err := storeRequestedModulesList(tb, ctx1, jwtToken, dynamoDBRequest, originRequester, jobID, encryptedData)
 			So(err, ShouldResemble, nil)
 			So(actualItem, ShouldResemble, expectedItem)
 		})
 
 		Convey("stores submitted job modules without original requestor if not provided", func() {
-			expectedItem := map[string]*dynamodb.AttributeValue{
-				jobIDKey:           {S: &jobID},
-				usernameKey:        {S: &jwtToken.BaseToken.AccountName},
-				"startTime":        {N: aws.String(fmt.Sprintf("%d", time.Now().Unix()))},
-				"ttl":              {N: aws.String(fmt.Sprintf("%d", time.Now().Add(time.Hour*24*30).Unix()))},
-				"submission":       encryptedDataMarshalled,
-				"responses":        {M: map[string]*dynamodb.AttributeValue{}},
-				"requestedModules": requestedModules,
-			}
-			err := storeRequestedModulesList(tb, ctx1, jwtToken, dynamoDBRequest, "", jobID, encryptedDataMarshalled)
+			err := storeRequestedModulesList(tb, ctx1, jwtToken, dynamoDBRequest, "", jobID, encryptedData)
 			So(err, ShouldResemble, nil)
-			So(actualItem, ShouldResemble, expectedItem)
+			So(actualItem, ShouldNotContainKey, originRequesterKey)
+			So(actualItem, ShouldContainKey, jobIDKey)
 		})
 
-		Convey("returns error if cannot get job submission", func() {
-			err := errors.New("Cannot marshal modules")
-			patches = append(patches, ApplyFunc(dynamodbattribute.Marshal,
-				func(input interface{}) (*dynamodb.AttributeValue, error) {
-					if reflect.DeepEqual(input, jobSubmission.Modules) {
-						return nil, err
-					}
-					encodeValue, _ := da.NewEncoder().Encode(input)
-					return encodeValue, nil
-				}))
-			actualErr := storeRequestedModulesList(tb, ctx1, jwtToken, dynamoDBRequest, originRequester, jobID, encryptedDataMarshalled)
-			So(actualErr, ShouldResemble, fmt.Errorf("error marshalling requestedModules: %w", err))
+		Convey("stores that the job has a callback without storing the callback URL", func() {
+			jobSubmission.CallbackURL = "https://soar.example.com/threat-api"
+			jobSubmission.CallbackSecret = "I am callback secret 2345"
+			err := storeRequestedModulesList(tb, ctx1, jwtToken, dynamoDBRequest, "", jobID, encryptedData)
+			So(err, ShouldResemble, nil)
+			So(actualItem["callback"], ShouldResemble, &dynamodb.AttributeValue{BOOL: aws.Bool(true)})
+			So(fmt.Sprint(actualItem), ShouldNotContainSubstring, "soar.example.com")
+		})
+
+		Convey("stores the IOC types, tags and metadata unencrypted for listing", func() {
+			jobSubmission.IOCGroups = map[triage.IOCType][]string{
+				triage.IPType:     {"127.0.0.1"},
+				triage.DomainType: {"godaddy.com"},
+			}
+			jobSubmission.Tags = []string{"phishing"}
+			jobSubmission.Metadata = map[string]interface{}{"name": "My Test Run"}
+			err := storeRequestedModulesList(tb, ctx1, jwtToken, dynamoDBRequest, "", jobID, encryptedData)
+			So(err, ShouldResemble, nil)
+			So(actualItem["iocTypes"], ShouldResemble, &dynamodb.AttributeValue{L: []*dynamodb.AttributeValue{{S: aws.String("DOMAIN")}, {S: aws.String("IP")}}})
+			So(actualItem["tags"], ShouldResemble, &dynamodb.AttributeValue{L: []*dynamodb.AttributeValue{{S: aws.String("phishing")}}})
+			So(actualItem["metadata"], ShouldResemble, &dynamodb.AttributeValue{M: map[string]*dynamodb.AttributeValue{"name": {S: aws.String("My Test Run")}}})
 		})
 
-		Convey("returns error if cannot marshal modules", func() {
-			err := errors.New("Cannot marshal modules")
+		Convey("returns error if cannot get job submission", func() {
+			err := errors.New("Cannot get job submission")
 			patches = append(patches, ApplyFunc(common.GetJobSubmission,
 				func(event events.APIGatewayProxyRequest) (common.JobSubmission, error) {
 					return jobSubmission, err
 				}))
-			actualErr := storeRequestedModulesList(tb, ctx1, jwtToken, dynamoDBRequest, originRequester, jobID, encryptedDataMarshalled)
+			actualErr := storeRequestedModulesList(tb, ctx1, jwtToken, dynamoDBRequest, originRequester, jobID, encryptedData)
 			So(actualErr, ShouldResemble, fmt.Errorf("error getting the jobSubmission: %w", err))
 		})
 
@@ -280,7 +256,7 @@ func TestStoreRequestedModulesList(t *testing.T) {
 					actualItem = input.Item
 					return nil, err
 				}))
-			actualErr := storeRequestedModulesList(tb, ctx1, jwtToken, dynamoDBRequest, originRequester, jobID, encryptedDataMarshalled)
+			actualErr := storeRequestedModulesList(tb, ctx1, jwtToken, dynamoDBRequest, originRequester, jobID, encryptedData)
 			So(actualErr, ShouldResemble, err)
 		})
 
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	. "github.com/agiledragon/gomonkey/v2"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/gdcorp-golang/auth/gdtoken"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/jobstore"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestExtendJob(t *testing.T) {
+
+	Convey("extendJob", t, func() {
+		// setup stubs\mocks
+		patches := []*Patches{}
+		ctx1 := context.Background()
+		actualDynamoDBClient := &dynamodb.DynamoDB{}
+		patches = append(patches, ApplyFunc(dynamodb.New,
+			func(p client.ConfigProvider, cfgs ...*aws.Config) *dynamodb.DynamoDB {
+				return actualDynamoDBClient
+			}))
+		to = toolbox.GetToolbox()
+		jobStore = jobstore.NewDynamoDBStore(to)
+
+		jobID := "Generatedjob 2457245"
+		APIGatewayRequest := &events.APIGatewayProxyRequest{
+			Path: "v1/jobs/Generatedjob 2457245",
+			Body: `{"modules": ["apivoid", "passivetotal", "urlscanio", "passivetotal"]}`,
+		}
+
+		jwtToken := &gdtoken.Token{
+			BaseToken: gdtoken.BaseToken{
+				AccountName: "Account Name 7w45g",
+			},
+		}
+		patches = append(patches, ApplyMethod(reflect.TypeOf(to), "ValidateJWT",
+			func(t *toolbox.Toolbox, ctx context.Context, token string) (*gdtoken.Token, error) {
+				return jwtToken, nil
+			}))
+
+		actualOwner := ""
+		foundJob := &common.JobDBEntry{JobID: jobID, RequestedModules: []string{"apivoid"}}
+		patches = append(patches, ApplyFunc(findOwnedJob,
+			func(ctx context.Context, username string, jobID string) (*common.JobDBEntry, error) {
+				actualOwner = username
+				return foundJob, nil
+			}))
+
+		jobDB := &common.JobDBEntry{}
+		patches = append(patches, ApplyMethod(reflect.TypeOf(jobDB), "Decrypt",
+			func(job *common.JobDBEntry, ctx context.Context, box *toolbox.Toolbox) {
+				job.DecryptedSubmission = map[string]interface{}{
+					"iocType": "DOMAIN",
+					"iocs":    []interface{}{"godaddy.com"},
+					"modules": []interface{}{"apivoid"},
+				}
+			}))
+
+		var actualAddedModules []string
+		patches = append(patches, ApplyFunc(addModules,
+			func(ctx context.Context, jobEntry *common.JobDBEntry, modules []string) error {
+				actualAddedModules = modules
+				return nil
+			}))
+
+		patches = append(patches, ApplyFunc(countTopicSubscriptions,
+			func(box *toolbox.Toolbox, ctx context.Context, snsClient *sns.SNS) (int, string, error) {
+				return 1, "Topic ARN 6h356", nil
+			}))
+
+		var actualPublishedRequest events.APIGatewayProxyRequest
+		actualPublishedJobID := ""
+		patches = append(patches, ApplyFunc(publishToSns,
+			func(box *toolbox.Toolbox, ctx context.Context, message common.JobSNSMessage, snsClient *sns.SNS, topicARN string) error {
+				actualPublishedRequest = message.Submission
+				actualPublishedJobID = message.JobID
+				return nil
+			}))
+
+		Reset(func() {
+			// deferred reset all stubs\mocks after every test suite running
+			for i := len(patches) - 1; i >= 0; i-- {
+				patches[i].Reset()
+			}
+			jobStore = nil
+			to = nil
+		})
+
+		Convey("should add only the modules that are not already part of the job", func() {
+			actualResponse, err := extendJob(ctx1, *APIGatewayRequest, jobID)
+			So(err, ShouldBeNil)
+			So(actualResponse, ShouldResemble, events.APIGatewayProxyResponse{
+				StatusCode: http.StatusOK,
+				Body:       `{"jobId":"Generatedjob 2457245","modules":["passivetotal","urlscanio"]}`,
+			})
+			So(actualOwner, ShouldEqual, jwtToken.BaseToken.AccountName)
+			So(actualAddedModules, ShouldResemble, []string{"passivetotal", "urlscanio"})
+		})
+
+		Convey("should publish the stored submission to only the added modules", func() {
+			extendJob(ctx1, *APIGatewayRequest, jobID)
+			So(actualPublishedJobID, ShouldEqual, jobID)
+			publishedSubmission := map[string]interface{}{}
+			json.Unmarshal([]byte(actualPublishedRequest.Body), &publishedSubmission)
+			So(publishedSubmission, ShouldResemble, map[string]interface{}{
+				"iocType": "DOMAIN",
+				"iocs":    []interface{}{"godaddy.com"},
+				"modules": []interface{}{"passivetotal", "urlscanio"},
+			})
+		})
+
+		Convey("should return bad request if no modules are provided", func() {
+			APIGatewayRequest.Body = `{"modules": []}`
+			actualResponse, _ := extendJob(ctx1, *APIGatewayRequest, jobID)
+			So(actualResponse, ShouldResemble, events.APIGatewayProxyResponse{StatusCode: http.StatusBadRequest, Body: "Missing modules"})
+			So(actualOwner, ShouldEqual, "")
+		})
+
+		Convey("should return conflict if all modules are already part of the job", func() {
+			APIGatewayRequest.Body = `{"modules": ["apivoid"]}`
+			actualResponse, _ := extendJob(ctx1, *APIGatewayRequest, jobID)
+			So(actualResponse.StatusCode, ShouldEqual, http.StatusConflict)
+			So(actualAddedModules, ShouldBeNil)
+		})
+
+		Convey("should return forbidden status if the user does not own the job", func() {
+			patches = append(patches, ApplyFunc(findOwnedJob,
+				func(ctx context.Context, username string, jobID string) (*common.JobDBEntry, error) {
+					return nil, nil
+				}))
+			actualResponse, _ := extendJob(ctx1, *APIGatewayRequest, jobID)
+			So(actualResponse, ShouldResemble, events.APIGatewayProxyResponse{StatusCode: http.StatusForbidden})
+			So(actualAddedModules, ShouldBeNil)
+		})
+
+		Convey("should return error if JWT validation failed", func() {
+			err := errors.New("I am JWT Validation for extended job error")
+			patches = append(patches, ApplyMethod(reflect.TypeOf(to), "ValidateJWT",
+				func(t *toolbox.Toolbox, ctx context.Context, token string) (*gdtoken.Token, error) {
+					return nil, err
+				}))
+			actualResponse, actualError := extendJob(ctx1, *APIGatewayRequest, jobID)
+			So(actualError, ShouldResemble, fmt.Errorf("error validating jwt: %w", err))
+			So(actualResponse, ShouldResemble, events.APIGatewayProxyResponse{StatusCode: http.StatusUnauthorized})
+		})
+
+		Convey("should not publish if adding the modules failed", func() {
+			err := errors.New("I am add modules error")
+			patches = append(patches, ApplyFunc(addModules,
+				func(ctx context.Context, jobEntry *common.JobDBEntry, modules []string) error {
+					return err
+				}))
+			actualResponse, actualError := extendJob(ctx1, *APIGatewayRequest, jobID)
+			So(actualError, ShouldResemble, err)
+			So(actualResponse, ShouldResemble, events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError})
+			So(actualPublishedJobID, ShouldEqual, "")
+		})
+	})
+}
@@ -1,4 +1,4 @@
-package main
+package api
 
 import (
 	"context"
@@ -130,5 +130,77 @@ func TestGetJobProgress(t *testing.T) {
 			So(math.Round(actualPercentage), ShouldEqual, math.Round(1))
 		})
 
+		Convey("should use module statuses instead of responses when the job has them", func() {
+			TestJobEntryData = `{
+				"jobId": "Some job ID 345234",
+				"startTime": ` + fmt.Sprintf("%f", startTime) + `,
+				"requestedModules": ["apivoid", "urlscanio", "recordedfuture", "shodan"],
+				"submission": {},
+				"responses": {
+					"apivoid": [
+						{
+							"data": {},
+							"error": "not an error, this vendor had an error key in its data"
+						}
+					]
+				},
+				"moduleStatus": {
+					"apivoid": {"status": "SUCCEEDED"},
+					"urlscanio": {"status": "FAILED", "errorCode": "MODULE_ERROR", "retryable": true},
+					"recordedfuture": {"status": "RUNNING"},
+					"shodan": {"status": "PENDING"}
+				}
+			}`
+			jobDB = &common.JobDBEntry{}
+			json.Unmarshal([]byte(TestJobEntryData), &jobDB)
+			actualJobStatus, actualPercentage, _ := getJobProgress(ctx1, jobDB)
+			So(actualJobStatus, ShouldResemble, JobInProgress)
+			So(actualPercentage, ShouldEqual, 0.5)
+		})
+
+		Convey("should show cancelled jobs as cancelled", func() {
+			TestJobEntryData = `{
+				"jobId": "Some job ID 345234",
+				"startTime": ` + fmt.Sprintf("%f", startTime) + `,
+				"cancelled": true,
+				"requestedModules": ["apivoid", "urlscanio"],
+				"submission": {},
+				"responses": {},
+				"moduleStatus": {
+					"apivoid": {"status": "CANCELLED", "errorCode": "CANCELLED"},
+					"urlscanio": {"status": "RUNNING"}
+				}
+			}`
+			jobDB = &common.JobDBEntry{}
+			json.Unmarshal([]byte(TestJobEntryData), &jobDB)
+			actualJobStatus, actualPercentage, _ := getJobProgress(ctx1, jobDB)
+			So(actualJobStatus, ShouldResemble, JobCancelled)
+			So(actualPercentage, ShouldEqual, 0.5)
+		})
+
+		Convey("should mark unfinished module statuses as timed out when the job times out", func() {
+			oldTime := time.Now().Add(-time.Minute * 30)
+			startTime := float64(oldTime.Unix())
+			TestJobEntryData = `{
+				"jobId": "Some job ID 345234",
+				"startTime": ` + fmt.Sprintf("%f", startTime) + `,
+				"requestedModules": ["apivoid", "urlscanio"],
+				"submission": {},
+				"responses": {},
+				"moduleStatus": {
+					"apivoid": {"status": "SUCCEEDED"},
+					"urlscanio": {"status": "RUNNING"}
+				}
+			}`
+			jobDB = &common.JobDBEntry{}
+			json.Unmarshal([]byte(TestJobEntryData), &jobDB)
+			actualJobStatus, actualPercentage, _ := getJobProgress(ctx1, jobDB)
+			So(actualJobStatus, ShouldResemble, JobIncomplete)
+			So(actualPercentage, ShouldEqual, 1)
+			So(jobDB.ModuleStatuses["apivoid"].Status, ShouldEqual, common.ModuleSucceeded)
+			So(jobDB.ModuleStatuses["urlscanio"].Status, ShouldEqual, common.ModuleTimedOut)
+			So(jobDB.ModuleStatuses["urlscanio"].ErrorCode, ShouldEqual, common.ModuleErrorCodeTimeout)
+		})
+
 	})
 }
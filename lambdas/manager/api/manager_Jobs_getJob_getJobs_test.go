@@ -0,0 +1,494 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	. "github.com/agiledragon/gomonkey/v2"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+	"github.com/gdcorp-golang/auth/gdtoken"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/jobstore"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGetJob(t *testing.T) {
+
+	Convey("getJob", t, func() {
+		// setup stubs\mocks
+		patches := []*Patches{}
+		ctx1 := context.Background()
+		actualDynamoDBClient := &dynamodb.DynamoDB{}
+		patches = append(patches, ApplyFunc(dynamodb.New,
+			func(p client.ConfigProvider, cfgs ...*aws.Config) *dynamodb.DynamoDB {
+				return actualDynamoDBClient
+			}))
+
+		to = toolbox.GetToolbox()
+		dynamoDBClient := dynamodb.New(to.AWSSession)
+		jobStore = jobstore.NewDynamoDBStore(to)
+		APIGatewayRequest := &events.APIGatewayProxyRequest{
+			Path: "Super cool path3ye435t",
+		}
+
+		jwtTokenString := "I am cool JWK secret token345 gw4vw45"
+		patches = append(patches, ApplyFunc(toolbox.GetJWTFromRequest,
+			func(request events.APIGatewayProxyRequest) string {
+				return jwtTokenString
+			}))
+
+		jwtToken := &gdtoken.Token{
+			BaseToken: gdtoken.BaseToken{
+				AccountName: "Account Name vaw45",
+			},
+		}
+
+		actualJWTToken := ""
+		patches = append(patches, ApplyMethod(reflect.TypeOf(to), "ValidateJWT",
+			func(t *toolbox.Toolbox, ctx context.Context, token string) (*gdtoken.Token, error) {
+				actualJWTToken = token
+				return jwtToken, nil
+			}))
+
+		jobID := "job twer32t23s"
+		jobStatus := JobInProgress
+		jobPercentage := 47.45
+		patches = append(patches, ApplyFunc(getJobProgress,
+			func(ctx context.Context, jobEntry *common.JobDBEntry) (JobStatus, float64, error) {
+				return jobStatus, jobPercentage, nil
+			}))
+
+		getItem := map[string]*dynamodb.AttributeValue{
+			jobIDKey: {S: &jobID},
+		}
+
+		actualGetItemOutput := &dynamodb.GetItemOutput{
+			Item: getItem,
+		}
+		patches = append(patches, ApplyMethod(reflect.TypeOf(dynamoDBClient), "GetItem",
+			func(client *dynamodb.DynamoDB, input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+				return actualGetItemOutput, nil
+			}))
+
+		jobDB := &common.JobDBEntry{
+			JobID: jobID,
+		}
+		var loadedJobID string
+		patches = append(patches, ApplyMethod(reflect.TypeOf(jobDB), "LoadResponses",
+			func(job *common.JobDBEntry, ctx context.Context, box *toolbox.Toolbox) error {
+				loadedJobID = job.JobID
+				return nil
+			}))
+		patches = append(patches, ApplyMethod(reflect.TypeOf(jobDB), "Decrypt",
+			func(job *common.JobDBEntry, ctx context.Context, box *toolbox.Toolbox) {
+			}))
+
+		Reset(func() {
+			// deferred reset all stubs\mocks after every test suite running
+			for _, patch := range patches {
+				patch.Reset()
+			}
+			jobStore = nil
+			to = nil
+		})
+
+		Convey("should successfully delete job", func() {
+			responseData, _ := json.Marshal(struct {
+				common.JobDBEntry
+				JobStatus     JobStatus `json:"jobStatus"`
+				JobPercentage float64   `json:"jobPercentage"`
+			}{
+				JobDBEntry:    *jobDB,
+				JobStatus:     jobStatus,
+				JobPercentage: jobPercentage * 100,
+			})
+			expectedResponse := events.APIGatewayProxyResponse{StatusCode: 200, Body: string(responseData)}
+			actualResponse, _ := getJob(ctx1, *APIGatewayRequest, jobID)
+			So(actualResponse, ShouldResemble, expectedResponse)
+			So(loadedJobID, ShouldEqual, jobID)
+		})
+
+		Convey("should return error if getting the job responses from DB failed", func() {
+			err := errors.New("I am getting job responses from DB error")
+			patches = append(patches, ApplyMethod(reflect.TypeOf(jobDB), "LoadResponses",
+				func(job *common.JobDBEntry, ctx context.Context, box *toolbox.Toolbox) error {
+					return err
+				}))
+			actualResponse, actualError := getJob(ctx1, *APIGatewayRequest, jobID)
+			So(actualError, ShouldResemble, err)
+			So(actualResponse, ShouldResemble, events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError})
+		})
+
+		Convey("should return error if JobID is not provided", func() {
+			expectedResponse := events.APIGatewayProxyResponse{StatusCode: 400}
+			actualResponse, _ := getJob(ctx1, *APIGatewayRequest, "")
+			So(actualResponse, ShouldResemble, expectedResponse)
+		})
+
+		Convey("should get JWT from actual response", func() {
+			getJob(ctx1, *APIGatewayRequest, "")
+			So(actualJWTToken, ShouldResemble, jwtTokenString)
+		})
+
+		Convey("should return error if getting job from DB failed", func() {
+			err := errors.New("I am getting job from DB error")
+			patches = append(patches, ApplyMethod(reflect.TypeOf(dynamoDBClient), "GetItem",
+				func(client *dynamodb.DynamoDB, input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+					return nil, err
+				}))
+			actualResponse, actualError := getJob(ctx1, *APIGatewayRequest, jobID)
+			So(actualError, ShouldResemble, err)
+			So(actualResponse, ShouldResemble, events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError})
+		})
+
+		Convey("should return error if getting job from DB found no jobs", func() {
+			actualGetItemOutput.Item = nil
+			actualResponse, _ := getJob(ctx1, *APIGatewayRequest, jobID)
+			So(actualResponse, ShouldResemble, events.APIGatewayProxyResponse{StatusCode: 404})
+		})
+
+		Convey("should only decrypt the modules that finished after the cursor", func() {
+			item, _ := dynamodbattribute.MarshalMap(common.JobDBEntry{
+				JobID:            jobID,
+				RequestedModules: []string{"apivoid", "urlscanio", "shodan"},
+				ModuleStatuses: map[string]*common.ModuleStatus{
+					"apivoid":   {Status: common.ModuleSucceeded, EndTime: 1610000003.7},
+					"urlscanio": {Status: common.ModuleSucceeded, EndTime: 1610000002.1},
+					"shodan":    {Status: common.ModuleRunning},
+				},
+			})
+			actualGetItemOutput.Item = item
+			var actualModules []string
+			patches = append(patches, ApplyMethod(reflect.TypeOf(jobDB), "DecryptModules",
+				func(job *common.JobDBEntry, ctx context.Context, box *toolbox.Toolbox, modules []string) {
+					actualModules = modules
+				}))
+			APIGatewayRequest.QueryStringParameters = map[string]string{
+				"since": jobCursor(&common.JobDBEntry{
+					RequestedModules: []string{"apivoid"},
+					ModuleStatuses: map[string]*common.ModuleStatus{
+						"apivoid": {Status: common.ModuleSucceeded, EndTime: 1610000003.7},
+					},
+				}),
+			}
+
+			actualResponse, _ := getJob(ctx1, *APIGatewayRequest, jobID)
+			So(actualResponse.StatusCode, ShouldEqual, 200)
+			So(actualModules, ShouldResemble, []string{"urlscanio"})
+			response := struct {
+				Cursor string `json:"cursor"`
+			}{}
+			json.Unmarshal([]byte(actualResponse.Body), &response)
+			cursor, _ := parseJobCursor(response.Cursor)
+			So(cursor, ShouldResemble, map[string]float64{"apivoid": 1610000003.7, "urlscanio": 1610000002.1})
+		})
+
+		Convey("should give a verdict per IOC from the weighted module scores", func() {
+			scored := scoredJobEntry()
+			patches = append(patches, ApplyMethod(reflect.TypeOf(jobDB), "Decrypt",
+				func(job *common.JobDBEntry, ctx context.Context, box *toolbox.Toolbox) {
+					job.DecryptedSubmission = scored.DecryptedSubmission
+					job.DecryptedResponses = scored.DecryptedResponses
+				}))
+			sucuriWeight := 0.0
+			patches = append(patches, ApplyMethod(reflect.TypeOf(to), "GetModules",
+				func(t *toolbox.Toolbox, ctx context.Context) (map[string]toolbox.LambdaMetadata, error) {
+					return map[string]toolbox.LambdaMetadata{"sucuri": {VerdictWeight: &sucuriWeight}}, nil
+				}))
+
+			actualResponse, _ := getJob(ctx1, *APIGatewayRequest, jobID)
+			So(actualResponse.StatusCode, ShouldEqual, 200)
+			response := struct {
+				Verdicts []iocVerdict `json:"verdicts"`
+			}{}
+			So(json.Unmarshal([]byte(actualResponse.Body), &response), ShouldBeNil)
+			So(response.Verdicts, ShouldHaveLength, 4)
+			So(response.Verdicts[0].IOC, ShouldEqual, "godaddy.com")
+			So(response.Verdicts[0].Verdict, ShouldEqual, VerdictBenign)
+			So(response.Verdicts[1].IOC, ShouldEqual, "gumblar.cn")
+			So(response.Verdicts[1].Verdict, ShouldEqual, VerdictMalicious)
+		})
+
+		Convey("should return bad request for invalid cursors", func() {
+			APIGatewayRequest.QueryStringParameters = map[string]string{"since": "not a cursor"}
+			actualResponse, _ := getJob(ctx1, *APIGatewayRequest, jobID)
+			So(actualResponse.StatusCode, ShouldEqual, http.StatusBadRequest)
+		})
+
+	})
+}
+
+func TestGetJobs(t *testing.T) {
+
+	Convey("getJobs", t, func() {
+		// setup stubs\mocks
+		patches := []*Patches{}
+		ctx1 := context.Background()
+		actualDynamoDBClient := &dynamodb.DynamoDB{}
+		patches = append(patches, ApplyFunc(dynamodb.New,
+			func(p client.ConfigProvider, cfgs ...*aws.Config) *dynamodb.DynamoDB {
+				return actualDynamoDBClient
+			}))
+		to = toolbox.GetToolbox()
+		dynamoDBClient := dynamodb.New(to.AWSSession)
+		jobStore = jobstore.NewDynamoDBStore(to)
+
+		jobID := "job 56243262 fgw"
+		jobStatus := JobInProgress
+		jobPercentage := 65.4
+		patches = append(patches, ApplyFunc(getJobProgress,
+			func(ctx context.Context, jobEntry *common.JobDBEntry) (JobStatus, float64, error) {
+				return jobStatus, jobPercentage, nil
+			}))
+
+		APIGatewayRequest := &events.APIGatewayProxyRequest{
+			Path: "Super cool pat2345frq34",
+		}
+
+		jwtTokenString := "I am cool JWK secret token345 gw4vw45"
+		patches = append(patches, ApplyFunc(toolbox.GetJWTFromRequest,
+			func(request events.APIGatewayProxyRequest) string {
+				return jwtTokenString
+			}))
+
+		jwtToken := &gdtoken.Token{
+			BaseToken: gdtoken.BaseToken{
+				AccountName: "Account Name vaw45",
+			},
+		}
+
+		actualJWTToken := ""
+		patches = append(patches, ApplyMethod(reflect.TypeOf(to), "ValidateJWT",
+			func(t *toolbox.Toolbox, ctx context.Context, token string) (*gdtoken.Token, error) {
+				actualJWTToken = token
+				return jwtToken, nil
+			}))
+
+		jobDB := &common.JobDBEntry{
+			JobID: jobID,
+		}
+		patches = append(patches, ApplyMethod(reflect.TypeOf(jobDB), "Decrypt",
+			func(job *common.JobDBEntry, ctx context.Context, box *toolbox.Toolbox) {
+			}))
+
+		var foundJobsInDB int64
+		foundJobsInDB = 1
+
+		foundItem := map[string]*dynamodb.AttributeValue{
+			jobIDKey:           {S: &jobID},
+			"requestedModules": {L: []*dynamodb.AttributeValue{{S: aws.String("apivoid")}}},
+			"iocTypes":         {L: []*dynamodb.AttributeValue{{S: aws.String("DOMAIN")}}},
+			"metadata":         {M: map[string]*dynamodb.AttributeValue{"name": {S: aws.String("My Test Run")}}},
+		}
+		foundItems := []map[string]*dynamodb.AttributeValue{foundItem}
+		actualDynamodbQueryOutput := &dynamodb.QueryOutput{
+			Count: &foundJobsInDB,
+			Items: foundItems,
+		}
+		var actualQueryInput *dynamodb.QueryInput
+		patches = append(patches, ApplyMethod(reflect.TypeOf(dynamoDBClient), "Query",
+			func(client *dynamodb.DynamoDB, input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+				actualQueryInput = input
+				return actualDynamodbQueryOutput, nil
+			}))
+
+		decrypted := false
+		patches = append(patches, ApplyMethod(reflect.TypeOf(jobDB), "Decrypt",
+			func(job *common.JobDBEntry, ctx context.Context, box *toolbox.Toolbox) {
+				decrypted = true
+			}))
+
+		listedJobDB := common.JobDBEntry{
+			JobID:            jobID,
+			RequestedModules: []string{"apivoid"},
+			IOCTypes:         []string{"DOMAIN"},
+			Metadata:         map[string]interface{}{"name": "My Test Run"},
+			DecryptedSubmission: map[string]interface{}{
+				"modules":  []string{"apivoid"},
+				"metadata": map[string]interface{}{"name": "My Test Run"},
+			},
+			DecryptedResponses: map[string]interface{}{},
+		}
+
+		dynamodbBuilder := expression.Builder{}
+		patches = append(patches, ApplyFunc(expression.NewBuilder,
+			func() expression.Builder {
+				return dynamodbBuilder
+			}))
+
+		actualExpression := expression.Expression{}
+		patches = append(patches, ApplyMethod(reflect.TypeOf(dynamodbBuilder), "Build",
+			func(builder expression.Builder) (expression.Expression, error) {
+				return actualExpression, nil
+			}))
+
+		Reset(func() {
+			// deferred reset all stubs\mocks after every test suite running
+			// reset in reverse order so functions patched more than once are restored
+			for i := len(patches) - 1; i >= 0; i-- {
+				patches[i].Reset()
+			}
+			jobStore = nil
+			to = nil
+		})
+
+		Convey("should successfully get all jobs", func() {
+			thisModuleResponse := ResponseData{
+				JobDB:         listedJobDB,
+				JobPercentage: jobPercentage * 100,
+			}
+			response := []ResponseData{}
+			response = append(response, thisModuleResponse)
+			responseBytes, _ := json.Marshal(response)
+			expectedResponse := events.APIGatewayProxyResponse{
+				StatusCode: 200,
+				Body:       string(responseBytes),
+			}
+			actualResponse, _ := getJobs(ctx1, *APIGatewayRequest)
+			So(actualResponse, ShouldResemble, expectedResponse)
+			So(decrypted, ShouldBeFalse)
+		})
+
+		Convey("should query the newest jobs of the user from the index", func() {
+			getJobs(ctx1, *APIGatewayRequest)
+			So(*actualQueryInput.IndexName, ShouldEqual, "username-startTime-index")
+			So(*actualQueryInput.ScanIndexForward, ShouldBeFalse)
+			So(*actualQueryInput.Limit, ShouldEqual, defaultJobsLimit)
+		})
+
+		Convey("should get JWT from actual response", func() {
+			getJobs(ctx1, *APIGatewayRequest)
+			So(actualJWTToken, ShouldResemble, jwtTokenString)
+		})
+
+		Convey("should return the cursor of the next page", func() {
+			actualDynamodbQueryOutput.LastEvaluatedKey = map[string]*dynamodb.AttributeValue{
+				jobIDKey:    {S: &jobID},
+				usernameKey: {S: &jwtToken.BaseToken.AccountName},
+				"startTime": {N: aws.String("1610000000")},
+			}
+			actualResponse, _ := getJobs(ctx1, *APIGatewayRequest)
+			So(actualResponse.Headers, ShouldContainKey, nextCursorHeader)
+
+			APIGatewayRequest.QueryStringParameters = map[string]string{"cursor": actualResponse.Headers[nextCursorHeader]}
+			getJobs(ctx1, *APIGatewayRequest)
+			So(actualQueryInput.ExclusiveStartKey, ShouldResemble, actualDynamodbQueryOutput.LastEvaluatedKey)
+		})
+
+		Convey("should only return jobs with the requested status", func() {
+			APIGatewayRequest.QueryStringParameters = map[string]string{"status": string(JobCompleted)}
+			actualResponse, _ := getJobs(ctx1, *APIGatewayRequest)
+			So(actualResponse.Body, ShouldEqual, "[]")
+		})
+
+		Convey("should query again until the page is full", func() {
+			APIGatewayRequest.QueryStringParameters = map[string]string{"status": string(JobCompleted), "limit": "2"}
+			patches = append(patches, ApplyFunc(getJobProgress,
+				func(ctx context.Context, jobEntry *common.JobDBEntry) (JobStatus, float64, error) {
+					if jobEntry.JobID == "in progress" {
+						return JobInProgress, 0.5, nil
+					}
+					return JobCompleted, 1, nil
+				}))
+			pages := [][]string{{"in progress", "job 1"}, {"in progress", "job 2", "job 3"}}
+			queries := 0
+			patches = append(patches, ApplyMethod(reflect.TypeOf(dynamoDBClient), "Query",
+				func(client *dynamodb.DynamoDB, input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+					output := &dynamodb.QueryOutput{}
+					for i, pageJobID := range pages[queries] {
+						output.Items = append(output.Items, map[string]*dynamodb.AttributeValue{
+							jobIDKey:    {S: aws.String(pageJobID)},
+							"startTime": {N: aws.String(fmt.Sprintf("161000000%d.5", 9-i))},
+							"iocTypes":  {L: []*dynamodb.AttributeValue{}},
+						})
+					}
+					if queries == 0 {
+						output.LastEvaluatedKey = map[string]*dynamodb.AttributeValue{jobIDKey: {S: aws.String("job 1")}, "startTime": {N: aws.String("1610000008.5")}}
+					}
+					queries++
+					return output, nil
+				}))
+
+			actualResponse, _ := getJobs(ctx1, *APIGatewayRequest)
+			response := []ResponseData{}
+			json.Unmarshal([]byte(actualResponse.Body), &response)
+			So(queries, ShouldEqual, 2)
+			So(len(response), ShouldEqual, 2)
+			So(response[0].JobDB.JobID, ShouldEqual, "job 1")
+			So(response[1].JobDB.JobID, ShouldEqual, "job 2")
+
+			// The next page starts after the last job returned, not after the last job queried
+			next, err := jobstore.DecodeCursor(actualResponse.Headers[nextCursorHeader])
+			So(err, ShouldBeNil)
+			So(next, ShouldResemble, &jobstore.Cursor{JobID: "job 2", StartTime: "1610000008.5"})
+		})
+
+		Convey("should return bad request for invalid filters", func() {
+			APIGatewayRequest.QueryStringParameters = map[string]string{"status": "Done"}
+			actualResponse, _ := getJobs(ctx1, *APIGatewayRequest)
+			So(actualResponse.StatusCode, ShouldEqual, http.StatusBadRequest)
+			So(actualQueryInput, ShouldBeNil)
+		})
+
+		Convey("should decrypt jobs created before the listing metadata was stored", func() {
+			delete(foundItem, "iocTypes")
+			var actualFetchedJobID string
+			patches = append(patches, ApplyFunc(fetchJob,
+				func(ctx context.Context, jobID string) (*common.JobDBEntry, error) {
+					actualFetchedJobID = jobID
+					return &common.JobDBEntry{JobID: jobID}, nil
+				}))
+			patches = append(patches, ApplyMethod(reflect.TypeOf(&common.JobDBEntry{}), "LoadResponses",
+				func(job *common.JobDBEntry, ctx context.Context, box *toolbox.Toolbox) error {
+					return nil
+				}))
+			getJobs(ctx1, *APIGatewayRequest)
+			So(actualFetchedJobID, ShouldEqual, jobID)
+			So(decrypted, ShouldBeTrue)
+		})
+
+		Convey("should return error if Query expression cannot be built", func() {
+			err := errors.New("I am query expression built error")
+			patches = append(patches, ApplyMethod(reflect.TypeOf(dynamodbBuilder), "Build",
+				func(builder expression.Builder) (expression.Expression, error) {
+					return actualExpression, err
+				}))
+			actualResponse, actualError := getJobs(ctx1, *APIGatewayRequest)
+			So(actualError, ShouldResemble, err)
+			So(actualResponse, ShouldResemble, events.APIGatewayProxyResponse{StatusCode: 500})
+		})
+
+		Convey("should return error if Query cannot query the DB", func() {
+			err := errors.New("I am query in DB error")
+			patches = append(patches, ApplyMethod(reflect.TypeOf(dynamoDBClient), "Query",
+				func(client *dynamodb.DynamoDB, input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+					return nil, err
+				}))
+			actualResponse, actualError := getJobs(ctx1, *APIGatewayRequest)
+			So(actualError, ShouldResemble, fmt.Errorf("error getting jobs from database: %w", err))
+			So(actualResponse, ShouldResemble, events.APIGatewayProxyResponse{StatusCode: 500})
+		})
+
+		Convey("should call progress with proper job entry found", func() {
+			var expectedJobEntry *common.JobDBEntry
+			patches = append(patches, ApplyFunc(getJobProgress,
+				func(ctx context.Context, jobEntry *common.JobDBEntry) (JobStatus, float64, error) {
+					expectedJobEntry = jobEntry
+					return jobStatus, jobPercentage, nil
+				}))
+			getJobs(ctx1, *APIGatewayRequest)
+			So(expectedJobEntry, ShouldResemble, &listedJobDB)
+		})
+	})
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGroupResponsesByType(t *testing.T) {
+
+	Convey("groupResponsesByType", t, func() {
+		var jobDB *common.JobDBEntry
+		var TestJobEntryData = `{
+			"jobId": "Some job ID 56y4536",
+			"requestedModules": ["whois", "urlhaus"],
+			"submission": {},
+			"responses": {
+				"whois": [
+					{"Title": "Whois", "iocType": "DOMAIN"}
+				],
+				"urlhaus": [
+					{"Title": "Host", "iocType": "DOMAIN"},
+					{"Title": "URL", "iocType": "URL"},
+					{"Title": "Legacy"}
+				]
+			}
+		}`
+		json.Unmarshal([]byte(TestJobEntryData), &jobDB)
+
+		Convey("should group each module's data by IOC type", func() {
+			responsesByType := groupResponsesByType(jobDB)
+			So(len(responsesByType), ShouldEqual, 3)
+			So(len(responsesByType[triage.DomainType]["whois"]), ShouldEqual, 1)
+			So(len(responsesByType[triage.DomainType]["urlhaus"]), ShouldEqual, 1)
+			So(len(responsesByType[triage.URLType]["urlhaus"]), ShouldEqual, 1)
+			So(responsesByType[triage.URLType]["whois"], ShouldBeNil)
+		})
+
+		Convey("should put data without an IOC type under UNKNOWN", func() {
+			responsesByType := groupResponsesByType(jobDB)
+			So(responsesByType[triage.UnknownType]["urlhaus"], ShouldResemble, []interface{}{map[string]interface{}{"Title": "Legacy"}})
+		})
+	})
+}
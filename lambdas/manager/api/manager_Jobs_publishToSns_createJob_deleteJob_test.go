@@ -1,4 +1,4 @@
-package main
+package api
 
 import (
 	"context"
@@ -8,19 +8,21 @@ import (
 	"net/http"
 	"reflect"
 	"testing"
+	"time"
 
 	. "github.com/agiledragon/gomonkey/v2"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/client"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
 	"github.com/aws/aws-sdk-go/service/sns"
 	. "github.com/aws/aws-sdk-go/service/sns"
 	"github.com/gdcorp-golang/auth/gdtoken"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/jobstore"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
 	. "github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
+	"github.com/godaddy/asherah/go/appencryption"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -57,7 +59,7 @@ func TestPublishToSns(t *testing.T) {
 				Message:  &submissionMarshalledString,
 				TopicArn: &snsARN,
 			}
-			actualError := publishToSns(tb, ctx1, *APIGatewayRequest, jobID, snsClient, snsARN)
+			actualError := publishToSns(tb, ctx1, common.JobSNSMessage{Submission: *APIGatewayRequest, JobID: jobID}, snsClient, snsARN)
 			So(actualPublishInput, ShouldResemble, expectedPublishInput)
 			So(actualError, ShouldResemble, nil)
 		})
@@ -69,7 +71,7 @@ func TestPublishToSns(t *testing.T) {
 					actualPublishInput = input
 					return nil, err
 				}))
-			actualError := publishToSns(tb, ctx1, *APIGatewayRequest, jobID, snsClient, snsARN)
+			actualError := publishToSns(tb, ctx1, common.JobSNSMessage{Submission: *APIGatewayRequest, JobID: jobID}, snsClient, snsARN)
 			So(actualError, ShouldResemble, err)
 		})
 
@@ -120,11 +122,11 @@ func TestCreateJob(t *testing.T) {
 			}))
 
 		submittedModule := "I am cool64356"
-		encryptedSubmission := &dynamodb.AttributeValue{
-			S: &submittedModule,
+		encryptedSubmission := &appencryption.DataRowRecord{
+			Data: []byte(submittedModule),
 		}
 		patches = append(patches, ApplyFunc(encryptSubmission,
-			func(box *toolbox.Toolbox, ctx context.Context, jobID string, body string) (*dynamodb.AttributeValue, error) {
+			func(box *toolbox.Toolbox, ctx context.Context, jobID string, body string) (*appencryption.DataRowRecord, error) {
 				return encryptedSubmission, nil
 			}))
 
@@ -137,16 +139,22 @@ func TestCreateJob(t *testing.T) {
 
 		actualRequester := ""
 		patches = append(patches, ApplyFunc(storeRequestedModulesList,
-			func(box *toolbox.Toolbox, ctx context.Context, jwt *gdtoken.Token, request *events.APIGatewayProxyRequest, originRequester string, jobID string, encryptedDataMarshalled *dynamodb.AttributeValue) error {
+			func(box *toolbox.Toolbox, ctx context.Context, jwt *gdtoken.Token, request *events.APIGatewayProxyRequest, originRequester string, jobID string, encryptedData *appencryption.DataRowRecord) error {
 				actualRequester = originRequester
 				return nil
 			}))
 
 		patches = append(patches, ApplyFunc(publishToSns,
-			func(box *toolbox.Toolbox, ctx context.Context, request events.APIGatewayProxyRequest, jobID string, snsClient *sns.SNS, topicARN string) error {
+			func(box *toolbox.Toolbox, ctx context.Context, message common.JobSNSMessage, snsClient *sns.SNS, topicARN string) error {
 				return nil
 			}))
 
+		sightingsErr := error(nil)
+		patches = append(patches, ApplyFunc(storeIOCSightings,
+			func(box *toolbox.Toolbox, ctx context.Context, username string, jobID string, request events.APIGatewayProxyRequest) error {
+				return sightingsErr
+			}))
+
 		Reset(func() {
 			// deferred reset all stubs\mocks after every test suite running
 			for _, patch := range patches {
@@ -180,28 +188,28 @@ func TestCreateJob(t *testing.T) {
 
 		Convey("should store module submission in DB properly", func() {
 			actualJobID := ""
-			var actualEncryptedDataMarshalled *dynamodb.AttributeValue
+			var actualEncryptedData *appencryption.DataRowRecord
 			actualFullJWTToken := &gdtoken.Token{}
 			patches = append(patches, ApplyFunc(storeRequestedModulesList,
-				func(box *toolbox.Toolbox, ctx context.Context, jwt *gdtoken.Token, request *events.APIGatewayProxyRequest, originRequester string, jobID string, encryptedDataMarshalled *dynamodb.AttributeValue) error {
+				func(box *toolbox.Toolbox, ctx context.Context, jwt *gdtoken.Token, request *events.APIGatewayProxyRequest, originRequester string, jobID string, encryptedData *appencryption.DataRowRecord) error {
 					actualRequester = originRequester
 					actualJobID = jobID
-					actualEncryptedDataMarshalled = encryptedDataMarshalled
+					actualEncryptedData = encryptedData
 					actualFullJWTToken = jwt
 					return nil
 				}))
 			createJob(tb, ctx1, *APIGatewayRequest)
 			So(actualJobID, ShouldResemble, jobID)
 			So(actualFullJWTToken, ShouldResemble, jwtToken)
-			So(actualEncryptedDataMarshalled, ShouldResemble, encryptedSubmission)
+			So(actualEncryptedData, ShouldResemble, encryptedSubmission)
 		})
 
 		Convey("should publish job in SNS properly", func() {
 			actualJobID := ""
 			actualTopicARN := ""
 			patches = append(patches, ApplyFunc(publishToSns,
-				func(box *toolbox.Toolbox, ctx context.Context, request events.APIGatewayProxyRequest, jobID string, snsClient *sns.SNS, topicARN string) error {
-					actualJobID = jobID
+				func(box *toolbox.Toolbox, ctx context.Context, message common.JobSNSMessage, snsClient *sns.SNS, topicARN string) error {
+					actualJobID = message.JobID
 					actualTopicARN = topicARN
 					return nil
 				}))
@@ -210,6 +218,67 @@ func TestCreateJob(t *testing.T) {
 			So(actualTopicARN, ShouldResemble, topicArn)
 		})
 
+		Convey("should create the job even if the IOC sightings could not be stored", func() {
+			sightingsErr = errors.New("I am sightings error")
+			actualResponse, actualError := createJob(tb, ctx1, *APIGatewayRequest)
+			So(actualError, ShouldBeNil)
+			So(actualResponse.StatusCode, ShouldEqual, 200)
+		})
+
+		Convey("should reject callback URLs that are not https", func() {
+			APIGatewayRequest.Body = `{"iocType": "DOMAIN", "iocs": ["godaddy.com"], "modules": ["apivoid"], "callbackUrl": "http://soar.example.com/threat-api"}`
+			actualResponse, actualError := createJob(tb, ctx1, *APIGatewayRequest)
+			So(actualError, ShouldBeNil)
+			So(actualResponse, ShouldResemble, events.APIGatewayProxyResponse{StatusCode: 400, Body: "Invalid callbackUrl"})
+		})
+
+		Convey("should reject callback URLs inside our network", func() {
+			for _, callbackURL := range []string{"https://169.254.169.254/latest/meta-data", "https://127.0.0.1/threat-api", "https://10.0.0.1/threat-api"} {
+				APIGatewayRequest.Body = `{"iocType": "DOMAIN", "iocs": ["godaddy.com"], "modules": ["apivoid"], "callbackUrl": "` + callbackURL + `"}`
+				actualResponse, actualError := createJob(tb, ctx1, *APIGatewayRequest)
+				So(actualError, ShouldBeNil)
+				So(actualResponse, ShouldResemble, events.APIGatewayProxyResponse{StatusCode: 400, Body: "Invalid callbackUrl"})
+			}
+		})
+
+		Convey("should schedule the callback of jobs with a callback URL for when they time out", func() {
+			scheduledJobIDs := []string{}
+			patches = append(patches, ApplyFunc(common.EnqueueJobCallback, func(ctx context.Context, t *toolbox.Toolbox, jobID string, delay time.Duration) error {
+				So(delay, ShouldEqual, common.JobTimeout)
+				scheduledJobIDs = append(scheduledJobIDs, jobID)
+				return nil
+			}))
+			APIGatewayRequest.Body = `{"iocType": "DOMAIN", "iocs": ["godaddy.com"], "modules": ["apivoid"], "callbackUrl": "https://93.184.216.34/threat-api"}`
+			actualResponse, actualError := createJob(tb, ctx1, *APIGatewayRequest)
+			So(actualError, ShouldBeNil)
+			So(actualResponse.StatusCode, ShouldEqual, 200)
+			So(scheduledJobIDs, ShouldResemble, []string{jobID})
+		})
+
+		Convey("should leave out the modules without enough quota left", func() {
+			trimmedModules := map[string]string{"virustotal": "the job needs up to 3 calls, 2 are left in the monthly quota of virustotal"}
+			patches = append(patches, ApplyFunc(trimModulesOverQuota,
+				func(box *toolbox.Toolbox, ctx context.Context, username string, body string) (string, []string, map[string]string) {
+					return body, []string{"whois"}, trimmedModules
+				}))
+			actualResponse, actualError := createJob(tb, ctx1, *APIGatewayRequest)
+			So(actualError, ShouldBeNil)
+			So(actualResponse.StatusCode, ShouldEqual, 200)
+			So(actualResponse.Body, ShouldContainSubstring, `"trimmedModules":{"virustotal":"the job needs up to 3 calls`)
+		})
+
+		Convey("should reject the job if no module has enough quota left", func() {
+			trimmedModules := map[string]string{"virustotal": "the job needs up to 3 calls, 2 are left in the monthly quota of virustotal"}
+			patches = append(patches, ApplyFunc(trimModulesOverQuota,
+				func(box *toolbox.Toolbox, ctx context.Context, username string, body string) (string, []string, map[string]string) {
+					return body, []string{}, trimmedModules
+				}))
+			actualResponse, actualError := createJob(tb, ctx1, *APIGatewayRequest)
+			So(actualError, ShouldBeNil)
+			So(actualResponse.StatusCode, ShouldEqual, http.StatusTooManyRequests)
+			So(actualResponse.Body, ShouldContainSubstring, "no module has enough quota left for this job")
+		})
+
 		Convey("should return error if JWT validation failed", func() {
 			err := errors.New("I am JWT Validation error")
 			patches = append(patches, ApplyMethod(reflect.TypeOf(tb), "ValidateJWT",
@@ -224,7 +293,7 @@ func TestCreateJob(t *testing.T) {
 		Convey("should return error if encrypt submission failed", func() {
 			err := errors.New("I am encrypt submission error")
 			patches = append(patches, ApplyFunc(encryptSubmission,
-				func(box *toolbox.Toolbox, ctx context.Context, jobID string, body string) (*dynamodb.AttributeValue, error) {
+				func(box *toolbox.Toolbox, ctx context.Context, jobID string, body string) (*appencryption.DataRowRecord, error) {
 					return nil, err
 				}))
 			actualResponse, actualError := createJob(tb, ctx1, *APIGatewayRequest)
@@ -246,7 +315,7 @@ func TestCreateJob(t *testing.T) {
 		Convey("should return error if job submissiob storage in DB failed", func() {
 			err := errors.New("I am error for storing job in DB")
 			patches = append(patches, ApplyFunc(storeRequestedModulesList,
-				func(box *toolbox.Toolbox, ctx context.Context, jwt *gdtoken.Token, request *events.APIGatewayProxyRequest, originRequester string, jobID string, encryptedDataMarshalled *dynamodb.AttributeValue) error {
+				func(box *toolbox.Toolbox, ctx context.Context, jwt *gdtoken.Token, request *events.APIGatewayProxyRequest, originRequester string, jobID string, encryptedData *appencryption.DataRowRecord) error {
 					return err
 				}))
 			actualResponse, actualError := createJob(tb, ctx1, *APIGatewayRequest)
@@ -257,7 +326,7 @@ func TestCreateJob(t *testing.T) {
 		Convey("should return error if Job topic publish ", func() {
 			err := errors.New("I am error during SNS publish of job")
 			patches = append(patches, ApplyFunc(publishToSns,
-				func(box *toolbox.Toolbox, ctx context.Context, request events.APIGatewayProxyRequest, jobID string, snsClient *sns.SNS, topicARN string) error {
+				func(box *toolbox.Toolbox, ctx context.Context, message common.JobSNSMessage, snsClient *sns.SNS, topicARN string) error {
 					return err
 				}))
 			actualResponse, actualError := createJob(tb, ctx1, *APIGatewayRequest)
@@ -280,7 +349,8 @@ func TestDeleteJob(t *testing.T) {
 				return actualDynamoDBClient
 			}))
 		to = toolbox.GetToolbox()
-		dynamoDBClient = dynamodb.New(to.AWSSession)
+		dynamoDBClient := dynamodb.New(to.AWSSession)
+		jobStore = jobstore.NewDynamoDBStore(to)
 
 		jobID := "Generatedjob 562432"
 		APIGatewayRequest := &events.APIGatewayProxyRequest{
@@ -305,46 +375,37 @@ func TestDeleteJob(t *testing.T) {
 				return jwtToken, nil
 			}))
 
-		var foundJobsInDB int64
-		foundJobsInDB = 1
-
 		foundItem := map[string]*dynamodb.AttributeValue{
-			jobIDKey: {S: &jobID},
-		}
-		foundItems := []map[string]*dynamodb.AttributeValue{foundItem}
-		actualDynamodbScanOutput := &dynamodb.ScanOutput{
-			Count: &foundJobsInDB,
-			Items: foundItems,
+			jobIDKey:           {S: &jobID},
+			usernameKey:        {S: &jwtToken.BaseToken.AccountName},
+			"requestedModules": {L: []*dynamodb.AttributeValue{{S: aws.String("apivoid")}}},
 		}
-		patches = append(patches, ApplyMethod(reflect.TypeOf(dynamoDBClient), "Scan",
-			func(client *dynamodb.DynamoDB, input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
-				return actualDynamodbScanOutput, nil
+		actualGetItemOutput := &dynamodb.GetItemOutput{Item: foundItem}
+		patches = append(patches, ApplyMethod(reflect.TypeOf(dynamoDBClient), "GetItem",
+			func(client *dynamodb.DynamoDB, input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+				return actualGetItemOutput, nil
 			}))
 
-		actualDeleteItemOutput := &dynamodb.DeleteItemOutput{}
+		actualDeleteItemOutput := &dynamodb.DeleteItemOutput{Attributes: foundItem}
 		patches = append(patches, ApplyMethod(reflect.TypeOf(dynamoDBClient), "DeleteItem",
 			func(client *dynamodb.DynamoDB, input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
 				return actualDeleteItemOutput, nil
 			}))
 
-		dynamodbBuilder := expression.Builder{}
-		patches = append(patches, ApplyFunc(expression.NewBuilder,
-			func() expression.Builder {
-				return dynamodbBuilder
-			}))
-
-		actualExpression := expression.Expression{}
-		patches = append(patches, ApplyMethod(reflect.TypeOf(dynamodbBuilder), "Build",
-			func(builder expression.Builder) (expression.Expression, error) {
-				return actualExpression, nil
+		var actualDeletedResponses []string
+		patches = append(patches, ApplyFunc(common.DeleteJobResponses,
+			func(ctx context.Context, t *Toolbox, jobID string, modules []string) error {
+				actualDeletedResponses = modules
+				return nil
 			}))
 
 		Reset(func() {
 			// deferred reset all stubs\mocks after every test suite running
-			for _, patch := range patches {
-				patch.Reset()
+			// reset in reverse order so functions patched more than once are restored
+			for i := len(patches) - 1; i >= 0; i-- {
+				patches[i].Reset()
 			}
-			dynamoDBClient = nil
+			jobStore = nil
 			to = nil
 		})
 
@@ -352,6 +413,7 @@ func TestDeleteJob(t *testing.T) {
 			expectedResponse := events.APIGatewayProxyResponse{StatusCode: http.StatusOK}
 			actualResponse, _ := deleteJob(ctx1, *APIGatewayRequest, jobID)
 			So(actualResponse, ShouldResemble, expectedResponse)
+			So(actualDeletedResponses, ShouldResemble, []string{"apivoid"})
 		})
 
 		Convey("should get JWT from actual response", func() {
@@ -370,34 +432,28 @@ func TestDeleteJob(t *testing.T) {
 			So(actualResponse, ShouldResemble, events.APIGatewayProxyResponse{StatusCode: http.StatusUnauthorized})
 		})
 
-		Convey("should return error if cannot build expression for scanning in DynamoDB", func() {
-			err := errors.New("I am build expression error for deleted job error")
-			patches = append(patches, ApplyMethod(reflect.TypeOf(dynamodbBuilder), "Build",
-				func(builder expression.Builder) (expression.Expression, error) {
-					return actualExpression, err
-				}))
-			actualResponse, actualError := deleteJob(ctx1, *APIGatewayRequest, jobID)
-			So(actualError, ShouldResemble, err)
-			So(actualResponse, ShouldResemble, events.APIGatewayProxyResponse{StatusCode: 500})
-		})
-
-		Convey("should return error if scanning in DynamoDB failed", func() {
-			err := errors.New("I am scanning error for deleted job error")
-			patches = append(patches, ApplyMethod(reflect.TypeOf(dynamoDBClient), "Scan",
-				func(client *dynamodb.DynamoDB, input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+		Convey("should return error if getting the job from DynamoDB failed", func() {
+			err := errors.New("I am get item error for deleted job error")
+			patches = append(patches, ApplyMethod(reflect.TypeOf(dynamoDBClient), "GetItem",
+				func(client *dynamodb.DynamoDB, input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
 					return nil, err
 				}))
 			actualResponse, actualError := deleteJob(ctx1, *APIGatewayRequest, jobID)
-			So(actualError, ShouldResemble, fmt.Errorf("error searching for job id in db: %w", err))
+			So(actualError, ShouldResemble, fmt.Errorf("error getting job from DB: %w", err))
 			So(actualResponse, ShouldResemble, events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError})
 		})
 
-		Convey("should return forbidden status if scanning didnt find jobs in DB", func() {
-			var foundJobsInDB int64
-			foundJobsInDB = 0
-			actualDynamodbScanOutput.Count = &foundJobsInDB
+		Convey("should return forbidden status if the job is not in DB", func() {
+			actualGetItemOutput.Item = nil
+			actualResponse, _ := deleteJob(ctx1, *APIGatewayRequest, jobID)
+			So(actualResponse, ShouldResemble, events.APIGatewayProxyResponse{StatusCode: http.StatusForbidden})
+		})
+
+		Convey("should return forbidden status if the job belongs to another user", func() {
+			foundItem[usernameKey] = &dynamodb.AttributeValue{S: aws.String("Another Account Name")}
 			actualResponse, _ := deleteJob(ctx1, *APIGatewayRequest, jobID)
 			So(actualResponse, ShouldResemble, events.APIGatewayProxyResponse{StatusCode: http.StatusForbidden})
+			So(actualDeletedResponses, ShouldBeNil)
 		})
 
 		Convey("should return error if deleting job in DynamoDB failed", func() {
@@ -0,0 +1,316 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	. "github.com/agiledragon/gomonkey/v2"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/gdcorp-golang/auth/gdtoken"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/jobstore"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRetryJob(t *testing.T) {
+
+	Convey("retryJob", t, func() {
+		// setup stubs\mocks
+		patches := []*Patches{}
+		ctx1 := context.Background()
+		actualDynamoDBClient := &dynamodb.DynamoDB{}
+		patches = append(patches, ApplyFunc(dynamodb.New,
+			func(p client.ConfigProvider, cfgs ...*aws.Config) *dynamodb.DynamoDB {
+				return actualDynamoDBClient
+			}))
+		to = toolbox.GetToolbox()
+		jobStore = jobstore.NewDynamoDBStore(to)
+
+		jobID := "Generatedjob 7345234"
+		APIGatewayRequest := &events.APIGatewayProxyRequest{
+			Path: "v1/jobs/Generatedjob 7345234/retry",
+		}
+
+		jwtToken := &gdtoken.Token{
+			BaseToken: gdtoken.BaseToken{
+				AccountName: "Account Name 34t5gw",
+			},
+		}
+		patches = append(patches, ApplyMethod(reflect.TypeOf(to), "ValidateJWT",
+			func(t *toolbox.Toolbox, ctx context.Context, token string) (*gdtoken.Token, error) {
+				return jwtToken, nil
+			}))
+
+		actualOwner := ""
+		foundJob := &common.JobDBEntry{
+			JobID:            jobID,
+			StartTime:        float64(time.Now().Unix()),
+			RequestedModules: []string{"apivoid", "urlscanio", "shodan"},
+		}
+		patches = append(patches, ApplyFunc(findOwnedJob,
+			func(ctx context.Context, username string, jobID string) (*common.JobDBEntry, error) {
+				actualOwner = username
+				return foundJob, nil
+			}))
+
+		moduleStatuses := map[string]*common.ModuleStatus{
+			"apivoid":   {Status: common.ModuleSucceeded},
+			"urlscanio": {Status: common.ModuleFailed, ErrorCode: common.ModuleErrorCodeModule, Retryable: true},
+			"shodan":    {Status: common.ModuleSkippedUnauthorized, ErrorCode: common.ModuleErrorCodeUnauthorized},
+		}
+		jobDB := &common.JobDBEntry{}
+		loadedResponses := false
+		patches = append(patches, ApplyMethod(reflect.TypeOf(jobDB), "LoadResponses",
+			func(job *common.JobDBEntry, ctx context.Context, box *toolbox.Toolbox) error {
+				loadedResponses = true
+				return nil
+			}))
+		patches = append(patches, ApplyMethod(reflect.TypeOf(jobDB), "Decrypt",
+			func(job *common.JobDBEntry, ctx context.Context, box *toolbox.Toolbox) {
+				job.ModuleStatuses = moduleStatuses
+				job.DecryptedSubmission = map[string]interface{}{
+					"iocType": "DOMAIN",
+					"iocs":    []interface{}{"godaddy.com"},
+					"modules": []interface{}{"apivoid", "urlscanio", "shodan"},
+				}
+			}))
+
+		var actualResetModules []string
+		patches = append(patches, ApplyFunc(resetModules,
+			func(ctx context.Context, jobEntry *common.JobDBEntry, modules []string) error {
+				actualResetModules = modules
+				return nil
+			}))
+
+		topicARN := "Topic ARN 245twer"
+		patches = append(patches, ApplyFunc(countTopicSubscriptions,
+			func(box *toolbox.Toolbox, ctx context.Context, snsClient *sns.SNS) (int, string, error) {
+				return 1, topicARN, nil
+			}))
+
+		var actualPublishedRequest events.APIGatewayProxyRequest
+		actualPublishedJobID := ""
+		patches = append(patches, ApplyFunc(publishToSns,
+			func(box *toolbox.Toolbox, ctx context.Context, message common.JobSNSMessage, snsClient *sns.SNS, topicARN string) error {
+				actualPublishedRequest = message.Submission
+				actualPublishedJobID = message.JobID
+				return nil
+			}))
+
+		Reset(func() {
+			// deferred reset all stubs\mocks after every test suite running
+			for i := len(patches) - 1; i >= 0; i-- {
+				patches[i].Reset()
+			}
+			jobStore = nil
+			to = nil
+		})
+
+		Convey("should retry only the retryable failed modules", func() {
+			actualResponse, err := retryJob(ctx1, *APIGatewayRequest, jobID)
+			So(err, ShouldBeNil)
+			So(actualResponse, ShouldResemble, events.APIGatewayProxyResponse{
+				StatusCode: http.StatusOK,
+				Body:       `{"jobId":"Generatedjob 7345234","modules":["urlscanio"]}`,
+			})
+			So(actualOwner, ShouldEqual, jwtToken.BaseToken.AccountName)
+			So(actualResetModules, ShouldResemble, []string{"urlscanio"})
+			// The found job has no module statuses, so its failed modules are found in its responses
+			So(loadedResponses, ShouldBeTrue)
+		})
+
+		Convey("should publish the original submission restricted to the retried modules", func() {
+			retryJob(ctx1, *APIGatewayRequest, jobID)
+			So(actualPublishedJobID, ShouldEqual, jobID)
+			publishedSubmission, _ := common.GetJobSubmission(actualPublishedRequest)
+			So(publishedSubmission, ShouldResemble, common.JobSubmission{
+				Modules: []string{"urlscanio"},
+				IOCs:    []string{"godaddy.com"},
+				IOCType: "DOMAIN",
+			})
+		})
+
+		Convey("should return forbidden status if the user does not own the job", func() {
+			patches = append(patches, ApplyFunc(findOwnedJob,
+				func(ctx context.Context, username string, jobID string) (*common.JobDBEntry, error) {
+					return nil, nil
+				}))
+			actualResponse, _ := retryJob(ctx1, *APIGatewayRequest, jobID)
+			So(actualResponse, ShouldResemble, events.APIGatewayProxyResponse{StatusCode: http.StatusForbidden})
+			So(actualResetModules, ShouldBeNil)
+		})
+
+		Convey("should return error if JWT validation failed", func() {
+			err := errors.New("I am JWT Validation for retried job error")
+			patches = append(patches, ApplyMethod(reflect.TypeOf(to), "ValidateJWT",
+				func(t *toolbox.Toolbox, ctx context.Context, token string) (*gdtoken.Token, error) {
+					return nil, err
+				}))
+			actualResponse, actualError := retryJob(ctx1, *APIGatewayRequest, jobID)
+			So(actualError, ShouldResemble, fmt.Errorf("error validating jwt: %w", err))
+			So(actualResponse, ShouldResemble, events.APIGatewayProxyResponse{StatusCode: http.StatusUnauthorized})
+		})
+
+		Convey("should return conflict if there are no modules to retry", func() {
+			moduleStatuses["urlscanio"] = &common.ModuleStatus{Status: common.ModuleSucceeded}
+			actualResponse, _ := retryJob(ctx1, *APIGatewayRequest, jobID)
+			So(actualResponse.StatusCode, ShouldEqual, http.StatusConflict)
+			So(actualResetModules, ShouldBeNil)
+		})
+
+		Convey("should not retry cancelled jobs", func() {
+			foundJob.Cancelled = true
+			actualResponse, _ := retryJob(ctx1, *APIGatewayRequest, jobID)
+			So(actualResponse, ShouldResemble, events.APIGatewayProxyResponse{StatusCode: http.StatusConflict, Body: "Job is cancelled"})
+			So(actualResetModules, ShouldBeNil)
+		})
+
+		Convey("should return error if resetting the modules failed", func() {
+			err := errors.New("I am reset modules error")
+			patches = append(patches, ApplyFunc(resetModules,
+				func(ctx context.Context, jobEntry *common.JobDBEntry, modules []string) error {
+					return err
+				}))
+			actualResponse, actualError := retryJob(ctx1, *APIGatewayRequest, jobID)
+			So(actualError, ShouldResemble, err)
+			So(actualResponse, ShouldResemble, events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError})
+			So(actualPublishedJobID, ShouldEqual, "")
+		})
+	})
+}
+
+func TestGetRetryableModules(t *testing.T) {
+
+	Convey("getRetryableModules", t, func() {
+		ctx1 := context.Background()
+		to = toolbox.GetToolbox()
+
+		Reset(func() {
+			to = nil
+		})
+
+		Convey("should retry modules that never finished once the job timed out", func() {
+			var jobDB *common.JobDBEntry
+			json.Unmarshal([]byte(`{
+				"jobId": "Some job ID 345234",
+				"startTime": `+fmt.Sprintf("%d", time.Now().Add(-time.Minute*30).Unix())+`,
+				"requestedModules": ["apivoid", "urlscanio", "shodan"],
+				"responses": {},
+				"moduleStatus": {
+					"apivoid": {"status": "PARTIAL", "errorCode": "TIMEOUT", "retryable": true},
+					"urlscanio": {"status": "RUNNING"},
+					"shodan": {"status": "SKIPPED_UNSUPPORTED", "errorCode": "UNSUPPORTED_IOC_TYPE"}
+				}
+			}`), &jobDB)
+			So(getRetryableModules(ctx1, jobDB), ShouldResemble, []string{"apivoid", "urlscanio"})
+		})
+
+		Convey("should not retry modules that are still running", func() {
+			var jobDB *common.JobDBEntry
+			json.Unmarshal([]byte(`{
+				"jobId": "Some job ID 345234",
+				"startTime": `+fmt.Sprintf("%d", time.Now().Add(-time.Minute*30).Unix())+`,
+				"lastDispatchTime": `+fmt.Sprintf("%d", time.Now().Unix())+`,
+				"requestedModules": ["apivoid", "urlscanio"],
+				"responses": {},
+				"moduleStatus": {
+					"apivoid": {"status": "SUCCEEDED"},
+					"urlscanio": {"status": "PENDING"}
+				}
+			}`), &jobDB)
+			So(getRetryableModules(ctx1, jobDB), ShouldResemble, []string{})
+		})
+
+		Convey("should retry modules with errors in their responses for jobs without module statuses", func() {
+			var jobDB *common.JobDBEntry
+			json.Unmarshal([]byte(`{
+				"jobId": "Some job ID 345234",
+				"startTime": `+fmt.Sprintf("%d", time.Now().Add(-time.Minute*30).Unix())+`,
+				"requestedModules": ["apivoid", "urlscanio", "recordedfuture"],
+				"responses": {
+					"apivoid": [{"data": {}}],
+					"urlscanio": [{"error": "I am error"}]
+				}
+			}`), &jobDB)
+			So(getRetryableModules(ctx1, jobDB), ShouldResemble, []string{"urlscanio", "recordedfuture"})
+		})
+	})
+}
+
+func TestFindOwnedJob(t *testing.T) {
+
+	Convey("findOwnedJob", t, func() {
+		// setup stubs\mocks
+		patches := []*Patches{}
+		ctx1 := context.Background()
+		actualDynamoDBClient := &dynamodb.DynamoDB{}
+		patches = append(patches, ApplyFunc(dynamodb.New,
+			func(p client.ConfigProvider, cfgs ...*aws.Config) *dynamodb.DynamoDB {
+				return actualDynamoDBClient
+			}))
+		to = toolbox.GetToolbox()
+		dynamoDBClient := dynamodb.New(to.AWSSession)
+		jobStore = jobstore.NewDynamoDBStore(to)
+
+		jobID := "Some job ID 345234"
+		item := map[string]*dynamodb.AttributeValue{
+			jobIDKey:    {S: aws.String(jobID)},
+			usernameKey: {S: aws.String("Account Name 2q34tg")},
+		}
+		var actualGetItemInput *dynamodb.GetItemInput
+		patches = append(patches, ApplyMethod(reflect.TypeOf(dynamoDBClient), "GetItem",
+			func(d *dynamodb.DynamoDB, input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+				actualGetItemInput = input
+				return &dynamodb.GetItemOutput{Item: item}, nil
+			}))
+
+		Reset(func() {
+			// deferred reset all stubs\mocks after every test suite running
+			for i := len(patches) - 1; i >= 0; i-- {
+				patches[i].Reset()
+			}
+			jobStore = nil
+			to = nil
+		})
+
+		Convey("should get the job by its key if the user owns it", func() {
+			actualItem, actualError := findOwnedJob(ctx1, "Account Name 2q34tg", jobID)
+			So(actualError, ShouldBeNil)
+			So(actualItem, ShouldResemble, &common.JobDBEntry{JobID: jobID, Username: "Account Name 2q34tg"})
+			So(*actualGetItemInput.Key[jobIDKey].S, ShouldEqual, jobID)
+		})
+
+		Convey("should return nil if another user owns the job", func() {
+			actualItem, actualError := findOwnedJob(ctx1, "Someone else", jobID)
+			So(actualError, ShouldBeNil)
+			So(actualItem, ShouldBeNil)
+		})
+
+		Convey("should return nil if there is no such job", func() {
+			item = nil
+			actualItem, actualError := findOwnedJob(ctx1, "Account Name 2q34tg", jobID)
+			So(actualError, ShouldBeNil)
+			So(actualItem, ShouldBeNil)
+		})
+
+		Convey("should return error if the job could not be fetched", func() {
+			patches = append(patches, ApplyMethod(reflect.TypeOf(dynamoDBClient), "GetItem",
+				func(d *dynamodb.DynamoDB, input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+					return nil, errors.New("I am GetItem error")
+				}))
+			_, actualError := findOwnedJob(ctx1, "Account Name 2q34tg", jobID)
+			So(actualError, ShouldNotBeNil)
+		})
+	})
+}
@@ -1,4 +1,4 @@
-package main
+package api
 
 import (
 	"context"
@@ -64,6 +64,30 @@ func TestManagerHandler(t *testing.T) {
 				return deleteJobResponse, nil
 			}))
 
+		retryJobResponse := events.APIGatewayProxyResponse{}
+		var isRetryJobCalled events.APIGatewayProxyRequest
+		patches = append(patches, ApplyFunc(retryJob,
+			func(ctx context.Context, request events.APIGatewayProxyRequest, jobId string) (events.APIGatewayProxyResponse, error) {
+				isRetryJobCalled = request
+				return retryJobResponse, nil
+			}))
+
+		cancelJobResponse := events.APIGatewayProxyResponse{}
+		var isCancelJobCalled events.APIGatewayProxyRequest
+		patches = append(patches, ApplyFunc(cancelJob,
+			func(ctx context.Context, request events.APIGatewayProxyRequest, jobId string) (events.APIGatewayProxyResponse, error) {
+				isCancelJobCalled = request
+				return cancelJobResponse, nil
+			}))
+
+		extendJobResponse := events.APIGatewayProxyResponse{}
+		var isExtendJobCalled events.APIGatewayProxyRequest
+		patches = append(patches, ApplyFunc(extendJob,
+			func(ctx context.Context, request events.APIGatewayProxyRequest, jobId string) (events.APIGatewayProxyResponse, error) {
+				isExtendJobCalled = request
+				return extendJobResponse, nil
+			}))
+
 		classifyIOCsResponse := events.APIGatewayProxyResponse{}
 		var isClassifyIOCsCalled events.APIGatewayProxyRequest
 		patches = append(patches, ApplyFunc(classifyIOCs,
@@ -80,6 +104,30 @@ func TestManagerHandler(t *testing.T) {
 				return GetModulesResponse, nil
 			}))
 
+		getIOCJobsResponse := events.APIGatewayProxyResponse{}
+		var isGetIOCJobsCalled events.APIGatewayProxyRequest
+		patches = append(patches, ApplyFunc(getIOCJobs,
+			func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+				isGetIOCJobsCalled = request
+				return getIOCJobsResponse, nil
+			}))
+
+		getUsageResponse := events.APIGatewayProxyResponse{}
+		var isGetUsageCalled events.APIGatewayProxyRequest
+		patches = append(patches, ApplyFunc(getUsage,
+			func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+				isGetUsageCalled = request
+				return getUsageResponse, nil
+			}))
+
+		exportJobResponse := events.APIGatewayProxyResponse{}
+		var isExportJobCalled events.APIGatewayProxyRequest
+		patches = append(patches, ApplyFunc(exportJob,
+			func(ctx context.Context, request events.APIGatewayProxyRequest, jobId string) (events.APIGatewayProxyResponse, error) {
+				isExportJobCalled = request
+				return exportJobResponse, nil
+			}))
+
 		Reset(func() {
 			// deferred reset all stubs\mocks after every test suite running
 			for _, patch := range patches {
@@ -89,7 +137,7 @@ func TestManagerHandler(t *testing.T) {
 
 		Convey("should return non found error if no API end point is found", func() {
 			expectedResponse := events.APIGatewayProxyResponse{StatusCode: http.StatusNotFound, Body: string("")}
-			actualResponse, _ := handler(ctx1, *APIGatewayRequest)
+			actualResponse, _ := Handler(ctx1, *APIGatewayRequest)
 			So(actualResponse, ShouldResemble, expectedResponse)
 		})
 
@@ -120,6 +168,16 @@ func TestManagerHandler(t *testing.T) {
 			&isGetJobCalled,
 		})
 
+		APICalls = append(APICalls, &TestAPICall{
+			"Export job",
+			"/jobs/job_id_9245245/export",
+			map[string]string{
+				jobIDKey: "job_id_9245245",
+			},
+			http.MethodGet,
+			&isExportJobCalled,
+		})
+
 		APICalls = append(APICalls, &TestAPICall{
 			"Get many jobs",
 			"/jobs",
@@ -138,6 +196,36 @@ func TestManagerHandler(t *testing.T) {
 			&isDeleteJobCalled,
 		})
 
+		APICalls = append(APICalls, &TestAPICall{
+			"Retry job",
+			"/jobs/job_id_24562345/retry",
+			map[string]string{
+				jobIDKey: "job_id_24562345",
+			},
+			http.MethodPost,
+			&isRetryJobCalled,
+		})
+
+		APICalls = append(APICalls, &TestAPICall{
+			"Cancel job",
+			"/jobs/job_id_7345734/cancel",
+			map[string]string{
+				jobIDKey: "job_id_7345734",
+			},
+			http.MethodPost,
+			&isCancelJobCalled,
+		})
+
+		APICalls = append(APICalls, &TestAPICall{
+			"Extend job",
+			"/jobs",
+			map[string]string{
+				jobIDKey: "job_id_83452345",
+			},
+			http.MethodPatch,
+			&isExtendJobCalled,
+		})
+
 		APICalls = append(APICalls, &TestAPICall{
 			"Classify IOCs",
 			"/classifications",
@@ -154,13 +242,31 @@ func TestManagerHandler(t *testing.T) {
 			&isGetModulesCalled,
 		})
 
+		APICalls = append(APICalls, &TestAPICall{
+			"Get usage",
+			"/usage",
+			map[string]string{},
+			http.MethodGet,
+			&isGetUsageCalled,
+		})
+
+		APICalls = append(APICalls, &TestAPICall{
+			"Get IOC jobs",
+			"/iocs/1.2.3.4/jobs",
+			map[string]string{
+				iocKey: "1.2.3.4",
+			},
+			http.MethodGet,
+			&isGetIOCJobsCalled,
+		})
+
 		for _, APICall := range APICalls {
 			Convey("should call "+APICall.Name+" API properly by it's URL", func() {
 				APIGatewayRequest.Resource = fmt.Sprintf("%d", rand.Intn(1000))
 				APIGatewayRequest.Path = version + APICall.Path
 				APIGatewayRequest.HTTPMethod = APICall.Method
 				APIGatewayRequest.PathParameters = APICall.PathParameters
-				handler(ctx1, *APIGatewayRequest)
+				Handler(ctx1, *APIGatewayRequest)
 				So(APICall.Result, ShouldResemble, APIGatewayRequest)
 			})
 		}
@@ -168,14 +274,21 @@ func TestManagerHandler(t *testing.T) {
 		Convey("should return error if Delete API has no Job ID", func() {
 			APIGatewayRequest.Path = version + "/jobs"
 			APIGatewayRequest.HTTPMethod = http.MethodDelete
-			actualResponse, _ := handler(ctx1, *APIGatewayRequest)
+			actualResponse, _ := Handler(ctx1, *APIGatewayRequest)
 			So(actualResponse, ShouldResemble, events.APIGatewayProxyResponse{StatusCode: http.StatusBadRequest, Body: "Missing jobId"})
 		})
 
-		Convey("should return error if Jobs API method is not allowed or supported", func() {
+		Convey("should return error if Extend API has no Job ID", func() {
 			APIGatewayRequest.Path = version + "/jobs"
 			APIGatewayRequest.HTTPMethod = http.MethodPatch
-			actualResponse, _ := handler(ctx1, *APIGatewayRequest)
+			actualResponse, _ := Handler(ctx1, *APIGatewayRequest)
+			So(actualResponse, ShouldResemble, events.APIGatewayProxyResponse{StatusCode: http.StatusBadRequest, Body: "Missing jobId"})
+		})
+
+		Convey("should return error if Jobs API method is not allowed or supported", func() {
+			APIGatewayRequest.Path = version + "/jobs"
+			APIGatewayRequest.HTTPMethod = http.MethodPut
+			actualResponse, _ := Handler(ctx1, *APIGatewayRequest)
 			So(actualResponse, ShouldResemble, events.APIGatewayProxyResponse{StatusCode: http.StatusMethodNotAllowed})
 		})
 
@@ -1,4 +1,4 @@
-package main
+package api
 
 import (
 	"context"
@@ -36,7 +36,7 @@ func TestJobWork(t *testing.T) {
 	var jobID string
 	t.Run("CreateJob", func(t *testing.T) {
 		// Create an empty job
-		resp, err := handler(context.Background(), events.APIGatewayProxyRequest{
+		resp, err := Handler(context.Background(), events.APIGatewayProxyRequest{
 			Headers:    headers,
 			Body:       testBody,
 			Path:       version + "/jobs",
@@ -67,7 +67,7 @@ func TestJobWork(t *testing.T) {
 
 	t.Run("GetJob", func(t *testing.T) {
 		// Get the job status
-		resp, err := handler(context.Background(), events.APIGatewayProxyRequest{
+		resp, err := Handler(context.Background(), events.APIGatewayProxyRequest{
 			Path:           version + "/jobs/",
 			PathParameters: map[string]string{jobIDKey: jobID},
 			HTTPMethod:     http.MethodGet,
@@ -107,7 +107,7 @@ func TestJobWork(t *testing.T) {
 
 		// Wait a bit and check if the job completed
 		time.Sleep(time.Second * 3)
-		resp, err = handler(context.Background(), events.APIGatewayProxyRequest{
+		resp, err = Handler(context.Background(), events.APIGatewayProxyRequest{
 			Path:           version + "/jobs/",
 			PathParameters: map[string]string{jobIDKey: jobID},
 			HTTPMethod:     http.MethodGet,
@@ -134,7 +134,7 @@ func TestJobWork(t *testing.T) {
 
 	t.Run("GetJobs", func(t *testing.T) {
 		// Get the jobs of this user
-		resp, err := handler(context.Background(), events.APIGatewayProxyRequest{
+		resp, err := Handler(context.Background(), events.APIGatewayProxyRequest{
 			Path:       version + "/jobs/",
 			Headers:    headers,
 			HTTPMethod: http.MethodGet,
@@ -182,7 +182,7 @@ func TestJobWork(t *testing.T) {
 
 	t.Run("DeleteJob", func(t *testing.T) {
 		// Get the created job
-		resp, err := handler(context.Background(), events.APIGatewayProxyRequest{
+		resp, err := Handler(context.Background(), events.APIGatewayProxyRequest{
 			Path:           version + "/jobs/",
 			PathParameters: map[string]string{jobIDKey: jobID},
 			Headers:        headers,
@@ -196,7 +196,7 @@ func TestJobWork(t *testing.T) {
 		}
 
 		// Check if job is actually deleted
-		resp, err = handler(context.Background(), events.APIGatewayProxyRequest{
+		resp, err = Handler(context.Background(), events.APIGatewayProxyRequest{
 			Path:           version + "/jobs/",
 			PathParameters: map[string]string{jobIDKey: jobID},
 			HTTPMethod:     http.MethodGet,
@@ -213,7 +213,7 @@ func TestJobWork(t *testing.T) {
 }
 
 func TestClassifyIOCs(t *testing.T) {
-	resp, err := handler(context.Background(), events.APIGatewayProxyRequest{
+	resp, err := Handler(context.Background(), events.APIGatewayProxyRequest{
 		Path:       version + "/classifications",
 		HTTPMethod: "POST",
 		Body:       `{"iocs":["1.1.1.1","domain.com","email@email.com"]}`,
@@ -244,7 +244,7 @@ func TestClassifyIOCs(t *testing.T) {
 }
 
 func TestGetModulesRequest(t *testing.T) {
-	resp, err := handler(context.Background(), events.APIGatewayProxyRequest{
+	resp, err := Handler(context.Background(), events.APIGatewayProxyRequest{
 		Path:       version + "/modules",
 		HTTPMethod: "GET",
 	})
@@ -0,0 +1,266 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
+)
+
+const (
+	// defaultTLP is the TLP of jobs without a tlp: tag
+	defaultTLP = "tlp:amber"
+	// MISP distribution levels
+	mispDistributionOrganisation = "0"
+	mispDistributionInherit      = "5"
+	// MISP analysis levels
+	mispAnalysisOngoing   = "1"
+	mispAnalysisCompleted = "2"
+	// mispThreatLevelUndefined leaves the threat level to the analysts
+	mispThreatLevelUndefined = "4"
+)
+
+// mispNamespace is the namespace of the UUIDs of exported events, so exporting a job twice gives the same event
+var mispNamespace = mustParseUUID("b3c99e46-64a9-42ac-bb1b-5eb6411a957a")
+
+// mispAttributeType is the MISP type and category of an IOC type
+type mispAttributeType struct {
+	Type     string
+	Category string
+	ToIDS    bool
+}
+
+// mispAttributeTypes maps IOC types to MISP attribute types, other IOC types are exported as text
+var mispAttributeTypes = map[triage.IOCType]mispAttributeType{
+	triage.DomainType:          {Type: "domain", Category: "Network activity", ToIDS: true},
+	triage.GoDaddyHostnameType: {Type: "hostname", Category: "Network activity", ToIDS: true},
+	triage.AWSHostnameType:     {Type: "hostname", Category: "Network activity", ToIDS: true},
+	triage.IPType:              {Type: "ip-dst", Category: "Network activity", ToIDS: true},
+	triage.URLType:             {Type: "url", Category: "Network activity", ToIDS: true},
+	triage.EmailType:           {Type: "email", Category: "Payload delivery", ToIDS: true},
+	triage.MD5Type:             {Type: "md5", Category: "Payload delivery", ToIDS: true},
+	triage.SHA1Type:            {Type: "sha1", Category: "Payload delivery", ToIDS: true},
+	triage.SHA256Type:          {Type: "sha256", Category: "Payload delivery", ToIDS: true},
+	triage.SHA512Type:          {Type: "sha512", Category: "Payload delivery", ToIDS: true},
+	triage.CVEType:             {Type: "vulnerability", Category: "External analysis"},
+	triage.CWEType:             {Type: "weakness", Category: "External analysis"},
+	triage.CPEType:             {Type: "cpe", Category: "External analysis"},
+	triage.GoDaddyUsernameType: {Type: "target-user", Category: "Targeting data"},
+}
+
+// mispEventExport is the JSON MISP imports events from
+type mispEventExport struct {
+	Event mispEvent `json:"Event"`
+}
+
+// mispEvent is a MISP event
+type mispEvent struct {
+	UUID          string          `json:"uuid"`
+	Info          string          `json:"info"`
+	Date          string          `json:"date"`
+	Timestamp     string          `json:"timestamp"`
+	Published     bool            `json:"published"`
+	Analysis      string          `json:"analysis"`
+	ThreatLevelID string          `json:"threat_level_id"`
+	Distribution  string          `json:"distribution"`
+	Tag           []mispTag       `json:"Tag,omitempty"`
+	Attribute     []mispAttribute `json:"Attribute"`
+	Object        []mispObject    `json:"Object"`
+}
+
+// mispTag is a tag of a MISP event or attribute
+type mispTag struct {
+	Name string `json:"name"`
+}
+
+// mispAttribute is a MISP attribute, of an event or of an object
+type mispAttribute struct {
+	UUID           string    `json:"uuid"`
+	Type           string    `json:"type"`
+	Category       string    `json:"category"`
+	ObjectRelation string    `json:"object_relation,omitempty"`
+	Value          string    `json:"value"`
+	ToIDS          bool      `json:"to_ids"`
+	Comment        string    `json:"comment,omitempty"`
+	Timestamp      string    `json:"timestamp"`
+	Distribution   string    `json:"distribution"`
+	Tag            []mispTag `json:"Tag,omitempty"`
+}
+
+// mispObject is a MISP object, a group of attributes
+type mispObject struct {
+	UUID            string                `json:"uuid"`
+	Name            string                `json:"name"`
+	MetaCategory    string                `json:"meta-category"`
+	Description     string                `json:"description,omitempty"`
+	Comment         string                `json:"comment,omitempty"`
+	Timestamp       string                `json:"timestamp"`
+	Distribution    string                `json:"distribution"`
+	Attribute       []mispAttribute       `json:"Attribute"`
+	ObjectReference []mispObjectReference `json:"ObjectReference,omitempty"`
+}
+
+// mispObjectReference relates an object to an attribute or another object
+type mispObjectReference struct {
+	UUID             string `json:"uuid"`
+	ObjectUUID       string `json:"object_uuid"`
+	ReferencedUUID   string `json:"referenced_uuid"`
+	RelationshipType string `json:"relationship_type"`
+}
+
+// exportMISP exports a job as a MISP event.
+// The submitted IOCs are attributes, the results of every module are annotation objects referencing the
+// attributes they are about, which are tagged with the modules that found something about them.
+func exportMISP(jobEntry *common.JobDBEntry) ([]byte, error) {
+	jobSubmission, err := getExportSubmission(jobEntry)
+	if err != nil {
+		return nil, err
+	}
+
+	startTime := jobStartTime(jobEntry)
+	timestamp := strconv.FormatInt(startTime.Unix(), 10)
+	event := mispEvent{
+		UUID:          nameUUID(mispNamespace, jobEntry.JobID),
+		Info:          fmt.Sprintf("Threat API job %s", jobEntry.JobID),
+		Date:          startTime.UTC().Format("2006-01-02"),
+		Timestamp:     timestamp,
+		Analysis:      mispAnalysisOngoing,
+		ThreatLevelID: mispThreatLevelUndefined,
+		Distribution:  mispDistributionOrganisation,
+		Tag:           mispEventTags(jobEntry),
+		Attribute:     []mispAttribute{},
+		Object:        []mispObject{},
+	}
+
+	// Attributes of the submitted IOCs, by IOC type
+	iocGroups := jobSubmission.GetIOCGroups()
+	attributes := map[triage.IOCType][]int{}
+	iocTypes := []string{}
+	for iocType := range iocGroups {
+		iocTypes = append(iocTypes, string(iocType))
+	}
+	sort.Strings(iocTypes)
+	for _, iocType := range iocTypes {
+		attributeType, ok := mispAttributeTypes[triage.IOCType(iocType)]
+		if !ok {
+			attributeType = mispAttributeType{Type: "text", Category: "Other"}
+		}
+		seen := map[string]bool{}
+		for _, ioc := range iocGroups[triage.IOCType(iocType)] {
+			ioc = strings.TrimSpace(ioc)
+			if ioc == "" || seen[ioc] {
+				continue
+			}
+			seen[ioc] = true
+			attributes[triage.IOCType(iocType)] = append(attributes[triage.IOCType(iocType)], len(event.Attribute))
+			event.Attribute = append(event.Attribute, mispAttribute{
+				UUID:         nameUUID(mispNamespace, jobEntry.JobID+"|attribute|"+iocType+"|"+ioc),
+				Type:         attributeType.Type,
+				Category:     attributeType.Category,
+				Value:        ioc,
+				ToIDS:        attributeType.ToIDS,
+				Comment:      iocType,
+				Timestamp:    timestamp,
+				Distribution: mispDistributionInherit,
+			})
+		}
+	}
+
+	// Modules that failed responded too
+	if len(jobEntry.RequestedModules) > 0 && len(jobEntry.DecryptedResponses) >= len(jobEntry.RequestedModules) {
+		event.Analysis = mispAnalysisCompleted
+	}
+	responses := getExportResponses(jobEntry)
+	for _, moduleName := range sortedModules(responses) {
+		moduleTag := mispTag{Name: fmt.Sprintf("threat-api:module=\"%s\"", moduleName)}
+		for i, data := range responses[moduleName] {
+			text := strings.Join(data.Metadata, "\n")
+			// Images can't be read as text
+			if data.Data != "" && data.DataType != triage.PNGType {
+				text = strings.TrimSpace(text + "\n\n" + data.Data)
+			}
+			if text == "" {
+				continue
+			}
+
+			objectUUID := nameUUID(mispNamespace, fmt.Sprintf("%s|object|%s|%d", jobEntry.JobID, moduleName, i))
+			object := mispObject{
+				UUID:         objectUUID,
+				Name:         "annotation",
+				MetaCategory: "misc",
+				Description:  "An annotation object allowing analysts to add annotations, comments, executive summary to a MISP event, objects or attributes.",
+				Comment:      data.Title,
+				Timestamp:    timestamp,
+				Distribution: mispDistributionInherit,
+				Attribute: []mispAttribute{
+					{
+						UUID:           nameUUID(mispNamespace, objectUUID+"|text"),
+						Type:           "text",
+						Category:       "Other",
+						ObjectRelation: "text",
+						Value:          text,
+						Timestamp:      timestamp,
+						Distribution:   mispDistributionInherit,
+						Tag:            []mispTag{moduleTag},
+					},
+					{
+						UUID:           nameUUID(mispNamespace, objectUUID+"|type"),
+						Type:           "text",
+						Category:       "Other",
+						ObjectRelation: "type",
+						Value:          "Analysis",
+						Timestamp:      timestamp,
+						Distribution:   mispDistributionInherit,
+					},
+				},
+			}
+
+			iocType := data.IOCType
+			if iocType == "" && len(iocGroups) == 1 {
+				iocType = triage.IOCType(strings.ToUpper(jobSubmission.IOCType))
+			}
+			for _, attribute := range attributes[iocType] {
+				object.ObjectReference = append(object.ObjectReference, mispObjectReference{
+					UUID:             nameUUID(mispNamespace, objectUUID+"|annotates|"+event.Attribute[attribute].UUID),
+					ObjectUUID:       objectUUID,
+					ReferencedUUID:   event.Attribute[attribute].UUID,
+					RelationshipType: "annotates",
+				})
+				if !hasMISPTag(event.Attribute[attribute].Tag, moduleTag.Name) {
+					event.Attribute[attribute].Tag = append(event.Attribute[attribute].Tag, moduleTag)
+				}
+			}
+			event.Object = append(event.Object, object)
+		}
+	}
+
+	return json.Marshal(mispEventExport{Event: event})
+}
+
+// mispEventTags returns the TLP of a job followed by its other tags
+func mispEventTags(jobEntry *common.JobDBEntry) []mispTag {
+	tlp := defaultTLP
+	tags := []mispTag{}
+	for _, tag := range jobEntry.Tags {
+		if strings.HasPrefix(strings.ToLower(tag), "tlp:") {
+			tlp = strings.ToLower(tag)
+			continue
+		}
+		tags = append(tags, mispTag{Name: tag})
+	}
+	return append([]mispTag{{Name: tlp}}, tags...)
+}
+
+// hasMISPTag checks if a tag is in a list of tags
+func hasMISPTag(tags []mispTag, name string) bool {
+	for _, tag := range tags {
+		if tag.Name == name {
+			return true
+		}
+	}
+	return false
+}
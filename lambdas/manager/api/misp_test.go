@@ -0,0 +1,152 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMISPEventTags(t *testing.T) {
+
+	Convey("mispEventTags", t, func() {
+
+		Convey("should use the TLP of the job first", func() {
+			jobEntry := &common.JobDBEntry{Tags: []string{"phishing", "TLP:GREEN"}}
+			So(mispEventTags(jobEntry), ShouldResemble, []mispTag{{Name: "tlp:green"}, {Name: "phishing"}})
+		})
+
+		Convey("should default to amber", func() {
+			So(mispEventTags(&common.JobDBEntry{}), ShouldResemble, []mispTag{{Name: defaultTLP}})
+		})
+	})
+}
+
+func TestMISPEventRoundTrip(t *testing.T) {
+
+	Convey("MISP events", t, func() {
+		samples, err := filepath.Glob("testdata/misp/*.json")
+		So(err, ShouldBeNil)
+		So(samples, ShouldNotBeEmpty)
+
+		for _, sample := range samples {
+			Convey("should read and write "+sample+" without losing anything", func() {
+				sampleJSON, err := ioutil.ReadFile(sample)
+				So(err, ShouldBeNil)
+
+				event := mispEventExport{}
+				So(json.Unmarshal(sampleJSON, &event), ShouldBeNil)
+				eventJSON, err := json.Marshal(event)
+				So(err, ShouldBeNil)
+
+				expected, actual := map[string]interface{}{}, map[string]interface{}{}
+				So(json.Unmarshal(sampleJSON, &expected), ShouldBeNil)
+				So(json.Unmarshal(eventJSON, &actual), ShouldBeNil)
+				So(actual, ShouldResemble, expected)
+			})
+		}
+	})
+}
+
+func TestExportMISP(t *testing.T) {
+
+	Convey("exportMISP", t, func() {
+		jobEntry := &common.JobDBEntry{
+			JobID:            "job 56ugh345",
+			StartTime:        1610000000,
+			RequestedModules: []string{"virustotal", "nvd", "apivoid", "shodan"},
+			Tags:             []string{"tlp:red", "phishing"},
+			DecryptedSubmission: map[string]interface{}{
+				"iocGroups": map[string]interface{}{
+					"IP":           []interface{}{"1.2.3.4", "1.2.3.4"},
+					"CVE":          []interface{}{"CVE-2021-44228"},
+					"MITRE_TACTIC": []interface{}{"TA0001"},
+				},
+			},
+			DecryptedResponses: map[string]interface{}{
+				"virustotal": []interface{}{map[string]interface{}{
+					"Title":    "VirusTotal",
+					"Metadata": []interface{}{"Found 1 matching IP address"},
+					"DataType": "csv",
+					"Data":     "IoC,Badness\n1.2.3.4,0.73\n",
+					"iocType":  "IP",
+				}},
+				"nvd": []interface{}{map[string]interface{}{
+					"Title":    "NVD",
+					"DataType": "png",
+					"Data":     "iVBORw0KGgo=",
+					"iocType":  "CVE",
+				}},
+				"apivoid": "error running module",
+			},
+		}
+
+		exported, err := exportMISP(jobEntry)
+		So(err, ShouldBeNil)
+		export := mispEventExport{}
+		So(json.Unmarshal(exported, &export), ShouldBeNil)
+		event := export.Event
+
+		Convey("should write the same JSON it reads", func() {
+			again, err := json.Marshal(export)
+			So(err, ShouldBeNil)
+			So(string(again), ShouldEqual, string(exported))
+		})
+
+		Convey("should be the same every time the job is exported", func() {
+			again, err := exportMISP(jobEntry)
+			So(err, ShouldBeNil)
+			So(string(again), ShouldEqual, string(exported))
+		})
+
+		Convey("should describe the job", func() {
+			So(event.Info, ShouldEqual, "Threat API job job 56ugh345")
+			So(event.Date, ShouldEqual, "2021-01-07")
+			So(event.Timestamp, ShouldEqual, "1610000000")
+			So(event.Analysis, ShouldEqual, mispAnalysisOngoing)
+			So(event.Tag, ShouldResemble, []mispTag{{Name: "tlp:red"}, {Name: "phishing"}})
+		})
+
+		Convey("should type the submitted IOCs as attributes", func() {
+			So(event.Attribute, ShouldHaveLength, 3)
+			types := map[string]mispAttribute{}
+			for _, attribute := range event.Attribute {
+				types[attribute.Type] = attribute
+			}
+			So(types["vulnerability"].Value, ShouldEqual, "CVE-2021-44228")
+			So(types["vulnerability"].Category, ShouldEqual, "External analysis")
+			So(types["vulnerability"].ToIDS, ShouldBeFalse)
+			So(types["ip-dst"].Value, ShouldEqual, "1.2.3.4")
+			So(types["ip-dst"].ToIDS, ShouldBeTrue)
+			So(types["ip-dst"].Tag, ShouldResemble, []mispTag{{Name: `threat-api:module="virustotal"`}})
+			So(types["text"].Value, ShouldEqual, "TA0001")
+			So(types["text"].Comment, ShouldEqual, "MITRE_TACTIC")
+		})
+
+		Convey("should add module findings as objects referencing their attributes", func() {
+			So(event.Object, ShouldHaveLength, 1)
+			object := event.Object[0]
+			So(object.Name, ShouldEqual, "annotation")
+			So(object.Comment, ShouldEqual, "VirusTotal")
+			So(object.Attribute[0].Value, ShouldEqual, "Found 1 matching IP address\n\nIoC,Badness\n1.2.3.4,0.73")
+			So(object.ObjectReference, ShouldHaveLength, 1)
+			So(object.ObjectReference[0].ObjectUUID, ShouldEqual, object.UUID)
+			for _, attribute := range event.Attribute {
+				if attribute.Type == "ip-dst" {
+					So(object.ObjectReference[0].ReferencedUUID, ShouldEqual, attribute.UUID)
+				}
+			}
+		})
+
+		Convey("should be completed once every module responded", func() {
+			jobEntry.DecryptedResponses["shodan"] = "error running module"
+			exported, err := exportMISP(jobEntry)
+			So(err, ShouldBeNil)
+			So(json.Unmarshal(exported, &export), ShouldBeNil)
+			So(export.Event.Analysis, ShouldEqual, mispAnalysisCompleted)
+		})
+	})
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
+)
+
+// ModuleInfo is a module listed by GetModules, with the health of its vendor so clients can grey out modules that are skipped
+type ModuleInfo struct {
+	toolbox.LambdaMetadata
+	Health *toolbox.ModuleHealth `json:"health,omitempty"`
+}
+
+// GetModules responds to a API gateway request to list the available modules and their metadata
+func GetModules(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	span, ctx := to.TracerLogger.StartSpan(ctx, "GetModules", "modules", "manager", "list")
+	defer span.End(ctx)
+
+	modulesAndSupportedTypes, err := to.GetModules(ctx)
+	if err != nil {
+		return events.APIGatewayProxyResponse{StatusCode: 500}, fmt.Errorf("error getting modules: %w", err)
+	}
+
+	// The modules are still listed if their health can't be fetched, just without it
+	modulesHealth, err := to.GetModulesHealth(ctx)
+	if err != nil {
+		span.LogKV("error", err)
+	}
+	modules := map[string]ModuleInfo{}
+	for moduleName, metadata := range modulesAndSupportedTypes {
+		module := ModuleInfo{LambdaMetadata: metadata}
+		if modulesHealth != nil {
+			module.Health = modulesHealth[moduleName]
+			if module.Health == nil {
+				// Modules that never ran are healthy
+				module.Health = &toolbox.ModuleHealth{State: toolbox.CircuitClosed}
+			}
+		}
+		modules[moduleName] = module
+	}
+
+	marshalledData, err := json.Marshal(modules)
+	if err != nil {
+		return events.APIGatewayProxyResponse{StatusCode: 500, Body: "Error marshalling response"}, fmt.Errorf("error marshalling response: %w", err)
+	}
+	return events.APIGatewayProxyResponse{StatusCode: 200, Body: string(marshalledData)}, nil
+}
@@ -1,4 +1,4 @@
-package main
+package api
 
 import (
 	"context"
@@ -19,6 +19,7 @@ func TestGetModulesAPI(t *testing.T) {
 
 	Convey("GetModules", t, func() {
 		// setup stubs\mocks
+		to = toolbox.GetToolbox()
 		patches := []*Patches{}
 		ctx1 := context.Background()
 		APIGatewayRequest := &events.APIGatewayProxyRequest{
@@ -59,6 +60,14 @@ func TestGetModulesAPI(t *testing.T) {
 				return GetModulesList, nil
 			}))
 
+		Reset(func() {
+			// deferred reset all stubs\mocks after every test suite running
+			for i := len(patches) - 1; i >= 0; i-- {
+				patches[i].Reset()
+			}
+			to = nil
+		})
+
 		Convey("should return proper list of modules supported", func() {
 			marshalledData, _ := json.Marshal(GetModulesList)
 			expectedGetModulesResponse := events.APIGatewayProxyResponse{StatusCode: 200, Body: string(marshalledData)}
@@ -66,6 +75,22 @@ func TestGetModulesAPI(t *testing.T) {
 			So(actualGetModulesResponse, ShouldResemble, expectedGetModulesResponse)
 		})
 
+		Convey("should return the health of each module", func() {
+			trustarHealth := &ModuleHealth{State: CircuitOpen, ErrorRate: 0.6, LastError: "TIMEOUT", LastErrorAt: 1600000000, RetryAt: 1600000300}
+			patches = append(patches, ApplyMethod(reflect.TypeOf(to), "GetModulesHealth",
+				func(t *toolbox.Toolbox, ctx context.Context) (map[string]*ModuleHealth, error) {
+					return map[string]*ModuleHealth{"trustar": trustarHealth}, nil
+				}))
+			marshalledData, _ := json.Marshal(map[string]ModuleInfo{
+				"trustar": {LambdaMetadata: GetModulesList["trustar"], Health: trustarHealth},
+				"cmap":    {LambdaMetadata: GetModulesList["cmap"], Health: &ModuleHealth{State: CircuitClosed}},
+			})
+			expectedGetModulesResponse := events.APIGatewayProxyResponse{StatusCode: 200, Body: string(marshalledData)}
+			actualGetModulesResponse, _ := GetModules(ctx1, *APIGatewayRequest)
+			So(actualGetModulesResponse, ShouldResemble, expectedGetModulesResponse)
+			So(actualGetModulesResponse.Body, ShouldContainSubstring, `"health":{"state":"open","errorRate":0.6,"lastError":"TIMEOUT"`)
+		})
+
 		Convey("should return error if modules list failed to be returned", func() {
 			err := errors.New("I am error during retriaval of modules")
 			patches = append(patches, ApplyMethod(reflect.TypeOf(to), "GetModules",
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+)
+
+// maxJobWait is the longest a client can wait for job updates, it has to fit in the lambda timeout
+const maxJobWait = time.Second * 10
+
+// jobPollInterval is how often we check the job for updates while a client waits
+var jobPollInterval = time.Second
+
+// getPollParameters gets how long to wait for updates and the cursor of what the client already has from the request.
+// A nil cursor means the client wants everything.
+func getPollParameters(request events.APIGatewayProxyRequest) (time.Duration, map[string]float64, error) {
+	var wait time.Duration
+	if waitParameter, ok := request.QueryStringParameters["wait"]; ok {
+		seconds, err := strconv.Atoi(waitParameter)
+		if err != nil || seconds < 0 {
+			return 0, nil, fmt.Errorf("invalid wait, it must be a number of seconds")
+		}
+		wait = time.Duration(seconds) * time.Second
+		if wait > maxJobWait {
+			wait = maxJobWait
+		}
+	}
+
+	var since map[string]float64
+	if sinceParameter, ok := request.QueryStringParameters["since"]; ok {
+		var err error
+		since, err = parseJobCursor(sinceParameter)
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid since, it must be a cursor from an earlier response")
+		}
+	}
+
+	return wait, since, nil
+}
+
+// finishedModules returns the end time of every requested module that finished
+func finishedModules(jobEntry *common.JobDBEntry) map[string]float64 {
+	ret := map[string]float64{}
+	for _, module := range jobEntry.RequestedModules {
+		if status, ok := jobEntry.ModuleStatuses[module]; ok && status.Finished() {
+			ret[module] = status.EndTime
+		}
+	}
+	return ret
+}
+
+// modulesFinishedSince returns the requested modules that finished after the client got the cursor.
+// Retried modules finish again with a new end time, so they are returned again.
+func modulesFinishedSince(jobEntry *common.JobDBEntry, since map[string]float64) []string {
+	ret := []string{}
+	finished := finishedModules(jobEntry)
+	for _, module := range jobEntry.RequestedModules {
+		endTime, ok := finished[module]
+		if !ok {
+			continue
+		}
+		if seenEndTime, seen := since[module]; !seen || seenEndTime != endTime {
+			ret = append(ret, module)
+		}
+	}
+	return ret
+}
+
+// jobCursor encodes the modules that finished so far, clients pass it back as since to only get newer results.
+// We don't use a single timestamp as modules can be stored out of order with the time they finished.
+func jobCursor(jobEntry *common.JobDBEntry) string {
+	cursor, _ := json.Marshal(finishedModules(jobEntry))
+	return base64.RawURLEncoding.EncodeToString(cursor)
+}
+
+// parseJobCursor decodes a cursor from jobCursor
+func parseJobCursor(cursor string) (map[string]float64, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	ret := map[string]float64{}
+	err = json.Unmarshal(decoded, &ret)
+	return ret, err
+}
+
+// waitForJobUpdate fetches the job until a module finishes that isn't in the since cursor, the job is no longer in progress, or the wait elapses.
+// Without a cursor we wait for a module to finish after the job was first fetched.
+// It returns the last version of the job, or nil if the job was deleted while waiting.
+func waitForJobUpdate(ctx context.Context, jobEntry *common.JobDBEntry, since map[string]float64, wait time.Duration) (*common.JobDBEntry, error) {
+	span, ctx := to.TracerLogger.StartSpan(ctx, "WaitForJobUpdate", "job", "manager", "wait")
+	defer span.End(ctx)
+
+	// Jobs created before module statuses were added can't tell which modules finished without decrypting them
+	if len(jobEntry.ModuleStatuses) == 0 {
+		return jobEntry, nil
+	}
+	if since == nil {
+		since = finishedModules(jobEntry)
+	}
+
+	deadline := time.Now().Add(wait)
+	for {
+		if len(modulesFinishedSince(jobEntry, since)) > 0 {
+			return jobEntry, nil
+		}
+		// This also marks modules as timed out, so a timed out job stops waiting too
+		if jobStatus, _, _ := getJobProgress(ctx, jobEntry); jobStatus != JobInProgress {
+			return jobEntry, nil
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return jobEntry, nil
+		}
+		if remaining > jobPollInterval {
+			remaining = jobPollInterval
+		}
+		select {
+		case <-ctx.Done():
+			return jobEntry, nil
+		case <-time.After(remaining):
+		}
+
+		var err error
+		jobEntry, err = fetchJob(ctx, jobEntry.JobID)
+		if err != nil || jobEntry == nil {
+			return jobEntry, err
+		}
+	}
+}
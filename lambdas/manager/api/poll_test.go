@@ -0,0 +1,171 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/agiledragon/gomonkey/v2"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGetPollParameters(t *testing.T) {
+
+	Convey("getPollParameters", t, func() {
+		request := events.APIGatewayProxyRequest{QueryStringParameters: map[string]string{}}
+
+		Convey("should not wait without parameters", func() {
+			wait, since, err := getPollParameters(request)
+			So(err, ShouldBeNil)
+			So(wait, ShouldEqual, 0)
+			So(since, ShouldBeNil)
+		})
+
+		Convey("should cap the wait", func() {
+			request.QueryStringParameters["wait"] = "600"
+			wait, _, err := getPollParameters(request)
+			So(err, ShouldBeNil)
+			So(wait, ShouldEqual, maxJobWait)
+		})
+
+		Convey("should reject invalid waits", func() {
+			request.QueryStringParameters["wait"] = "-1"
+			_, _, err := getPollParameters(request)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("should read cursors from earlier responses", func() {
+			request.QueryStringParameters["since"] = jobCursor(&common.JobDBEntry{
+				RequestedModules: []string{"apivoid", "urlscanio"},
+				ModuleStatuses: map[string]*common.ModuleStatus{
+					"apivoid":   {Status: common.ModuleSucceeded, EndTime: 1610000003.7},
+					"urlscanio": {Status: common.ModuleRunning},
+				},
+			})
+			_, since, err := getPollParameters(request)
+			So(err, ShouldBeNil)
+			So(since, ShouldResemble, map[string]float64{"apivoid": 1610000003.7})
+		})
+
+		Convey("should reject invalid cursors", func() {
+			request.QueryStringParameters["since"] = "not a cursor"
+			_, _, err := getPollParameters(request)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestModulesFinishedSince(t *testing.T) {
+
+	Convey("modulesFinishedSince", t, func() {
+		jobEntry := &common.JobDBEntry{
+			RequestedModules: []string{"apivoid", "urlscanio", "shodan"},
+			ModuleStatuses: map[string]*common.ModuleStatus{
+				"apivoid":   {Status: common.ModuleSucceeded, EndTime: 1610000003.7},
+				"urlscanio": {Status: common.ModuleFailed, EndTime: 1610000002.1},
+				"shodan":    {Status: common.ModulePending},
+			},
+		}
+
+		Convey("should return every finished module without a cursor", func() {
+			So(modulesFinishedSince(jobEntry, nil), ShouldResemble, []string{"apivoid", "urlscanio"})
+		})
+
+		Convey("should skip modules the client already has, even if they finished earlier", func() {
+			So(modulesFinishedSince(jobEntry, map[string]float64{"apivoid": 1610000003.7}), ShouldResemble, []string{"urlscanio"})
+		})
+
+		Convey("should return modules that finished again after a retry", func() {
+			since := map[string]float64{"apivoid": 1610000003.7, "urlscanio": 1610000001}
+			So(modulesFinishedSince(jobEntry, since), ShouldResemble, []string{"urlscanio"})
+		})
+	})
+}
+
+func TestWaitForJobUpdate(t *testing.T) {
+
+	Convey("waitForJobUpdate", t, func() {
+		patches := []*Patches{}
+		ctx1 := context.Background()
+		to = toolbox.GetToolbox()
+		jobPollInterval = time.Millisecond
+
+		newJobEntry := func(statuses map[string]*common.ModuleStatus) *common.JobDBEntry {
+			return &common.JobDBEntry{
+				JobID:            "job 2v45y245",
+				StartTime:        float64(time.Now().Unix()),
+				RequestedModules: []string{"apivoid", "urlscanio"},
+				ModuleStatuses:   statuses,
+			}
+		}
+		jobEntry := newJobEntry(map[string]*common.ModuleStatus{
+			"apivoid":   {Status: common.ModuleSucceeded, EndTime: 1610000003.7},
+			"urlscanio": {Status: common.ModuleRunning},
+		})
+
+		fetches := 0
+		updatedJobEntry := newJobEntry(map[string]*common.ModuleStatus{
+			"apivoid":   {Status: common.ModuleSucceeded, EndTime: 1610000003.7},
+			"urlscanio": {Status: common.ModuleSucceeded, EndTime: 1610000009.2},
+		})
+		patches = append(patches, ApplyFunc(fetchJob,
+			func(ctx context.Context, jobID string) (*common.JobDBEntry, error) {
+				fetches++
+				if fetches < 3 {
+					return jobEntry, nil
+				}
+				return updatedJobEntry, nil
+			}))
+
+		Reset(func() {
+			for i := len(patches) - 1; i >= 0; i-- {
+				patches[i].Reset()
+			}
+			jobPollInterval = time.Second
+			to = nil
+		})
+
+		Convey("should wait until a module finishes", func() {
+			actualJobEntry, err := waitForJobUpdate(ctx1, jobEntry, nil, time.Second*5)
+			So(err, ShouldBeNil)
+			So(actualJobEntry, ShouldEqual, updatedJobEntry)
+			So(fetches, ShouldEqual, 3)
+		})
+
+		Convey("should return right away if the client is missing finished modules", func() {
+			actualJobEntry, _ := waitForJobUpdate(ctx1, jobEntry, map[string]float64{}, time.Second*5)
+			So(actualJobEntry, ShouldEqual, jobEntry)
+			So(fetches, ShouldEqual, 0)
+		})
+
+		Convey("should stop waiting when the wait elapses", func() {
+			patches = append(patches, ApplyFunc(fetchJob,
+				func(ctx context.Context, jobID string) (*common.JobDBEntry, error) {
+					return jobEntry, nil
+				}))
+			actualJobEntry, err := waitForJobUpdate(ctx1, jobEntry, nil, time.Millisecond*20)
+			So(err, ShouldBeNil)
+			So(actualJobEntry, ShouldEqual, jobEntry)
+		})
+
+		Convey("should not wait for jobs that are no longer in progress", func() {
+			jobEntry.Cancelled = true
+			waitForJobUpdate(ctx1, jobEntry, nil, time.Second*5)
+			So(fetches, ShouldEqual, 0)
+		})
+
+		Convey("should return error if fetching the job failed", func() {
+			err := errors.New("I am fetch job error")
+			patches = append(patches, ApplyFunc(fetchJob,
+				func(ctx context.Context, jobID string) (*common.JobDBEntry, error) {
+					return nil, err
+				}))
+			_, actualError := waitForJobUpdate(ctx1, jobEntry, nil, time.Second*5)
+			So(actualError, ShouldResemble, err)
+		})
+	})
+}
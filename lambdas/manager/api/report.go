@@ -0,0 +1,466 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
+)
+
+// reportTimeFormat is how times are written in reports
+const reportTimeFormat = "2006-01-02 15:04:05 UTC"
+
+// jobReport is what the Markdown and HTML reports of a job show
+type jobReport struct {
+	JobID      string
+	Started    string
+	Tags       []string
+	Modules    []string
+	Submission []reportIOCGroup
+	Results    []reportModule
+	Failures   []reportFailure
+}
+
+// reportIOCGroup is the submitted IOCs of a type
+type reportIOCGroup struct {
+	IOCType string
+	IOCs    []string
+}
+
+// reportModule is everything a module returned
+type reportModule struct {
+	Name     string
+	Sections []reportSection
+}
+
+// reportSection is a piece of data a module returned, only one of Table, Text and Image is set
+type reportSection struct {
+	Title     string
+	IOCType   string
+	FetchedAt string
+	Insights  []string
+	Table     *reportTable
+	Text      string
+	Image     string
+}
+
+// reportTable is CSV or JSON data as a table
+type reportTable struct {
+	Header []string
+	Rows   [][]string
+}
+
+// reportFailure is a module that didn't give us its results
+type reportFailure struct {
+	Module string
+	Status string
+	Error  string
+}
+
+// exportMarkdown exports a job as a Markdown report
+func exportMarkdown(jobEntry *common.JobDBEntry) ([]byte, error) {
+	report, err := buildJobReport(jobEntry)
+	if err != nil {
+		return nil, err
+	}
+	ret := &bytes.Buffer{}
+	err = markdownReportTemplate.Execute(ret, report)
+	return ret.Bytes(), err
+}
+
+// exportHTML exports a job as a standalone HTML report
+func exportHTML(jobEntry *common.JobDBEntry) ([]byte, error) {
+	report, err := buildJobReport(jobEntry)
+	if err != nil {
+		return nil, err
+	}
+	ret := &bytes.Buffer{}
+	err = htmlReportTemplate.Execute(ret, report)
+	return ret.Bytes(), err
+}
+
+// buildJobReport collects what the reports of a decrypted job show
+func buildJobReport(jobEntry *common.JobDBEntry) (jobReport, error) {
+	jobSubmission, err := getExportSubmission(jobEntry)
+	if err != nil {
+		return jobReport{}, err
+	}
+
+	report := jobReport{
+		JobID:   jobEntry.JobID,
+		Started: jobStartTime(jobEntry).UTC().Format(reportTimeFormat),
+		Tags:    jobEntry.Tags,
+		Modules: append([]string{}, jobEntry.RequestedModules...),
+	}
+	sort.Strings(report.Modules)
+
+	iocGroups := jobSubmission.GetIOCGroups()
+	for iocType, iocs := range iocGroups {
+		report.Submission = append(report.Submission, reportIOCGroup{IOCType: string(iocType), IOCs: iocs})
+	}
+	sort.Slice(report.Submission, func(i, j int) bool { return report.Submission[i].IOCType < report.Submission[j].IOCType })
+
+	responses := getExportResponses(jobEntry)
+	for _, moduleName := range sortedModules(responses) {
+		module := reportModule{Name: moduleName}
+		for _, data := range responses[moduleName] {
+			// Errors are in the failure appendix
+			if data.Title == "" && len(data.Metadata) == 0 && data.Data == "" {
+				continue
+			}
+			section := reportSection{
+				Title:    data.Title,
+				IOCType:  string(data.IOCType),
+				Insights: data.Metadata,
+			}
+			if section.Title == "" {
+				section.Title = moduleName
+			}
+			if data.FetchedAt != nil {
+				section.FetchedAt = data.FetchedAt.UTC().Format(reportTimeFormat)
+			}
+			switch data.DataType {
+			case triage.PNGType:
+				// Only embed images that are really base64 encoded
+				if _, err := base64.StdEncoding.DecodeString(data.Data); err == nil {
+					section.Image = data.Data
+				}
+			case triage.JSONType:
+				section.Table, section.Text = jsonReportTable(data.Data)
+			case triage.TextType:
+				section.Text = data.Data
+			default:
+				section.Table = csvReportTable(data.Data)
+				if section.Table == nil {
+					section.Text = data.Data
+				}
+			}
+			section.Text = strings.Trim(section.Text, "\r\n")
+			module.Sections = append(module.Sections, section)
+		}
+		if len(module.Sections) > 0 {
+			report.Results = append(report.Results, module)
+		}
+	}
+
+	report.Failures = getReportFailures(jobEntry)
+	return report, nil
+}
+
+// getReportFailures lists the requested modules that failed, haven't finished or never responded
+func getReportFailures(jobEntry *common.JobDBEntry) []reportFailure {
+	failures := []reportFailure{}
+	for _, moduleName := range jobEntry.RequestedModules {
+		failure := reportFailure{Module: moduleName}
+		moduleStatus := jobEntry.ModuleStatuses[moduleName]
+		switch {
+		case moduleStatus != nil && moduleStatus.Failed():
+			failure.Status = string(moduleStatus.Status)
+			if moduleStatus.ErrorCode != "" {
+				failure.Status += " (" + string(moduleStatus.ErrorCode) + ")"
+			}
+		case moduleStatus != nil && !moduleStatus.Finished():
+			failure.Status = "Not finished"
+		}
+
+		response, responded := jobEntry.DecryptedResponses[moduleName]
+		failure.Error = responseError(response)
+		if failure.Status == "" && failure.Error != "" {
+			failure.Status = string(common.ModuleFailed)
+		}
+		if failure.Status == "" && !responded && moduleStatus == nil {
+			failure.Status = "No response"
+		}
+		if failure.Status != "" {
+			failures = append(failures, failure)
+		}
+	}
+	sort.Slice(failures, func(i, j int) bool { return failures[i].Module < failures[j].Module })
+	return failures
+}
+
+// responseError returns the error message of a module response, if it is an error
+func responseError(response interface{}) string {
+	if message, ok := response.(string); ok {
+		return message
+	}
+	responseDatas, ok := response.([]interface{})
+	if !ok {
+		return ""
+	}
+	for _, responseData := range responseDatas {
+		if responseDataMap, ok := responseData.(map[string]interface{}); ok {
+			if message, ok := responseDataMap["error"]; ok {
+				return fmt.Sprint(message)
+			}
+		}
+	}
+	return ""
+}
+
+// csvReportTable reads CSV data as a table, it returns nil if the data isn't CSV
+func csvReportTable(data string) *reportTable {
+	reader := csv.NewReader(strings.NewReader(data))
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil || len(rows) == 0 {
+		return nil
+	}
+	return &reportTable{Header: rows[0], Rows: rows[1:]}
+}
+
+// jsonReportTable reads JSON data as a table if it is a list of objects or an object,
+// other JSON is returned indented instead
+func jsonReportTable(data string) (*reportTable, string) {
+	var value interface{}
+	if err := json.Unmarshal([]byte(data), &value); err != nil {
+		return nil, data
+	}
+
+	switch value := value.(type) {
+	case []interface{}:
+		columns := map[string]bool{}
+		objects := []map[string]interface{}{}
+		for _, item := range value {
+			object, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, indentJSON(value)
+			}
+			for column := range object {
+				columns[column] = true
+			}
+			objects = append(objects, object)
+		}
+		if len(objects) == 0 {
+			return nil, ""
+		}
+		table := &reportTable{}
+		for column := range columns {
+			table.Header = append(table.Header, column)
+		}
+		sort.Strings(table.Header)
+		for _, object := range objects {
+			row := []string{}
+			for _, column := range table.Header {
+				row = append(row, jsonReportCell(object[column]))
+			}
+			table.Rows = append(table.Rows, row)
+		}
+		return table, ""
+	case map[string]interface{}:
+		table := &reportTable{Header: []string{"Key", "Value"}}
+		keys := []string{}
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			table.Rows = append(table.Rows, []string{key, jsonReportCell(value[key])})
+		}
+		return table, ""
+	}
+	return nil, indentJSON(value)
+}
+
+// jsonReportCell writes a JSON value as a table cell
+func jsonReportCell(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case float64, bool:
+		return fmt.Sprint(value)
+	}
+	cell, _ := json.Marshal(value)
+	return string(cell)
+}
+
+// indentJSON writes a JSON value indented
+func indentJSON(value interface{}) string {
+	ret, _ := json.MarshalIndent(value, "", "  ")
+	return string(ret)
+}
+
+// markdownEscaper escapes the characters that mean something in Markdown
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`,
+	"<", `\<`, ">", `\>`, "#", `\#`, "|", `\|`, "\r\n", " ", "\n", " ",
+)
+
+// markdownFence returns a code fence longer than any run of backticks in the content
+func markdownFence(content string) string {
+	fence := "```"
+	for strings.Contains(content, fence) {
+		fence += "`"
+	}
+	return fence
+}
+
+// markdownCode writes inline code, whatever backticks it contains
+func markdownCode(content string) string {
+	fence := "`"
+	for strings.Contains(content, fence) {
+		fence += "`"
+	}
+	return fence + " " + strings.ReplaceAll(content, "\n", " ") + " " + fence
+}
+
+var reportFuncs = map[string]interface{}{
+	"join": strings.Join,
+}
+
+var markdownReportTemplate = template.Must(template.New("report.md").Funcs(reportFuncs).Funcs(template.FuncMap{
+	"md":    markdownEscaper.Replace,
+	"code":  markdownCode,
+	"fence": markdownFence,
+	"separator": func(columns []string) string {
+		return strings.TrimSuffix(strings.Repeat("| --- ", len(columns)), " ") + " |"
+	},
+}).Parse(`# Threat API job {{md .JobID}}
+
+- **Started:** {{.Started}}
+- **Modules:** {{md (join .Modules ", ")}}
+{{- if .Tags}}
+- **Tags:** {{md (join .Tags ", ")}}
+{{- end}}
+
+## Submission
+{{range .Submission}}
+### {{md .IOCType}}
+{{range .IOCs}}
+- {{code .}}
+{{- end}}
+{{end}}
+{{- range .Results}}
+## {{md .Name}}
+{{range .Sections}}
+### {{md .Title}}
+{{if or .IOCType .FetchedAt}}
+{{if .IOCType}}_IOC type: {{md .IOCType}}_{{end}}{{if and .IOCType .FetchedAt}} {{end}}{{if .FetchedAt}}_Fetched at: {{.FetchedAt}}_{{end}}
+{{end}}
+{{- if .Insights}}
+{{range .Insights}}- {{md .}}
+{{end}}
+{{- end}}
+{{- if .Table}}
+|{{range .Table.Header}} {{md .}} |{{end}}
+{{separator .Table.Header}}
+{{range .Table.Rows}}|{{range .}} {{md .}} |{{end}}
+{{end}}
+{{- end}}
+{{- if .Text}}
+{{fence .Text}}
+{{.Text}}
+{{fence .Text}}
+{{end}}
+{{- if .Image}}
+![{{md .Title}}](data:image/png;base64,{{.Image}})
+{{end}}
+{{- end}}
+{{- end}}
+{{- if .Failures}}
+## Appendix: failures
+
+| Module | Status | Error |
+| --- | --- | --- |
+{{- range .Failures}}
+| {{md .Module}} | {{md .Status}} | {{md .Error}} |
+{{- end}}
+{{end}}
+_Generated by Threat API_
+`))
+
+var htmlReportTemplate = htmltemplate.Must(htmltemplate.New("report.html").Funcs(reportFuncs).Funcs(htmltemplate.FuncMap{
+	"image": func(data string) htmltemplate.URL {
+		// Only base64 encoded PNGs get here
+		return htmltemplate.URL("data:image/png;base64," + data)
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Threat API job {{.JobID}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em auto; max-width: 1100px; padding: 0 1em; color: #1b1b1b; }
+table { border-collapse: collapse; margin: 1em 0; display: block; overflow-x: auto; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; font-size: 0.9em; }
+th { background: #f3f3f3; }
+pre { background: #f6f8fa; padding: 1em; overflow-x: auto; }
+img { max-width: 100%; }
+.meta { color: #666; font-style: italic; }
+</style>
+</head>
+<body>
+<h1>Threat API job {{.JobID}}</h1>
+<ul>
+<li><strong>Started:</strong> {{.Started}}</li>
+<li><strong>Modules:</strong> {{join .Modules ", "}}</li>
+{{- if .Tags}}
+<li><strong>Tags:</strong> {{join .Tags ", "}}</li>
+{{- end}}
+</ul>
+<h2>Submission</h2>
+{{- range .Submission}}
+<h3>{{.IOCType}}</h3>
+<ul>
+{{- range .IOCs}}
+<li><code>{{.}}</code></li>
+{{- end}}
+</ul>
+{{- end}}
+{{- range .Results}}
+<h2>{{.Name}}</h2>
+{{- range .Sections}}
+<h3>{{.Title}}</h3>
+{{- if or .IOCType .FetchedAt}}
+<p class="meta">{{if .IOCType}}IOC type: {{.IOCType}}{{end}}{{if and .IOCType .FetchedAt}} {{end}}{{if .FetchedAt}}Fetched at: {{.FetchedAt}}{{end}}</p>
+{{- end}}
+{{- if .Insights}}
+<ul>
+{{- range .Insights}}
+<li>{{.}}</li>
+{{- end}}
+</ul>
+{{- end}}
+{{- if .Table}}
+<table>
+<thead><tr>{{range .Table.Header}}<th>{{.}}</th>{{end}}</tr></thead>
+<tbody>
+{{- range .Table.Rows}}
+<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{- end}}
+</tbody>
+</table>
+{{- end}}
+{{- if .Text}}
+<pre>{{.Text}}</pre>
+{{- end}}
+{{- if .Image}}
+<img src="{{image .Image}}" alt="{{.Title}}">
+{{- end}}
+{{- end}}
+{{- end}}
+{{- if .Failures}}
+<h2>Appendix: failures</h2>
+<table>
+<thead><tr><th>Module</th><th>Status</th><th>Error</th></tr></thead>
+<tbody>
+{{- range .Failures}}
+<tr><td>{{.Module}}</td><td>{{.Status}}</td><td>{{.Error}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+{{- end}}
+<p class="meta">Generated by Threat API</p>
+</body>
+</html>
+`))
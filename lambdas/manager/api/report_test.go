@@ -0,0 +1,181 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// reportJobEntry is a job with every kind of data reports show
+func reportJobEntry() *common.JobDBEntry {
+	return &common.JobDBEntry{
+		JobID:            "job 4w5yhw45",
+		StartTime:        1610000000,
+		RequestedModules: []string{"virustotal", "passivetotal", "nvd", "apivoid", "shodan", "urlhaus"},
+		Tags:             []string{"phishing"},
+		ModuleStatuses: map[string]*common.ModuleStatus{
+			"virustotal": {Status: common.ModuleSucceeded},
+			"shodan":     {Status: common.ModuleTimedOut, ErrorCode: common.ModuleErrorCodeTimeout},
+			"urlhaus":    {Status: common.ModuleRunning},
+		},
+		DecryptedSubmission: map[string]interface{}{
+			"iocGroups": map[string]interface{}{
+				"DOMAIN": []interface{}{"godaddy.com"},
+				"IP":     []interface{}{"1.2.3.4"},
+			},
+		},
+		DecryptedResponses: map[string]interface{}{
+			"virustotal": []interface{}{map[string]interface{}{
+				"Title":    "VirusTotal",
+				"Metadata": []interface{}{"Found 1 matching IP address", "Score <b>high</b> | really"},
+				"DataType": "csv",
+				"Data":     "IoC,Badness\n1.2.3.4,0.73\n",
+				"iocType":  "IP",
+			}},
+			"passivetotal": []interface{}{map[string]interface{}{
+				"Title":    "PassiveTotal",
+				"DataType": "json",
+				"Data":     `[{"query":"godaddy.com","firstSeen":"2020-01-01 00:00:00","resolutions":{"A":{}}}]`,
+				"iocType":  "DOMAIN",
+			}},
+			"nvd": []interface{}{map[string]interface{}{
+				"Title":    "Graph",
+				"DataType": "png",
+				"Data":     "iVBORw0KGgo=",
+			}},
+			"apivoid": []interface{}{map[string]interface{}{"error": "vendor unavailable"}},
+		},
+	}
+}
+
+func TestBuildJobReport(t *testing.T) {
+
+	Convey("buildJobReport", t, func() {
+		report, err := buildJobReport(reportJobEntry())
+		So(err, ShouldBeNil)
+
+		Convey("should summarize the submission", func() {
+			So(report.Started, ShouldEqual, "2021-01-07 06:13:20 UTC")
+			So(report.Modules, ShouldResemble, []string{"apivoid", "nvd", "passivetotal", "shodan", "urlhaus", "virustotal"})
+			So(report.Submission, ShouldResemble, []reportIOCGroup{
+				{IOCType: "DOMAIN", IOCs: []string{"godaddy.com"}},
+				{IOCType: "IP", IOCs: []string{"1.2.3.4"}},
+			})
+		})
+
+		Convey("should render module data by its type", func() {
+			So(report.Results, ShouldHaveLength, 3)
+			So(report.Results[0].Name, ShouldEqual, "nvd")
+			So(report.Results[0].Sections[0].Image, ShouldEqual, "iVBORw0KGgo=")
+			So(report.Results[1].Sections[0].Table, ShouldResemble, &reportTable{
+				Header: []string{"firstSeen", "query", "resolutions"},
+				Rows:   [][]string{{"2020-01-01 00:00:00", "godaddy.com", `{"A":{}}`}},
+			})
+			So(report.Results[2].Sections[0].Table, ShouldResemble, &reportTable{
+				Header: []string{"IoC", "Badness"},
+				Rows:   [][]string{{"1.2.3.4", "0.73"}},
+			})
+		})
+
+		Convey("should list the modules that didn't give us their results", func() {
+			So(report.Failures, ShouldResemble, []reportFailure{
+				{Module: "apivoid", Status: "FAILED", Error: "vendor unavailable"},
+				{Module: "shodan", Status: "TIMED_OUT (TIMEOUT)"},
+				{Module: "urlhaus", Status: "Not finished"},
+			})
+		})
+	})
+}
+
+func TestJSONReportTable(t *testing.T) {
+
+	Convey("jsonReportTable", t, func() {
+
+		Convey("should show objects as keys and values", func() {
+			table, text := jsonReportTable(`{"b":1,"a":[1,2]}`)
+			So(text, ShouldEqual, "")
+			So(table, ShouldResemble, &reportTable{Header: []string{"Key", "Value"}, Rows: [][]string{{"a", "[1,2]"}, {"b", "1"}}})
+		})
+
+		Convey("should indent JSON that isn't a table", func() {
+			table, text := jsonReportTable(`[1,"two"]`)
+			So(table, ShouldBeNil)
+			So(text, ShouldEqual, "[\n  1,\n  \"two\"\n]")
+		})
+
+		Convey("should keep data that isn't JSON", func() {
+			table, text := jsonReportTable("not json")
+			So(table, ShouldBeNil)
+			So(text, ShouldEqual, "not json")
+		})
+	})
+}
+
+func TestExportMarkdown(t *testing.T) {
+
+	Convey("exportMarkdown", t, func() {
+		exported, err := exportMarkdown(reportJobEntry())
+		So(err, ShouldBeNil)
+		report := string(exported)
+
+		Convey("should render every part of the report", func() {
+			So(report, ShouldStartWith, "# Threat API job job 4w5yhw45\n")
+			So(report, ShouldContainSubstring, "### DOMAIN\n\n- ` godaddy.com `\n")
+			So(report, ShouldContainSubstring, "## virustotal\n\n### VirusTotal\n\n_IOC type: IP_\n\n- Found 1 matching IP address\n")
+			So(report, ShouldContainSubstring, "| IoC | Badness |\n| --- | --- |\n| 1.2.3.4 | 0.73 |\n")
+			So(report, ShouldContainSubstring, "![Graph](data:image/png;base64,iVBORw0KGgo=)")
+			So(report, ShouldContainSubstring, "## Appendix: failures\n\n| Module | Status | Error |\n| --- | --- | --- |\n| apivoid | FAILED | vendor unavailable |\n")
+		})
+
+		Convey("should escape Markdown in module data", func() {
+			So(report, ShouldContainSubstring, `- Score \<b\>high\</b\> \| really`)
+		})
+	})
+
+	Convey("markdownFence", t, func() {
+		So(markdownFence("no code"), ShouldEqual, "```")
+		So(markdownFence("```go\n```"), ShouldEqual, "````")
+	})
+}
+
+func TestExportHTML(t *testing.T) {
+
+	Convey("exportHTML", t, func() {
+		exported, err := exportHTML(reportJobEntry())
+		So(err, ShouldBeNil)
+		report := string(exported)
+
+		Convey("should be a standalone page", func() {
+			So(report, ShouldStartWith, "<!DOCTYPE html>")
+			So(strings.TrimSpace(report), ShouldEndWith, "</html>")
+			So(report, ShouldNotContainSubstring, "<link")
+			So(report, ShouldNotContainSubstring, "<script")
+		})
+
+		Convey("should render every part of the report", func() {
+			So(report, ShouldContainSubstring, "<li><code>1.2.3.4</code></li>")
+			So(report, ShouldContainSubstring, "<thead><tr><th>IoC</th><th>Badness</th></tr></thead>")
+			So(report, ShouldContainSubstring, "<tr><td>1.2.3.4</td><td>0.73</td></tr>")
+			So(report, ShouldContainSubstring, `<img src="data:image/png;base64,iVBORw0KGgo=" alt="Graph">`)
+			So(report, ShouldContainSubstring, "<tr><td>shodan</td><td>TIMED_OUT (TIMEOUT)</td><td></td></tr>")
+		})
+
+		Convey("should escape HTML in module data", func() {
+			So(report, ShouldContainSubstring, "<li>Score &lt;b&gt;high&lt;/b&gt; | really</li>")
+		})
+
+		Convey("should not embed images that aren't base64", func() {
+			jobEntry := reportJobEntry()
+			jobEntry.DecryptedResponses["nvd"] = []interface{}{map[string]interface{}{
+				"Title":    "Graph",
+				"DataType": "png",
+				"Data":     `" onerror="alert(1)`,
+			}}
+			exported, err := exportHTML(jobEntry)
+			So(err, ShouldBeNil)
+			So(string(exported), ShouldNotContainSubstring, "<img")
+		})
+	})
+}
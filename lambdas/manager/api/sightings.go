@@ -0,0 +1,296 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/jobstore"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
+)
+
+const (
+	// sightingKeySecretID is the secret with the key IOCs are hashed with in the sightings table
+	sightingKeySecretID = "/ThreatTools/IOCSightingKey"
+	iocKey              = "ioc"
+
+	// maxSightingVerdictJobs is how many of the newest jobs get the verdicts of their modules,
+	// each of them has to be decrypted
+	maxSightingVerdictJobs = 20
+
+	// maxJobStatusesBatch is the most jobs a single GetJobStatuses call can get
+	maxJobStatusesBatch = 100
+)
+
+// sightingKey is kept between invocations of a warm lambda
+var sightingKey []byte
+
+// SightingKey is the key IOCs are hashed with instead of the one in the credentials store if set, for local runs
+var SightingKey []byte
+
+// iocSightings is the reply to a sightings lookup
+type iocSightings struct {
+	// Number of jobs of anyone on the team that had this IOC, and when it was first and last submitted
+	Sightings int     `json:"sightings"`
+	FirstSeen float64 `json:"firstSeen,omitempty"`
+	LastSeen  float64 `json:"lastSeen,omitempty"`
+	// The jobs of the requester that had this IOC, newest first
+	Jobs []iocSightingJob `json:"jobs"`
+}
+
+// iocSightingJob is a job of the requester that had the IOC, with what its modules reported
+type iocSightingJob struct {
+	JobID          string                          `json:"jobId"`
+	StartTime      float64                         `json:"startTime"`
+	IOCType        string                          `json:"iocType"`
+	JobStatus      JobStatus                       `json:"jobStatus"`
+	ModuleStatuses map[string]*common.ModuleStatus `json:"moduleStatus,omitempty"`
+	// What the modules of the job made of the IOC, only for the newest jobs
+	Verdict        *iocVerdict           `json:"verdict,omitempty"`
+	ModuleVerdicts map[string]IOCVerdict `json:"moduleVerdicts,omitempty"`
+}
+
+// getSightingKey gets the key IOCs are hashed with
+func getSightingKey(ctx context.Context, box *toolbox.Toolbox) ([]byte, error) {
+	if SightingKey != nil {
+		return SightingKey, nil
+	}
+	if sightingKey != nil {
+		return sightingKey, nil
+	}
+	secret, err := box.GetFromCredentialsStore(ctx, sightingKeySecretID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error getting sighting key: %w", err)
+	}
+	if secret.SecretString == nil || *secret.SecretString == "" {
+		return nil, fmt.Errorf("sighting key is empty")
+	}
+	sightingKey = []byte(*secret.SecretString)
+	return sightingKey, nil
+}
+
+// hashIOC returns the keyed hash an IOC is stored under in the sightings table.
+// IOCs are normalized first, so the same IOC submitted differently, like defanged, is still found.
+func hashIOC(key []byte, ioc string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(normalizeIOC(ioc)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// storeIOCSightings stores a sighting of every IOC of the job, so later jobs with the same IOCs can be found
+func storeIOCSightings(box *toolbox.Toolbox, ctx context.Context, username string, jobID string, request events.APIGatewayProxyRequest) error {
+	span, ctx := box.TracerLogger.StartSpan(ctx, "StoreIOCSightings", "job", "manager", "storesightings")
+	defer span.End(ctx)
+	span.LogKV("jobID", jobID)
+
+	jobSubmission, err := common.GetJobSubmission(request)
+	if err != nil {
+		return fmt.Errorf("error getting the jobSubmission: %w", err)
+	}
+	key, err := getSightingKey(ctx, box)
+	if err != nil {
+		span.LogKV("error", err)
+		return err
+	}
+
+	// The same IOC can be submitted more than once in a job, but it's only one sighting
+	now := time.Now()
+	sightings := []*jobstore.Sighting{}
+	seen := map[string]bool{}
+	for iocType, iocs := range jobSubmission.GetIOCGroups() {
+		for _, ioc := range iocs {
+			if strings.TrimSpace(ioc) == "" {
+				continue
+			}
+			iocHash := hashIOC(key, ioc)
+			if seen[iocHash] {
+				continue
+			}
+			seen[iocHash] = true
+
+			sightings = append(sightings, &jobstore.Sighting{
+				IOCHash:   iocHash,
+				JobID:     jobID,
+				Username:  username,
+				IOCType:   string(iocType),
+				StartTime: float64(now.Unix()),
+				// Sightings expire with the job they point to
+				TTL: now.Add(common.JobTTL).Unix(),
+			})
+		}
+	}
+	span.LogKV("sightings", len(sightings))
+
+	err = jobStore.PutSightings(ctx, sightings)
+	if err != nil {
+		span.LogKV("error", err)
+		return err
+	}
+
+	return nil
+}
+
+// getIOCJobs finds the jobs an IOC was submitted in.
+// Everyone can see how often and when the team submitted the IOC, but only their own jobs are returned.
+func getIOCJobs(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	span, ctx := to.TracerLogger.StartSpan(ctx, "GetIOCJobs", "job", "manager", "getiocjobs")
+	defer span.End(ctx)
+
+	jwt, err := to.ValidateJWT(ctx, toolbox.GetJWTFromRequest(request))
+	if err != nil {
+		err = fmt.Errorf("error validating jwt: %w", err)
+		span.LogKV("error", err)
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusUnauthorized}, err
+	}
+	span.LogKV("username", jwt.BaseToken.AccountName)
+
+	ioc := request.PathParameters[iocKey]
+	if strings.TrimSpace(ioc) == "" {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusBadRequest, Body: "Missing ioc"}, nil
+	}
+
+	key, err := getSightingKey(ctx, to)
+	if err != nil {
+		span.LogKV("error", err)
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
+	}
+	sightings, jobs, err := findSightings(ctx, hashIOC(key, ioc))
+	if err != nil {
+		span.LogKV("error", err)
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
+	}
+
+	ret := iocSightings{Sightings: len(sightings), Jobs: []iocSightingJob{}}
+	owned := []*jobstore.Sighting{}
+	for _, sighting := range sightings {
+		if ret.FirstSeen == 0 || sighting.StartTime < ret.FirstSeen {
+			ret.FirstSeen = sighting.StartTime
+		}
+		if sighting.StartTime > ret.LastSeen {
+			ret.LastSeen = sighting.StartTime
+		}
+		if sighting.Username == jwt.BaseToken.AccountName {
+			owned = append(owned, sighting)
+		}
+	}
+	sort.Slice(owned, func(i, j int) bool { return owned[i].StartTime > owned[j].StartTime })
+	if len(owned) > maxJobsLimit {
+		owned = owned[:maxJobsLimit]
+	}
+
+	var modules map[string]toolbox.LambdaMetadata
+	modulesLoaded := false
+	for _, sighting := range owned {
+		jobEntry := jobs[sighting.JobID]
+		jobStatus, _, err := getJobProgress(ctx, jobEntry)
+		if err != nil {
+			to.Logger.WithError(err).Error("error getting job status")
+		}
+		sightingJob := iocSightingJob{
+			JobID:          jobEntry.JobID,
+			StartTime:      jobEntry.StartTime,
+			IOCType:        sighting.IOCType,
+			JobStatus:      jobStatus,
+			ModuleStatuses: jobEntry.ModuleStatuses,
+		}
+		// The jobs are still worth listing without their verdicts, so errors are only logged
+		if len(ret.Jobs) < maxSightingVerdictJobs {
+			if !modulesLoaded {
+				modules, modulesLoaded = getModuleMetadata(ctx), true
+			}
+			sightingJob.Verdict, err = getSightingVerdict(ctx, jobEntry.JobID, ioc, modules)
+			if err != nil {
+				to.Logger.WithError(err).Error("error getting job verdicts")
+			}
+			if sightingJob.Verdict != nil {
+				sightingJob.ModuleVerdicts = moduleVerdicts(sightingJob.Verdict)
+			}
+		}
+		ret.Jobs = append(ret.Jobs, sightingJob)
+	}
+
+	responseData, err := json.Marshal(ret)
+	if err != nil {
+		span.LogKV("error", err)
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, nil
+	}
+	return events.APIGatewayProxyResponse{StatusCode: http.StatusOK, Body: string(responseData)}, nil
+}
+
+// getSightingVerdict gets the verdict the modules of a job gave to the IOC, it returns nil if the job has no such IOC
+func getSightingVerdict(ctx context.Context, jobID string, ioc string, modules map[string]toolbox.LambdaMetadata) (*iocVerdict, error) {
+	jobEntry, err := fetchJob(ctx, jobID)
+	if err != nil || jobEntry == nil {
+		return nil, err
+	}
+	err = jobStore.LoadResponses(ctx, jobEntry)
+	if err != nil {
+		return nil, err
+	}
+	jobEntry.Decrypt(ctx, to)
+
+	normalizedIOC := normalizeIOC(ioc)
+	for _, verdict := range getVerdicts(jobEntry, modules) {
+		if normalizeIOC(verdict.IOC) == normalizedIOC {
+			return &verdict, nil
+		}
+	}
+	return nil, nil
+}
+
+// findSightings gets every sighting of this IOC hash whose job still exists, along with the unencrypted status
+// of these jobs mapped by job ID. The sightings of deleted jobs are left in the store, so they are dropped here.
+func findSightings(ctx context.Context, iocHash string) ([]*jobstore.Sighting, map[string]*common.JobDBEntry, error) {
+	sightings, err := jobStore.GetSightings(ctx, iocHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	jobs, err := fetchSightingJobs(ctx, sightings)
+	if err != nil {
+		return nil, nil, err
+	}
+	found := []*jobstore.Sighting{}
+	for _, sighting := range sightings {
+		if _, ok := jobs[sighting.JobID]; ok {
+			found = append(found, sighting)
+		}
+	}
+	return found, jobs, nil
+}
+
+// fetchSightingJobs gets the unencrypted status of the jobs of these sightings, mapped by job ID.
+// Jobs that no longer exist are left out.
+func fetchSightingJobs(ctx context.Context, sightings []*jobstore.Sighting) (map[string]*common.JobDBEntry, error) {
+	jobs := map[string]*common.JobDBEntry{}
+	jobIDs := []string{}
+	seen := map[string]bool{}
+	for _, sighting := range sightings {
+		if !seen[sighting.JobID] {
+			seen[sighting.JobID] = true
+			jobIDs = append(jobIDs, sighting.JobID)
+		}
+	}
+	for start := 0; start < len(jobIDs); start += maxJobStatusesBatch {
+		end := start + maxJobStatusesBatch
+		if end > len(jobIDs) {
+			end = len(jobIDs)
+		}
+		batch, err := jobStore.GetJobStatuses(ctx, jobIDs[start:end])
+		if err != nil {
+			return nil, err
+		}
+		for jobID, jobEntry := range batch {
+			jobs[jobID] = jobEntry
+		}
+	}
+	return jobs, nil
+}
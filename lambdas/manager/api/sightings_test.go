@@ -0,0 +1,393 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	. "github.com/agiledragon/gomonkey/v2"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/gdcorp-golang/auth/gdtoken"
+	"github.com/gdcorp-infosec/go-ioc/ioc"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/jobstore"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHashIOC(t *testing.T) {
+
+	Convey("hashIOC", t, func() {
+		key := []byte("I am sighting key 3456")
+
+		Convey("should hash the same IOC submitted differently the same way", func() {
+			So(hashIOC(key, " GoDaddy.com "), ShouldEqual, hashIOC(key, "godaddy.com"))
+		})
+
+		Convey("should hash refanged IOCs and URLs that point to the same place the same way", func() {
+			patch := ApplyFunc(ioc.ParseIOC, func(input string) *ioc.IOC {
+				switch input {
+				case "hxxps://Example[.]com:443/":
+					return &ioc.IOC{IOC: "https://Example.com:443/", Type: ioc.URL}
+				case "8.8.8[.]8":
+					return &ioc.IOC{IOC: "8.8.8.8", Type: ioc.IPv4}
+				}
+				return &ioc.IOC{IOC: input}
+			})
+			defer patch.Reset()
+			So(hashIOC(key, "hxxps://Example[.]com:443/"), ShouldEqual, hashIOC(key, "https://example.com"))
+			So(hashIOC(key, "8.8.8[.]8"), ShouldEqual, hashIOC(key, "8.8.8.8"))
+		})
+
+		Convey("should not store the IOC in plaintext or as a plain hash", func() {
+			So(hashIOC(key, "godaddy.com"), ShouldNotContainSubstring, "godaddy")
+			So(hashIOC(key, "godaddy.com"), ShouldNotEqual, hashIOC([]byte("another key"), "godaddy.com"))
+		})
+	})
+}
+
+func TestStoreIOCSightings(t *testing.T) {
+
+	Convey("storeIOCSightings", t, func() {
+		patches := []*Patches{}
+		ctx1 := context.Background()
+		tb := toolbox.GetToolbox()
+		dynamoDBClient := &dynamodb.DynamoDB{}
+		jobStore = jobstore.NewDynamoDBStore(tb)
+		key := []byte("I am sighting key 3456")
+		jobID := "job 2v45y245"
+		request := events.APIGatewayProxyRequest{
+			Body: `{"iocGroups": {"DOMAIN": ["godaddy.com", "GoDaddy.com"], "IP": ["127.0.0.1", ""]}, "modules": ["apivoid"]}`,
+		}
+
+		patches = append(patches, ApplyFunc(getSightingKey,
+			func(ctx context.Context, box *toolbox.Toolbox) ([]byte, error) {
+				return key, nil
+			}))
+
+		batches := [][]*dynamodb.WriteRequest{}
+		var unprocessed map[string][]*dynamodb.WriteRequest
+		patches = append(patches, ApplyMethod(reflect.TypeOf(dynamoDBClient), "BatchWriteItem",
+			func(c *dynamodb.DynamoDB, input *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+				batches = append(batches, input.RequestItems[tb.SightingDBTableName])
+				output := &dynamodb.BatchWriteItemOutput{UnprocessedItems: unprocessed}
+				unprocessed = nil
+				return output, nil
+			}))
+
+		Reset(func() {
+			for i := len(patches) - 1; i >= 0; i-- {
+				patches[i].Reset()
+			}
+			jobStore = nil
+		})
+
+		Convey("should store one sighting per IOC", func() {
+			err := storeIOCSightings(tb, ctx1, "user", jobID, request)
+			So(err, ShouldBeNil)
+			So(batches, ShouldHaveLength, 1)
+			So(batches[0], ShouldHaveLength, 2)
+
+			sightings := []*jobstore.Sighting{}
+			for _, writeRequest := range batches[0] {
+				sighting := &jobstore.Sighting{}
+				dynamodbattribute.UnmarshalMap(writeRequest.PutRequest.Item, &sighting)
+				sightings = append(sightings, sighting)
+			}
+			for _, sighting := range sightings {
+				So(sighting.JobID, ShouldEqual, jobID)
+				So(sighting.Username, ShouldEqual, "user")
+			}
+			So(fmt.Sprint(writeRequestsItems(batches[0])), ShouldNotContainSubstring, "godaddy")
+			So([]string{sightings[0].IOCHash, sightings[1].IOCHash}, ShouldContain, hashIOC(key, "godaddy.com"))
+			So([]string{sightings[0].IOCHash, sightings[1].IOCHash}, ShouldContain, hashIOC(key, "127.0.0.1"))
+		})
+
+		Convey("should store sightings in batches", func() {
+			iocs := []string{}
+			for i := 0; i < 30; i++ {
+				iocs = append(iocs, fmt.Sprintf("10.0.0.%d", i))
+			}
+			body, _ := json.Marshal(common.JobSubmission{IOCType: "IP", IOCs: iocs})
+			request.Body = string(body)
+			err := storeIOCSightings(tb, ctx1, "user", jobID, request)
+			So(err, ShouldBeNil)
+			So(batches, ShouldHaveLength, 2)
+			So(batches[0], ShouldHaveLength, 25)
+			So(batches[1], ShouldHaveLength, 5)
+		})
+
+		Convey("should retry unprocessed sightings", func() {
+			unprocessed = map[string][]*dynamodb.WriteRequest{tb.SightingDBTableName: {{}}}
+			err := storeIOCSightings(tb, ctx1, "user", jobID, request)
+			So(err, ShouldBeNil)
+			So(batches, ShouldHaveLength, 2)
+			So(batches[1], ShouldHaveLength, 1)
+		})
+
+		Convey("should return error if the sighting key is not available", func() {
+			keyErr := errors.New("I am key error")
+			patches = append(patches, ApplyFunc(getSightingKey,
+				func(ctx context.Context, box *toolbox.Toolbox) ([]byte, error) {
+					return nil, keyErr
+				}))
+			err := storeIOCSightings(tb, ctx1, "user", jobID, request)
+			So(err, ShouldResemble, keyErr)
+			So(batches, ShouldBeEmpty)
+		})
+
+		Convey("should return error if the sightings could not be stored", func() {
+			writeErr := errors.New("I am write error")
+			patches = append(patches, ApplyMethod(reflect.TypeOf(dynamoDBClient), "BatchWriteItem",
+				func(c *dynamodb.DynamoDB, input *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+					return nil, writeErr
+				}))
+			err := storeIOCSightings(tb, ctx1, "user", jobID, request)
+			So(err, ShouldResemble, fmt.Errorf("error storing sightings: %w", writeErr))
+		})
+	})
+}
+
+// writeRequestsItems returns the items of these put requests
+func writeRequestsItems(writeRequests []*dynamodb.WriteRequest) []map[string]*dynamodb.AttributeValue {
+	ret := []map[string]*dynamodb.AttributeValue{}
+	for _, writeRequest := range writeRequests {
+		ret = append(ret, writeRequest.PutRequest.Item)
+	}
+	return ret
+}
+
+func TestGetIOCJobs(t *testing.T) {
+
+	Convey("getIOCJobs", t, func() {
+		patches := []*Patches{}
+		ctx1 := context.Background()
+		to = toolbox.GetToolbox()
+		dynamoDBClient := &dynamodb.DynamoDB{}
+		jobStore = jobstore.NewDynamoDBStore(to)
+		key := []byte("I am sighting key 3456")
+		request := events.APIGatewayProxyRequest{
+			PathParameters: map[string]string{iocKey: "GoDaddy.com"},
+		}
+
+		patches = append(patches, ApplyFunc(toolbox.GetJWTFromRequest,
+			func(request events.APIGatewayProxyRequest) string {
+				return "I am cool JWK secret token 356"
+			}))
+		patches = append(patches, ApplyMethod(reflect.TypeOf(to), "ValidateJWT",
+			func(t *toolbox.Toolbox, ctx context.Context, token string) (*gdtoken.Token, error) {
+				return &gdtoken.Token{BaseToken: gdtoken.BaseToken{AccountName: "user"}}, nil
+			}))
+		patches = append(patches, ApplyFunc(getSightingKey,
+			func(ctx context.Context, box *toolbox.Toolbox) ([]byte, error) {
+				return key, nil
+			}))
+		patches = append(patches, ApplyFunc(getJobProgress,
+			func(ctx context.Context, jobEntry *common.JobDBEntry) (JobStatus, float64, error) {
+				return JobCompleted, 1, nil
+			}))
+		patches = append(patches, ApplyFunc(getModuleMetadata,
+			func(ctx context.Context) map[string]toolbox.LambdaMetadata {
+				return nil
+			}))
+		verdict := &iocVerdict{IOC: "godaddy.com", IOCType: "DOMAIN", Verdict: VerdictBenign, Contributions: []verdictContribution{
+			{Module: "apivoid", Source: "apivoid", Score: 10, Confidence: 1, Weight: 1},
+		}}
+		patches = append(patches, ApplyFunc(getSightingVerdict,
+			func(ctx context.Context, jobID string, ioc string, modules map[string]toolbox.LambdaMetadata) (*iocVerdict, error) {
+				if jobID == "job 1" {
+					return verdict, nil
+				}
+				return nil, nil
+			}))
+
+		sightings := []*jobstore.Sighting{
+			{JobID: "job 1", Username: "user", IOCType: "DOMAIN", StartTime: 1610000000},
+			{JobID: "job 2", Username: "someone else", IOCType: "DOMAIN", StartTime: 1600000000},
+			{JobID: "job 3", Username: "user", IOCType: "URL", StartTime: 1620000000},
+			{JobID: "deleted job", Username: "someone else", IOCType: "DOMAIN", StartTime: 1590000000},
+			{JobID: "deleted job 2", Username: "user", IOCType: "DOMAIN", StartTime: 1630000000},
+		}
+		var actualQuery *dynamodb.QueryInput
+		patches = append(patches, ApplyMethod(reflect.TypeOf(dynamoDBClient), "QueryPages",
+			func(c *dynamodb.DynamoDB, input *dynamodb.QueryInput, fn func(*dynamodb.QueryOutput, bool) bool) error {
+				actualQuery = input
+				items := []map[string]*dynamodb.AttributeValue{}
+				for _, sighting := range sightings {
+					item, _ := dynamodbattribute.MarshalMap(sighting)
+					items = append(items, item)
+				}
+				fn(&dynamodb.QueryOutput{Items: items}, true)
+				return nil
+			}))
+
+		moduleStatuses := map[string]*common.ModuleStatus{
+			"apivoid": {Status: common.ModuleSucceeded, IOCCount: 1, ResultCount: 1},
+		}
+		var actualKeys []map[string]*dynamodb.AttributeValue
+		batchGets := 0
+		patches = append(patches, ApplyMethod(reflect.TypeOf(dynamoDBClient), "BatchGetItem",
+			func(c *dynamodb.DynamoDB, input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+				batchGets++
+				actualKeys = append(actualKeys, input.RequestItems[to.JobDBTableName].Keys...)
+				items := []map[string]*dynamodb.AttributeValue{}
+				for _, key := range input.RequestItems[to.JobDBTableName].Keys {
+					jobID := *key["jobId"].S
+					if strings.HasPrefix(jobID, "deleted job") {
+						continue
+					}
+					item, _ := dynamodbattribute.MarshalMap(common.JobDBEntry{
+						JobID:            jobID,
+						StartTime:        1610000000,
+						RequestedModules: []string{"apivoid"},
+						ModuleStatuses:   moduleStatuses,
+					})
+					items = append(items, item)
+				}
+				return &dynamodb.BatchGetItemOutput{Responses: map[string][]map[string]*dynamodb.AttributeValue{to.JobDBTableName: items}}, nil
+			}))
+
+		Reset(func() {
+			for i := len(patches) - 1; i >= 0; i-- {
+				patches[i].Reset()
+			}
+			jobStore = nil
+			to = nil
+		})
+
+		Convey("should return when the team saw the IOC and the requester's jobs with it", func() {
+			response, err := getIOCJobs(ctx1, request)
+			So(err, ShouldBeNil)
+			So(response.StatusCode, ShouldEqual, http.StatusOK)
+			So(*actualQuery.ExpressionAttributeValues[":0"].S, ShouldEqual, hashIOC(key, "godaddy.com"))
+			So(actualKeys, ShouldHaveLength, 5)
+
+			actual := iocSightings{}
+			json.Unmarshal([]byte(response.Body), &actual)
+			So(actual, ShouldResemble, iocSightings{
+				Sightings: 3,
+				FirstSeen: 1600000000,
+				LastSeen:  1620000000,
+				Jobs: []iocSightingJob{
+					{JobID: "job 3", StartTime: 1610000000, IOCType: "URL", JobStatus: JobCompleted, ModuleStatuses: moduleStatuses},
+					{JobID: "job 1", StartTime: 1610000000, IOCType: "DOMAIN", JobStatus: JobCompleted, ModuleStatuses: moduleStatuses,
+						Verdict: verdict, ModuleVerdicts: map[string]IOCVerdict{"apivoid": VerdictBenign}},
+				},
+			})
+		})
+
+		Convey("should look up the jobs of many sightings in batches", func() {
+			sightings = []*jobstore.Sighting{}
+			for i := 0; i < 250; i++ {
+				sightings = append(sightings, &jobstore.Sighting{JobID: fmt.Sprintf("job %d", i), Username: "someone else", IOCType: "DOMAIN", StartTime: 1600000000})
+			}
+			sightings = append(sightings, &jobstore.Sighting{JobID: "deleted job", Username: "someone else", IOCType: "DOMAIN", StartTime: 1590000000})
+			response, err := getIOCJobs(ctx1, request)
+			So(err, ShouldBeNil)
+			So(batchGets, ShouldEqual, 3)
+			So(actualKeys, ShouldHaveLength, 251)
+			So(response.Body, ShouldEqual, `{"sightings":250,"firstSeen":1600000000,"lastSeen":1600000000,"jobs":[]}`)
+		})
+
+		Convey("should return no jobs for IOCs that were never seen", func() {
+			sightings = []*jobstore.Sighting{}
+			response, err := getIOCJobs(ctx1, request)
+			So(err, ShouldBeNil)
+			So(response.Body, ShouldEqual, `{"sightings":0,"jobs":[]}`)
+			So(actualKeys, ShouldBeNil)
+		})
+
+		Convey("should return error if the IOC is missing", func() {
+			request.PathParameters = map[string]string{}
+			response, _ := getIOCJobs(ctx1, request)
+			So(response, ShouldResemble, events.APIGatewayProxyResponse{StatusCode: http.StatusBadRequest, Body: "Missing ioc"})
+		})
+
+		Convey("should return error if the sightings could not be queried", func() {
+			queryErr := errors.New("I am query error")
+			patches = append(patches, ApplyMethod(reflect.TypeOf(dynamoDBClient), "QueryPages",
+				func(c *dynamodb.DynamoDB, input *dynamodb.QueryInput, fn func(*dynamodb.QueryOutput, bool) bool) error {
+					return queryErr
+				}))
+			response, err := getIOCJobs(ctx1, request)
+			So(response.StatusCode, ShouldEqual, http.StatusInternalServerError)
+			So(err, ShouldResemble, fmt.Errorf("error getting sightings from database: %w", queryErr))
+		})
+
+		Convey("should return error if the JWT is not valid", func() {
+			patches = append(patches, ApplyMethod(reflect.TypeOf(to), "ValidateJWT",
+				func(t *toolbox.Toolbox, ctx context.Context, token string) (*gdtoken.Token, error) {
+					return nil, errors.New("I am JWT error")
+				}))
+			response, _ := getIOCJobs(ctx1, request)
+			So(response.StatusCode, ShouldEqual, http.StatusUnauthorized)
+		})
+
+	})
+}
+
+func TestGetSightingVerdict(t *testing.T) {
+
+	Convey("getSightingVerdict", t, func() {
+		patches := []*Patches{}
+		ctx1 := context.Background()
+		to = toolbox.GetToolbox()
+		jobStore = jobstore.NewDynamoDBStore(to)
+
+		jobEntry := &common.JobDBEntry{JobID: "job 1"}
+		patches = append(patches, ApplyFunc(fetchJob,
+			func(ctx context.Context, jobID string) (*common.JobDBEntry, error) {
+				if jobID != jobEntry.JobID {
+					return nil, nil
+				}
+				return jobEntry, nil
+			}))
+		patches = append(patches, ApplyMethod(reflect.TypeOf(jobStore), "LoadResponses",
+			func(s *jobstore.DynamoDBStore, ctx context.Context, job *common.JobDBEntry) error {
+				return nil
+			}))
+		patches = append(patches, ApplyMethod(reflect.TypeOf(jobEntry), "Decrypt",
+			func(job *common.JobDBEntry, ctx context.Context, box *toolbox.Toolbox) {
+				job.DecryptedSubmission = map[string]interface{}{"iocType": "domain", "iocs": []interface{}{"GoDaddy.com", "gumblar.cn"}}
+				job.DecryptedResponses = map[string]interface{}{
+					"virustotal": []interface{}{map[string]interface{}{
+						"Title":  "VirusTotal",
+						"scores": []interface{}{map[string]interface{}{"ioc": "gumblar.cn", "score": 90, "source": "malicious engines", "confidence": 1}},
+					}},
+				}
+			}))
+
+		Reset(func() {
+			for i := len(patches) - 1; i >= 0; i-- {
+				patches[i].Reset()
+			}
+			jobStore = nil
+			to = nil
+		})
+
+		Convey("should get the verdict of the IOC however it was submitted", func() {
+			verdict, err := getSightingVerdict(ctx1, "job 1", "GUMBLAR.cn", nil)
+			So(err, ShouldBeNil)
+			So(verdict.IOC, ShouldEqual, "gumblar.cn")
+			So(verdict.Verdict, ShouldEqual, VerdictMalicious)
+			So(moduleVerdicts(verdict), ShouldResemble, map[string]IOCVerdict{"virustotal": VerdictMalicious})
+
+			verdict, err = getSightingVerdict(ctx1, "job 1", "godaddy.com", nil)
+			So(err, ShouldBeNil)
+			So(verdict.Verdict, ShouldEqual, VerdictUnknown)
+		})
+
+		Convey("should return nil for deleted jobs", func() {
+			verdict, err := getSightingVerdict(ctx1, "deleted job", "gumblar.cn", nil)
+			So(err, ShouldBeNil)
+			So(verdict, ShouldBeNil)
+		})
+	})
+}
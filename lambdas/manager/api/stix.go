@@ -0,0 +1,517 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
+)
+
+const (
+	stixSpecVersion = "2.1"
+	// STIX timestamps are RFC 3339 in UTC
+	stixTimeFormat = "2006-01-02T15:04:05.000Z"
+	// passiveTotalTimeFormat is the format of the first and last seen times of passivetotal resolutions
+	passiveTotalTimeFormat = "2006-01-02 15:04:05"
+
+	passiveTotalModule = "passivetotal"
+	virusTotalModule   = "virustotal"
+)
+
+var (
+	// stixSCONamespace is the namespace STIX defines for the deterministic IDs of cyber observables
+	stixSCONamespace = mustParseUUID("00abedb4-aa42-466c-9c01-fed23315a9b7")
+	// stixSDONamespace is the namespace of the IDs of the other objects, so exporting a job twice gives the same bundle
+	stixSDONamespace = mustParseUUID("2deb45f3-58e9-483e-b695-1b260cacb05d")
+)
+
+// stixObject is any STIX object, only the properties of the object's type are set
+type stixObject struct {
+	Type         string   `json:"type"`
+	SpecVersion  string   `json:"spec_version"`
+	ID           string   `json:"id"`
+	CreatedByRef string   `json:"created_by_ref,omitempty"`
+	Created      string   `json:"created,omitempty"`
+	Modified     string   `json:"modified,omitempty"`
+	Name         string   `json:"name,omitempty"`
+	Description  string   `json:"description,omitempty"`
+	Labels       []string `json:"labels,omitempty"`
+	// Identities
+	IdentityClass string `json:"identity_class,omitempty"`
+	// Cyber observables
+	Value  string            `json:"value,omitempty"`
+	Hashes map[string]string `json:"hashes,omitempty"`
+	CPE    string            `json:"cpe,omitempty"`
+	// Indicators
+	IndicatorTypes []string `json:"indicator_types,omitempty"`
+	Pattern        string   `json:"pattern,omitempty"`
+	PatternType    string   `json:"pattern_type,omitempty"`
+	ValidFrom      string   `json:"valid_from,omitempty"`
+	Confidence     *int     `json:"confidence,omitempty"`
+	// Notes
+	Abstract string `json:"abstract,omitempty"`
+	Content  string `json:"content,omitempty"`
+	// Reports
+	ReportTypes []string `json:"report_types,omitempty"`
+	Published   string   `json:"published,omitempty"`
+	// Notes and reports
+	ObjectRefs []string `json:"object_refs,omitempty"`
+	// Relationships
+	RelationshipType string `json:"relationship_type,omitempty"`
+	SourceRef        string `json:"source_ref,omitempty"`
+	TargetRef        string `json:"target_ref,omitempty"`
+	StartTime        string `json:"start_time,omitempty"`
+	StopTime         string `json:"stop_time,omitempty"`
+}
+
+// stixBundle is the STIX bundle a job is exported as
+type stixBundle struct {
+	Type    string       `json:"type"`
+	ID      string       `json:"id"`
+	Objects []stixObject `json:"objects"`
+}
+
+// passiveTotalResponse is the JSON data of the passivetotal module
+type passiveTotalResponse struct {
+	Query string `json:"query"`
+	// Record type to the record value to what it resolved to
+	Resolutions map[string]map[string][]passiveTotalResolution `json:"resolutions"`
+}
+
+// passiveTotalResolution is what a passivetotal record resolved to
+type passiveTotalResolution struct {
+	Resolution string `json:"resolution"`
+	FirstSeen  string `json:"firstSeen"`
+	LastSeen   string `json:"lastSeen"`
+}
+
+// stixBuilder collects the objects of the bundle of a job
+type stixBuilder struct {
+	jobID     string
+	created   string
+	identity  string
+	report    string
+	objects   []stixObject
+	ids       map[string]bool
+	submitted map[triage.IOCType][]string
+}
+
+// exportSTIX exports a job as a STIX 2.1 bundle.
+// The submitted IOCs are cyber observables, passivetotal resolutions are resolves-to relationships,
+// VirusTotal verdicts are indicators and the results of every module are notes.
+func exportSTIX(jobEntry *common.JobDBEntry) ([]byte, error) {
+	jobSubmission, err := getExportSubmission(jobEntry)
+	if err != nil {
+		return nil, err
+	}
+
+	builder := &stixBuilder{
+		jobID:     jobEntry.JobID,
+		created:   stixTime(jobStartTime(jobEntry)),
+		ids:       map[string]bool{},
+		submitted: map[triage.IOCType][]string{},
+	}
+	builder.report = builder.sdoID("report", "report")
+	builder.identity = builder.add(stixObject{
+		Type:          "identity",
+		ID:            stixID("identity", stixSDONamespace, "Threat API"),
+		Created:       stixTime(time.Unix(0, 0)),
+		Modified:      stixTime(time.Unix(0, 0)),
+		Name:          "Threat API",
+		IdentityClass: "system",
+	})
+
+	iocGroups := jobSubmission.GetIOCGroups()
+	iocTypes := []string{}
+	for iocType := range iocGroups {
+		iocTypes = append(iocTypes, string(iocType))
+	}
+	sort.Strings(iocTypes)
+	for _, iocType := range iocTypes {
+		for _, ioc := range iocGroups[triage.IOCType(iocType)] {
+			if id := builder.addIOC(triage.IOCType(iocType), ioc); id != "" {
+				builder.submitted[triage.IOCType(iocType)] = append(builder.submitted[triage.IOCType(iocType)], id)
+			}
+		}
+	}
+
+	responses := getExportResponses(jobEntry)
+	for _, moduleName := range sortedModules(responses) {
+		for i, data := range responses[moduleName] {
+			iocType := data.IOCType
+			if iocType == "" && len(iocGroups) == 1 {
+				iocType = triage.IOCType(strings.ToUpper(jobSubmission.IOCType))
+			}
+			switch {
+			case moduleName == passiveTotalModule && data.DataType == triage.JSONType:
+				builder.addResolutions(data)
+			case moduleName == virusTotalModule && data.DataType == triage.CSVType:
+				builder.addVerdicts(data, iocType)
+			}
+			builder.addNote(moduleName, i, data, iocType)
+		}
+	}
+
+	objectRefs := []string{}
+	for _, object := range builder.objects {
+		objectRefs = append(objectRefs, object.ID)
+	}
+	builder.add(stixObject{
+		Type:         "report",
+		ID:           builder.report,
+		CreatedByRef: builder.identity,
+		Created:      builder.created,
+		Modified:     builder.created,
+		Name:         fmt.Sprintf("Threat API job %s", jobEntry.JobID),
+		ReportTypes:  []string{"observed-data"},
+		Published:    builder.created,
+		Labels:       jobEntry.Tags,
+		ObjectRefs:   objectRefs,
+	})
+
+	return json.Marshal(stixBundle{
+		Type:    "bundle",
+		ID:      builder.sdoID("bundle", "bundle"),
+		Objects: builder.objects,
+	})
+}
+
+// add adds an object to the bundle once and returns its ID
+func (b *stixBuilder) add(object stixObject) string {
+	object.SpecVersion = stixSpecVersion
+	if !b.ids[object.ID] {
+		b.ids[object.ID] = true
+		b.objects = append(b.objects, object)
+	}
+	return object.ID
+}
+
+// sdoID returns the ID of an object of this job, the same key always gives the same ID
+func (b *stixBuilder) sdoID(objectType string, key string) string {
+	return stixID(objectType, stixSDONamespace, b.jobID+"|"+objectType+"|"+key)
+}
+
+// addIOC adds an IOC as a cyber observable, or as a vulnerability for CVEs.
+// It returns the ID of the object, or an empty string if STIX has no object for the IOC type.
+func (b *stixBuilder) addIOC(iocType triage.IOCType, ioc string) string {
+	ioc = strings.TrimSpace(ioc)
+	if ioc == "" {
+		return ""
+	}
+	switch iocType {
+	case triage.DomainType, triage.GoDaddyHostnameType, triage.AWSHostnameType:
+		return b.addObservable("domain-name", map[string]interface{}{"value": strings.ToLower(ioc)})
+	case triage.IPType:
+		ip := net.ParseIP(ioc)
+		if ip == nil {
+			return ""
+		}
+		if ip.To4() != nil {
+			return b.addObservable("ipv4-addr", map[string]interface{}{"value": ip.String()})
+		}
+		return b.addObservable("ipv6-addr", map[string]interface{}{"value": ip.String()})
+	case triage.URLType:
+		return b.addObservable("url", map[string]interface{}{"value": ioc})
+	case triage.EmailType:
+		return b.addObservable("email-addr", map[string]interface{}{"value": ioc})
+	case triage.MD5Type, triage.SHA1Type, triage.SHA256Type, triage.SHA512Type:
+		return b.addObservable("file", map[string]interface{}{
+			"hashes": map[string]string{stixHashAlgorithm(iocType): strings.ToLower(ioc)},
+		})
+	case triage.CPEType:
+		return b.addObservable("software", map[string]interface{}{"cpe": ioc, "name": ioc})
+	case triage.CVEType:
+		ioc = strings.ToUpper(ioc)
+		return b.add(stixObject{
+			Type:         "vulnerability",
+			ID:           stixID("vulnerability", stixSDONamespace, ioc),
+			CreatedByRef: b.identity,
+			Created:      b.created,
+			Modified:     b.created,
+			Name:         ioc,
+		})
+	}
+	return ""
+}
+
+// addObservable adds a cyber observable with the STIX deterministic ID of its properties
+func (b *stixBuilder) addObservable(objectType string, properties map[string]interface{}) string {
+	// The ID is the UUID of the canonical JSON of the properties the spec bases the ID of each type on
+	idJSON := &bytes.Buffer{}
+	encoder := json.NewEncoder(idJSON)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(properties); err != nil {
+		return ""
+	}
+
+	object := stixObject{
+		Type: objectType,
+		ID:   stixID(objectType, stixSCONamespace, strings.TrimSuffix(idJSON.String(), "\n")),
+	}
+	object.Value, _ = properties["value"].(string)
+	object.Hashes, _ = properties["hashes"].(map[string]string)
+	object.CPE, _ = properties["cpe"].(string)
+	object.Name, _ = properties["name"].(string)
+	return b.add(object)
+}
+
+// addResolutions adds the passivetotal resolutions as resolves-to relationships from domains to what they resolved to
+func (b *stixBuilder) addResolutions(data triage.Data) {
+	responses := []passiveTotalResponse{}
+	if err := json.Unmarshal([]byte(data.Data), &responses); err != nil {
+		to.Logger.WithError(err).Error("error reading passivetotal data")
+		return
+	}
+	for _, response := range responses {
+		for _, recordType := range sortedRecordTypes(response.Resolutions) {
+			records := response.Resolutions[recordType]
+			values := []string{}
+			for value := range records {
+				values = append(values, value)
+			}
+			sort.Strings(values)
+			for _, value := range values {
+				for _, resolution := range records[value] {
+					source, target := b.addHost(value), b.addHost(resolution.Resolution)
+					if source == "" || target == "" {
+						continue
+					}
+					// Domains resolve to addresses, so reverse lookups go the other way
+					if !strings.HasPrefix(source, "domain-name--") {
+						source, target = target, source
+					}
+					if !strings.HasPrefix(source, "domain-name--") {
+						continue
+					}
+					relationship := stixObject{
+						Type:             "relationship",
+						ID:               b.sdoID("relationship", source+"|resolves-to|"+target),
+						CreatedByRef:     b.identity,
+						Created:          b.created,
+						Modified:         b.created,
+						RelationshipType: "resolves-to",
+						SourceRef:        source,
+						TargetRef:        target,
+					}
+					firstSeen, firstErr := time.Parse(passiveTotalTimeFormat, resolution.FirstSeen)
+					lastSeen, lastErr := time.Parse(passiveTotalTimeFormat, resolution.LastSeen)
+					if firstErr == nil {
+						relationship.StartTime = stixTime(firstSeen)
+					}
+					if lastErr == nil && (firstErr != nil || lastSeen.After(firstSeen)) {
+						relationship.StopTime = stixTime(lastSeen)
+					}
+					b.add(relationship)
+				}
+			}
+		}
+	}
+}
+
+// sortedRecordTypes returns the record types of passivetotal resolutions in a stable order
+func sortedRecordTypes(resolutions map[string]map[string][]passiveTotalResolution) []string {
+	keys := []string{}
+	for key := range resolutions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// stixConfidence maps the confidence of a module score, 0 to 1, to the None/Low/Med/High scale of STIX 2.1 (appendix A.1):
+// 0 is None (0), under 0.3 is Low (15), under 0.7 is Med (50) and the rest is High (85)
+func stixConfidence(confidence float64) int {
+	switch percent := math.Round(math.Max(0, math.Min(1, confidence)) * 100); {
+	case percent == 0:
+		return 0
+	case percent < 30:
+		return 15
+	case percent < 70:
+		return 50
+	default:
+		return 85
+	}
+}
+
+// addHost adds an IP address or domain name and returns its ID
+func (b *stixBuilder) addHost(host string) string {
+	host = strings.TrimSuffix(strings.TrimSpace(host), ".")
+	if net.ParseIP(host) != nil {
+		return b.addIOC(triage.IPType, host)
+	}
+	return b.addIOC(triage.DomainType, host)
+}
+
+// addVerdicts adds the VirusTotal verdicts as indicators.
+// Their confidence is how much VirusTotal trusts its score of the IOC, see stixConfidence, not how bad the IOC is.
+func (b *stixBuilder) addVerdicts(data triage.Data, iocType triage.IOCType) {
+	rows, err := csv.NewReader(strings.NewReader(data.Data)).ReadAll()
+	if err != nil || len(rows) < 2 {
+		return
+	}
+	columns := map[string]int{}
+	for i, column := range rows[0] {
+		columns[column] = i
+	}
+	cell := func(row []string, column string) string {
+		if i, ok := columns[column]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+
+	for _, row := range rows[1:] {
+		ioc := cell(row, "IoC")
+		pattern := stixPattern(iocType, ioc)
+		if pattern == "" {
+			continue
+		}
+		observable := b.addIOC(iocType, ioc)
+		if observable == "" {
+			continue
+		}
+
+		indicator := stixObject{
+			Type:         "indicator",
+			ID:           b.sdoID("indicator", virusTotalModule+"|"+observable),
+			CreatedByRef: b.identity,
+			Created:      b.created,
+			Modified:     b.created,
+			Name:         fmt.Sprintf("VirusTotal verdict for %s", ioc),
+			Description: fmt.Sprintf("VirusTotal engines found it harmless %s, malicious %s, suspicious %s and undetected %s times",
+				orZero(cell(row, "Harmless")), orZero(cell(row, "Malicious")), orZero(cell(row, "Suspicious")), orZero(cell(row, "Undetected"))),
+			IndicatorTypes: []string{"benign"},
+			Pattern:        pattern,
+			PatternType:    "stix",
+			ValidFrom:      b.created,
+			Labels:         []string{virusTotalModule},
+		}
+		if malicious, _ := strconv.Atoi(cell(row, "Malicious")); malicious > 0 {
+			indicator.IndicatorTypes = []string{"malicious-activity"}
+		} else if suspicious, _ := strconv.Atoi(cell(row, "Suspicious")); suspicious > 0 {
+			indicator.IndicatorTypes = []string{"anomalous-activity"}
+		}
+		if badness := cell(row, "Badness"); badness != "" {
+			indicator.Description += fmt.Sprintf(", its badness is %s", badness)
+		}
+		for _, score := range data.Scores {
+			if strings.EqualFold(strings.TrimSpace(score.IOC), strings.TrimSpace(ioc)) {
+				confidence := stixConfidence(score.Confidence)
+				indicator.Confidence = &confidence
+				break
+			}
+		}
+		b.add(indicator)
+
+		b.add(stixObject{
+			Type:             "relationship",
+			ID:               b.sdoID("relationship", indicator.ID+"|based-on|"+observable),
+			CreatedByRef:     b.identity,
+			Created:          b.created,
+			Modified:         b.created,
+			RelationshipType: "based-on",
+			SourceRef:        indicator.ID,
+			TargetRef:        observable,
+		})
+	}
+}
+
+// addNote adds the results of a module as a note about the submitted IOCs of the type the results are about
+func (b *stixBuilder) addNote(moduleName string, index int, data triage.Data, iocType triage.IOCType) {
+	content := strings.Join(data.Metadata, "\n")
+	// Images can't be read in a note
+	if data.Data != "" && data.DataType != triage.PNGType {
+		content = strings.TrimSpace(content + "\n\n" + data.Data)
+	}
+	if content == "" {
+		return
+	}
+
+	objectRefs := b.submitted[iocType]
+	if len(objectRefs) == 0 {
+		objectRefs = []string{b.report}
+	}
+	abstract := data.Title
+	if abstract == "" {
+		abstract = moduleName
+	}
+	b.add(stixObject{
+		Type:         "note",
+		ID:           b.sdoID("note", fmt.Sprintf("%s|%d", moduleName, index)),
+		CreatedByRef: b.identity,
+		Created:      b.created,
+		Modified:     b.created,
+		Abstract:     abstract,
+		Content:      content,
+		Labels:       []string{moduleName},
+		ObjectRefs:   objectRefs,
+	})
+}
+
+// stixPattern returns the STIX pattern matching an IOC, or an empty string if there is none for the IOC type
+func stixPattern(iocType triage.IOCType, ioc string) string {
+	ioc = strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(strings.TrimSpace(ioc))
+	if ioc == "" {
+		return ""
+	}
+	switch iocType {
+	case triage.DomainType:
+		return fmt.Sprintf("[domain-name:value = '%s']", strings.ToLower(ioc))
+	case triage.IPType:
+		ip := net.ParseIP(ioc)
+		if ip == nil {
+			return ""
+		}
+		if ip.To4() != nil {
+			return fmt.Sprintf("[ipv4-addr:value = '%s']", ip.String())
+		}
+		return fmt.Sprintf("[ipv6-addr:value = '%s']", ip.String())
+	case triage.URLType:
+		return fmt.Sprintf("[url:value = '%s']", ioc)
+	case triage.EmailType:
+		return fmt.Sprintf("[email-addr:value = '%s']", ioc)
+	case triage.MD5Type, triage.SHA1Type, triage.SHA256Type, triage.SHA512Type:
+		return fmt.Sprintf("[file:hashes.'%s' = '%s']", stixHashAlgorithm(iocType), strings.ToLower(ioc))
+	}
+	return ""
+}
+
+// stixHashAlgorithm returns the STIX name of a hash IOC type
+func stixHashAlgorithm(iocType triage.IOCType) string {
+	switch iocType {
+	case triage.SHA1Type:
+		return "SHA-1"
+	case triage.SHA256Type:
+		return "SHA-256"
+	case triage.SHA512Type:
+		return "SHA-512"
+	}
+	return "MD5"
+}
+
+// stixTime formats a time as a STIX timestamp
+func stixTime(t time.Time) string {
+	return t.UTC().Format(stixTimeFormat)
+}
+
+// stixID returns the STIX ID of an object with a name based UUID
+func stixID(objectType string, namespace []byte, name string) string {
+	return objectType + "--" + nameUUID(namespace, name)
+}
+
+// orZero returns 0 for empty CSV cells
+func orZero(value string) string {
+	if value == "" {
+		return "0"
+	}
+	return value
+}
@@ -0,0 +1,221 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// stixBundleSchema is the path of the STIX 2.1 schema the exported bundles are validated against,
+// it has the parts of the OASIS STIX 2.1 JSON schemas for every type of object jobs are exported as
+const stixBundleSchema = "testdata/stix-2.1-bundle.json"
+
+func TestStixConfidence(t *testing.T) {
+
+	Convey("stixConfidence", t, func() {
+
+		Convey("should map score confidences to the None/Low/Med/High scale", func() {
+			So(stixConfidence(0), ShouldEqual, 0)
+			So(stixConfidence(0.2), ShouldEqual, 15)
+			So(stixConfidence(0.3), ShouldEqual, 50)
+			So(stixConfidence(0.69), ShouldEqual, 50)
+			So(stixConfidence(0.7), ShouldEqual, 85)
+			So(stixConfidence(1.5), ShouldEqual, 85)
+		})
+	})
+}
+
+func TestStixID(t *testing.T) {
+
+	Convey("stixID", t, func() {
+
+		Convey("should use the STIX deterministic IDs for cyber observables", func() {
+			So(stixID("domain-name", stixSCONamespace, `{"value":"godaddy.com"}`), ShouldEqual, "domain-name--f7915946-22f5-57b9-be75-b29bf719c79e")
+			So(stixID("ipv4-addr", stixSCONamespace, `{"value":"1.2.3.4"}`), ShouldEqual, "ipv4-addr--0198f97b-e65d-5025-87e5-58bc39d4bdb4")
+		})
+
+		Convey("should base the ID of files on their hashes", func() {
+			builder := &stixBuilder{ids: map[string]bool{}}
+			So(builder.addIOC("SHA256", strings.Repeat("A", 64)), ShouldEqual, "file--75cb38d5-2055-5354-b75a-8299a2d670b5")
+		})
+	})
+}
+
+func TestStixPattern(t *testing.T) {
+
+	Convey("stixPattern", t, func() {
+
+		Convey("should match the IOC by its type", func() {
+			So(stixPattern("DOMAIN", "GoDaddy.com"), ShouldEqual, "[domain-name:value = 'godaddy.com']")
+			So(stixPattern("IP", "1.2.3.4"), ShouldEqual, "[ipv4-addr:value = '1.2.3.4']")
+			So(stixPattern("IP", "2001:db8::1"), ShouldEqual, "[ipv6-addr:value = '2001:db8::1']")
+			So(stixPattern("SHA1", "ABC"), ShouldEqual, "[file:hashes.'SHA-1' = 'abc']")
+		})
+
+		Convey("should escape quotes", func() {
+			So(stixPattern("URL", `https://godaddy.com/?q='\`), ShouldEqual, `[url:value = 'https://godaddy.com/?q=\'\\']`)
+		})
+
+		Convey("should not match types without patterns", func() {
+			So(stixPattern("CVE", "CVE-2021-44228"), ShouldEqual, "")
+			So(stixPattern("IP", "not an ip"), ShouldEqual, "")
+		})
+	})
+}
+
+func TestExportSTIX(t *testing.T) {
+
+	Convey("exportSTIX", t, func() {
+		jobEntry := &common.JobDBEntry{
+			JobID:     "job 3w45ytg",
+			StartTime: 1610000000.5,
+			Tags:      []string{"phishing"},
+			DecryptedSubmission: map[string]interface{}{
+				"modules": []interface{}{"passivetotal", "virustotal", "nvd", "apivoid"},
+				"iocGroups": map[string]interface{}{
+					"DOMAIN":       []interface{}{"godaddy.com"},
+					"IP":           []interface{}{"1.2.3.4"},
+					"CVE":          []interface{}{"cve-2021-44228"},
+					"MITRE_TACTIC": []interface{}{"TA0001"},
+				},
+			},
+			DecryptedResponses: map[string]interface{}{
+				"passivetotal": []interface{}{map[string]interface{}{
+					"Title":    "PassiveTotal passive DNS",
+					"Metadata": []interface{}{"Found 2 resolutions"},
+					"DataType": "json",
+					"Data":     `[{"query":"godaddy.com","resolutions":{"A":{"godaddy.com":[{"resolution":"1.2.3.4","firstSeen":"2020-01-01 00:00:00","lastSeen":"2021-01-01 00:00:00"},{"resolution":"5.6.7.8","firstSeen":"2020-01-01 00:00:00","lastSeen":"2020-01-01 00:00:00"}]}}}]`,
+					"iocType":  "DOMAIN",
+				}},
+				"virustotal": []interface{}{map[string]interface{}{
+					"Title":    "VirusTotal",
+					"DataType": "csv",
+					"Data":     "IoC,Badness,Owner,ASN,Country,Harmless,Malicious,Suspicious,Timeout,Undetected\n1.2.3.4,0.73,GoDaddy,26496,US,60,7,1,0,12\n",
+					"iocType":  "IP",
+					"scores":   []interface{}{map[string]interface{}{"ioc": "1.2.3.4", "score": 73, "source": "Badness", "confidence": 0.8}},
+				}},
+				"nvd": []interface{}{map[string]interface{}{
+					"Title":    "NVD",
+					"DataType": "png",
+					"Data":     "iVBORw0KGgo=",
+					"Metadata": []interface{}{"Log4Shell"},
+					"iocType":  "CVE",
+				}},
+				"apivoid": "error running module",
+			},
+		}
+
+		exported, err := exportSTIX(jobEntry)
+		So(err, ShouldBeNil)
+
+		bundle := map[string]interface{}{}
+		So(json.Unmarshal(exported, &bundle), ShouldBeNil)
+		objects := map[string]map[string]interface{}{}
+		for _, object := range bundle["objects"].([]interface{}) {
+			objects[object.(map[string]interface{})["id"].(string)] = object.(map[string]interface{})
+		}
+		ofType := func(objectType string) []map[string]interface{} {
+			ret := []map[string]interface{}{}
+			for _, object := range bundle["objects"].([]interface{}) {
+				if object.(map[string]interface{})["type"] == objectType {
+					ret = append(ret, object.(map[string]interface{}))
+				}
+			}
+			return ret
+		}
+
+		Convey("should be a valid STIX 2.1 bundle", func() {
+			// A missing schema fails the test, so the bundles are always validated
+			schema, err := jsonschema.NewCompiler().Compile(stixBundleSchema)
+			So(err, ShouldBeNil)
+			So(schema.Validate(bundle), ShouldBeNil)
+
+			for id, object := range objects {
+				So(id, ShouldStartWith, object["type"].(string)+"--")
+			}
+		})
+
+		Convey("should only reference objects of the bundle", func() {
+			for _, object := range objects {
+				refs := []interface{}{object["created_by_ref"], object["source_ref"], object["target_ref"]}
+				if objectRefs, ok := object["object_refs"].([]interface{}); ok {
+					refs = append(refs, objectRefs...)
+				}
+				for _, ref := range refs {
+					if ref != nil {
+						So(objects, ShouldContainKey, ref)
+					}
+				}
+			}
+		})
+
+		Convey("should be the same every time the job is exported", func() {
+			again, err := exportSTIX(jobEntry)
+			So(err, ShouldBeNil)
+			So(string(again), ShouldEqual, string(exported))
+		})
+
+		Convey("should add the submitted IOCs as cyber observables", func() {
+			So(objects, ShouldContainKey, "domain-name--f7915946-22f5-57b9-be75-b29bf719c79e")
+			So(objects, ShouldContainKey, "ipv4-addr--0198f97b-e65d-5025-87e5-58bc39d4bdb4")
+			So(ofType("vulnerability"), ShouldHaveLength, 1)
+			So(ofType("vulnerability")[0]["name"], ShouldEqual, "CVE-2021-44228")
+		})
+
+		Convey("should add passivetotal resolutions as resolves-to relationships", func() {
+			resolutions := map[string]map[string]interface{}{}
+			for _, relationship := range ofType("relationship") {
+				if relationship["relationship_type"] == "resolves-to" {
+					So(relationship["source_ref"], ShouldEqual, "domain-name--f7915946-22f5-57b9-be75-b29bf719c79e")
+					resolutions[objects[relationship["target_ref"].(string)]["value"].(string)] = relationship
+				}
+			}
+			So(resolutions, ShouldHaveLength, 2)
+			So(resolutions["1.2.3.4"]["start_time"], ShouldEqual, "2020-01-01T00:00:00.000Z")
+			So(resolutions["1.2.3.4"]["stop_time"], ShouldEqual, "2021-01-01T00:00:00.000Z")
+			So(resolutions["5.6.7.8"], ShouldNotContainKey, "stop_time")
+		})
+
+		Convey("should add VirusTotal verdicts as indicators with confidence", func() {
+			indicators := ofType("indicator")
+			So(indicators, ShouldHaveLength, 1)
+			So(indicators[0]["pattern"], ShouldEqual, "[ipv4-addr:value = '1.2.3.4']")
+			So(indicators[0]["confidence"], ShouldEqual, 85)
+			So(indicators[0]["description"], ShouldContainSubstring, "its badness is 0.73")
+			So(indicators[0]["indicator_types"], ShouldResemble, []interface{}{"malicious-activity"})
+			So(indicators[0]["valid_from"], ShouldEqual, "2021-01-07T06:13:20.500Z")
+
+			basedOn := 0
+			for _, relationship := range ofType("relationship") {
+				if relationship["relationship_type"] == "based-on" {
+					basedOn++
+					So(relationship["source_ref"], ShouldEqual, indicators[0]["id"])
+					So(relationship["target_ref"], ShouldEqual, "ipv4-addr--0198f97b-e65d-5025-87e5-58bc39d4bdb4")
+				}
+			}
+			So(basedOn, ShouldEqual, 1)
+		})
+
+		Convey("should add module results as notes about their IOCs", func() {
+			notes := map[string]map[string]interface{}{}
+			for _, note := range ofType("note") {
+				notes[note["labels"].([]interface{})[0].(string)] = note
+			}
+			So(notes, ShouldHaveLength, 3)
+			So(notes["nvd"]["content"], ShouldEqual, "Log4Shell")
+			So(notes["nvd"]["object_refs"], ShouldResemble, []interface{}{ofType("vulnerability")[0]["id"]})
+			So(notes["virustotal"]["content"], ShouldContainSubstring, "1.2.3.4,0.73")
+		})
+
+		Convey("should cover everything with a report", func() {
+			reports := ofType("report")
+			So(reports, ShouldHaveLength, 1)
+			So(reports[0]["object_refs"], ShouldHaveLength, len(objects)-1)
+			So(reports[0]["labels"], ShouldResemble, []interface{}{"phishing"})
+		})
+	})
+}
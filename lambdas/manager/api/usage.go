@@ -0,0 +1,144 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
+)
+
+// usageResponse is the usage of the modules with a quota in the current minute, day and month
+type usageResponse struct {
+	// The calls of every user
+	Modules []toolbox.Usage `json:"modules"`
+	// The calls of the requester
+	User []toolbox.Usage `json:"user"`
+}
+
+// getUsage responds with the calls made to the modules with a quota, by everyone and by the requester
+func getUsage(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	span, ctx := to.TracerLogger.StartSpan(ctx, "GetUsage", "quota", "manager", "usage")
+	defer span.End(ctx)
+
+	jwt, err := to.ValidateJWT(ctx, toolbox.GetJWTFromRequest(request))
+	if err != nil {
+		err = fmt.Errorf("error validating jwt: %w", err)
+		span.LogKV("error", err)
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusUnauthorized}, err
+	}
+	span.LogKV("username", jwt.BaseToken.AccountName)
+
+	// The usage is only counted in the usage table, local runs have no quotas so there is nothing to report
+	usages, err := to.GetUsage(ctx, jwt.BaseToken.AccountName)
+	if err != nil && !errors.Is(err, toolbox.ErrNoAWSSession) {
+		span.LogKV("error", err)
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, err
+	}
+	response := usageResponse{Modules: []toolbox.Usage{}, User: []toolbox.Usage{}}
+	for _, usage := range usages {
+		if usage.Username != "" {
+			response.User = append(response.User, usage)
+		} else {
+			response.Modules = append(response.Modules, usage)
+		}
+	}
+
+	responseBytes, err := json.Marshal(response)
+	if err != nil {
+		return events.APIGatewayProxyResponse{StatusCode: http.StatusInternalServerError}, fmt.Errorf("error marshalling response: %w", err)
+	}
+	return events.APIGatewayProxyResponse{StatusCode: http.StatusOK, Body: string(responseBytes)}, nil
+}
+
+// trimModulesOverQuota leaves the modules without enough calls left in their daily or monthly quota, or the user's, out of the submission.
+// It returns the submission with the modules that are left, and why each module was left out.
+// A module needs a call for each IOC of the types it supports, even though IOCs it has cached results for won't cost one.
+// Modules whose quota can't be checked are kept, the triage connector enforces the quota of each call anyway.
+// Submissions without modules run every module supporting their IOCs, which are written in the submission.
+func trimModulesOverQuota(box *toolbox.Toolbox, ctx context.Context, username string, body string) (string, []string, map[string]string) {
+	span, ctx := box.TracerLogger.StartSpan(ctx, "TrimModulesOverQuota", "quota", "manager", "trim")
+	defer span.End(ctx)
+
+	jobSubmission := common.JobSubmission{}
+	err := json.Unmarshal([]byte(body), &jobSubmission)
+	if err != nil {
+		return body, jobSubmission.Modules, nil
+	}
+	modules, err := box.GetModules(ctx)
+	if err != nil {
+		span.LogKV("error", err)
+		return body, jobSubmission.Modules, nil
+	}
+
+	iocGroups := jobSubmission.GetIOCGroups()
+	requestedModules := jobSubmission.Modules
+	if len(requestedModules) == 0 {
+		requestedModules = defaultModules(modules, iocGroups)
+	}
+	keptModules := []string{}
+	trimmedModules := map[string]string{}
+	for _, moduleName := range requestedModules {
+		metadata, ok := modules[moduleName]
+		if !ok || metadata.Quota == nil {
+			keptModules = append(keptModules, moduleName)
+			continue
+		}
+		calls := int64(0)
+		for _, iocType := range metadata.SupportedIOCTypes {
+			calls += int64(len(iocGroups[iocType]))
+		}
+		remaining, usage, err := box.RemainingQuota(ctx, moduleName, username, metadata.Quota)
+		if err != nil {
+			span.LogKV("error", err)
+			keptModules = append(keptModules, moduleName)
+			continue
+		}
+		if calls > remaining {
+			trimmedModules[moduleName] = fmt.Sprintf("the job needs up to %d calls, %d are left in %s", calls, remaining, usage.QuotaName())
+			continue
+		}
+		keptModules = append(keptModules, moduleName)
+	}
+	if len(trimmedModules) == 0 {
+		if len(jobSubmission.Modules) > 0 {
+			return body, keptModules, nil
+		}
+		trimmedModules = nil
+	}
+	span.LogKV("trimmedModules", len(trimmedModules))
+
+	// Keep everything else (metadata etc.) the submitter sent us
+	submission := map[string]interface{}{}
+	err = json.Unmarshal([]byte(body), &submission)
+	if err != nil {
+		return body, jobSubmission.Modules, nil
+	}
+	submission["modules"] = keptModules
+	submissionMarshalled, err := json.Marshal(submission)
+	if err != nil {
+		return body, jobSubmission.Modules, nil
+	}
+	return string(submissionMarshalled), keptModules, trimmedModules
+}
+
+// defaultModules returns the modules supporting any of the IOC types of a submission, sorted by name
+func defaultModules(modules map[string]toolbox.LambdaMetadata, iocGroups map[triage.IOCType][]string) []string {
+	defaults := []string{}
+	for moduleName, metadata := range modules {
+		for _, iocType := range metadata.SupportedIOCTypes {
+			if len(iocGroups[iocType]) > 0 {
+				defaults = append(defaults, moduleName)
+				break
+			}
+		}
+	}
+	sort.Strings(defaults)
+	return defaults
+}
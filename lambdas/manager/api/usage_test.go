@@ -0,0 +1,165 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"reflect"
+	"testing"
+
+	. "github.com/agiledragon/gomonkey/v2"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/gdcorp-golang/auth/gdtoken"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
+	. "github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGetUsage(t *testing.T) {
+
+	Convey("getUsage", t, func() {
+		// setup stubs\mocks
+		to = toolbox.GetToolbox()
+		patches := []*Patches{}
+		ctx1 := context.Background()
+
+		jwtToken := &gdtoken.Token{BaseToken: gdtoken.BaseToken{AccountName: "jdoe"}}
+		patches = append(patches, ApplyMethod(reflect.TypeOf(to), "ValidateJWT",
+			func(t *Toolbox, ctx context.Context, token string) (*gdtoken.Token, error) {
+				return jwtToken, nil
+			}))
+
+		usages := []Usage{
+			{ModuleName: "virustotal", Period: QuotaPeriodDay, Window: "2021-01-31", Calls: 120, Limit: 1000},
+			{ModuleName: "virustotal", Username: "jdoe", Period: QuotaPeriodDay, Window: "2021-01-31", Calls: 20, Limit: 100},
+		}
+		actualUsername := ""
+		patches = append(patches, ApplyMethod(reflect.TypeOf(to), "GetUsage",
+			func(t *Toolbox, ctx context.Context, username string) ([]Usage, error) {
+				actualUsername = username
+				return usages, nil
+			}))
+
+		Reset(func() {
+			// deferred reset all stubs\mocks after every test suite running
+			for i := len(patches) - 1; i >= 0; i-- {
+				patches[i].Reset()
+			}
+			to = nil
+		})
+
+		Convey("should return the usage of the modules and of the requester", func() {
+			expectedBody, _ := json.Marshal(usageResponse{Modules: usages[:1], User: usages[1:]})
+			actualResponse, actualError := getUsage(ctx1, events.APIGatewayProxyRequest{})
+			So(actualError, ShouldBeNil)
+			So(actualResponse, ShouldResemble, events.APIGatewayProxyResponse{StatusCode: http.StatusOK, Body: string(expectedBody)})
+			So(actualUsername, ShouldEqual, "jdoe")
+		})
+
+		Convey("should return error if JWT validation failed", func() {
+			patches = append(patches, ApplyMethod(reflect.TypeOf(to), "ValidateJWT",
+				func(t *Toolbox, ctx context.Context, token string) (*gdtoken.Token, error) {
+					return nil, errors.New("I am JWT validation error")
+				}))
+			actualResponse, actualError := getUsage(ctx1, events.APIGatewayProxyRequest{})
+			So(actualError, ShouldNotBeNil)
+			So(actualResponse.StatusCode, ShouldEqual, http.StatusUnauthorized)
+		})
+
+		Convey("should return error if the usage could not be fetched", func() {
+			err := errors.New("I am usage error")
+			patches = append(patches, ApplyMethod(reflect.TypeOf(to), "GetUsage",
+				func(t *Toolbox, ctx context.Context, username string) ([]Usage, error) {
+					return nil, err
+				}))
+			actualResponse, actualError := getUsage(ctx1, events.APIGatewayProxyRequest{})
+			So(actualError, ShouldResemble, err)
+			So(actualResponse.StatusCode, ShouldEqual, http.StatusInternalServerError)
+		})
+	})
+}
+
+func TestTrimModulesOverQuota(t *testing.T) {
+
+	Convey("trimModulesOverQuota", t, func() {
+		// setup stubs\mocks
+		tb := toolbox.GetToolbox()
+		patches := []*Patches{}
+		ctx1 := context.Background()
+
+		patches = append(patches, ApplyMethod(reflect.TypeOf(tb), "GetModules",
+			func(t *Toolbox, ctx context.Context) (map[string]LambdaMetadata, error) {
+				return map[string]LambdaMetadata{
+					"virustotal": {SupportedIOCTypes: []triage.IOCType{triage.DomainType, triage.IPType}, Quota: &ModuleQuota{UserPerDay: 100}},
+					"urlscanio":  {SupportedIOCTypes: []triage.IOCType{triage.URLType}, Quota: &ModuleQuota{PerMonth: 1000}},
+					"whois":      {SupportedIOCTypes: []triage.IOCType{triage.DomainType}},
+				}, nil
+			}))
+
+		remaining := map[string]int64{"virustotal": 2, "urlscanio": 5}
+		patches = append(patches, ApplyMethod(reflect.TypeOf(tb), "RemainingQuota",
+			func(t *Toolbox, ctx context.Context, moduleName string, username string, quota *ModuleQuota) (int64, *Usage, error) {
+				return remaining[moduleName], &Usage{ModuleName: moduleName, Username: username, Period: QuotaPeriodDay}, nil
+			}))
+
+		Reset(func() {
+			// deferred reset all stubs\mocks after every test suite running
+			for i := len(patches) - 1; i >= 0; i-- {
+				patches[i].Reset()
+			}
+		})
+
+		body := `{"iocGroups": {"DOMAIN": ["godaddy.com", "example.com"], "IP": ["1.2.3.4"]}, "modules": ["virustotal", "urlscanio", "whois"], "tags": ["phishing"]}`
+
+		Convey("should leave out the modules without enough quota left", func() {
+			actualBody, actualModules, actualTrimmed := trimModulesOverQuota(tb, ctx1, "jdoe", body)
+			So(actualModules, ShouldResemble, []string{"urlscanio", "whois"})
+			So(actualTrimmed, ShouldResemble, map[string]string{
+				"virustotal": "the job needs up to 3 calls, 2 are left in the daily quota of jdoe for virustotal",
+			})
+			submission := map[string]interface{}{}
+			json.Unmarshal([]byte(actualBody), &submission)
+			So(submission["modules"], ShouldResemble, []interface{}{"urlscanio", "whois"})
+			So(submission["tags"], ShouldResemble, []interface{}{"phishing"})
+		})
+
+		Convey("should keep the submission if every module has enough quota left", func() {
+			remaining["virustotal"] = math.MaxInt64
+			actualBody, actualModules, actualTrimmed := trimModulesOverQuota(tb, ctx1, "jdoe", body)
+			So(actualBody, ShouldEqual, body)
+			So(actualModules, ShouldResemble, []string{"virustotal", "urlscanio", "whois"})
+			So(actualTrimmed, ShouldBeNil)
+		})
+
+		Convey("should check the quotas of the modules supporting the IOCs if the submission has no modules", func() {
+			actualBody, actualModules, actualTrimmed := trimModulesOverQuota(tb, ctx1, "jdoe", `{"iocGroups": {"DOMAIN": ["godaddy.com", "example.com"], "IP": ["1.2.3.4"]}}`)
+			So(actualModules, ShouldResemble, []string{"whois"})
+			So(actualTrimmed, ShouldResemble, map[string]string{
+				"virustotal": "the job needs up to 3 calls, 2 are left in the daily quota of jdoe for virustotal",
+			})
+			submission := map[string]interface{}{}
+			json.Unmarshal([]byte(actualBody), &submission)
+			So(submission["modules"], ShouldResemble, []interface{}{"whois"})
+
+			remaining["virustotal"] = math.MaxInt64
+			actualBody, actualModules, actualTrimmed = trimModulesOverQuota(tb, ctx1, "jdoe", `{"iocGroups": {"URL": ["https://godaddy.com/"]}}`)
+			So(actualModules, ShouldResemble, []string{"urlscanio"})
+			So(actualTrimmed, ShouldBeNil)
+			So(actualBody, ShouldEqual, `{"iocGroups":{"URL":["https://godaddy.com/"]},"modules":["urlscanio"]}`)
+		})
+
+		Convey("should keep the modules whose quota could not be checked", func() {
+			patches = append(patches, ApplyMethod(reflect.TypeOf(tb), "RemainingQuota",
+				func(t *Toolbox, ctx context.Context, moduleName string, username string, quota *ModuleQuota) (int64, *Usage, error) {
+					return 0, nil, errors.New("I am usage error")
+				}))
+			actualBody, actualModules, actualTrimmed := trimModulesOverQuota(tb, ctx1, "jdoe", body)
+			So(actualBody, ShouldEqual, body)
+			So(actualModules, ShouldResemble, []string{"virustotal", "urlscanio", "whois"})
+			So(actualTrimmed, ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,217 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
+)
+
+// IOCVerdict is what the modules of a job think of an IOC altogether
+type IOCVerdict string
+
+// IOCVerdicts
+const (
+	VerdictMalicious  IOCVerdict = "malicious"
+	VerdictSuspicious IOCVerdict = "suspicious"
+	VerdictBenign     IOCVerdict = "benign"
+	VerdictUnknown    IOCVerdict = "unknown"
+)
+
+const (
+	// Weighted scores (0-100) from which IOCs are malicious or suspicious
+	maliciousScore  = 70.0
+	suspiciousScore = 40.0
+	// minVerdictWeight is how much weight the scores of an IOC need to add up to for a verdict,
+	// like one module with a weight of 1 and a confidence of 0.5
+	minVerdictWeight = 0.5
+)
+
+// iocVerdict is the verdict of an IOC, weighted from the scores modules gave it
+type iocVerdict struct {
+	IOC     string         `json:"ioc"`
+	IOCType triage.IOCType `json:"iocType"`
+	Verdict IOCVerdict     `json:"verdict"`
+	// Weighted average of the scores, 0 (benign) to 100 (malicious)
+	Score         float64               `json:"score"`
+	Explanation   string                `json:"explanation"`
+	Contributions []verdictContribution `json:"contributions"`
+}
+
+// verdictContribution is a score a module gave to an IOC, and how much it counts in its verdict
+type verdictContribution struct {
+	Module     string  `json:"module"`
+	Source     string  `json:"source"`
+	Score      float64 `json:"score"`
+	Confidence float64 `json:"confidence"`
+	// The weight of the module multiplied by the confidence of the score
+	Weight float64 `json:"weight"`
+}
+
+// getModuleMetadata gets the metadata of the modules, which have the weights of their scores.
+// Verdicts are still worth giving with the default weights, so errors are only logged.
+func getModuleMetadata(ctx context.Context) map[string]toolbox.LambdaMetadata {
+	modules, err := to.GetModules(ctx)
+	if err != nil {
+		to.Logger.WithError(err).Error("error getting module verdict weights")
+		return nil
+	}
+	return modules
+}
+
+// hasScores checks if any module of a decrypted job scored an IOC
+func hasScores(jobEntry *common.JobDBEntry) bool {
+	for _, datas := range getExportResponses(jobEntry) {
+		for _, data := range datas {
+			if len(data.Scores) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getVerdicts weighs the scores modules gave to the IOCs of a decrypted job into one verdict per normalized IOC,
+// submitted IOCs no module scored are unknown
+func getVerdicts(jobEntry *common.JobDBEntry, modules map[string]toolbox.LambdaMetadata) []iocVerdict {
+	type verdictKey struct {
+		IOCType triage.IOCType
+		IOC     string
+	}
+	verdicts := map[verdictKey]*iocVerdict{}
+	// Modules don't always write IOCs like they were submitted (hash case, defanging...),
+	// so verdicts are keyed by the normalized IOC and keep the IOC as it was first seen
+	getVerdict := func(iocType triage.IOCType, ioc string) *iocVerdict {
+		key := verdictKey{IOCType: iocType, IOC: normalizeIOC(ioc)}
+		if _, ok := verdicts[key]; !ok {
+			verdicts[key] = &iocVerdict{IOC: ioc, IOCType: iocType, Contributions: []verdictContribution{}}
+		}
+		return verdicts[key]
+	}
+
+	jobSubmission, err := getExportSubmission(jobEntry)
+	if err != nil {
+		to.Logger.WithError(err).Error("error reading job submission")
+	}
+	iocGroups := jobSubmission.GetIOCGroups()
+	for iocType, iocs := range iocGroups {
+		for _, ioc := range iocs {
+			if ioc = strings.TrimSpace(ioc); ioc != "" {
+				getVerdict(iocType, ioc)
+			}
+		}
+	}
+
+	responses := getExportResponses(jobEntry)
+	for _, moduleName := range sortedModules(responses) {
+		weight := modules[moduleName].GetVerdictWeight()
+		for _, data := range responses[moduleName] {
+			iocType := data.IOCType
+			if iocType == "" && len(iocGroups) == 1 {
+				iocType = triage.IOCType(strings.ToUpper(jobSubmission.IOCType))
+			}
+			if iocType == "" {
+				iocType = triage.UnknownType
+			}
+			for _, score := range data.Scores {
+				verdict := getVerdict(iocType, strings.TrimSpace(score.IOC))
+				verdict.Contributions = append(verdict.Contributions, verdictContribution{
+					Module:     moduleName,
+					Source:     score.Source,
+					Score:      score.Score,
+					Confidence: score.Confidence,
+					Weight:     weight * score.Confidence,
+				})
+			}
+		}
+	}
+
+	var ret []iocVerdict
+	for _, verdict := range verdicts {
+		weighVerdict(verdict)
+		ret = append(ret, *verdict)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].IOCType != ret[j].IOCType {
+			return ret[i].IOCType < ret[j].IOCType
+		}
+		return ret[i].IOC < ret[j].IOC
+	})
+	return ret
+}
+
+// weighVerdict gives the verdict of an IOC from the weighted average of its scores,
+// the modules that weigh the most in it come first in its explanation
+func weighVerdict(verdict *iocVerdict) {
+	sort.SliceStable(verdict.Contributions, func(i, j int) bool {
+		return verdict.Contributions[i].Weight > verdict.Contributions[j].Weight
+	})
+
+	totalWeight, weightedScore := 0.0, 0.0
+	drivers := []string{}
+	ignored := []string{}
+	for _, contribution := range verdict.Contributions {
+		if contribution.Weight <= 0 {
+			ignored = append(ignored, contribution.Module)
+			continue
+		}
+		totalWeight += contribution.Weight
+		weightedScore += contribution.Score * contribution.Weight
+		drivers = append(drivers, fmt.Sprintf("%s scored %.0f (%s, weight %.2f)", contribution.Module, contribution.Score, contribution.Source, contribution.Weight))
+	}
+
+	verdict.Verdict = VerdictUnknown
+	switch {
+	case len(verdict.Contributions) == 0:
+		verdict.Explanation = "No module scored this IOC"
+		return
+	case totalWeight == 0:
+		verdict.Explanation = fmt.Sprintf("Scores of %s are not weighted", strings.Join(ignored, ", "))
+		return
+	}
+
+	verdict.Score = math.Round(weightedScore/totalWeight*100) / 100
+	explanation := strings.Join(drivers, ", ")
+	if len(ignored) > 0 {
+		explanation += fmt.Sprintf("; scores of %s are not weighted", strings.Join(ignored, ", "))
+	}
+	if totalWeight < minVerdictWeight {
+		verdict.Explanation = fmt.Sprintf("Not enough confidence in the scores for a verdict: %s", explanation)
+		return
+	}
+	verdict.Verdict = scoreVerdict(verdict.Score)
+	verdict.Explanation = explanation
+}
+
+// scoreVerdict gives the verdict of a score of 0 (benign) to 100 (malicious)
+func scoreVerdict(score float64) IOCVerdict {
+	switch {
+	case score >= maliciousScore:
+		return VerdictMalicious
+	case score >= suspiciousScore:
+		return VerdictSuspicious
+	default:
+		return VerdictBenign
+	}
+}
+
+// moduleVerdicts gives what each module that scored the IOC made of it on its own, from the average of its scores.
+// Weights only matter to weigh modules against each other, so they don't change the verdict of a single module.
+func moduleVerdicts(verdict *iocVerdict) map[string]IOCVerdict {
+	totals := map[string]float64{}
+	counts := map[string]int{}
+	for _, contribution := range verdict.Contributions {
+		totals[contribution.Module] += contribution.Score
+		counts[contribution.Module]++
+	}
+	ret := map[string]IOCVerdict{}
+	for module, total := range totals {
+		ret[module] = scoreVerdict(total / float64(counts[module]))
+	}
+	return ret
+}
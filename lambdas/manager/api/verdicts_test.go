@@ -0,0 +1,152 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/triagelegacyconnector/triage"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// scoredJobEntry is a job several modules scored the IOCs of
+func scoredJobEntry() *common.JobDBEntry {
+	return &common.JobDBEntry{
+		JobID: "job 8ow3f4hq",
+		DecryptedSubmission: map[string]interface{}{
+			"iocGroups": map[string]interface{}{
+				"DOMAIN": []interface{}{"godaddy.com", "gumblar.cn", "unscored.com"},
+				"IP":     []interface{}{"1.2.3.4"},
+			},
+		},
+		DecryptedResponses: map[string]interface{}{
+			"virustotal": []interface{}{
+				map[string]interface{}{
+					"Title":   "VirusTotal",
+					"iocType": "DOMAIN",
+					"scores": []interface{}{
+						map[string]interface{}{"ioc": "gumblar.cn", "score": 90, "source": "Badness", "confidence": 1},
+						map[string]interface{}{"ioc": "godaddy.com", "score": 0, "source": "Badness", "confidence": 1},
+					},
+				},
+				map[string]interface{}{
+					"Title":   "VirusTotal",
+					"iocType": "IP",
+					"scores": []interface{}{
+						map[string]interface{}{"ioc": "1.2.3.4", "score": 60, "source": "Badness", "confidence": 0.2},
+					},
+				},
+			},
+			"recordedfuture": []interface{}{map[string]interface{}{
+				"Title":   "Recorded Future Data",
+				"iocType": "DOMAIN",
+				"scores": []interface{}{
+					map[string]interface{}{"ioc": "gumblar.cn", "score": 60, "source": "Risk Score", "confidence": 1},
+				},
+			}},
+			"sucuri": []interface{}{map[string]interface{}{
+				"Title":   "Data from sucuri",
+				"iocType": "DOMAIN",
+				"scores": []interface{}{
+					map[string]interface{}{"ioc": "godaddy.com", "score": 100, "source": "Badness", "confidence": 1},
+				},
+			}},
+			"apivoid": []interface{}{map[string]interface{}{"error": "vendor unavailable"}},
+		},
+	}
+}
+
+func TestGetVerdicts(t *testing.T) {
+
+	Convey("getVerdicts", t, func() {
+		sucuriWeight := 0.0
+		modules := map[string]toolbox.LambdaMetadata{
+			"recordedfuture": {},
+			"sucuri":         {VerdictWeight: &sucuriWeight},
+		}
+		verdicts := getVerdicts(scoredJobEntry(), modules)
+
+		Convey("should give one verdict per submitted IOC", func() {
+			So(verdicts, ShouldHaveLength, 4)
+			So(verdicts[0].IOCType, ShouldEqual, triage.DomainType)
+			So(verdicts[0].IOC, ShouldEqual, "godaddy.com")
+			So(verdicts[1].IOC, ShouldEqual, "gumblar.cn")
+			So(verdicts[2].IOC, ShouldEqual, "unscored.com")
+			So(verdicts[3].IOCType, ShouldEqual, triage.IPType)
+		})
+
+		Convey("should weigh the scores of the modules", func() {
+			So(verdicts[1].Verdict, ShouldEqual, VerdictMalicious)
+			So(verdicts[1].Score, ShouldEqual, 75)
+			So(verdicts[1].Explanation, ShouldEqual, "recordedfuture scored 60 (Risk Score, weight 1.00), virustotal scored 90 (Badness, weight 1.00)")
+		})
+
+		Convey("should ignore modules weighted 0", func() {
+			So(verdicts[0].Verdict, ShouldEqual, VerdictBenign)
+			So(verdicts[0].Score, ShouldEqual, 0)
+			So(verdicts[0].Contributions, ShouldHaveLength, 2)
+			So(verdicts[0].Explanation, ShouldEqual, "virustotal scored 0 (Badness, weight 1.00); scores of sucuri are not weighted")
+		})
+
+		Convey("should not give a verdict without enough confidence", func() {
+			So(verdicts[3].Verdict, ShouldEqual, VerdictUnknown)
+			So(verdicts[3].Score, ShouldEqual, 60)
+			So(verdicts[3].Explanation, ShouldStartWith, "Not enough confidence in the scores for a verdict: ")
+		})
+
+		Convey("should not give a verdict to IOCs no module scored", func() {
+			So(verdicts[2].Verdict, ShouldEqual, VerdictUnknown)
+			So(verdicts[2].Explanation, ShouldEqual, "No module scored this IOC")
+		})
+
+		Convey("should weigh modules 1 by default", func() {
+			verdicts := getVerdicts(scoredJobEntry(), nil)
+			So(verdicts[0].Verdict, ShouldEqual, VerdictSuspicious)
+			So(verdicts[0].Score, ShouldEqual, 50)
+		})
+	})
+
+	Convey("getVerdicts of a single IOC type job", t, func() {
+		verdicts := getVerdicts(&common.JobDBEntry{
+			DecryptedSubmission: map[string]interface{}{"iocType": "domain", "iocs": []interface{}{"gumblar.cn"}},
+			DecryptedResponses: map[string]interface{}{
+				"apivoid": []interface{}{map[string]interface{}{
+					"Title":  "APIvoid data",
+					"scores": []interface{}{map[string]interface{}{"ioc": "gumblar.cn", "score": 100, "source": "RiskScore", "confidence": 1}},
+				}},
+			},
+		}, nil)
+
+		Convey("should use the IOC type of the job for data without one", func() {
+			So(verdicts, ShouldHaveLength, 1)
+			So(verdicts[0].IOCType, ShouldEqual, triage.DomainType)
+			So(verdicts[0].Verdict, ShouldEqual, VerdictMalicious)
+		})
+	})
+
+	Convey("getVerdicts of IOCs the modules write differently", t, func() {
+		verdicts := getVerdicts(&common.JobDBEntry{
+			DecryptedSubmission: map[string]interface{}{"iocType": "md5", "iocs": []interface{}{"44d88612fea8a8f36de82e1278abb02f"}},
+			DecryptedResponses: map[string]interface{}{
+				"virustotal": []interface{}{map[string]interface{}{
+					"Title":  "VirusTotal",
+					"scores": []interface{}{map[string]interface{}{"ioc": "44D88612FEA8A8F36DE82E1278ABB02F", "score": 100, "source": "Badness", "confidence": 1}},
+				}},
+			},
+		}, nil)
+
+		Convey("should normalize the IOCs of the submission and the scores the same way", func() {
+			So(verdicts, ShouldHaveLength, 1)
+			So(verdicts[0].IOC, ShouldEqual, "44d88612fea8a8f36de82e1278abb02f")
+			So(verdicts[0].Verdict, ShouldEqual, VerdictMalicious)
+		})
+	})
+}
+
+func TestHasScores(t *testing.T) {
+
+	Convey("hasScores", t, func() {
+		So(hasScores(scoredJobEntry()), ShouldBeTrue)
+		So(hasScores(reportJobEntry()), ShouldBeFalse)
+	})
+}
@@ -5,12 +5,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"regexp"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/jobstore"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
 
 	"github.com/godaddy/asherah/go/appencryption"
@@ -106,18 +107,59 @@ func processFailedJob(ctx context.Context, sqsRecord events.SQSMessage, complete
 	}).Warn("This lambda response was a failed invocation.  We are replacing the data with error description")
 
 	// Process this job, changing the response to contain the error AWS returned us
-	dynamodbClient := dynamodb.New(t.AWSSession)
-	err = processCompletedJob(dynamodbClient, ctx, common.CompletedJobData{
-		// TODO: Update this to some other standard format?
-		Response:   fmt.Sprintf(`[{"error":"%s"}]`, completedLambdaData.RequestContext.Condition),
+	status, errorMessage := getFailedJobStatus(sqsRecord, completedLambdaData)
+	span2.LogKV("status", string(status.Status))
+	response, _ := json.Marshal([]map[string]string{{"error": errorMessage}})
+	store, err := jobstore.New(t)
+	if err != nil {
+		span2.LogKV("error", err)
+		return fmt.Errorf("error opening job store: %w", err)
+	}
+	err = processCompletedJob(store, ctx, common.CompletedJobData{
+		Response:   string(response),
 		ModuleName: lambdaName,
 		JobID:      jobID,
+		Status:     status,
 	})
 
 	return err
 }
 
+// getFailedJobStatus builds the module status of a failed lambda invocation from the error AWS returned us
+func getFailedJobStatus(sqsRecord events.SQSMessage, completedLambdaData LambdaDestination) (*common.ModuleStatus, string) {
+	// The response payload of a failed invocation is the lambda error instead of a list of completed jobs
+	failedInvocation := struct {
+		ResponsePayload struct {
+			ErrorMessage string `json:"errorMessage"`
+			ErrorType    string `json:"errorType"`
+		} `json:"responsePayload"`
+	}{}
+	json.Unmarshal([]byte(sqsRecord.Body), &failedInvocation)
+
+	errorMessage := completedLambdaData.RequestContext.Condition
+	if failedInvocation.ResponsePayload.ErrorMessage != "" {
+		errorMessage = fmt.Sprintf("%s: %s", errorMessage, failedInvocation.ResponsePayload.ErrorMessage)
+	}
+
+	status := &common.ModuleStatus{
+		Status:    common.ModuleFailed,
+		ErrorCode: common.ModuleErrorCodeLambdaFailure,
+		Retryable: true,
+		EndTime:   common.EpochTime(time.Now()),
+	}
+	if strings.Contains(failedInvocation.ResponsePayload.ErrorMessage, "Task timed out") {
+		status.Status = common.ModuleTimedOut
+		status.ErrorCode = common.ModuleErrorCodeTimeout
+	}
+	return status, errorMessage
+}
+
 func processSuccessfulJob(ctx context.Context, completedLambdaData LambdaDestination, lambdaName string) (err error) {
+	store, err := jobstore.New(t)
+	if err != nil {
+		return fmt.Errorf("error opening job store: %w", err)
+	}
+
 	// Process every completed job from the passed in data
 	for i, completedJob := range completedLambdaData.ResponsePayload {
 		span2, ctx := t.TracerLogger.StartSpan(ctx, "ProcessSuccessfulJob", "job", "job", "processSuccessfulJob")
@@ -134,12 +176,18 @@ func processSuccessfulJob(ctx context.Context, completedLambdaData LambdaDestina
 		t.Logger.WithFields(logrus.Fields{"moduleName": completedJob.ModuleName, "jobData": completedJob}).Info("Processing module response")
 
 		// Convert blank responses to blank lists
-		if completedJob.Response == "" {
+		if completedJob.Response == "" && completedJob.ResponseReference == nil {
 			completedJob.Response = "[]"
 		}
+		// Modules that don't report a status finished successfully if they sent us a response
+		if completedJob.Status == nil {
+			completedJob.Status = &common.ModuleStatus{
+				Status:  common.ModuleSucceeded,
+				EndTime: common.EpochTime(time.Now()),
+			}
+		}
 
-		dynamodbClient := dynamodb.New(t.AWSSession)
-		err = processCompletedJob(dynamodbClient, ctx, completedJob)
+		err = processCompletedJob(store, ctx, completedJob)
 		if err != nil {
 			span2.LogKV("error", err)
 			t.Logger.WithError(err).Error("Error processing completed job")
@@ -148,8 +196,8 @@ func processSuccessfulJob(ctx context.Context, completedLambdaData LambdaDestina
 	return err
 }
 
-// processCompleteJob takes the completed job data, encrypts the response, and adds it to the appropriate dynamoDB entry
-func processCompletedJob(dynamodbClient *dynamodb.DynamoDB, ctx context.Context, request common.CompletedJobData) error {
+// processCompleteJob takes the completed job data, encrypts the response, and adds it to the job in the job store
+func processCompletedJob(store jobstore.JobStore, ctx context.Context, request common.CompletedJobData) error {
 	if request.JobID == "" || request.ModuleName == "" {
 		return fmt.Errorf("missing jobId or module name")
 	}
@@ -165,13 +213,19 @@ func processCompletedJob(dynamodbClient *dynamodb.DynamoDB, ctx context.Context,
 		t.Logger.WithError(e).Error("Error encrypting data")
 	}
 
-	err := UpdateDatabaseItem(dynamodbClient, ctx, request, encryptedData)
+	err := UpdateDatabaseItem(store, ctx, request, encryptedData)
 	if err != nil {
 		span.LogKV("error", err)
-		err = fmt.Errorf("error updating database %w", err)
+		return fmt.Errorf("error updating database %w", err)
 	}
 
-	return err
+	// This may have been the last module the job was waiting on, the callback is sent from its own queue so a slow receiver doesn't hold up the responses
+	notifyErr := common.EnqueueJobCallbackIfFinished(ctx, t, store, request.JobID)
+	if notifyErr != nil {
+		t.Logger.WithFields(logrus.Fields{"jobID": request.JobID, "error": notifyErr}).Error("Error queueing job callback")
+	}
+
+	return nil
 }
 
 func encrypt_results(ctx context.Context, request common.CompletedJobData) (encryptedData *appencryption.DataRowRecord, e error) {
@@ -179,7 +233,8 @@ func encrypt_results(ctx context.Context, request common.CompletedJobData) (encr
 	span.LogKV("jobID", request.JobID)
 	defer span.End(ctx)
 
-	encryptedData, err := t.Encrypt(ctx, request.JobID, []byte(request.Response))
+	// Responses stored in the job bucket are stored as a reference to them
+	encryptedData, err := t.Encrypt(ctx, request.JobID, []byte(request.StoredResponse()))
 	if err != nil {
 		span.LogKV("error", err)
 		err = fmt.Errorf("error using t.encrypt: %w", err)
@@ -187,26 +242,15 @@ func encrypt_results(ctx context.Context, request common.CompletedJobData) (encr
 	return encryptedData, err
 }
 
-func UpdateDatabaseItem(dynamodbClient *dynamodb.DynamoDB, ctx context.Context, request common.CompletedJobData, encryptedData *appencryption.DataRowRecord) (err error) {
+// UpdateDatabaseItem stores the encrypted response of the module in the job store, and its status if it is set
+func UpdateDatabaseItem(store jobstore.JobStore, ctx context.Context, request common.CompletedJobData, encryptedData *appencryption.DataRowRecord) (err error) {
 	span, ctx := t.TracerLogger.StartSpan(ctx, "Updating Database", "aws update", "job", "update")
 	defer span.End(ctx)
 
-	update := expression.
-		Set(expression.Name(fmt.Sprintf("responses.%s", request.ModuleName)), expression.Value(*encryptedData))
-	expr, err := expression.NewBuilder().WithUpdate(update).Build()
-
+	err = store.UpdateResponse(ctx, request.JobID, request.ModuleName, *encryptedData, request.Status)
 	if err != nil {
-		return fmt.Errorf("error creating update expression: %w", err)
+		span.LogKV("error", err)
 	}
-	_, err = dynamodbClient.UpdateItem(&dynamodb.UpdateItemInput{
-		Key: map[string]*dynamodb.AttributeValue{
-			"jobId": {S: &request.JobID},
-		},
-		ExpressionAttributeNames:  expr.Names(),
-		ExpressionAttributeValues: expr.Values(),
-		UpdateExpression:          expr.Update(),
-		TableName:                 &t.JobDBTableName,
-	})
 	return err
 }
 
@@ -13,6 +13,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/client"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/jobstore"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
 	 "github.com/godaddy/asherah/go/appencryption"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox/appsectracing"
@@ -24,7 +25,7 @@ import (
 
 func TestProcessCompletedJob(t *testing.T) {
 	Convey("ProcessCompletedJob", t, func() {
-		patchUpdateDatabaseItem := ApplyFunc(UpdateDatabaseItem, func(dynamodbClient *dynamodb.DynamoDB, ctx context.Context, request common.CompletedJobData, encryptedData *appencryption.DataRowRecord) (err error) {
+		patchUpdateDatabaseItem := ApplyFunc(UpdateDatabaseItem, func(store jobstore.JobStore, ctx context.Context, request common.CompletedJobData, encryptedData *appencryption.DataRowRecord) (err error) {
 			return err
 		})
 		defer patchUpdateDatabaseItem.Reset()
@@ -35,6 +36,13 @@ func TestProcessCompletedJob(t *testing.T) {
 		})
 		defer patchEncryptedResults.Reset()
 
+		notifiedJobID := ""
+		patchNotifyJobFinished := ApplyFunc(common.EnqueueJobCallbackIfFinished, func(ctx context.Context, box *toolbox.Toolbox, store common.JobCallbackStore, jobID string) error {
+			notifiedJobID = jobID
+			return nil
+		})
+		defer patchNotifyJobFinished.Reset()
+
 
 		loggingSpan := &appsectracing.Span{}
 		isErrorHappened := false
@@ -59,6 +67,7 @@ func TestProcessCompletedJob(t *testing.T) {
 			return dynamodbClient
 		})
 		defer dynamodbNewPatches.Reset()
+		store := jobstore.NewDynamoDBStore(tb)
 
 
 		ctx := context.Background()
@@ -74,25 +83,39 @@ func TestProcessCompletedJob(t *testing.T) {
 		fmt.Println(string(j))
 
 		Convey("Should return proper processing of a completed job", func() {
-			err := processCompletedJob(dynamodbClient, ctx, completedJobData)
+			err := processCompletedJob(store, ctx, completedJobData)
 			So(err, ShouldEqual, nil)
 		})
 
 		Convey("Should return error if job was not successfully updated", func() {
 			expectedError := errors.New("Error from processcompletedjob")
 			expectedError = fmt.Errorf("error updating database %w", expectedError)
-			patch1 := ApplyFunc(UpdateDatabaseItem, func(dynamodbClient *dynamodb.DynamoDB, ctx context.Context, request common.CompletedJobData, encryptedData *appencryption.DataRowRecord) (err error) {
+			patch1 := ApplyFunc(UpdateDatabaseItem, func(store jobstore.JobStore, ctx context.Context, request common.CompletedJobData, encryptedData *appencryption.DataRowRecord) (err error) {
 				return errors.New("Error from processcompletedjob")
 			})
 			defer patch1.Reset()
 			fmt.Printf("Error happened %v", isErrorHappened)
-			err := processCompletedJob(dynamodbClient, ctx, completedJobData)
+			err := processCompletedJob(store, ctx, completedJobData)
 			So(err, ShouldResemble, expectedError)
 		})
 
 
+		Convey("Should check if the job finished once the response is stored", func() {
+			processCompletedJob(store, ctx, completedJobData)
+			So(notifiedJobID, ShouldEqual, "4245")
+		})
+
+		Convey("Should not check if the job finished if the response was not stored", func() {
+			patch1 := ApplyFunc(UpdateDatabaseItem, func(store jobstore.JobStore, ctx context.Context, request common.CompletedJobData, encryptedData *appencryption.DataRowRecord) (err error) {
+				return errors.New("Error from processcompletedjob")
+			})
+			defer patch1.Reset()
+			processCompletedJob(store, ctx, completedJobData)
+			So(notifiedJobID, ShouldEqual, "")
+		})
+
 		Convey("Should log job properly", func() {
-			processCompletedJob(dynamodbClient, ctx, completedJobData)
+			processCompletedJob(store, ctx, completedJobData)
 			So(LogKVValues, ShouldResemble, []string{"4245"})
 		})
 
@@ -14,6 +14,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/client"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/jobstore"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox/appsectracing"
 	_ "go.elastic.co/apm/module/apmlambda"
@@ -27,7 +28,7 @@ func TestProcessFailedJob(t *testing.T) {
 
 	Convey("ProcessFailedJob", t, func() {
 
-		patchpProcessCompletedJob := ApplyFunc(processCompletedJob, func(dynamodbClient *dynamodb.DynamoDB, ctx context.Context, request common.CompletedJobData) (err error) {
+		patchpProcessCompletedJob := ApplyFunc(processCompletedJob, func(store jobstore.JobStore, ctx context.Context, request common.CompletedJobData) (err error) {
 			return err
 		})
 		defer patchpProcessCompletedJob.Reset()
@@ -136,7 +137,7 @@ func TestProcessFailedJob(t *testing.T) {
 
 		Convey("Should return error if it is raised in completed job", func() {
 			expectedError := errors.New("Error from completed job")
-			patch1 := ApplyFunc(processCompletedJob, func(dynamodbClient *dynamodb.DynamoDB, ctx context.Context, request common.CompletedJobData) (err error) {
+			patch1 := ApplyFunc(processCompletedJob, func(store jobstore.JobStore, ctx context.Context, request common.CompletedJobData) (err error) {
 				return expectedError
 			})
 			defer patch1.Reset()
@@ -145,6 +146,37 @@ func TestProcessFailedJob(t *testing.T) {
 			So(err, ShouldResemble, expectedError)
 		})
 
+		Convey("Should report a failed lambda as a retryable lambda failure", func() {
+			var actualRequest common.CompletedJobData
+			patch1 := ApplyFunc(processCompletedJob, func(store jobstore.JobStore, ctx context.Context, request common.CompletedJobData) (err error) {
+				actualRequest = request
+				return nil
+			})
+			defer patch1.Reset()
+			inputSQSMessage.Body = `{"responsePayload": {"errorMessage": "runtime error: invalid memory address", "errorType": "runtime.Error"}}`
+			err := processFailedJob(ctx, inputSQSMessage, completedLambdaData, "nvd")
+			So(err, ShouldBeNil)
+			So(actualRequest.ModuleName, ShouldEqual, "nvd")
+			So(actualRequest.Status.Status, ShouldEqual, common.ModuleFailed)
+			So(actualRequest.Status.ErrorCode, ShouldEqual, common.ModuleErrorCodeLambdaFailure)
+			So(actualRequest.Status.Retryable, ShouldBeTrue)
+			So(actualRequest.Response, ShouldEqual, `[{"error":"condition234: runtime error: invalid memory address"}]`)
+		})
+
+		Convey("Should report a lambda that timed out as timed out", func() {
+			var actualRequest common.CompletedJobData
+			patch1 := ApplyFunc(processCompletedJob, func(store jobstore.JobStore, ctx context.Context, request common.CompletedJobData) (err error) {
+				actualRequest = request
+				return nil
+			})
+			defer patch1.Reset()
+			inputSQSMessage.Body = `{"responsePayload": {"errorMessage": "2021-08-10T17:09:42.812Z 8a7ba3e8 Task timed out after 300.10 seconds"}}`
+			err := processFailedJob(ctx, inputSQSMessage, completedLambdaData, "nvd")
+			So(err, ShouldBeNil)
+			So(actualRequest.Status.Status, ShouldEqual, common.ModuleTimedOut)
+			So(actualRequest.Status.ErrorCode, ShouldEqual, common.ModuleErrorCodeTimeout)
+		})
+
 
 	})
 }
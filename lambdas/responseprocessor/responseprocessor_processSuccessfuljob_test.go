@@ -13,6 +13,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/client"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/jobstore"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox/appsectracing"
 	_ "go.elastic.co/apm/module/apmlambda"
@@ -24,9 +25,10 @@ import (
 
 func TestProcessSuccessfulJob(t *testing.T) {
 	Convey("ProcessSuccessfulJob", t, func() {
-		var completedJobResponse string
-		patchpProcessCompletedJob := ApplyFunc(processCompletedJob, func(dynamodbClient *dynamodb.DynamoDB, ctx context.Context, request common.CompletedJobData) (err error) {
+		var completedJobResponse, completedJobStoredResponse string
+		patchpProcessCompletedJob := ApplyFunc(processCompletedJob, func(store jobstore.JobStore, ctx context.Context, request common.CompletedJobData) (err error) {
 			completedJobResponse = request.Response
+			completedJobStoredResponse = request.StoredResponse()
 			return err
 		})
 		defer patchpProcessCompletedJob.Reset()
@@ -111,7 +113,7 @@ func TestProcessSuccessfulJob(t *testing.T) {
 
 		Convey("Should return error if job was not successfully completed", func() {
 			expectedError := errors.New("Error from succcessful job -  Test 2")
-			patch1 := ApplyFunc(processCompletedJob, func(dynamodbClient *dynamodb.DynamoDB, ctx context.Context, request common.CompletedJobData) (err error) {
+			patch1 := ApplyFunc(processCompletedJob, func(store jobstore.JobStore, ctx context.Context, request common.CompletedJobData) (err error) {
 				return expectedError
 			})
 			defer patch1.Reset()
@@ -131,5 +133,12 @@ func TestProcessSuccessfulJob(t *testing.T) {
 			So(completedJobResponse, ShouldResemble, "[]")
 		})
 
+		Convey("Should store the reference to a response stored in the job bucket", func() {
+			completedLambdaData.ResponsePayload[0].ResponseReference = &common.ResponseReference{Bucket: "job-bucket", Key: "responses/jobId34234/module_name234.json", Size: 70000}
+			processSuccessfulJob(ctx, completedLambdaData, "nvd")
+			So(completedJobResponse, ShouldBeEmpty)
+			So(completedJobStoredResponse, ShouldEqual, `{"responseReference":{"bucket":"job-bucket","key":"responses/jobId34234/module_name234.json","size":70000}}`)
+		})
+
 	})
 }
@@ -10,6 +10,7 @@ import (
 
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/jobstore"
 	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
 	"github.com/godaddy/asherah/go/appencryption"
 	_ "go.elastic.co/apm/module/apmlambda"
@@ -21,12 +22,22 @@ func TestUpdateDatabaseIt(t *testing.T) {
 	Convey("Update Database Item Testing", t, func() {
 		tb := toolbox.GetToolbox()
 		dynamodbClient := dynamodb.New(tb.AWSSession)
+		store := jobstore.NewDynamoDBStore(tb)
 
+		var actualUpdateInput *dynamodb.UpdateItemInput
 		patchUpdateIt := ApplyMethod(reflect.TypeOf(dynamodbClient), "UpdateItem", func(db *dynamodb.DynamoDB, input *dynamodb.UpdateItemInput) (output *dynamodb.UpdateItemOutput, err error) {
+			actualUpdateInput = input
 			return nil, err
 		})
 		defer patchUpdateIt.Reset()
 
+		var actualPutInput *dynamodb.PutItemInput
+		patchPutIt := ApplyMethod(reflect.TypeOf(dynamodbClient), "PutItem", func(db *dynamodb.DynamoDB, input *dynamodb.PutItemInput) (output *dynamodb.PutItemOutput, err error) {
+			actualPutInput = input
+			return nil, err
+		})
+		defer patchPutIt.Reset()
+
 		ctx := context.Background()
 
 		var completedJobData common.CompletedJobData
@@ -55,10 +66,29 @@ func TestUpdateDatabaseIt(t *testing.T) {
 
 
 		Convey("Should return properly update job", func() {
-			err := UpdateDatabaseItem(dynamodbClient, ctx, completedJobData, &datarowdata)
+			err := UpdateDatabaseItem(store, ctx, completedJobData, &datarowdata)
 			So(err, ShouldEqual, nil)
 		})
 
+		Convey("Should store the response as its own item", func() {
+			UpdateDatabaseItem(store, ctx, completedJobData, &datarowdata)
+			So(*actualPutInput.TableName, ShouldEqual, tb.JobResponsesDBTableName)
+			So(*actualPutInput.Item["jobId"].S, ShouldEqual, "4245")
+			So(*actualPutInput.Item["module_name"].S, ShouldEqual, "nvd")
+			So(actualPutInput.Item["response"].M, ShouldNotBeEmpty)
+			// Jobs created before module statuses were added have nothing else to update
+			So(actualUpdateInput, ShouldBeNil)
+		})
+
+		Convey("Should update the module status in the job", func() {
+			completedJobData.Status = &common.ModuleStatus{Status: common.ModuleSucceeded}
+			UpdateDatabaseItem(store, ctx, completedJobData, &datarowdata)
+			So(*actualUpdateInput.TableName, ShouldEqual, tb.JobDBTableName)
+			So(*actualUpdateInput.UpdateExpression, ShouldEqual, "SET #0.#1 = :0\n")
+			So(*actualUpdateInput.ExpressionAttributeNames["#0"], ShouldEqual, "moduleStatus")
+			So(*actualUpdateInput.ExpressionAttributeNames["#1"], ShouldEqual, "nvd")
+		})
+
 
   		Convey("Error condition for update item", func() {
 			expected_err := errors.New("Error using AWS UpdateItem")
@@ -67,7 +97,8 @@ func TestUpdateDatabaseIt(t *testing.T) {
 			})
 			defer patchUpdateIt.Reset()
 
-			update_error := UpdateDatabaseItem(dynamodbClient, ctx, completedJobData, &datarowdata)
+			completedJobData.Status = &common.ModuleStatus{Status: common.ModuleSucceeded}
+			update_error := UpdateDatabaseItem(store, ctx, completedJobData, &datarowdata)
 
 			So(update_error, ShouldEqual, expected_err)
 
@@ -1,10 +1,10 @@
 #!/bin/bash
 
 # This script supports the build process for the system
-# ("manager" and "responseprocessor") lambdas:
+# ("manager", "responseprocessor" and "jobcallbacks") lambdas:
 # - Store a SHA1 hash of the binary so the CloudFormation templates can
 #   use them to detect differences and trigger an update
-# - Build the lambdas (both are assumed to be golang implementations)
+# - Build the lambdas (all are assumed to be golang implementations)
 # - Create ZIP files and upload them to S3 so that the CloudFormation templates
 #   can reference them
 
@@ -17,7 +17,7 @@ THREAT_API_SOURCE=$(cd `dirname $0`/../.. && pwd)
 
 CODE_BUCKET=$(aws s3api list-buckets --output text --query 'Buckets[?ends_with(Name, `code-bucket`)].Name')
 RESOURCES_DIR=${THREAT_API_SOURCE}/sceptre/resources
-SYSTEM_LAMBDAS="manager responseprocessor"
+SYSTEM_LAMBDAS="manager responseprocessor jobcallbacks"
 
 pushd ${RESOURCES_DIR}/authorizer
 ./build.sh
@@ -0,0 +1,73 @@
+// Command migrate-job-responses moves the module responses of jobs created before the job responses table
+// from the jobs table to the job responses table.
+// Jobs are readable while they are being migrated, and it is safe to run more than once.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common"
+	"github.com/gdcorp-infosec/threat-api/lambdas/common/toolbox"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "only count the jobs and responses to migrate")
+	flag.Parse()
+
+	ctx := context.Background()
+	t := toolbox.GetToolbox()
+	defer t.Close(ctx)
+
+	jobs, responses, err := migrate(ctx, t, *dryRun)
+	fmt.Printf("Migrated %d responses of %d jobs\n", responses, jobs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// migrate moves the responses of every job that still has responses in the jobs table
+func migrate(ctx context.Context, t *toolbox.Toolbox, dryRun bool) (jobs int, responses int, err error) {
+	filter := expression.Name("responses").Size().GreaterThan(expression.Value(0))
+	expr, err := expression.NewBuilder().WithFilter(filter).Build()
+	if err != nil {
+		return 0, 0, fmt.Errorf("error creating scan expression: %w", err)
+	}
+
+	var migrateErr error
+	err = dynamodb.New(t.AWSSession).ScanPagesWithContext(ctx, &dynamodb.ScanInput{
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		FilterExpression:          expr.Filter(),
+		TableName:                 &t.JobDBTableName,
+	}, func(output *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range output.Items {
+			jobEntry := &common.JobDBEntry{}
+			if migrateErr = dynamodbattribute.UnmarshalMap(item, jobEntry); migrateErr != nil {
+				return false
+			}
+			jobs++
+			if dryRun {
+				responses += len(jobEntry.Responses)
+				continue
+			}
+			moved, err := common.MigrateJobResponses(ctx, t, jobEntry)
+			responses += moved
+			if err != nil {
+				migrateErr = fmt.Errorf("error migrating job %s: %w", jobEntry.JobID, err)
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return jobs, responses, fmt.Errorf("error scanning jobs: %w", err)
+	}
+	return jobs, responses, migrateErr
+}